@@ -28,6 +28,70 @@ func (m *mockQuerier) GetIDByName(_ context.Context, table, name string) (int, e
 	return id, nil
 }
 
+func (m *mockQuerier) UpdateDeviceHealth(context.Context, int, string, string, int) error {
+	return nil
+}
+
+func (m *mockQuerier) UpdateReportedState(context.Context, int, string, string) error {
+	return nil
+}
+
+func (m *mockQuerier) GetDeviceActionIDs(context.Context, int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockQuerier) GetDeviceActions(context.Context) ([]models.DeviceAction, error) {
+	return nil, nil
+}
+
+func (m *mockQuerier) AttachAction(context.Context, int, int) error {
+	return nil
+}
+
+func (m *mockQuerier) DetachAction(context.Context, int, int) error {
+	return nil
+}
+
+func (m *mockQuerier) GetGroupDeviceIDs(context.Context, int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockQuerier) GetDeviceGroupIDs(context.Context, int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockQuerier) GetGroupDevices(context.Context) ([]models.GroupDevice, error) {
+	return nil, nil
+}
+
+func (m *mockQuerier) AddGroupDevice(context.Context, int, int) error {
+	return nil
+}
+
+func (m *mockQuerier) RemoveGroupDevice(context.Context, int, int) error {
+	return nil
+}
+
+func (m *mockQuerier) UpdateAutomationLastCheck(context.Context, int, string) error {
+	return nil
+}
+
+func (m *mockQuerier) UpdateAutomationLastTriggersRun(context.Context, int, string) error {
+	return nil
+}
+
+func (m *mockQuerier) UpdateAutomationLastActionRun(context.Context, int, string) error {
+	return nil
+}
+
+func (m *mockQuerier) Rename(context.Context, string, int, string, []*models.Automation) error {
+	return nil
+}
+
+func (m *mockQuerier) DeleteJobsFinishedBefore(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
 func TestNewCache(t *testing.T) {
 	c := NewCache[*models.Device]()
 	require.NotNil(t, c)
@@ -0,0 +1,4 @@
+ALTER TABLE devices DROP COLUMN headers;
+ALTER TABLE devices DROP COLUMN rpc_path;
+ALTER TABLE devices DROP COLUMN port;
+ALTER TABLE devices DROP COLUMN scheme;
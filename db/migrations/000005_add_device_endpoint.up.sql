@@ -0,0 +1,4 @@
+ALTER TABLE devices ADD COLUMN scheme TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN port INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN rpc_path TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN headers TEXT NOT NULL DEFAULT '';
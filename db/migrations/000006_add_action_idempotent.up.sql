@@ -0,0 +1 @@
+ALTER TABLE actions ADD COLUMN idempotent INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE actions DROP COLUMN timeout;
+ALTER TABLE devices DROP COLUMN timeout;
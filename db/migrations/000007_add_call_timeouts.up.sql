@@ -0,0 +1,2 @@
+ALTER TABLE devices ADD COLUMN timeout TEXT NOT NULL DEFAULT '';
+ALTER TABLE actions ADD COLUMN timeout TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN auth_secret;
+ALTER TABLE devices DROP COLUMN auth_username;
+ALTER TABLE devices DROP COLUMN auth_type;
@@ -0,0 +1,3 @@
+ALTER TABLE devices ADD COLUMN auth_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN auth_username TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN auth_secret TEXT NOT NULL DEFAULT '';
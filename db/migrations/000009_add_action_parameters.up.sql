@@ -0,0 +1 @@
+ALTER TABLE actions ADD COLUMN parameters TEXT NOT NULL DEFAULT '';
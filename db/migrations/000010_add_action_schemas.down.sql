@@ -0,0 +1,2 @@
+ALTER TABLE actions DROP COLUMN result_schema;
+ALTER TABLE actions DROP COLUMN params_schema;
@@ -0,0 +1,2 @@
+ALTER TABLE actions ADD COLUMN params_schema TEXT NOT NULL DEFAULT '';
+ALTER TABLE actions ADD COLUMN result_schema TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN latency_ms;
+ALTER TABLE devices DROP COLUMN last_seen;
+ALTER TABLE devices DROP COLUMN status;
@@ -0,0 +1,3 @@
+ALTER TABLE devices ADD COLUMN status TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN last_seen TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN latency_ms INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN reported_at;
+ALTER TABLE devices DROP COLUMN reported_state;
+ALTER TABLE devices DROP COLUMN ingest_token;
@@ -0,0 +1,3 @@
+ALTER TABLE devices ADD COLUMN ingest_token TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN reported_state TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN reported_at TEXT NOT NULL DEFAULT '';
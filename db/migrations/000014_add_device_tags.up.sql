@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN tags TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+ALTER TABLE devices ADD COLUMN actions TEXT DEFAULT '';
+
+UPDATE devices SET actions = (
+    SELECT json_group_array(action_id)
+    FROM (SELECT action_id FROM device_actions WHERE device_id = devices.id ORDER BY action_id)
+);
+
+DROP TABLE IF EXISTS device_actions;
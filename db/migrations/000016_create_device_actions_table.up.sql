@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS device_actions (
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    action_id INTEGER NOT NULL REFERENCES actions(id) ON DELETE RESTRICT,
+    PRIMARY KEY (device_id, action_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_actions_action_id ON device_actions(action_id);
+
+-- Carry over assignments from the JSON column, dropping IDs of actions that no longer exist
+INSERT OR IGNORE INTO device_actions (device_id, action_id)
+SELECT devices.id, json_each.value
+FROM devices, json_each(CASE WHEN json_valid(devices.actions) THEN devices.actions ELSE '[]' END)
+WHERE json_each.value IN (SELECT id FROM actions);
+
+ALTER TABLE devices DROP COLUMN actions;
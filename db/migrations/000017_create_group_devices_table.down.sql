@@ -0,0 +1,8 @@
+ALTER TABLE groups ADD COLUMN devices TEXT NOT NULL DEFAULT '';
+
+UPDATE groups SET devices = (
+    SELECT json_group_array(device_id)
+    FROM (SELECT device_id FROM group_devices WHERE group_id = groups.id ORDER BY device_id)
+);
+
+DROP TABLE IF EXISTS group_devices;
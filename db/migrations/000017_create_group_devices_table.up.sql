@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS group_devices (
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_devices_device_id ON group_devices(device_id);
+
+-- Carry over members from the JSON column, dropping IDs of devices that no longer exist
+INSERT OR IGNORE INTO group_devices (group_id, device_id)
+SELECT groups.id, json_each.value
+FROM groups, json_each(CASE WHEN json_valid(groups.devices) THEN groups.devices ELSE '[]' END)
+WHERE json_each.value IN (SELECT id FROM devices);
+
+ALTER TABLE groups DROP COLUMN devices;
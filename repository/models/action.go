@@ -8,12 +8,17 @@ import (
 )
 
 type Action struct {
-	ID        int             `json:"id" db:"id"`
-	Name      string          `json:"name" db:"name"`
-	Path      string          `json:"path" db:"path"`
-	Params    string          `json:"params" db:"params"`
-	CreatedAt gocrud.NullTime `json:"created_at" db:"created_at"`
-	UpdatedAt gocrud.NullTime `json:"updated_at" db:"updated_at"`
+	ID           int             `json:"id" db:"id"`
+	Name         string          `json:"name" db:"name"`
+	Path         string          `json:"path" db:"path"`
+	Params       string          `json:"params" db:"params"`
+	Parameters   string          `json:"parameters" db:"parameters"`
+	ParamsSchema string          `json:"params_schema" db:"params_schema"`
+	ResultSchema string          `json:"result_schema" db:"result_schema"`
+	Idempotent   bool            `json:"idempotent" db:"idempotent"`
+	Timeout      string          `json:"timeout" db:"timeout"`
+	CreatedAt    gocrud.NullTime `json:"created_at" db:"created_at"`
+	UpdatedAt    gocrud.NullTime `json:"updated_at" db:"updated_at"`
 	gocrud.Reflection
 }
 
@@ -24,5 +29,13 @@ func (a *Action) Validate(ctx context.Context, db gocrud.DBQuerier) error {
 		}
 	}
 
-	return nil
+	if err := a.validateParameters(); err != nil {
+		return err
+	}
+
+	if err := a.validateSchemas(); err != nil {
+		return err
+	}
+
+	return validateTimeout(a.Timeout)
 }
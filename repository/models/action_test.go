@@ -48,6 +48,86 @@ func TestAction_Validate(t *testing.T) {
 			action:  Action{Params: `{"pin": 5`},
 			wantErr: "params must be valid JSON",
 		},
+		{
+			name:    "valid timeout",
+			action:  Action{Timeout: "1m30s"},
+			wantErr: "",
+		},
+		{
+			name:    "negative timeout returns error",
+			action:  Action{Timeout: "-2s"},
+			wantErr: "timeout must be a positive duration",
+		},
+		{
+			name:    "timeout without unit returns error",
+			action:  Action{Timeout: "30"},
+			wantErr: "timeout must be a positive duration",
+		},
+		{
+			name:    "declared parameters with placeholders",
+			action:  Action{Params: `{"seconds": "{{duration}}"}`, Parameters: `[{"name":"duration","type":"integer","default":30}]`},
+			wantErr: "",
+		},
+		{
+			name:    "parameters must be a list",
+			action:  Action{Parameters: `{"name":"duration"}`},
+			wantErr: "parameters must be a list of {name, type, default, required} objects",
+		},
+		{
+			name:    "invalid parameter name",
+			action:  Action{Parameters: `[{"name":"run time","type":"number"}]`},
+			wantErr: "invalid parameter name 'run time'",
+		},
+		{
+			name:    "duplicate parameter",
+			action:  Action{Parameters: `[{"name":"a","type":"number"},{"name":"a","type":"string"}]`},
+			wantErr: "parameter 'a' is declared more than once",
+		},
+		{
+			name:    "unknown parameter type",
+			action:  Action{Parameters: `[{"name":"a","type":"date"}]`},
+			wantErr: "parameter 'a' type must be one of: string, number, integer, boolean",
+		},
+		{
+			name:    "default of wrong type",
+			action:  Action{Parameters: `[{"name":"a","type":"boolean","default":"yes"}]`},
+			wantErr: "default of parameter 'a' must be of type boolean",
+		},
+		{
+			name:    "undeclared placeholder",
+			action:  Action{Params: `{"seconds": "{{duration}}"}`},
+			wantErr: "params refer to undeclared parameter 'duration'",
+		},
+		{
+			name:    "params conforming to params schema",
+			action:  Action{Params: `{"pin": 5}`, ParamsSchema: `{"type":"object","properties":{"pin":{"type":"integer"}}}`},
+			wantErr: "",
+		},
+		{
+			name:    "params not conforming to params schema",
+			action:  Action{Params: `{"pin": "five"}`, ParamsSchema: `{"type":"object","properties":{"pin":{"type":"integer"}}}`},
+			wantErr: "params do not match params_schema: at '/pin': got string, want integer",
+		},
+		{
+			name:    "params schema is checked with parameter defaults",
+			action:  Action{Params: `{"pin": "{{pin}}"}`, Parameters: `[{"name":"pin","type":"integer","default":40}]`, ParamsSchema: `{"properties":{"pin":{"maximum":39}}}`},
+			wantErr: "params do not match params_schema: at '/pin': maximum: got 40, want 39",
+		},
+		{
+			name:    "params schema is not checked when values are required",
+			action:  Action{Params: `{"pin": "{{pin}}"}`, Parameters: `[{"name":"pin","type":"integer","required":true}]`, ParamsSchema: `{"properties":{"pin":{"type":"integer"}}}`},
+			wantErr: "",
+		},
+		{
+			name:    "invalid params schema",
+			action:  Action{ParamsSchema: `{"type": 5}`},
+			wantErr: "params_schema must be a valid JSON Schema",
+		},
+		{
+			name:    "result schema is not JSON",
+			action:  Action{ResultSchema: `{type: object}`},
+			wantErr: "result_schema must be a valid JSON Schema",
+		},
 	}
 
 	for _, tt := range tests {
@@ -2,11 +2,12 @@ package models
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"slices"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/tender-barbarian/gniotek/solar"
 	gocrud "github.com/tender-barbarian/go-crud"
 	"gopkg.in/yaml.v3"
 )
@@ -25,27 +26,116 @@ type Automation struct {
 }
 
 type AutomationDefinition struct {
-	Interval       string              `yaml:"interval"`
+	Interval       string              `yaml:"interval,omitempty"`
+	Schedule       Schedules           `yaml:"schedule,omitempty"`
+	Timezone       string              `yaml:"timezone,omitempty"`
+	Events         []AutomationEvent   `yaml:"events,omitempty"`
 	Triggers       []AutomationTrigger `yaml:"triggers"`
 	ConditionLogic string              `yaml:"condition_logic,omitempty"`
+	Logic          *LogicNode          `yaml:"logic,omitempty"`
 	Actions        []AutomationAction  `yaml:"actions"`
 }
 
+// Event types an automation can react to. They match the types of the events
+// published by the service.
+const (
+	EventTypeDeviceReported     = "device_reported"
+	EventTypeDeviceOffline      = "device_offline"
+	EventTypeDeviceOnline       = "device_online"
+	EventTypeAutomationFinished = "automation_finished"
+	EventTypeWebhook            = "webhook"
+)
+
+// AutomationEvent runs the automation as soon as a matching event is published,
+// instead of waiting for the next interval. Conditions are evaluated against the
+// event data, e.g. the state pushed by a device.
+type AutomationEvent struct {
+	Type       string                `yaml:"type"`
+	Device     string                `yaml:"device,omitempty"`
+	Automation string                `yaml:"automation,omitempty"`
+	Webhook    string                `yaml:"webhook,omitempty"`
+	Conditions []AutomationCondition `yaml:"conditions,omitempty"`
+}
+
+var webhookNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Trigger sources. An action trigger calls the device; a reported trigger reads the
+// state the device last pushed to the server.
+const (
+	TriggerSourceAction   = "action"
+	TriggerSourceReported = "reported"
+)
+
+// Trigger match modes for triggers that read several devices. With "all", every
+// device must meet the conditions; with "any", one is enough.
+const (
+	TriggerMatchAll = "all"
+	TriggerMatchAny = "any"
+)
+
+// AutomationTrigger reads a single device, the members of a group, or every device
+// carrying all of the tags. Exactly one of Device, Group and Tags is set, unless the
+// trigger checks a time window instead.
 type AutomationTrigger struct {
+	Name       string                `yaml:"name,omitempty"`
 	Device     string                `yaml:"device"`
-	Action     string                `yaml:"action"`
+	Group      string                `yaml:"group,omitempty"`
+	Tags       []string              `yaml:"tags,omitempty"`
+	Match      string                `yaml:"match,omitempty"`
+	Action     string                `yaml:"action,omitempty"`
+	Params     map[string]any        `yaml:"params,omitempty"`
+	Source     string                `yaml:"source,omitempty"`
+	MaxAge     string                `yaml:"max_age,omitempty"`
 	Conditions []AutomationCondition `yaml:"conditions"`
+	Time       *TimeWindow           `yaml:"time,omitempty"`
 }
 
+// IsTime reports whether the trigger checks a time window instead of a device.
+func (t *AutomationTrigger) IsTime() bool {
+	return t.Time != nil
+}
+
+// IsReported reports whether the trigger reads the device's reported state.
+func (t *AutomationTrigger) IsReported() bool {
+	return t.Source == TriggerSourceReported
+}
+
+// AutomationCondition compares a field with a threshold, or is a block of nested
+// conditions: all of them must be met, any one of them, or not the nested one. The
+// threshold is a number, string, boolean or null; a missing threshold is null.
 type AutomationCondition struct {
-	Field     string  `yaml:"field"`
-	Operator  string  `yaml:"operator"`
-	Threshold float64 `yaml:"threshold"`
+	Field     string                `yaml:"field,omitempty"`
+	Operator  string                `yaml:"operator,omitempty"`
+	Threshold any                   `yaml:"threshold,omitempty"`
+	All       []AutomationCondition `yaml:"all,omitempty"`
+	Any       []AutomationCondition `yaml:"any,omitempty"`
+	Not       *AutomationCondition  `yaml:"not,omitempty"`
 }
 
+// IsBlock reports whether the condition nests other conditions instead of comparing
+// a field.
+func (c *AutomationCondition) IsBlock() bool {
+	return len(c.All) > 0 || len(c.Any) > 0 || c.Not != nil
+}
+
+// AutomationAction runs on a single device, the members of a group, or every device
+// carrying all of the tags. Exactly one of Device, Group and Tags is set.
 type AutomationAction struct {
-	Device string `yaml:"device"`
-	Action string `yaml:"action"`
+	Device string         `yaml:"device"`
+	Group  string         `yaml:"group,omitempty"`
+	Tags   []string       `yaml:"tags,omitempty"`
+	Action string         `yaml:"action"`
+	Params map[string]any `yaml:"params,omitempty"`
+}
+
+// IsSelector reports whether the trigger targets a group or tags rather than a device.
+func (t *AutomationTrigger) IsSelector() bool {
+	return t.Group != "" || len(t.Tags) > 0
+}
+
+// IsSelector reports whether the action targets a group or tags rather than a device.
+func (a *AutomationAction) IsSelector() bool {
+	return a.Group != "" || len(a.Tags) > 0
 }
 
 func (a *Automation) ParseDefinition() (*AutomationDefinition, error) {
@@ -67,25 +157,52 @@ func (a *Automation) Validate(ctx context.Context, db gocrud.DBQuerier) error {
 		return ValidationError{msg: "condition_logic must be 'and' or 'or'"}
 	}
 
-	// Validate interval
-	interval, err := time.ParseDuration(def.Interval)
-	if err != nil {
-		return ValidationError{msg: fmt.Errorf("interval must be a valid duration (e.g., '5m', '1h'): %w", err).Error()}
+	if err := validateLogic(def); err != nil {
+		return err
 	}
 
-	if interval < time.Second {
-		return ValidationError{msg: "interval must be at least 1s"}
+	site := siteFrom(ctx)
+
+	// Validate schedule, which replaces the interval
+	if len(def.Schedule) > 0 {
+		if def.Interval != "" {
+			return ValidationError{msg: "interval and schedule cannot be combined"}
+		}
+		if _, err := def.ParseSchedule(site); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	} else if _, err := def.Location(site); err != nil {
+		return ValidationError{msg: err.Error()}
 	}
 
-	validOperators := map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true}
+	// Validate interval, which may be left out when the automation runs on a schedule
+	// or only on events
+	if def.Interval != "" || (len(def.Events) == 0 && len(def.Schedule) == 0) {
+		interval, err := time.ParseDuration(def.Interval)
+		if err != nil {
+			return ValidationError{msg: fmt.Errorf("interval must be a valid duration (e.g., '5m', '1h'): %w", err).Error()}
+		}
+
+		if interval < time.Second {
+			return ValidationError{msg: "interval must be at least 1s"}
+		}
+	}
+
+	for _, event := range def.Events {
+		if err := a.validateEvent(ctx, db, event); err != nil {
+			return err
+		}
+	}
 
 	for _, trigger := range def.Triggers {
-		// Triggers must have both device and action
-		if trigger.Device == "" || trigger.Action == "" {
-			return ValidationError{msg: "trigger must have both device and action"}
+		if trigger.IsTime() {
+			if err := validateTimeTrigger(trigger, site); err != nil {
+				return err
+			}
+			continue
 		}
 
-		if err := validateDeviceAction(ctx, db, trigger.Device, trigger.Action); err != nil {
+		if err := validateTriggerSource(ctx, db, trigger); err != nil {
 			return err
 		}
 
@@ -94,12 +211,16 @@ func (a *Automation) Validate(ctx context.Context, db gocrud.DBQuerier) error {
 			return ValidationError{msg: "conditions are required when a trigger reads from a device"}
 		}
 
-		for _, cond := range trigger.Conditions {
-			if cond.Field == "" {
-				return ValidationError{msg: "condition must have a field"}
+		if err := validateConditions(trigger.Conditions); err != nil {
+			return err
+		}
+
+		if !trigger.IsReported() {
+			if err := validateConditionTypes(ctx, db, trigger.Action, trigger.Conditions); err != nil {
+				return err
 			}
-			if !validOperators[cond.Operator] {
-				return ValidationError{msg: fmt.Sprintf("invalid operator '%s': must be one of >, <, >=, <=, ==, !=", cond.Operator)}
+			if err := validateActionParams(ctx, db, trigger.Action, trigger.Params); err != nil {
+				return err
 			}
 		}
 	}
@@ -110,18 +231,225 @@ func (a *Automation) Validate(ctx context.Context, db gocrud.DBQuerier) error {
 
 	// Validate all action devices and actions exist and are linked
 	for _, action := range def.Actions {
-		if err := validateDeviceAction(ctx, db, action.Device, action.Action); err != nil {
+		if err := validateTarget(ctx, db, "action", action.Device, action.Group, action.Tags); err != nil {
+			return err
+		}
+
+		if action.IsSelector() {
+			if err := validateActionExists(ctx, db, action.Action); err != nil {
+				return err
+			}
+		} else if err := validateDeviceAction(ctx, db, action.Device, action.Action); err != nil {
+			return err
+		}
+
+		// Checked even without params, since the action may require some
+		if err := validateActionParams(ctx, db, action.Action, action.Params); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateConditions(conditions []AutomationCondition) error {
+	validOperators := map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true}
+
+	for _, cond := range conditions {
+		if cond.IsBlock() {
+			if err := validateConditionBlock(cond); err != nil {
+				return err
+			}
+			continue
+		}
+		if cond.Field == "" {
+			return ValidationError{msg: "condition must have a field"}
+		}
+		if !validOperators[cond.Operator] {
+			return ValidationError{msg: fmt.Sprintf("invalid operator '%s': must be one of >, <, >=, <=, ==, !=", cond.Operator)}
+		}
+		if err := validateThreshold(cond); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateConditionBlock(cond AutomationCondition) error {
+	blocks := 0
+	for _, set := range []bool{len(cond.All) > 0, len(cond.Any) > 0, cond.Not != nil} {
+		if set {
+			blocks++
+		}
+	}
+	if blocks != 1 || cond.Field != "" || cond.Operator != "" || cond.Threshold != nil {
+		return ValidationError{msg: "a condition block must have exactly one of all, any or not, and no field"}
+	}
+
+	switch {
+	case len(cond.All) > 0:
+		return validateConditions(cond.All)
+	case len(cond.Any) > 0:
+		return validateConditions(cond.Any)
+	default:
+		return validateConditions([]AutomationCondition{*cond.Not})
+	}
+}
+
+func (a *Automation) validateEvent(ctx context.Context, db gocrud.DBQuerier, event AutomationEvent) error {
+	switch event.Type {
+	case EventTypeDeviceReported, EventTypeDeviceOffline, EventTypeDeviceOnline:
+		if event.Device == "" {
+			return ValidationError{msg: fmt.Sprintf("%s events must have a device", event.Type)}
+		}
+		if event.Automation != "" || event.Webhook != "" {
+			return ValidationError{msg: fmt.Sprintf("%s events only match on device", event.Type)}
+		}
+		var id int
+		if err := db.QueryRowContext(ctx, "SELECT id FROM devices WHERE name = ?", event.Device).Scan(&id); err != nil {
+			return ValidationError{msg: fmt.Sprintf("device '%s' not found", event.Device)}
+		}
+	case EventTypeAutomationFinished:
+		if event.Automation == "" {
+			return ValidationError{msg: "automation_finished events must have an automation"}
+		}
+		if event.Device != "" || event.Webhook != "" {
+			return ValidationError{msg: "automation_finished events only match on automation"}
+		}
+		if event.Automation == a.Name {
+			return ValidationError{msg: "an automation cannot run on its own automation_finished event"}
+		}
+		var id int
+		if err := db.QueryRowContext(ctx, "SELECT id FROM automations WHERE name = ?", event.Automation).Scan(&id); err != nil {
+			return ValidationError{msg: fmt.Sprintf("automation '%s' not found", event.Automation)}
+		}
+	case EventTypeWebhook:
+		if !webhookNamePattern.MatchString(event.Webhook) {
+			return ValidationError{msg: "webhook events must have a webhook name of letters, digits, '-' or '_'"}
+		}
+		if event.Device != "" || event.Automation != "" {
+			return ValidationError{msg: "webhook events only match on webhook"}
+		}
+	default:
+		return ValidationError{msg: fmt.Sprintf("invalid event type '%s': must be one of %s, %s, %s, %s, %s", event.Type,
+			EventTypeDeviceReported, EventTypeDeviceOffline, EventTypeDeviceOnline, EventTypeAutomationFinished, EventTypeWebhook)}
+	}
+
+	return validateConditions(event.Conditions)
+}
+
+func validateTimeTrigger(trigger AutomationTrigger, site *solar.Site) error {
+	if trigger.Device != "" || trigger.IsSelector() || trigger.Action != "" || trigger.Source != "" ||
+		trigger.Match != "" || trigger.MaxAge != "" || len(trigger.Conditions) > 0 {
+		return ValidationError{msg: "time triggers must not read a device or have conditions"}
+	}
+	if err := trigger.Time.Validate(); err != nil {
+		return err
+	}
+	if trigger.Time.UsesSun() && site == nil {
+		return ValidationError{msg: ErrNoSite.Error()}
+	}
+	return nil
+}
+
+func validateTriggerSource(ctx context.Context, db gocrud.DBQuerier, trigger AutomationTrigger) error {
+	if trigger.Source != "" && trigger.Source != TriggerSourceAction && trigger.Source != TriggerSourceReported {
+		return ValidationError{msg: fmt.Sprintf("trigger source must be '%s' or '%s'", TriggerSourceAction, TriggerSourceReported)}
+	}
+
+	if trigger.Match != "" {
+		if !trigger.IsSelector() {
+			return ValidationError{msg: "match is only supported for triggers on a group or tags"}
+		}
+		if trigger.Match != TriggerMatchAll && trigger.Match != TriggerMatchAny {
+			return ValidationError{msg: fmt.Sprintf("match must be '%s' or '%s'", TriggerMatchAll, TriggerMatchAny)}
+		}
+	}
+
+	if trigger.IsReported() {
+		if trigger.Device == "" && !trigger.IsSelector() {
+			return ValidationError{msg: "trigger must have a device"}
+		}
+		if trigger.Action != "" || len(trigger.Params) > 0 {
+			return ValidationError{msg: "reported triggers read the device state and must not have an action or params"}
+		}
+		if trigger.MaxAge != "" {
+			if maxAge, err := time.ParseDuration(trigger.MaxAge); err != nil || maxAge <= 0 {
+				return ValidationError{msg: "max_age must be a positive duration, e.g. '15m'"}
+			}
+		}
+		if err := validateTarget(ctx, db, "trigger", trigger.Device, trigger.Group, trigger.Tags); err != nil {
 			return err
 		}
+		if trigger.Device != "" {
+			var id int
+			if err := db.QueryRowContext(ctx, "SELECT id FROM devices WHERE name = ?", trigger.Device).Scan(&id); err != nil {
+				return ValidationError{msg: fmt.Sprintf("device '%s' not found", trigger.Device)}
+			}
+		}
+		return nil
 	}
 
+	// Triggers must have both device and action
+	if trigger.Action == "" || (trigger.Device == "" && !trigger.IsSelector()) {
+		return ValidationError{msg: "trigger must have both device and action"}
+	}
+	if trigger.MaxAge != "" {
+		return ValidationError{msg: "max_age is only supported for reported triggers"}
+	}
+	if err := validateTarget(ctx, db, "trigger", trigger.Device, trigger.Group, trigger.Tags); err != nil {
+		return err
+	}
+	if trigger.IsSelector() {
+		return validateActionExists(ctx, db, trigger.Action)
+	}
+	return validateDeviceAction(ctx, db, trigger.Device, trigger.Action)
+}
+
+// validateTarget checks that exactly one of device, group and tags is set and that
+// the group exists. Devices are checked along with their action. Devices selected by
+// a group or tags are resolved when the automation runs, so membership can change
+// without editing the automation.
+func validateTarget(ctx context.Context, db gocrud.DBQuerier, kind, device, group string, tags []string) error {
+	set := 0
+	for _, ok := range []bool{device != "", group != "", len(tags) > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return ValidationError{msg: fmt.Sprintf("%s must have exactly one of device, group or tags", kind)}
+	}
+
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return ValidationError{msg: "tags must not be empty"}
+		}
+	}
+
+	if group != "" {
+		var id int
+		if err := db.QueryRowContext(ctx, "SELECT id FROM groups WHERE name = ?", group).Scan(&id); err != nil {
+			return ValidationError{msg: fmt.Sprintf("group '%s' not found", group)}
+		}
+	}
+
+	return nil
+}
+
+func validateActionExists(ctx context.Context, db gocrud.DBQuerier, actionName string) error {
+	var actionID int
+	if err := db.QueryRowContext(ctx, "SELECT id FROM actions WHERE name = ?", actionName).Scan(&actionID); err != nil {
+		return ValidationError{msg: fmt.Sprintf("action '%s' not found", actionName)}
+	}
 	return nil
 }
 
 func validateDeviceAction(ctx context.Context, db gocrud.DBQuerier, deviceName, actionName string) error {
-	var deviceActions string
-	row := db.QueryRowContext(ctx, "SELECT actions FROM devices WHERE name = ?", deviceName)
-	if err := row.Scan(&deviceActions); err != nil {
+	var deviceID int
+	row := db.QueryRowContext(ctx, "SELECT id FROM devices WHERE name = ?", deviceName)
+	if err := row.Scan(&deviceID); err != nil {
 		return ValidationError{msg: fmt.Sprintf("device '%s' not found", deviceName)}
 	}
 
@@ -131,16 +459,29 @@ func validateDeviceAction(ctx context.Context, db gocrud.DBQuerier, deviceName,
 		return ValidationError{msg: fmt.Sprintf("action '%s' not found", actionName)}
 	}
 
-	var deviceActionIDs []int
-	if deviceActions != "" {
-		if err := json.Unmarshal([]byte(deviceActions), &deviceActionIDs); err != nil {
-			return ValidationError{msg: fmt.Sprintf("failed to parse device '%s' actions", deviceName)}
-		}
+	var assigned bool
+	row = db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM device_actions WHERE device_id = ? AND action_id = ?)", deviceID, actionID)
+	if err := row.Scan(&assigned); err != nil {
+		return ValidationError{msg: err.Error()}
 	}
 
-	if !slices.Contains(deviceActionIDs, actionID) {
+	if !assigned {
 		return ValidationError{msg: fmt.Sprintf("action '%s' is not assigned to device '%s'", actionName, deviceName)}
 	}
 
 	return nil
 }
+
+func validateActionParams(ctx context.Context, db gocrud.DBQuerier, actionName string, values map[string]any) error {
+	var action Action
+	row := db.QueryRowContext(ctx, "SELECT params, parameters, params_schema FROM actions WHERE name = ?", actionName)
+	if err := row.Scan(&action.Params, &action.Parameters, &action.ParamsSchema); err != nil {
+		return ValidationError{msg: fmt.Sprintf("action '%s' not found", actionName)}
+	}
+
+	if _, err := action.RenderParams(values); err != nil {
+		return ValidationError{msg: fmt.Sprintf("params of action '%s': %s", actionName, err)}
+	}
+
+	return nil
+}
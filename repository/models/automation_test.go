@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -121,12 +122,15 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "invalid operator 'invalid'")
@@ -150,9 +154,9 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "device 'sensor1' not found")
@@ -176,9 +180,9 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}))
@@ -205,12 +209,15 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2,3]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "action 'read_temp' is not assigned to device 'sensor1'")
@@ -234,12 +241,15 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow(""))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "action 'read_temp' is not assigned to device 'sensor1'")
@@ -263,15 +273,22 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "device 'actuator1' not found")
@@ -295,15 +312,22 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}))
@@ -330,18 +354,28 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[3,4]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "action 'turn_on' is not assigned to device 'actuator1'")
@@ -365,18 +399,29 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		expectActionParams(mock, "turn_on")
 
 		err = a.Validate(context.Background(), db)
 		require.NoError(t, err)
@@ -403,24 +448,39 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		expectActionParams(mock, "turn_on")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator2").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[3]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("send_alert").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(3, 3).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		expectActionParams(mock, "send_alert")
 
 		err = a.Validate(context.Background(), db)
 		require.NoError(t, err)
@@ -461,6 +521,221 @@ func TestAutomation_Validate(t *testing.T) {
 		assert.ErrorContains(t, err, "trigger must have both device and action")
 	})
 
+	t.Run("reported triggers", func(t *testing.T) {
+		cond := []AutomationCondition{{Field: "leak", Operator: "==", Threshold: 1}}
+		tests := []struct {
+			name     string
+			trigger  AutomationTrigger
+			deviceOK bool
+			wantErr  string
+		}{
+			{
+				name:     "valid reported trigger",
+				trigger:  AutomationTrigger{Device: "leak-sensor", Source: "reported", MaxAge: "15m", Conditions: cond},
+				deviceOK: true,
+			},
+			{
+				name:    "reported trigger with action",
+				trigger: AutomationTrigger{Device: "leak-sensor", Action: "read", Source: "reported", Conditions: cond},
+				wantErr: "reported triggers read the device state and must not have an action or params",
+			},
+			{
+				name:    "reported trigger with params",
+				trigger: AutomationTrigger{Device: "leak-sensor", Params: map[string]any{"channel": 1}, Source: "reported", Conditions: cond},
+				wantErr: "reported triggers read the device state and must not have an action or params",
+			},
+			{
+				name:    "invalid max_age",
+				trigger: AutomationTrigger{Device: "leak-sensor", Source: "reported", MaxAge: "soon", Conditions: cond},
+				wantErr: "max_age must be a positive duration",
+			},
+			{
+				name:    "unknown device",
+				trigger: AutomationTrigger{Device: "ghost", Source: "reported", Conditions: cond},
+				wantErr: "device 'ghost' not found",
+			},
+			{
+				name:    "max_age on action trigger",
+				trigger: AutomationTrigger{Device: "sensor1", Action: "read_temp", MaxAge: "1m", Conditions: cond},
+				wantErr: "max_age is only supported for reported triggers",
+			},
+			{
+				name:    "unknown source",
+				trigger: AutomationTrigger{Device: "sensor1", Source: "push", Conditions: cond},
+				wantErr: "trigger source must be 'action' or 'reported'",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				def := AutomationDefinition{
+					Interval: "5m",
+					Triggers: []AutomationTrigger{tt.trigger},
+					Actions:  []AutomationAction{{Device: "valve", Action: "close"}},
+				}
+				data, _ := yaml.Marshal(def)
+				a := Automation{Definition: string(data)}
+
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close() // nolint
+
+				if tt.deviceOK {
+					mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
+						WithArgs(tt.trigger.Device).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
+						WithArgs("valve").
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
+						WithArgs("close").
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+					mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+						WithArgs(4, 2).
+						WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+					expectActionParams(mock, "close")
+				} else {
+					mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").WillReturnError(sql.ErrNoRows)
+				}
+
+				err = a.Validate(context.Background(), db)
+				if tt.wantErr == "" {
+					require.NoError(t, err)
+				} else {
+					assert.ErrorContains(t, err, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			interval string
+			event    AutomationEvent
+			lookup   string
+			found    bool
+			wantErr  string
+		}{
+			{
+				name:   "device event without interval",
+				event:  AutomationEvent{Type: "device_reported", Device: "leak-sensor", Conditions: []AutomationCondition{{Field: "water", Operator: ">", Threshold: 0}}},
+				lookup: "SELECT id FROM devices WHERE name = ?",
+				found:  true,
+			},
+			{
+				name:     "event with interval",
+				interval: "5m",
+				event:    AutomationEvent{Type: "device_offline", Device: "valve"},
+				lookup:   "SELECT id FROM devices WHERE name = ?",
+				found:    true,
+			},
+			{
+				name:   "automation finished",
+				event:  AutomationEvent{Type: "automation_finished", Automation: "morning"},
+				lookup: "SELECT id FROM automations WHERE name = ?",
+				found:  true,
+			},
+			{
+				name:  "webhook",
+				event: AutomationEvent{Type: "webhook", Webhook: "door-bell"},
+			},
+			{
+				name:    "unknown device",
+				event:   AutomationEvent{Type: "device_online", Device: "ghost"},
+				lookup:  "SELECT id FROM devices WHERE name = ?",
+				wantErr: "device 'ghost' not found",
+			},
+			{
+				name:    "device event without device",
+				event:   AutomationEvent{Type: "device_reported"},
+				wantErr: "device_reported events must have a device",
+			},
+			{
+				name:    "device event with webhook",
+				event:   AutomationEvent{Type: "device_reported", Device: "leak-sensor", Webhook: "door-bell"},
+				wantErr: "device_reported events only match on device",
+			},
+			{
+				name:    "unknown automation",
+				event:   AutomationEvent{Type: "automation_finished", Automation: "ghost"},
+				lookup:  "SELECT id FROM automations WHERE name = ?",
+				wantErr: "automation 'ghost' not found",
+			},
+			{
+				name:    "own automation",
+				event:   AutomationEvent{Type: "automation_finished", Automation: "leak"},
+				wantErr: "an automation cannot run on its own automation_finished event",
+			},
+			{
+				name:    "invalid webhook name",
+				event:   AutomationEvent{Type: "webhook", Webhook: "door bell"},
+				wantErr: "webhook events must have a webhook name",
+			},
+			{
+				name:    "unknown type",
+				event:   AutomationEvent{Type: "device_rebooted", Device: "valve"},
+				wantErr: "invalid event type 'device_rebooted'",
+			},
+			{
+				name:    "invalid condition",
+				event:   AutomationEvent{Type: "webhook", Webhook: "door-bell", Conditions: []AutomationCondition{{Field: "open", Operator: "~"}}},
+				wantErr: "invalid operator '~'",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				def := AutomationDefinition{
+					Interval: tt.interval,
+					Events:   []AutomationEvent{tt.event},
+					Actions:  []AutomationAction{{Device: "valve", Action: "close"}},
+				}
+				data, _ := yaml.Marshal(def)
+				a := Automation{Name: "leak", Definition: string(data)}
+
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close() // nolint
+
+				if tt.lookup != "" && tt.found {
+					mock.ExpectQuery(tt.lookup).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				} else if tt.lookup != "" {
+					mock.ExpectQuery(tt.lookup).WillReturnError(sql.ErrNoRows)
+				}
+				mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
+					WithArgs("valve").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+				mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
+					WithArgs("close").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+					WithArgs(4, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				expectActionParams(mock, "close")
+
+				err = a.Validate(context.Background(), db)
+				if tt.wantErr == "" {
+					require.NoError(t, err)
+				} else {
+					assert.ErrorContains(t, err, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("missing interval without events returns error", func(t *testing.T) {
+		data, _ := yaml.Marshal(AutomationDefinition{Actions: []AutomationAction{{Device: "valve", Action: "close"}}})
+		a := Automation{Definition: string(data)}
+
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		err = a.Validate(context.Background(), db)
+		assert.ErrorContains(t, err, "interval must be a valid duration")
+	})
+
 	t.Run("trigger with empty conditions returns error", func(t *testing.T) {
 		def := AutomationDefinition{
 			Interval: "5m",
@@ -478,12 +753,15 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "conditions are required when a trigger reads from a device")
@@ -513,18 +791,29 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		expectActionParams(mock, "turn_on")
 
 		err = a.Validate(context.Background(), db)
 		require.NoError(t, err)
@@ -548,12 +837,19 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
 
 		err = a.Validate(context.Background(), db)
 		assert.ErrorContains(t, err, "actions are required")
@@ -585,27 +881,284 @@ func TestAutomation_Validate(t *testing.T) {
 		require.NoError(t, err)
 		defer db.Close() // nolint
 
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[1]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_temp").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_temp")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("sensor2").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[3]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("read_humidity").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
-		mock.ExpectQuery("SELECT actions FROM devices WHERE name = ?").
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(5, 3).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_humidity").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		expectActionParams(mock, "read_humidity")
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
 			WithArgs("actuator1").
-			WillReturnRows(sqlmock.NewRows([]string{"actions"}).AddRow("[2]"))
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
 			WithArgs("turn_on").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		expectActionParams(mock, "turn_on")
 
 		err = a.Validate(context.Background(), db)
 		require.NoError(t, err)
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("action params are checked against declared parameters", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			params  map[string]any
+			wantErr string
+		}{
+			{name: "valid params", params: map[string]any{"duration": 90}},
+			{name: "wrong type", params: map[string]any{"duration": "long"}, wantErr: "params of action 'water': parameter 'duration' must be of type integer"},
+			{name: "unknown parameter", params: map[string]any{"speed": 1}, wantErr: "params of action 'water': unknown parameter 'speed'"},
+			{name: "violates params schema", params: map[string]any{"duration": 900}, wantErr: "params of action 'water': params do not match params_schema: at '/seconds': maximum: got 900, want 600"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				def := AutomationDefinition{
+					Interval: "5m",
+					Actions:  []AutomationAction{{Device: "valve", Action: "water", Params: tt.params}},
+				}
+				data, _ := yaml.Marshal(def)
+				a := Automation{Definition: string(data)}
+
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close() // nolint
+
+				mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
+					WithArgs("valve").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+				mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
+					WithArgs("water").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+					WithArgs(4, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery("SELECT params, parameters, params_schema FROM actions WHERE name = ?").
+					WithArgs("water").
+					WillReturnRows(sqlmock.NewRows([]string{"params", "parameters", "params_schema"}).
+						AddRow(`{"seconds":"{{duration}}"}`, `[{"name":"duration","type":"integer","default":30}]`, `{"properties":{"seconds":{"maximum":600}}}`))
+
+				err = a.Validate(context.Background(), db)
+				if tt.wantErr == "" {
+					require.NoError(t, err)
+				} else {
+					assert.EqualError(t, err, tt.wantErr)
+				}
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+
+	t.Run("trigger params are checked against declared parameters", func(t *testing.T) {
+		def := AutomationDefinition{
+			Interval: "5m",
+			Triggers: []AutomationTrigger{{
+				Device:     "sensor1",
+				Action:     "read_temp",
+				Params:     map[string]any{"channel": "inner"},
+				Conditions: []AutomationCondition{{Field: "temp", Operator: ">", Threshold: 25}},
+			}},
+			Actions: []AutomationAction{{Device: "actuator1", Action: "turn_on"}},
+		}
+		data, _ := yaml.Marshal(def)
+		a := Automation{Definition: string(data)}
+
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").
+			WithArgs("sensor1").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+		mock.ExpectQuery("SELECT params, parameters, params_schema FROM actions WHERE name = ?").
+			WithArgs("read_temp").
+			WillReturnRows(sqlmock.NewRows([]string{"params", "parameters", "params_schema"}).
+				AddRow(`{"channel":"{{channel}}"}`, `[{"name":"channel","type":"integer","default":0}]`, ""))
+
+		err = a.Validate(context.Background(), db)
+		assert.EqualError(t, err, "params of action 'read_temp': parameter 'channel' must be of type integer")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("required params are checked even when an action gives none", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			action AutomationAction
+			mocks  func(mock sqlmock.Sqlmock)
+		}{
+			{
+				name:   "device action",
+				action: AutomationAction{Device: "valve", Action: "water"},
+				mocks: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery("SELECT id FROM devices WHERE name = ?").WithArgs("valve").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").WithArgs("water").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM device_actions").WithArgs(4, 1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				},
+			},
+			{
+				name:   "tag action",
+				action: AutomationAction{Tags: []string{"valve"}, Action: "water"},
+				mocks: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").WithArgs("water").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				def := AutomationDefinition{Interval: "5m", Actions: []AutomationAction{tt.action}}
+				data, _ := yaml.Marshal(def)
+				a := Automation{Definition: string(data)}
+
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close() // nolint
+
+				tt.mocks(mock)
+				mock.ExpectQuery("SELECT params, parameters, params_schema FROM actions WHERE name = ?").
+					WithArgs("water").
+					WillReturnRows(sqlmock.NewRows([]string{"params", "parameters", "params_schema"}).
+						AddRow(`{"seconds":"{{duration}}"}`, `[{"name":"duration","type":"integer","required":true}]`, ""))
+
+				err = a.Validate(context.Background(), db)
+				assert.EqualError(t, err, "params of action 'water': missing value for parameter 'duration'")
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+
+	t.Run("group and tag targets", func(t *testing.T) {
+		cond := []AutomationCondition{{Field: "moisture", Operator: "<", Threshold: 30}}
+		tests := []struct {
+			name    string
+			trigger AutomationTrigger
+			action  AutomationAction
+			mocks   func(mock sqlmock.Sqlmock)
+			wantErr string
+		}{
+			{
+				name:    "group trigger and tag action",
+				trigger: AutomationTrigger{Group: "beds", Action: "read_moisture", Match: "any", Conditions: cond},
+				action:  AutomationAction{Tags: []string{"garden", "valve"}, Action: "water"},
+				mocks: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery("SELECT id FROM groups WHERE name = ?").WithArgs("beds").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").WithArgs("read_moisture").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").WithArgs("read_moisture").WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(""))
+					expectActionParams(mock, "read_moisture")
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").WithArgs("water").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+					expectActionParams(mock, "water")
+				},
+			},
+			{
+				name:    "reported trigger on tags",
+				trigger: AutomationTrigger{Tags: []string{"leak"}, Source: "reported", Conditions: cond},
+				action:  AutomationAction{Group: "valves", Action: "close"},
+				mocks: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery("SELECT id FROM groups WHERE name = ?").WithArgs("valves").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+					mock.ExpectQuery("SELECT id FROM actions WHERE name = ?").WithArgs("close").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+					expectActionParams(mock, "close")
+				},
+			},
+			{
+				name:    "device and group together",
+				trigger: AutomationTrigger{Device: "bed-1", Group: "beds", Action: "read_moisture", Conditions: cond},
+				wantErr: "trigger must have exactly one of device, group or tags",
+			},
+			{
+				name:    "unknown group",
+				trigger: AutomationTrigger{Group: "ghosts", Action: "read_moisture", Conditions: cond},
+				mocks: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery("SELECT id FROM groups WHERE name = ?").WillReturnError(sql.ErrNoRows)
+				},
+				wantErr: "group 'ghosts' not found",
+			},
+			{
+				name:    "match on single device",
+				trigger: AutomationTrigger{Device: "bed-1", Action: "read_moisture", Match: "any", Conditions: cond},
+				wantErr: "match is only supported for triggers on a group or tags",
+			},
+			{
+				name:    "unknown match",
+				trigger: AutomationTrigger{Group: "beds", Action: "read_moisture", Match: "most", Conditions: cond},
+				wantErr: "match must be 'all' or 'any'",
+			},
+			{
+				name:    "blank tag",
+				trigger: AutomationTrigger{Tags: []string{""}, Action: "read_moisture", Conditions: cond},
+				wantErr: "tags must not be empty",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				action := tt.action
+				if action.Action == "" {
+					action = AutomationAction{Tags: []string{"valve"}, Action: "water"}
+				}
+				def := AutomationDefinition{
+					Interval: "5m",
+					Triggers: []AutomationTrigger{tt.trigger},
+					Actions:  []AutomationAction{action},
+				}
+				data, _ := yaml.Marshal(def)
+				a := Automation{Definition: string(data)}
+
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close() // nolint
+
+				if tt.mocks != nil {
+					tt.mocks(mock)
+				}
+
+				err = a.Validate(context.Background(), db)
+				if tt.wantErr == "" {
+					require.NoError(t, err)
+					require.NoError(t, mock.ExpectationsWereMet())
+				} else {
+					assert.EqualError(t, err, tt.wantErr)
+				}
+			})
+		}
+	})
+}
+
+// expectActionParams expects the params of an action without declared parameters to be read.
+func expectActionParams(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectQuery("SELECT params, parameters, params_schema FROM actions WHERE name = ?").
+		WithArgs(action).
+		WillReturnRows(sqlmock.NewRows([]string{"params", "parameters", "params_schema"}).AddRow("{}", "", ""))
 }
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	gocrud "github.com/tender-barbarian/go-crud"
+)
+
+// Types of the values a condition compares.
+const (
+	ValueNumber  = "number"
+	ValueString  = "string"
+	ValueBoolean = "boolean"
+	ValueNull    = "null"
+)
+
+// orderedOperators only apply to numbers and strings, which compare lexically.
+var orderedOperators = map[string]bool{">": true, "<": true, ">=": true, "<=": true}
+
+// NormalizeValue returns v with numbers converted to float64, along with its type.
+// ok is false when v isn't a number, string, boolean or null.
+func NormalizeValue(v any) (value any, typ string, ok bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, ValueNull, true
+	case bool:
+		return v, ValueBoolean, true
+	case string:
+		return v, ValueString, true
+	case float64:
+		return v, ValueNumber, true
+	case float32:
+		return float64(v), ValueNumber, true
+	case int:
+		return float64(v), ValueNumber, true
+	case int64:
+		return float64(v), ValueNumber, true
+	case uint64:
+		return float64(v), ValueNumber, true
+	}
+	return nil, "", false
+}
+
+// validateThreshold checks that the threshold of a condition has a supported type and
+// that its operator can compare it.
+func validateThreshold(cond AutomationCondition) error {
+	_, typ, ok := NormalizeValue(cond.Threshold)
+	if !ok {
+		return ValidationError{msg: fmt.Sprintf("threshold of field '%s' must be a number, string, boolean or null", cond.Field)}
+	}
+	if orderedOperators[cond.Operator] && typ != ValueNumber && typ != ValueString {
+		return ValidationError{msg: fmt.Sprintf("operator '%s' cannot compare the %s threshold of field '%s': use == or !=", cond.Operator, typ, cond.Field)}
+	}
+	return nil
+}
+
+// validateConditionTypes checks the thresholds of a trigger's conditions against the
+// field types declared by the result schema of its action, if it has one. Results are
+// checked against the schema, so a threshold of another type could never match.
+func validateConditionTypes(ctx context.Context, db gocrud.DBQuerier, actionName string, conditions []AutomationCondition) error {
+	var schema string
+	if err := db.QueryRowContext(ctx, "SELECT result_schema FROM actions WHERE name = ?", actionName).Scan(&schema); err != nil {
+		return ValidationError{msg: fmt.Sprintf("action '%s' not found", actionName)}
+	}
+	if schema == "" {
+		return nil
+	}
+
+	// The schema was checked when the action was saved
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(schema), &doc); err != nil {
+		return nil
+	}
+	return checkConditionTypes(doc, actionName, conditions)
+}
+
+func checkConditionTypes(schema map[string]any, actionName string, conditions []AutomationCondition) error {
+	for _, cond := range conditions {
+		if cond.IsBlock() {
+			nested := append(append([]AutomationCondition{}, cond.All...), cond.Any...)
+			if cond.Not != nil {
+				nested = append(nested, *cond.Not)
+			}
+			if err := checkConditionTypes(schema, actionName, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		types := schemaFieldTypes(schema, cond.Field)
+		if len(types) == 0 {
+			continue
+		}
+		_, typ, _ := NormalizeValue(cond.Threshold)
+		if slices.Contains(types, typ) || (typ == ValueNumber && slices.Contains(types, "integer")) {
+			continue
+		}
+		return ValidationError{msg: fmt.Sprintf("threshold of field '%s' is a %s, but the result schema of action '%s' declares %s",
+			cond.Field, typ, actionName, strings.Join(types, " or "))}
+	}
+	return nil
+}
+
+// schemaFieldTypes returns the types a JSON Schema declares for a field, following dots
+// into nested properties. It returns nil when the schema doesn't declare them.
+func schemaFieldTypes(schema map[string]any, field string) []string {
+	node := schema
+	for _, part := range strings.Split(field, ".") {
+		properties, _ := node["properties"].(map[string]any)
+		next, ok := properties[part].(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = next
+	}
+
+	switch t := node["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		in       any
+		want     any
+		wantType string
+		wantOK   bool
+	}{
+		{in: 30, want: 30.0, wantType: ValueNumber, wantOK: true},
+		{in: 22.5, want: 22.5, wantType: ValueNumber, wantOK: true},
+		{in: "open", want: "open", wantType: ValueString, wantOK: true},
+		{in: true, want: true, wantType: ValueBoolean, wantOK: true},
+		{in: nil, want: nil, wantType: ValueNull, wantOK: true},
+		{in: []any{1}, wantOK: false},
+		{in: map[string]any{"a": 1}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, typ, ok := NormalizeValue(tt.in)
+		assert.Equal(t, tt.wantOK, ok, "%v", tt.in)
+		assert.Equal(t, tt.want, got, "%v", tt.in)
+		assert.Equal(t, tt.wantType, typ, "%v", tt.in)
+	}
+}
+
+func TestAutomation_ValidateThresholds(t *testing.T) {
+	event := "events:\n  - type: webhook\n    webhook: garden\n    conditions:\n"
+	tests := []struct {
+		name      string
+		condition string
+		wantErr   string
+	}{
+		{name: "number", condition: "{field: temp, operator: \">\", threshold: 25}", wantErr: "actions are required"},
+		{name: "ordered string", condition: "{field: time, operator: \">=\", threshold: \"08:00\"}", wantErr: "actions are required"},
+		{name: "string equality", condition: "{field: state, operator: \"==\", threshold: open}", wantErr: "actions are required"},
+		{name: "boolean equality", condition: "{field: leak, operator: \"==\", threshold: true}", wantErr: "actions are required"},
+		{name: "null equality", condition: "{field: error, operator: \"!=\", threshold: null}", wantErr: "actions are required"},
+		{name: "missing threshold is null", condition: "{field: error, operator: \"==\"}", wantErr: "actions are required"},
+		{name: "ordered boolean", condition: "{field: leak, operator: \">\", threshold: false}", wantErr: "operator '>' cannot compare the boolean threshold of field 'leak'"},
+		{name: "ordered null", condition: "{field: error, operator: \"<=\"}", wantErr: "operator '<=' cannot compare the null threshold of field 'error'"},
+		{name: "list threshold", condition: "{field: state, operator: \"==\", threshold: [open, closed]}", wantErr: "threshold of field 'state' must be a number, string, boolean or null"},
+		{name: "threshold on a block", condition: "{threshold: 1, all: [{field: leak, operator: \"==\", threshold: true}]}", wantErr: "exactly one of all, any or not"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			a := Automation{Definition: event + "      - " + tt.condition + "\nactions: []\n"}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), tt.wantErr)
+		})
+	}
+
+	t.Run("thresholds keep their type", func(t *testing.T) {
+		a := Automation{Definition: event + "      - {field: state, operator: \"==\", threshold: \"1\"}\n      - {field: count, operator: \"==\", threshold: 1}\n      - {field: leak, operator: \"==\", threshold: true}\n"}
+		def, err := a.ParseDefinition()
+		require.NoError(t, err)
+
+		conditions := def.Events[0].Conditions
+		assert.Equal(t, "1", conditions[0].Threshold)
+		assert.Equal(t, 1, conditions[1].Threshold)
+		assert.Equal(t, true, conditions[2].Threshold)
+	})
+}
+
+func TestAutomation_ValidateConditionTypes(t *testing.T) {
+	schema := `{"type":"object","properties":{
+		"state":{"type":"string"},
+		"leak":{"type":"boolean"},
+		"level":{"type":"integer"},
+		"error":{"type":["string","null"]},
+		"sensor":{"type":"object","properties":{"temperature":{"type":"number"}}}
+	}}`
+
+	tests := []struct {
+		name      string
+		condition AutomationCondition
+		wantErr   string
+	}{
+		{name: "string", condition: AutomationCondition{Field: "state", Operator: "==", Threshold: "open"}},
+		{name: "integer field takes numbers", condition: AutomationCondition{Field: "level", Operator: ">", Threshold: 2.5}},
+		{name: "nullable field", condition: AutomationCondition{Field: "error", Operator: "!=", Threshold: nil}},
+		{name: "undeclared field", condition: AutomationCondition{Field: "extra", Operator: "==", Threshold: true}},
+		{name: "nested field", condition: AutomationCondition{Field: "sensor.temperature", Operator: "<", Threshold: 30}},
+		{
+			name:      "number against string",
+			condition: AutomationCondition{Field: "state", Operator: "==", Threshold: 1},
+			wantErr:   "threshold of field 'state' is a number, but the result schema of action 'read' declares string",
+		},
+		{
+			name:      "null against boolean",
+			condition: AutomationCondition{Field: "leak", Operator: "==", Threshold: nil},
+			wantErr:   "threshold of field 'leak' is a null, but the result schema of action 'read' declares boolean",
+		},
+		{
+			name:      "inside a block",
+			condition: AutomationCondition{Any: []AutomationCondition{{Not: &AutomationCondition{Field: "sensor.temperature", Operator: ">", Threshold: "hot"}}}},
+			wantErr:   "field 'sensor.temperature' is a string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			mock.ExpectQuery("SELECT result_schema FROM actions WHERE name = ?").
+				WithArgs("read").
+				WillReturnRows(sqlmock.NewRows([]string{"result_schema"}).AddRow(schema))
+
+			err = validateConditionTypes(context.Background(), db, "read", []AutomationCondition{tt.condition})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
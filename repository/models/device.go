@@ -2,43 +2,318 @@ package models
 
 import (
 	"context"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
 
 	gocrud "github.com/tender-barbarian/go-crud"
 )
 
+const (
+	TransportHTTP = "http"
+	TransportMQTT = "mqtt"
+)
+
+// Transports lists the device transports the server knows how to talk to. Devices
+// are validated against them unless the context names the registered transports.
+var Transports = []string{TransportHTTP, TransportMQTT}
+
+type transportsKey struct{}
+
+// WithTransports returns a copy of ctx carrying the names of the transports the
+// server has registered, which devices are then validated against.
+func WithTransports(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, transportsKey{}, names)
+}
+
+func transportsFrom(ctx context.Context) []string {
+	if names, ok := ctx.Value(transportsKey{}).([]string); ok {
+		return names
+	}
+	return Transports
+}
+
+const (
+	AuthNone   = "none"
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthHMAC   = "hmac"
+)
+
+// AuthTypes lists the ways the server can authenticate itself to HTTP devices.
+var AuthTypes = []string{AuthNone, AuthBearer, AuthBasic, AuthHMAC}
+
+// minIngestTokenLength keeps ingest tokens long enough not to be guessed.
+const minIngestTokenLength = 16
+
+// Device health states recorded by the health checker. A device that has not
+// been checked yet has an empty status.
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
 type Device struct {
-	ID        int             `json:"id" db:"id"`
-	Name      string          `json:"name" db:"name"`
-	Type      string          `json:"type" db:"type"`
-	Chip      string          `json:"chip" db:"chip"`
-	Board     string          `json:"board" db:"board"`
-	IP        string          `json:"ip" db:"ip"`
-	Actions   string          `json:"actions,omitempty" db:"actions"`
-	CreatedAt gocrud.NullTime `json:"created_at" db:"created_at"`
-	UpdatedAt gocrud.NullTime `json:"updated_at" db:"updated_at"`
+	ID            int             `json:"id" db:"id"`
+	Name          string          `json:"name" db:"name"`
+	Type          string          `json:"type" db:"type"`
+	Chip          string          `json:"chip" db:"chip"`
+	Board         string          `json:"board" db:"board"`
+	IP            string          `json:"ip" db:"ip"`
+	Tags          Tags            `json:"tags" db:"tags"`
+	Transport     string          `json:"transport" db:"transport"`
+	Scheme        string          `json:"scheme" db:"scheme"`
+	Port          int             `json:"port" db:"port"`
+	RPCPath       string          `json:"rpc_path" db:"rpc_path"`
+	Headers       string          `json:"headers" db:"headers"`
+	Timeout       string          `json:"timeout" db:"timeout"`
+	AuthType      string          `json:"auth_type" db:"auth_type"`
+	AuthUsername  string          `json:"auth_username" db:"auth_username"`
+	AuthSecret    string          `json:"auth_secret,omitempty" db:"auth_secret"`
+	Status        string          `json:"status" db:"status"`
+	LastSeen      string          `json:"last_seen" db:"last_seen"`
+	LatencyMs     int             `json:"latency_ms" db:"latency_ms"`
+	IngestToken   string          `json:"ingest_token,omitempty" db:"ingest_token"`
+	ReportedState string          `json:"reported_state" db:"reported_state"`
+	ReportedAt    string          `json:"reported_at" db:"reported_at"`
+	CreatedAt     gocrud.NullTime `json:"created_at" db:"created_at"`
+	UpdatedAt     gocrud.NullTime `json:"updated_at" db:"updated_at"`
 	gocrud.Reflection
 }
 
 func (d *Device) Validate(ctx context.Context, db gocrud.DBQuerier) error {
-	var actions []int
-	if d.Actions != "" {
-		if err := json.Unmarshal([]byte(d.Actions), &actions); err != nil {
-			return ValidationError{msg: "actions must be a list of action IDs"}
+	if transports := transportsFrom(ctx); d.Transport != "" && !slices.Contains(transports, d.Transport) {
+		return ValidationError{msg: fmt.Sprintf("transport must be one of: %s", strings.Join(transports, ", "))}
+	}
+
+	// MQTT devices are addressed by name in topic paths
+	if d.Transport == TransportMQTT && strings.ContainsAny(d.Name, "/+#") {
+		return ValidationError{msg: "name of an MQTT device must not contain '/', '+' or '#'"}
+	}
+
+	if err := d.validateEndpoint(); err != nil {
+		return err
+	}
+
+	if err := d.validateAuth(); err != nil {
+		return err
+	}
+
+	if d.IngestToken != "" && len(d.IngestToken) < minIngestTokenLength {
+		return ValidationError{msg: fmt.Sprintf("ingest_token must be at least %d characters", minIngestTokenLength)}
+	}
+
+	for _, tag := range d.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return ValidationError{msg: "tags must not be empty"}
+		}
+	}
+
+	return nil
+}
+
+// Tags label a device. They are a JSON array in the API and stored as JSON text.
+type Tags []string
+
+// MarshalJSON returns an empty array rather than null for a device without tags.
+func (t Tags) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(t))
+}
+
+// Value stores the tags as a JSON array, or an empty string when there are none.
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal([]string(t))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads tags stored by Value.
+func (t *Tags) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into tags", value)
+	}
+
+	*t = nil
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// DeviceAction assigns an action to a device. Assignments live in the device_actions
+// table, which keeps an assigned action from being deleted.
+type DeviceAction struct {
+	DeviceID int `json:"device_id"`
+	ActionID int `json:"action_id"`
+}
+
+// RedactedHeader replaces the values of custom headers in responses, since they
+// often carry API keys.
+const RedactedHeader = "********"
+
+// MarshalJSON leaves out the auth secret and ingest token, which can be set through
+// the API but are never returned, and redacts the values of custom headers.
+func (d Device) MarshalJSON() ([]byte, error) {
+	type device Device
+	out := device(d)
+	out.AuthSecret = ""
+	out.IngestToken = ""
+	out.Headers = redactHeaders(d.Headers)
+	return json.Marshal(out)
+}
+
+// redactHeaders keeps the header names and replaces their values. Headers that don't
+// parse are left out entirely.
+func redactHeaders(headers string) string {
+	if headers == "" {
+		return ""
+	}
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(headers), &parsed); err != nil {
+		return ""
+	}
+	for name := range parsed {
+		parsed[name] = RedactedHeader
+	}
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// RestoreHeaders returns the headers of an update with every value sent back as
+// RedactedHeader replaced by the stored value of that header, so a client can send
+// back the device it read. Headers that don't parse are returned as sent, for
+// validation to reject.
+func RestoreHeaders(update, current string) string {
+	var sent, stored map[string]string
+	if update == "" || json.Unmarshal([]byte(update), &sent) != nil {
+		return update
+	}
+	if current == "" || json.Unmarshal([]byte(current), &stored) != nil {
+		return update
+	}
+
+	restored := false
+	for name, value := range sent {
+		if storedValue, ok := stored[name]; ok && value == RedactedHeader {
+			sent[name] = storedValue
+			restored = true
 		}
 	}
+	if !restored {
+		return update
+	}
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return update
+	}
+	return string(data)
+}
+
+// ParseReportedState returns the state last pushed by the device, or nil if it never reported.
+func (d *Device) ParseReportedState() (map[string]any, error) {
+	if d.ReportedState == "" {
+		return nil, nil
+	}
+	var state map[string]any
+	if err := json.Unmarshal([]byte(d.ReportedState), &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
 
-	for _, actionID := range actions {
-		var exists bool
-		row := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM actions WHERE ID = ?)", actionID)
-		if err := row.Scan(&exists); err != nil {
-			return ValidationError{msg: err.Error()}
+// HasTags reports whether the device carries every given tag.
+func (d *Device) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(d.Tags, tag) {
+			return false
 		}
+	}
+	return true
+}
+
+// ParseHeaders returns the custom HTTP headers sent with every request to the device.
+func (d *Device) ParseHeaders() (map[string]string, error) {
+	headers := map[string]string{}
+	if d.Headers == "" {
+		return headers, nil
+	}
+	if err := json.Unmarshal([]byte(d.Headers), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
 
-		if !exists {
-			return ValidationError{msg: "all actions must exist"}
+func (d *Device) validateEndpoint() error {
+	if d.Scheme != "" && d.Scheme != "http" && d.Scheme != "https" {
+		return ValidationError{msg: "scheme must be 'http' or 'https'"}
+	}
+
+	if d.Port < 0 || d.Port > 65535 {
+		return ValidationError{msg: "port must be between 0 and 65535, where 0 uses the default port of the scheme"}
+	}
+
+	if d.Port != 0 {
+		if _, _, err := net.SplitHostPort(d.IP); err == nil {
+			return ValidationError{msg: "port must not be set when ip already includes a port"}
 		}
 	}
 
+	if d.RPCPath != "" && !strings.HasPrefix(d.RPCPath, "/") {
+		return ValidationError{msg: "rpc_path must start with '/'"}
+	}
+
+	if _, err := d.ParseHeaders(); err != nil {
+		return ValidationError{msg: "headers must be a JSON object of string values"}
+	}
+
+	if err := validateTimeout(d.Timeout); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (d *Device) validateAuth() error {
+	if d.AuthType == "" || d.AuthType == AuthNone {
+		return nil
+	}
+
+	if !slices.Contains(AuthTypes, d.AuthType) {
+		return ValidationError{msg: fmt.Sprintf("auth_type must be one of: %s", strings.Join(AuthTypes, ", "))}
+	}
+
+	if d.Transport != "" && d.Transport != TransportHTTP {
+		return ValidationError{msg: "auth_type is only supported for http devices"}
+	}
+
+	if d.AuthType == AuthBasic && d.AuthUsername == "" {
+		return ValidationError{msg: "auth_username is required for basic auth"}
+	}
+
+	if d.AuthSecret == "" {
+		return ValidationError{msg: fmt.Sprintf("auth_secret is required for %s auth", d.AuthType)}
+	}
+
 	return nil
 }
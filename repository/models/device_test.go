@@ -2,7 +2,7 @@ package models
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -18,66 +18,136 @@ func TestDevice_ValidateWithDB(t *testing.T) {
 		wantErr   string
 	}{
 		{
-			name:      "empty actions is valid",
-			device:    Device{Actions: ""},
+			name:      "empty device is valid",
+			device:    Device{},
 			setupMock: func(mock sqlmock.Sqlmock) {},
 			wantErr:   "",
 		},
 		{
-			name:      "invalid JSON returns error",
-			device:    Device{Actions: "not-json"},
+			name:      "explicit http transport is valid",
+			device:    Device{Transport: "http"},
 			setupMock: func(mock sqlmock.Sqlmock) {},
-			wantErr:   "actions must be a list of action IDs",
+			wantErr:   "",
+		},
+		{
+			name:      "tags are valid",
+			device:    Device{Tags: Tags{"garden", "watering"}},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
+		},
+		{
+			name:      "blank tag returns error",
+			device:    Device{Tags: Tags{"garden", " "}},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "tags must not be empty",
+		},
+		{
+			name:      "unknown transport returns error",
+			device:    Device{Transport: "carrier-pigeon"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "transport must be one of: http, mqtt",
+		},
+		{
+			name:      "mqtt device with plain name is valid",
+			device:    Device{Name: "balcony-sensor", Transport: "mqtt"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
+		},
+		{
+			name:      "mqtt device name with topic separator returns error",
+			device:    Device{Name: "balcony/sensor", Transport: "mqtt"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "name of an MQTT device must not contain",
+		},
+		{
+			name:      "full custom endpoint is valid",
+			device:    Device{IP: "192.168.1.10", Scheme: "https", Port: 8443, RPCPath: "/api/rpc", Headers: `{"X-Api-Key":"abc"}`},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
 		},
 		{
-			name:      "invalid JSON array returns error",
-			device:    Device{Actions: `{"foo": "bar"}`},
+			name:      "unknown scheme returns error",
+			device:    Device{Scheme: "ftp"},
 			setupMock: func(mock sqlmock.Sqlmock) {},
-			wantErr:   "actions must be a list of action IDs",
+			wantErr:   "scheme must be 'http' or 'https'",
 		},
 		{
-			name:   "all actions exist is valid",
-			device: Device{Actions: "[1, 2, 3]"},
-			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-			},
-			wantErr: "",
+			name:      "port out of range returns error",
+			device:    Device{Port: 70000},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "port must be between 0 and 65535, where 0 uses the default port of the scheme",
 		},
 		{
-			name:   "non-existent action returns error",
-			device: Device{Actions: "[1, 2, 999]"},
-			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(999).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
-			},
-			wantErr: "all actions must exist",
+			name:      "port together with port in ip returns error",
+			device:    Device{IP: "192.168.1.10:80", Port: 8080},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "port must not be set when ip already includes a port",
 		},
 		{
-			name:   "first action does not exist",
-			device: Device{Actions: "[100]"},
-			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(100).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
-			},
-			wantErr: "all actions must exist",
+			name:      "relative rpc path returns error",
+			device:    Device{RPCPath: "rpc"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "rpc_path must start with '/'",
 		},
 		{
-			name:   "database error is returned",
-			device: Device{Actions: "[1]"},
-			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnError(errors.New("database connection failed"))
-			},
-			wantErr: "database connection failed",
+			name:      "non-string header values return error",
+			device:    Device{Headers: `{"X-Retries": 3}`},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "headers must be a JSON object of string values",
 		},
 		{
-			name:   "single valid action",
-			device: Device{Actions: "[5]"},
-			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT EXISTS").WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-			},
-			wantErr: "",
+			name:      "valid timeout",
+			device:    Device{Timeout: "60s"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
+		},
+		{
+			name:      "invalid timeout returns error",
+			device:    Device{Timeout: "soon"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "timeout must be a positive duration",
+		},
+		{
+			name:      "bearer auth with secret is valid",
+			device:    Device{AuthType: "bearer", AuthSecret: "token"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
+		},
+		{
+			name:      "unknown auth type returns error",
+			device:    Device{AuthType: "digest"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "auth_type must be one of: none, bearer, basic, hmac",
+		},
+		{
+			name:      "hmac auth without secret returns error",
+			device:    Device{AuthType: "hmac"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "auth_secret is required for hmac auth",
+		},
+		{
+			name:      "basic auth without username returns error",
+			device:    Device{AuthType: "basic", AuthSecret: "pass"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "auth_username is required for basic auth",
+		},
+		{
+			name:      "auth on mqtt device returns error",
+			device:    Device{Name: "sensor", Transport: "mqtt", AuthType: "bearer", AuthSecret: "token"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "auth_type is only supported for http devices",
+		},
+		{
+			name:      "short ingest token returns error",
+			device:    Device{IngestToken: "secret"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "ingest_token must be at least 16 characters",
+		},
+		{
+			name:      "long ingest token is valid",
+			device:    Device{IngestToken: "0123456789abcdef"},
+			setupMock: func(mock sqlmock.Sqlmock) {},
+			wantErr:   "",
 		},
 	}
 
@@ -102,3 +172,99 @@ func TestDevice_ValidateWithDB(t *testing.T) {
 		})
 	}
 }
+
+func TestDevice_MarshalJSON(t *testing.T) {
+	device := &Device{ID: 1, Name: "pump", AuthType: AuthHMAC, AuthSecret: "s3cret", IngestToken: "0123456789abcdef", Headers: `{"X-Api-Key":"k3y"}`}
+
+	data, err := json.Marshal(device)
+	require.NoError(t, err)
+
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.NotContains(t, out, "auth_secret")
+	assert.NotContains(t, out, "ingest_token")
+	assert.Equal(t, "hmac", out["auth_type"])
+	assert.Equal(t, "pump", out["name"])
+	assert.JSONEq(t, `{"X-Api-Key":"********"}`, out["headers"].(string))
+	assert.Equal(t, "s3cret", device.AuthSecret)
+	assert.Equal(t, `{"X-Api-Key":"k3y"}`, device.Headers)
+
+	// The secret can still be set through the API
+	var in Device
+	require.NoError(t, json.Unmarshal([]byte(`{"auth_type":"bearer","auth_secret":"token"}`), &in))
+	assert.Equal(t, "token", in.AuthSecret)
+}
+
+func TestRestoreHeaders(t *testing.T) {
+	stored := `{"X-Api-Key":"k3y","X-Zone":"north"}`
+	tests := []struct {
+		name   string
+		update string
+		want   string
+	}{
+		{name: "redacted values are restored", update: `{"X-Api-Key":"********","X-Zone":"********"}`, want: stored},
+		{name: "new values are kept", update: `{"X-Api-Key":"n3w","X-Zone":"********"}`, want: `{"X-Api-Key":"n3w","X-Zone":"north"}`},
+		{name: "unknown header stays redacted", update: `{"X-Other":"********"}`, want: `{"X-Other":"********"}`},
+		{name: "removed headers stay removed", update: "", want: ""},
+		{name: "invalid headers are returned as sent", update: `not json`, want: `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RestoreHeaders(tt.update, stored))
+		})
+	}
+}
+
+func TestDevice_ValidateTransports(t *testing.T) {
+	ctx := WithTransports(context.Background(), []string{"http", "lora"})
+
+	require.NoError(t, (&Device{Transport: "lora"}).Validate(ctx, nil))
+	assert.EqualError(t, (&Device{Transport: "mqtt"}).Validate(ctx, nil), "transport must be one of: http, lora")
+}
+
+func TestTags(t *testing.T) {
+	t.Run("json array in the API", func(t *testing.T) {
+		data, err := json.Marshal(&Device{Tags: Tags{"garden", "north"}})
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"tags":["garden","north"]`)
+
+		data, err = json.Marshal(&Device{})
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"tags":[]`)
+
+		var in Device
+		require.NoError(t, json.Unmarshal([]byte(`{"tags":["garden"]}`), &in))
+		assert.Equal(t, Tags{"garden"}, in.Tags)
+	})
+
+	t.Run("stored as json text", func(t *testing.T) {
+		value, err := Tags{"garden", "north"}.Value()
+		require.NoError(t, err)
+		assert.Equal(t, `["garden","north"]`, value)
+
+		value, err = Tags(nil).Value()
+		require.NoError(t, err)
+		assert.Equal(t, "", value)
+
+		var tags Tags
+		require.NoError(t, tags.Scan(`["garden","north"]`))
+		assert.Equal(t, Tags{"garden", "north"}, tags)
+		require.NoError(t, tags.Scan([]byte("")))
+		assert.Nil(t, tags)
+		assert.Error(t, tags.Scan(42))
+	})
+}
+
+func TestDevice_ParseReportedState(t *testing.T) {
+	state, err := (&Device{}).ParseReportedState()
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	state, err = (&Device{ReportedState: `{"leak":true,"battery":87}`}).ParseReportedState()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"leak": true, "battery": float64(87)}, state)
+
+	_, err = (&Device{ReportedState: `[1]`}).ParseReportedState()
+	assert.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"context"
+
+	gocrud "github.com/tender-barbarian/go-crud"
+)
+
+// Group is a named set of devices. A device can belong to any number of groups.
+type Group struct {
+	ID          int             `json:"id" db:"id"`
+	Name        string          `json:"name" db:"name"`
+	Description string          `json:"description" db:"description"`
+	CreatedAt   gocrud.NullTime `json:"created_at" db:"created_at"`
+	UpdatedAt   gocrud.NullTime `json:"updated_at" db:"updated_at"`
+	gocrud.Reflection
+}
+
+func (g *Group) Validate(ctx context.Context, db gocrud.DBQuerier) error {
+	if g.Name == "" {
+		return ValidationError{msg: "name is required"}
+	}
+	return nil
+}
+
+// GroupDevice makes a device a member of a group. Memberships live in the
+// group_devices table and are deleted along with the group or the device.
+type GroupDevice struct {
+	GroupID  int `json:"group_id"`
+	DeviceID int `json:"device_id"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup_Validate(t *testing.T) {
+	require.NoError(t, (&Group{Name: "garden"}).Validate(context.Background(), nil))
+	assert.EqualError(t, (&Group{}).Validate(context.Background(), nil), "name is required")
+}
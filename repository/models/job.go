@@ -0,0 +1,36 @@
+package models
+
+import (
+	gocrud "github.com/tender-barbarian/go-crud"
+)
+
+// Job states. A job is queued until a worker picks it up and ends as succeeded or failed.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is an action execution run in the background. Jobs are created by the server,
+// so they have no validation; Params and Response hold JSON.
+type Job struct {
+	ID         int             `json:"id" db:"id"`
+	DeviceID   int             `json:"device_id" db:"device_id"`
+	ActionID   int             `json:"action_id" db:"action_id"`
+	Params     string          `json:"params" db:"params"`
+	State      string          `json:"state" db:"state"`
+	Response   string          `json:"response" db:"response"`
+	Error      string          `json:"error" db:"error"`
+	StartedAt  string          `json:"started_at" db:"started_at"`
+	FinishedAt string          `json:"finished_at" db:"finished_at"`
+	DurationMs int             `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  gocrud.NullTime `json:"created_at" db:"created_at"`
+	UpdatedAt  gocrud.NullTime `json:"updated_at" db:"updated_at"`
+	gocrud.Reflection
+}
+
+// Finished reports whether the job has ended.
+func (j *Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LogicNode combines the results of named triggers into the expression that decides
+// whether an automation runs, replacing condition_logic. A node refers to a single
+// trigger, or is a block of nested nodes: all of them must be met, any one of them,
+// or not the nested one. A trigger can be referred to by its name alone, e.g.
+//
+//	logic:
+//	  any:
+//	    - all: [soil, tank]
+//	    - override
+type LogicNode struct {
+	Trigger string      `yaml:"trigger,omitempty"`
+	All     []LogicNode `yaml:"all,omitempty"`
+	Any     []LogicNode `yaml:"any,omitempty"`
+	Not     *LogicNode  `yaml:"not,omitempty"`
+}
+
+func (n *LogicNode) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*n = LogicNode{Trigger: node.Value}
+		return nil
+	}
+
+	// A separate type keeps Decode from calling this method again
+	type plain LogicNode
+	return node.Decode((*plain)(n))
+}
+
+// validateLogic checks the logic tree of def. Every trigger must be named and used by
+// the tree, so that none is read without affecting the result.
+func validateLogic(def *AutomationDefinition) error {
+	names := make(map[string]bool, len(def.Triggers))
+	for _, trigger := range def.Triggers {
+		if trigger.Name == "" {
+			continue
+		}
+		if names[trigger.Name] {
+			return ValidationError{msg: fmt.Sprintf("duplicate trigger name '%s'", trigger.Name)}
+		}
+		names[trigger.Name] = true
+	}
+
+	if def.Logic == nil {
+		return nil
+	}
+	if def.ConditionLogic != "" {
+		return ValidationError{msg: "condition_logic and logic cannot be combined"}
+	}
+
+	used := make(map[string]bool, len(names))
+	if err := validateLogicNode(*def.Logic, names, used); err != nil {
+		return err
+	}
+	for i, trigger := range def.Triggers {
+		if trigger.Name == "" {
+			return ValidationError{msg: fmt.Sprintf("trigger %d must have a name to be used in logic", i+1)}
+		}
+		if !used[trigger.Name] {
+			return ValidationError{msg: fmt.Sprintf("trigger '%s' is not used in logic", trigger.Name)}
+		}
+	}
+	return nil
+}
+
+func validateLogicNode(node LogicNode, names, used map[string]bool) error {
+	set := 0
+	for _, ok := range []bool{node.Trigger != "", len(node.All) > 0, len(node.Any) > 0, node.Not != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return ValidationError{msg: "each logic entry must have exactly one of trigger, all, any or not"}
+	}
+
+	switch {
+	case node.Trigger != "":
+		if !names[node.Trigger] {
+			return ValidationError{msg: fmt.Sprintf("logic refers to unknown trigger '%s'", node.Trigger)}
+		}
+		used[node.Trigger] = true
+	case node.Not != nil:
+		return validateLogicNode(*node.Not, names, used)
+	default:
+		for _, child := range append(node.All, node.Any...) {
+			if err := validateLogicNode(child, names, used); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
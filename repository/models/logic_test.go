@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutomation_ValidateConditionBlocks(t *testing.T) {
+	event := "events:\n  - type: webhook\n    webhook: garden\n    conditions:\n"
+	tests := []struct {
+		name       string
+		conditions string
+		wantErr    string
+	}{
+		{
+			name:       "nested blocks",
+			conditions: "      - any:\n          - all:\n              - {field: soil, operator: \"<\", threshold: 30}\n              - {field: tank, operator: \">\", threshold: 10}\n          - not: {field: override, operator: \"!=\", threshold: 1}\n",
+			wantErr:    "actions are required",
+		},
+		{
+			name:       "block with a field",
+			conditions: "      - field: soil\n        operator: \"<\"\n        all:\n          - {field: tank, operator: \">\", threshold: 10}\n",
+			wantErr:    "exactly one of all, any or not",
+		},
+		{
+			name:       "two blocks in one entry",
+			conditions: "      - all: [{field: soil, operator: \"<\", threshold: 30}]\n        any: [{field: tank, operator: \">\", threshold: 10}]\n",
+			wantErr:    "exactly one of all, any or not",
+		},
+		{
+			name:       "invalid nested condition",
+			conditions: "      - any:\n          - not: {field: soil, operator: \"=~\", threshold: 30}\n",
+			wantErr:    "invalid operator '=~'",
+		},
+		{
+			name:       "empty not",
+			conditions: "      - not: {}\n",
+			wantErr:    "condition must have a field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			a := Automation{Definition: event + tt.conditions + "actions: []\n"}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), tt.wantErr)
+		})
+	}
+}
+
+func TestAutomation_ValidateLogic(t *testing.T) {
+	triggers := "interval: 5m\ntriggers:\n  - name: day\n    time: {after: \"08:00\", before: \"20:00\"}\n  - name: weekend\n    time: {weekdays: [sat, sun]}\n"
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    string
+	}{
+		{
+			name:       "names and nested blocks",
+			definition: triggers + "logic:\n  any:\n    - all: [day, weekend]\n    - not: {trigger: day}\n",
+			wantErr:    "actions are required",
+		},
+		{
+			name:       "unknown trigger",
+			definition: triggers + "logic:\n  all: [day, weekend, night]\n",
+			wantErr:    "logic refers to unknown trigger 'night'",
+		},
+		{
+			name:       "unused trigger",
+			definition: triggers + "logic:\n  not: day\n",
+			wantErr:    "trigger 'weekend' is not used in logic",
+		},
+		{
+			name:       "unnamed trigger",
+			definition: triggers + "  - time: {weekdays: [mon]}\nlogic:\n  all: [day, weekend]\n",
+			wantErr:    "trigger 3 must have a name",
+		},
+		{
+			name:       "duplicate names",
+			definition: triggers + "  - name: day\n    time: {weekdays: [mon]}\n",
+			wantErr:    "duplicate trigger name 'day'",
+		},
+		{
+			name:       "combined with condition_logic",
+			definition: triggers + "condition_logic: or\nlogic:\n  any: [day, weekend]\n",
+			wantErr:    "condition_logic and logic cannot be combined",
+		},
+		{
+			name:       "entry with two blocks",
+			definition: triggers + "logic:\n  all: [day]\n  any: [weekend]\n",
+			wantErr:    "exactly one of trigger, all, any or not",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			a := Automation{Definition: tt.definition + "actions: []\n"}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), tt.wantErr)
+		})
+	}
+
+	t.Run("trigger names can be written alone", func(t *testing.T) {
+		a := Automation{Definition: triggers + "logic:\n  any:\n    - all: [day, weekend]\n    - not: day\n"}
+		def, err := a.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, &LogicNode{Any: []LogicNode{
+			{All: []LogicNode{{Trigger: "day"}, {Trigger: "weekend"}}},
+			{Not: &LogicNode{Trigger: "day"}},
+		}}, def.Logic)
+	})
+}
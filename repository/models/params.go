@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	ParamString  = "string"
+	ParamNumber  = "number"
+	ParamInteger = "integer"
+	ParamBoolean = "boolean"
+)
+
+// ParamTypes lists the types an action parameter can be declared with.
+var ParamTypes = []string{ParamString, ParamNumber, ParamInteger, ParamBoolean}
+
+// ActionParameter declares a runtime parameter of an action. The action params
+// refer to it with a "{{name}}" placeholder.
+type ActionParameter struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Default  any    `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+var (
+	paramNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// ParseParameters returns the parameters declared by the action.
+func (a *Action) ParseParameters() ([]ActionParameter, error) {
+	var parameters []ActionParameter
+	if a.Parameters == "" {
+		return parameters, nil
+	}
+	if err := json.Unmarshal([]byte(a.Parameters), &parameters); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
+
+// RenderParams fills the placeholders in the action params with the given values,
+// falling back to the declared defaults, and returns the decoded params after checking
+// them against the params schema. A string that consists of a single placeholder is
+// replaced by the typed value, so {"seconds": "{{duration}}"} becomes {"seconds": 30}.
+func (a *Action) RenderParams(values map[string]any) (any, error) {
+	parameters, err := a.ParseParameters()
+	if err != nil {
+		return nil, fmt.Errorf("parsing action parameters: %w", err)
+	}
+
+	resolved, err := resolveParams(parameters, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var params any
+	if a.Params != "" {
+		if err := json.Unmarshal([]byte(a.Params), &params); err != nil {
+			return nil, fmt.Errorf("parsing action params: %w", err)
+		}
+	}
+
+	params = substitute(params, resolved)
+	if a.ParamsSchema != "" {
+		if err := validateAgainstSchema("params_schema", a.ParamsSchema, params); err != nil {
+			return nil, ValidationError{msg: "params do not match params_schema: " + err.Error()}
+		}
+	}
+
+	return params, nil
+}
+
+func resolveParams(parameters []ActionParameter, values map[string]any) (map[string]any, error) {
+	for name := range values {
+		if !slices.ContainsFunc(parameters, func(p ActionParameter) bool { return p.Name == name }) {
+			return nil, ValidationError{msg: fmt.Sprintf("unknown parameter '%s'", name)}
+		}
+	}
+
+	resolved := make(map[string]any, len(parameters))
+	for _, p := range parameters {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Required && p.Default == nil {
+				return nil, ValidationError{msg: fmt.Sprintf("missing value for parameter '%s'", p.Name)}
+			}
+			value = p.Default
+		}
+
+		if value != nil {
+			typed, ok := convertParam(p.Type, value)
+			if !ok {
+				return nil, ValidationError{msg: fmt.Sprintf("parameter '%s' must be of type %s", p.Name, p.Type)}
+			}
+			value = typed
+		}
+
+		resolved[p.Name] = value
+	}
+
+	return resolved, nil
+}
+
+// convertParam checks a value against a parameter type. Values decoded from YAML
+// arrive as Go integers, so all numbers are normalised to float64 like JSON ones.
+func convertParam(paramType string, value any) (any, bool) {
+	switch paramType {
+	case ParamString:
+		s, ok := value.(string)
+		return s, ok
+	case ParamBoolean:
+		b, ok := value.(bool)
+		return b, ok
+	case ParamNumber, ParamInteger:
+		var f float64
+		switch v := value.(type) {
+		case float64:
+			f = v
+		case int:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		case uint64:
+			f = float64(v)
+		default:
+			return nil, false
+		}
+		if paramType == ParamInteger && f != math.Trunc(f) {
+			return nil, false
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+func substitute(v any, values map[string]any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = substitute(item, values)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = substitute(item, values)
+		}
+		return v
+	case string:
+		if m := placeholderPattern.FindStringSubmatch(v); m != nil && m[0] == strings.TrimSpace(v) {
+			return values[m[1]]
+		}
+		return placeholderPattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+			name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+			if values[name] == nil {
+				return ""
+			}
+			return fmt.Sprint(values[name])
+		})
+	}
+	return v
+}
+
+// placeholders returns the parameter names referenced in the action params.
+func placeholders(params string) []string {
+	var names []string
+	for _, m := range placeholderPattern.FindAllStringSubmatch(params, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+func (a *Action) validateParameters() error {
+	parameters, err := a.ParseParameters()
+	if err != nil {
+		return ValidationError{msg: "parameters must be a list of {name, type, default, required} objects"}
+	}
+
+	var names []string
+	for _, p := range parameters {
+		if !paramNamePattern.MatchString(p.Name) {
+			return ValidationError{msg: fmt.Sprintf("invalid parameter name '%s': use letters, digits and underscores", p.Name)}
+		}
+		if slices.Contains(names, p.Name) {
+			return ValidationError{msg: fmt.Sprintf("parameter '%s' is declared more than once", p.Name)}
+		}
+		names = append(names, p.Name)
+
+		if !slices.Contains(ParamTypes, p.Type) {
+			return ValidationError{msg: fmt.Sprintf("parameter '%s' type must be one of: %s", p.Name, strings.Join(ParamTypes, ", "))}
+		}
+		if p.Default != nil {
+			if _, ok := convertParam(p.Type, p.Default); !ok {
+				return ValidationError{msg: fmt.Sprintf("default of parameter '%s' must be of type %s", p.Name, p.Type)}
+			}
+		}
+	}
+
+	for _, name := range placeholders(a.Params) {
+		if !slices.Contains(names, name) {
+			return ValidationError{msg: fmt.Sprintf("params refer to undeclared parameter '%s'", name)}
+		}
+	}
+
+	return nil
+}
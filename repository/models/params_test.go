@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAction_RenderParams(t *testing.T) {
+	action := Action{
+		Params:     `{"seconds":"{{duration}}","label":"zone {{zone}} for {{duration}}s","pins":["{{pin}}"],"fast":"{{fast}}"}`,
+		Parameters: `[{"name":"duration","type":"number","default":30},{"name":"zone","type":"string","required":true},{"name":"pin","type":"integer","default":5},{"name":"fast","type":"boolean"}]`,
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]any
+		want    any
+		wantErr string
+	}{
+		{
+			name:   "values and defaults are substituted with their types",
+			values: map[string]any{"zone": "north"},
+			want:   map[string]any{"seconds": float64(30), "label": "zone north for 30s", "pins": []any{float64(5)}, "fast": nil},
+		},
+		{
+			name:   "integers from YAML are accepted",
+			values: map[string]any{"zone": "north", "duration": 90, "pin": 2, "fast": true},
+			want:   map[string]any{"seconds": float64(90), "label": "zone north for 90s", "pins": []any{float64(2)}, "fast": true},
+		},
+		{
+			name:    "missing required value",
+			values:  nil,
+			wantErr: "missing value for parameter 'zone'",
+		},
+		{
+			name:    "string for number",
+			values:  map[string]any{"zone": "north", "duration": "30"},
+			wantErr: "parameter 'duration' must be of type number",
+		},
+		{
+			name:    "fraction for integer",
+			values:  map[string]any{"zone": "north", "pin": 2.5},
+			wantErr: "parameter 'pin' must be of type integer",
+		},
+		{
+			name:    "unknown parameter",
+			values:  map[string]any{"zone": "north", "speed": 1},
+			wantErr: "unknown parameter 'speed'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := action.RenderParams(tt.values)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.IsType(t, ValidationError{}, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("action without parameters", func(t *testing.T) {
+		got, err := (&Action{Params: `{"pin":5}`}).RenderParams(nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"pin": float64(5)}, got)
+	})
+}
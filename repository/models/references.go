@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of records an automation definition refers to by name. They match the YAML
+// keys holding the names.
+const (
+	RefDevice     = "device"
+	RefAction     = "action"
+	RefGroup      = "group"
+	RefAutomation = "automation"
+)
+
+// Refers reports whether the definition names the device, action, group or
+// automation anywhere in its events, triggers or actions. Automations are only
+// named by automation_finished events.
+func (d *AutomationDefinition) Refers(kind, name string) bool {
+	for _, event := range d.Events {
+		if kind == RefDevice && event.Device == name {
+			return true
+		}
+		if kind == RefAutomation && event.Automation == name {
+			return true
+		}
+	}
+	for _, trigger := range d.Triggers {
+		if referenceOf(kind, trigger.Device, trigger.Action, trigger.Group) == name {
+			return true
+		}
+	}
+	for _, action := range d.Actions {
+		if referenceOf(kind, action.Device, action.Action, action.Group) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func referenceOf(kind, device, action, group string) string {
+	switch kind {
+	case RefDevice:
+		return device
+	case RefAction:
+		return action
+	case RefGroup:
+		return group
+	}
+	return ""
+}
+
+// RenameReferences replaces every reference to oldName of the given kind with
+// newName. The definition is edited in place, so comments and layout are kept. It
+// reports whether anything was renamed.
+func (a *Automation) RenameReferences(kind, oldName, newName string) (bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(a.Definition), &doc); err != nil {
+		return false, fmt.Errorf("parsing definition of automation '%s': %w", a.Name, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, nil
+	}
+
+	renamed := false
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		section := root.Content[i].Value
+		if section != "events" && section != "triggers" && section != "actions" {
+			continue
+		}
+		for _, item := range root.Content[i+1].Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				key, value := item.Content[j], item.Content[j+1]
+				if key.Value == kind && value.Kind == yaml.ScalarNode && value.Value == oldName {
+					value.Value = newName
+					renamed = true
+				}
+			}
+		}
+	}
+	if !renamed {
+		return false, nil
+	}
+
+	var out strings.Builder
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return false, fmt.Errorf("writing definition of automation '%s': %w", a.Name, err)
+	}
+	a.Definition = out.String()
+	return true, nil
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const referencesDefinition = `interval: 5m
+events:
+  - type: device_reported
+    device: sensor
+  - type: automation_finished
+    automation: heat-up
+triggers:
+  - device: sensor
+    action: read_temp
+    conditions:
+      - field: temperature
+        operator: ">"
+        threshold: 25
+  - group: fans
+    action: read_speed
+    conditions:
+      - field: speed
+        operator: "<"
+        threshold: 1
+actions:
+  # cool the greenhouse down
+  - device: fan
+    action: fan_on
+`
+
+func TestAutomationDefinition_Refers(t *testing.T) {
+	automation := Automation{Definition: referencesDefinition}
+	def, err := automation.ParseDefinition()
+	require.NoError(t, err)
+
+	tests := []struct {
+		kind string
+		name string
+		want bool
+	}{
+		{kind: RefDevice, name: "sensor", want: true},
+		{kind: RefDevice, name: "fan", want: true},
+		{kind: RefDevice, name: "fans", want: false},
+		{kind: RefAction, name: "read_speed", want: true},
+		{kind: RefAction, name: "fan_on", want: true},
+		{kind: RefAction, name: "sensor", want: false},
+		{kind: RefGroup, name: "fans", want: true},
+		{kind: RefGroup, name: "fan", want: false},
+		{kind: RefAutomation, name: "heat-up", want: true},
+		{kind: RefAutomation, name: "sensor", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, def.Refers(tt.kind, tt.name))
+		})
+	}
+}
+
+func TestAutomation_RenameReferences(t *testing.T) {
+	t.Run("renames every reference and keeps comments", func(t *testing.T) {
+		automation := Automation{Name: "cool-down", Definition: referencesDefinition}
+
+		renamed, err := automation.RenameReferences(RefDevice, "sensor", "greenhouse-sensor")
+		require.NoError(t, err)
+		assert.True(t, renamed)
+		assert.Contains(t, automation.Definition, "# cool the greenhouse down")
+
+		def, err := automation.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, "greenhouse-sensor", def.Events[0].Device)
+		assert.Equal(t, "greenhouse-sensor", def.Triggers[0].Device)
+		assert.Equal(t, "read_temp", def.Triggers[0].Action)
+		assert.Equal(t, "fan", def.Actions[0].Device)
+		assert.False(t, def.Refers(RefDevice, "sensor"))
+	})
+
+	t.Run("renames automations in events", func(t *testing.T) {
+		automation := Automation{Name: "cool-down", Definition: referencesDefinition}
+
+		renamed, err := automation.RenameReferences(RefAutomation, "heat-up", "warm-up")
+		require.NoError(t, err)
+		assert.True(t, renamed)
+
+		def, err := automation.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, "warm-up", def.Events[1].Automation)
+		assert.Equal(t, "sensor", def.Events[0].Device)
+	})
+
+	t.Run("only renames the given kind", func(t *testing.T) {
+		automation := Automation{Definition: "triggers: []\nactions:\n  - device: fan\n    action: fan\n"}
+
+		renamed, err := automation.RenameReferences(RefAction, "fan", "fan_on")
+		require.NoError(t, err)
+		assert.True(t, renamed)
+		assert.Equal(t, "triggers: []\nactions:\n  - device: fan\n    action: fan_on\n", automation.Definition)
+	})
+
+	t.Run("unreferenced name leaves the definition untouched", func(t *testing.T) {
+		automation := Automation{Definition: referencesDefinition}
+
+		renamed, err := automation.RenameReferences(RefGroup, "pumps", "water-pumps")
+		require.NoError(t, err)
+		assert.False(t, renamed)
+		assert.Equal(t, referencesDefinition, automation.Definition)
+	})
+
+	t.Run("invalid YAML returns error", func(t *testing.T) {
+		automation := Automation{Name: "broken", Definition: "actions: ["}
+
+		_, err := automation.RenameReferences(RefDevice, "fan", "fan-1")
+		assert.ErrorContains(t, err, "parsing definition of automation 'broken'")
+	})
+}
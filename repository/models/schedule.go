@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones must resolve on hosts without a zoneinfo database
+
+	"github.com/robfig/cron/v3"
+	"github.com/tender-barbarian/gniotek/solar"
+	"gopkg.in/yaml.v3"
+)
+
+// cronParser accepts standard five-field cron expressions, an optional leading
+// seconds field, and descriptors such as @daily.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedules holds the cron expressions an automation runs at. A single expression
+// can be written as a plain string instead of a list.
+type Schedules []string
+
+func (s *Schedules) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = Schedules{node.Value}
+		return nil
+	}
+
+	var exprs []string
+	if err := node.Decode(&exprs); err != nil {
+		return err
+	}
+	*s = exprs
+	return nil
+}
+
+// Schedule is the parsed schedule of an automation. It fires at every time matched
+// by any of its cron expressions and at each of its sun times.
+type Schedule struct {
+	specs []*cron.SpecSchedule
+	sun   []SunTime
+	site  *solar.Site
+}
+
+// Next returns the first fire time strictly after t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, spec := range s.specs {
+		if n := spec.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	for _, sunTime := range s.sun {
+		if n := sunTime.next(s.site, t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// Location returns the timezone schedules and time triggers are evaluated in: the
+// definition's timezone, else the site's timezone, else the server's local time.
+func (d *AutomationDefinition) Location(site *solar.Site) (*time.Location, error) {
+	if d.Timezone == "" {
+		if site != nil {
+			return site.Location, nil
+		}
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone '%s'", d.Timezone)
+	}
+	return loc, nil
+}
+
+// ParseSchedule parses the cron expressions and sun times of the definition. Cron
+// expressions are evaluated in the definition's Location. It returns nil when the
+// definition has no schedule, and ErrNoSite, after checking every expression, when
+// it has sun times but site is nil.
+func (d *AutomationDefinition) ParseSchedule(site *solar.Site) (*Schedule, error) {
+	if len(d.Schedule) == 0 {
+		return nil, nil
+	}
+
+	loc, err := d.Location(site)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &Schedule{site: site}
+	for _, expr := range d.Schedule {
+		expr = strings.TrimSpace(expr)
+		if sunTime, ok, err := parseSunTime(expr); ok {
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule: %w", err)
+			}
+			schedule.sun = append(schedule.sun, sunTime)
+			continue
+		}
+
+		ownTimezone := strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=")
+		if d.Timezone != "" && ownTimezone {
+			return nil, fmt.Errorf("schedule '%s' sets its own timezone; remove it or the timezone field", expr)
+		}
+
+		parsed, err := cronParser.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %w", expr, err)
+		}
+
+		// @every repeats from the previous run, which is what interval is for
+		spec, ok := parsed.(*cron.SpecSchedule)
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule '%s': use interval for repeating runs", expr)
+		}
+		if !ownTimezone {
+			spec.Location = loc
+		}
+		if spec.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("schedule '%s' never fires", expr)
+		}
+		schedule.specs = append(schedule.specs, spec)
+	}
+
+	if len(schedule.sun) > 0 && site == nil {
+		return nil, ErrNoSite
+	}
+	return schedule, nil
+}
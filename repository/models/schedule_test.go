@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutomationDefinition_ParseSchedule(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	t.Run("single expression as a string", func(t *testing.T) {
+		a := Automation{Definition: "schedule: \"0 30 6 * * *\"\ntimezone: Europe/Berlin\n"}
+		def, err := a.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, Schedules{"0 30 6 * * *"}, def.Schedule)
+
+		schedule, err := def.ParseSchedule(nil)
+		require.NoError(t, err)
+		next := schedule.Next(time.Date(2026, 3, 1, 6, 30, 0, 0, berlin))
+		assert.Equal(t, time.Date(2026, 3, 2, 6, 30, 0, 0, berlin), next)
+	})
+
+	t.Run("earliest of several expressions", func(t *testing.T) {
+		a := Automation{Definition: "schedule:\n  - \"30 6 * * *\"\n  - \"0 19 * * *\"\ntimezone: Europe/Berlin\n"}
+		def, err := a.ParseDefinition()
+		require.NoError(t, err)
+
+		schedule, err := def.ParseSchedule(nil)
+		require.NoError(t, err)
+		from := time.Date(2026, 3, 1, 7, 0, 0, 0, berlin)
+		assert.Equal(t, time.Date(2026, 3, 1, 19, 0, 0, 0, berlin), schedule.Next(from))
+		assert.Equal(t, time.Date(2026, 3, 2, 6, 30, 0, 0, berlin), schedule.Next(schedule.Next(from)))
+	})
+
+	t.Run("timezone follows daylight saving", func(t *testing.T) {
+		def := AutomationDefinition{Schedule: Schedules{"0 0 12 * * *"}, Timezone: "Europe/Berlin"}
+		schedule, err := def.ParseSchedule(nil)
+		require.NoError(t, err)
+
+		winter := schedule.Next(time.Date(2026, 3, 27, 13, 0, 0, 0, time.UTC))
+		summer := schedule.Next(winter)
+		assert.Equal(t, 11, winter.UTC().Hour())
+		assert.Equal(t, 10, summer.UTC().Hour())
+	})
+
+	t.Run("no schedule", func(t *testing.T) {
+		def := AutomationDefinition{Interval: "5m"}
+		schedule, err := def.ParseSchedule(nil)
+		require.NoError(t, err)
+		assert.Nil(t, schedule)
+	})
+
+	tests := []struct {
+		name    string
+		def     AutomationDefinition
+		wantErr string
+	}{
+		{name: "invalid expression", def: AutomationDefinition{Schedule: Schedules{"61 * * * *"}}, wantErr: "invalid schedule '61 * * * *'"},
+		{name: "unknown timezone", def: AutomationDefinition{Schedule: Schedules{"@daily"}, Timezone: "Mars/Olympus"}, wantErr: "unknown timezone 'Mars/Olympus'"},
+		{name: "every descriptor", def: AutomationDefinition{Schedule: Schedules{"@every 1h"}}, wantErr: "use interval for repeating runs"},
+		{name: "two timezones", def: AutomationDefinition{Schedule: Schedules{"CRON_TZ=UTC 0 6 * * *"}, Timezone: "Europe/Berlin"}, wantErr: "sets its own timezone"},
+		{name: "never fires", def: AutomationDefinition{Schedule: Schedules{"0 0 30 2 *"}}, wantErr: "never fires"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.def.ParseSchedule(nil)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAutomation_ValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    string
+	}{
+		{
+			name:       "schedule without interval",
+			definition: "schedule: \"0 30 6 * * *\"\ntimezone: UTC\nactions: []\n",
+			wantErr:    "actions are required",
+		},
+		{
+			name:       "schedule with interval",
+			definition: "interval: 5m\nschedule: \"0 30 6 * * *\"\n",
+			wantErr:    "interval and schedule cannot be combined",
+		},
+		{
+			name:       "invalid schedule",
+			definition: "schedule: \"every morning\"\n",
+			wantErr:    "invalid schedule 'every morning'",
+		},
+		{
+			name:       "unknown timezone without schedule",
+			definition: "interval: 5m\ntimezone: Mars/Olympus\n",
+			wantErr:    "unknown timezone 'Mars/Olympus'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			a := Automation{Definition: tt.definition}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// schemaKey identifies a compiled schema by its name and document.
+type schemaKey struct {
+	name, doc string
+}
+
+// compiledSchemas caches compiled schemas, since params and results are checked on
+// every call and documents rarely change.
+var compiledSchemas sync.Map
+
+// compileSchema compiles a JSON Schema document, or returns it from the cache when the
+// same document was compiled before. The name is used in error messages.
+func compileSchema(name, doc string) (*jsonschema.Schema, error) {
+	key := schemaKey{name: name, doc: doc}
+	if schema, ok := compiledSchemas.Load(key); ok {
+		return schema.(*jsonschema.Schema), nil
+	}
+
+	schema, err := compileSchemaDoc(name, doc)
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.Store(key, schema)
+	return schema, nil
+}
+
+func compileSchemaDoc(name, doc string) (*jsonschema.Schema, error) {
+	schemaDoc, err := jsonschema.UnmarshalJSON(strings.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	url := "mem:///" + name
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(url, schemaDoc); err != nil {
+		return nil, err
+	}
+
+	return c.Compile(url)
+}
+
+// validateAgainstSchema checks a decoded JSON value against a schema document and
+// returns the violations in a single line, e.g. "at '/seconds': got string, want integer".
+func validateAgainstSchema(name, doc string, value any) error {
+	schema, err := compileSchema(name, doc)
+	if err != nil {
+		return fmt.Errorf("compiling %s: %w", name, err)
+	}
+
+	// Round-trip through JSON so Go values from YAML or callers look like decoded JSON
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+
+	if err := schema.Validate(instance); err != nil {
+		return fmt.Errorf("%s", schemaViolations(err))
+	}
+
+	return nil
+}
+
+// schemaViolations drops the header line of a jsonschema error and joins the rest.
+func schemaViolations(err error) string {
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) > 1 {
+		lines = lines[1:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(strings.TrimSpace(line), "- ")
+	}
+	return strings.Join(lines, "; ")
+}
+
+// ValidateResult checks a device result against the action's result schema, if any.
+func (a *Action) ValidateResult(result json.RawMessage) error {
+	if a.ResultSchema == "" {
+		return nil
+	}
+
+	var value any
+	if len(result) > 0 {
+		if err := json.Unmarshal(result, &value); err != nil {
+			return fmt.Errorf("decoding result: %w", err)
+		}
+	}
+
+	return validateAgainstSchema("result_schema", a.ResultSchema, value)
+}
+
+func (a *Action) validateSchemas() error {
+	schemas := []struct{ name, doc string }{
+		{"params_schema", a.ParamsSchema},
+		{"result_schema", a.ResultSchema},
+	}
+	for _, schema := range schemas {
+		if schema.doc == "" {
+			continue
+		}
+		if _, err := compileSchema(schema.name, schema.doc); err != nil {
+			return ValidationError{msg: fmt.Sprintf("%s must be a valid JSON Schema: %s", schema.name, schemaViolations(err))}
+		}
+	}
+
+	if a.ParamsSchema == "" || a.hasRequiredParameters() {
+		return nil
+	}
+
+	// Params rendered with their defaults must conform to the schema
+	_, err := a.RenderParams(nil)
+	return err
+}
+
+// hasRequiredParameters reports whether the params can only be rendered with runtime values.
+func (a *Action) hasRequiredParameters() bool {
+	parameters, err := a.ParseParameters()
+	if err != nil {
+		return false
+	}
+	for _, p := range parameters {
+		if p.Required && p.Default == nil {
+			return true
+		}
+	}
+	return false
+}
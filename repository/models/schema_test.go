@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const temperatureSchema = `{"type":"object","properties":{"temperature":{"type":"number"}},"required":["temperature"]}`
+
+func TestAction_ValidateResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		result  string
+		wantErr string
+	}{
+		{name: "no schema accepts anything", schema: "", result: `"anything"`},
+		{name: "conforming result", schema: temperatureSchema, result: `{"temperature":21.5}`},
+		{name: "wrong type", schema: temperatureSchema, result: `{"temperature":"warm"}`, wantErr: "at '/temperature': got string, want number"},
+		{name: "missing field", schema: temperatureSchema, result: `{"humidity":40}`, wantErr: "at '': missing property 'temperature'"},
+		{name: "missing result", schema: temperatureSchema, result: ``, wantErr: "at '': got null, want object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := Action{ResultSchema: tt.schema}
+			err := action.ValidateResult(json.RawMessage(tt.result))
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAction_RenderParamsSchema(t *testing.T) {
+	action := Action{
+		Params:       `{"seconds":"{{duration}}"}`,
+		Parameters:   `[{"name":"duration","type":"integer","default":30}]`,
+		ParamsSchema: `{"type":"object","properties":{"seconds":{"type":"integer","maximum":600}}}`,
+	}
+
+	params, err := action.RenderParams(map[string]any{"duration": 90})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"seconds": float64(90)}, params)
+
+	_, err = action.RenderParams(map[string]any{"duration": 900})
+	assert.EqualError(t, err, "params do not match params_schema: at '/seconds': maximum: got 900, want 600")
+	assert.IsType(t, ValidationError{}, err)
+}
+
+func TestCompileSchema_Cache(t *testing.T) {
+	first, err := compileSchema("result_schema", temperatureSchema)
+	require.NoError(t, err)
+	second, err := compileSchema("result_schema", temperatureSchema)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	other, err := compileSchema("result_schema", `{"type":"object"}`)
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	_, err = compileSchema("result_schema", `{"type":`)
+	require.Error(t, err)
+	_, cached := compiledSchemas.Load(schemaKey{name: "result_schema", doc: `{"type":`})
+	assert.False(t, cached)
+}
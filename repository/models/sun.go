@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/solar"
+)
+
+// ErrNoSite is returned when an automation refers to the sun but no site location is
+// configured.
+var ErrNoSite = errors.New("sunrise and sunset need a site location; set SITE_LATITUDE and SITE_LONGITUDE")
+
+type siteKey struct{}
+
+// WithSite returns a copy of ctx carrying the site automations are validated
+// against. Without one, automations that refer to the sun are rejected.
+func WithSite(ctx context.Context, site *solar.Site) context.Context {
+	return context.WithValue(ctx, siteKey{}, site)
+}
+
+func siteFrom(ctx context.Context) *solar.Site {
+	site, _ := ctx.Value(siteKey{}).(*solar.Site)
+	return site
+}
+
+// Sun states a time window can require.
+const (
+	SunUp   = "up"
+	SunDown = "down"
+)
+
+// maxSunOffset bounds the offset of a sun time, so that it stays close to its day.
+const maxSunOffset = 12 * time.Hour
+
+var sunTimePattern = regexp.MustCompile(`^(sunrise|sunset)(?:\s*([+-])\s*(\S+))?$`)
+
+// SunTime is a time relative to sunrise or sunset, written as "sunrise", "sunset-30m"
+// or "sunrise+1h".
+type SunTime struct {
+	Event  string
+	Offset time.Duration
+}
+
+// parseSunTime parses s as a sun time. ok is false when s doesn't refer to the sun.
+func parseSunTime(s string) (sunTime SunTime, ok bool, err error) {
+	match := sunTimePattern.FindStringSubmatch(s)
+	if match == nil {
+		return SunTime{}, false, nil
+	}
+
+	sunTime.Event = match[1]
+	if match[2] != "" {
+		sunTime.Offset, err = time.ParseDuration(match[3])
+		if err != nil || sunTime.Offset < 0 || sunTime.Offset >= maxSunOffset {
+			return SunTime{}, true, fmt.Errorf("invalid offset in '%s': must be a duration below %s, e.g. '30m'", s, maxSunOffset)
+		}
+		if match[2] == "-" {
+			sunTime.Offset = -sunTime.Offset
+		}
+	}
+	return sunTime, true, nil
+}
+
+// On returns the sun time on the day of date at the site. ok is false when the sun
+// doesn't rise or set that day.
+func (t SunTime) On(site *solar.Site, date time.Time) (time.Time, bool) {
+	at, ok := site.Event(t.Event, date)
+	if !ok {
+		return time.Time{}, false
+	}
+	return at.Add(t.Offset), true
+}
+
+// next returns the first sun time strictly after after.
+func (t SunTime) next(site *solar.Site, after time.Time) time.Time {
+	day := after.In(site.Location)
+	// Polar nights can go without a sunrise for months
+	for i := -1; i <= 366; i++ {
+		if at, ok := t.On(site, day.AddDate(0, 0, i)); ok && at.After(after) {
+			return at
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/solar"
+)
+
+func TestParseSunTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SunTime
+		wantOK  bool
+		wantErr string
+	}{
+		{in: "sunrise", want: SunTime{Event: solar.Sunrise}, wantOK: true},
+		{in: "sunset-30m", want: SunTime{Event: solar.Sunset, Offset: -30 * time.Minute}, wantOK: true},
+		{in: "sunrise + 1h15m", want: SunTime{Event: solar.Sunrise, Offset: 75 * time.Minute}, wantOK: true},
+		{in: "sunset+soon", wantOK: true, wantErr: "invalid offset in 'sunset+soon'"},
+		{in: "sunset+12h", wantOK: true, wantErr: "invalid offset"},
+		{in: "0 30 6 * * *", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok, err := parseSunTime(tt.in)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSunSchedule(t *testing.T) {
+	berlin, err := solar.NewSite(52.52, 13.405, "Europe/Berlin")
+	require.NoError(t, err)
+
+	t.Run("next sun time", func(t *testing.T) {
+		def := AutomationDefinition{Schedule: Schedules{"sunset-30m", "0 0 23 * * *"}}
+		schedule, err := def.ParseSchedule(berlin)
+		require.NoError(t, err)
+
+		midsummer := time.Date(2026, 6, 21, 12, 0, 0, 0, berlin.Location)
+		next := schedule.Next(midsummer)
+		assert.WithinDuration(t, time.Date(2026, 6, 21, 21, 3, 0, 0, berlin.Location), next, 2*time.Minute)
+
+		// The cron expression runs in the site's timezone and comes next
+		assert.Equal(t, time.Date(2026, 6, 21, 23, 0, 0, 0, berlin.Location), schedule.Next(next))
+		tomorrow := schedule.Next(schedule.Next(next))
+		assert.Equal(t, 22, tomorrow.Day())
+	})
+
+	t.Run("sun times need a site", func(t *testing.T) {
+		def := AutomationDefinition{Schedule: Schedules{"sunrise"}}
+		_, err := def.ParseSchedule(nil)
+		assert.ErrorIs(t, err, ErrNoSite)
+	})
+
+	t.Run("validation needs a site for sun times", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		a := Automation{Definition: "schedule: sunset+15m\nactions: []\n"}
+		assert.ErrorContains(t, a.Validate(context.Background(), db), ErrNoSite.Error())
+		assert.ErrorContains(t, a.Validate(WithSite(context.Background(), berlin), db), "actions are required")
+
+		a = Automation{Definition: "schedule: sunset+forever\nactions: []\n"}
+		assert.ErrorContains(t, a.Validate(WithSite(context.Background(), berlin), db), "invalid offset")
+	})
+
+	t.Run("validation needs a site for sun windows", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		for _, window := range []string{"{sun: up}", "{after: sunset}", "{after: '08:00', before: sunrise+1h}"} {
+			a := Automation{Definition: "interval: 1m\ntriggers:\n  - time: " + window + "\nactions: []\n"}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), ErrNoSite.Error(), window)
+			assert.ErrorContains(t, a.Validate(WithSite(context.Background(), berlin), db), "actions are required", window)
+		}
+	})
+}
+
+func TestTimeWindow_Sun(t *testing.T) {
+	berlin, err := solar.NewSite(52.52, 13.405, "Europe/Berlin")
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 6, 21, hour, minute, 0, 0, berlin.Location)
+	}
+
+	tests := []struct {
+		name   string
+		window TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		{name: "sun is up at noon", window: TimeWindow{Sun: SunUp}, t: at(12, 0), want: true},
+		{name: "sun is down at night", window: TimeWindow{Sun: SunUp}, t: at(23, 0), want: false},
+		{name: "night window", window: TimeWindow{After: "sunset", Before: "sunrise"}, t: at(2, 0), want: true},
+		{name: "night window at noon", window: TimeWindow{After: "sunset", Before: "sunrise"}, t: at(12, 0), want: false},
+		{name: "before sunset with offset", window: TimeWindow{After: "18:00", Before: "sunset-1h"}, t: at(20, 45), want: false},
+		{name: "evening window", window: TimeWindow{After: "18:00", Before: "sunset-1h"}, t: at(20, 15), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.window.Validate())
+			assert.True(t, tt.window.UsesSun())
+			assert.Equal(t, tt.want, tt.window.Matches(tt.t, berlin))
+		})
+	}
+
+	t.Run("invalid sun state", func(t *testing.T) {
+		assert.ErrorContains(t, (&TimeWindow{Sun: "shining"}).Validate(), "sun must be 'up' or 'down'")
+	})
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// validateTimeout checks an optional device call timeout such as "2s" or "1m30s".
+func validateTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return ValidationError{msg: "timeout must be a positive duration, e.g. '2s' or '1m'"}
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/solar"
+)
+
+// TimeWindow is a trigger that checks the time the automation runs at instead of
+// reading a device. Every field that is set must match. Times and dates are in the
+// automation's timezone.
+type TimeWindow struct {
+	// After and Before bound the time of day, e.g. "08:00" and "20:00", or a sun
+	// time such as "sunset-30m". After is inclusive and Before exclusive; a window
+	// with Before earlier than After spans midnight.
+	After  string `yaml:"after,omitempty"`
+	Before string `yaml:"before,omitempty"`
+	// Sun requires the sun to be "up" or "down".
+	Sun string `yaml:"sun,omitempty"`
+	// Weekdays lists the days the window is open, e.g. ["mon", "tue"].
+	Weekdays []string `yaml:"weekdays,omitempty"`
+	// From and To bound the date, both inclusive. Dates are either "2026-06-01" or
+	// "06-01" for every year; a yearly range with To earlier than From spans the new year.
+	From string `yaml:"from,omitempty"`
+	To   string `yaml:"to,omitempty"`
+	// Except lists dates the window is closed on, in the same formats as From.
+	Except []string `yaml:"except,omitempty"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// windowDate is a date of a time window. Year is 0 for dates that recur every year.
+type windowDate struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func parseWindowDate(s string) (windowDate, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return windowDate{year: t.Year(), month: t.Month(), day: t.Day()}, nil
+	}
+	// Parsed in a leap year so that "02-29" is accepted
+	if t, err := time.Parse("2006-01-02", "2024-"+s); err == nil {
+		return windowDate{month: t.Month(), day: t.Day()}, nil
+	}
+	return windowDate{}, fmt.Errorf("invalid date '%s': must be YYYY-MM-DD or MM-DD", s)
+}
+
+// key orders dates; yearly dates only compare with the month and day of t.
+func (d windowDate) key(t time.Time) int {
+	if d.year == 0 {
+		return int(t.Month())*100 + t.Day()
+	}
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func (d windowDate) value() int {
+	return d.year*10000 + int(d.month)*100 + d.day
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time '%s': must be HH:MM or HH:MM:SS", s)
+}
+
+// parseBound parses a bound of the time of day, either a clock time or a sun time.
+func parseBound(s string) (time.Duration, *SunTime, error) {
+	if sunTime, ok, err := parseSunTime(s); ok {
+		return 0, &sunTime, err
+	}
+	d, err := parseTimeOfDay(s)
+	return d, nil, err
+}
+
+// resolveBound returns a bound as the time since midnight on the day of t. ok is
+// false when its sun time doesn't happen that day.
+func resolveBound(s string, t time.Time, site *solar.Site) (time.Duration, bool) {
+	d, sunTime, _ := parseBound(s)
+	if sunTime == nil {
+		return d, true
+	}
+	at, ok := sunTime.On(site, t)
+	if !ok {
+		return 0, false
+	}
+	at = at.In(t.Location())
+	return time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute + time.Duration(at.Second())*time.Second, true
+}
+
+// UsesSun reports whether the window needs the site location to be evaluated.
+func (w *TimeWindow) UsesSun() bool {
+	for _, bound := range []string{w.After, w.Before} {
+		if _, ok, _ := parseSunTime(bound); ok {
+			return true
+		}
+	}
+	return w.Sun != ""
+}
+
+// Validate checks the fields of the window.
+func (w *TimeWindow) Validate() error {
+	if w.After == "" && w.Before == "" && w.Sun == "" && len(w.Weekdays) == 0 && w.From == "" && w.To == "" && len(w.Except) == 0 {
+		return ValidationError{msg: "time triggers must set after, before, sun, weekdays, from, to or except"}
+	}
+
+	var after, before time.Duration
+	var afterSun, beforeSun *SunTime
+	var err error
+	if w.After != "" {
+		if after, afterSun, err = parseBound(w.After); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	}
+	if w.Before != "" {
+		if before, beforeSun, err = parseBound(w.Before); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	}
+	if w.After != "" && w.Before != "" && afterSun == nil && beforeSun == nil && after == before {
+		return ValidationError{msg: "after and before must differ"}
+	}
+
+	if w.Sun != "" && w.Sun != SunUp && w.Sun != SunDown {
+		return ValidationError{msg: fmt.Sprintf("sun must be '%s' or '%s'", SunUp, SunDown)}
+	}
+
+	for _, day := range w.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return ValidationError{msg: fmt.Sprintf("invalid weekday '%s': must be one of mon, tue, wed, thu, fri, sat, sun", day)}
+		}
+	}
+
+	var from, to windowDate
+	if w.From != "" {
+		if from, err = parseWindowDate(w.From); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	}
+	if w.To != "" {
+		if to, err = parseWindowDate(w.To); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	}
+	if w.From != "" && w.To != "" {
+		if (from.year == 0) != (to.year == 0) {
+			return ValidationError{msg: "from and to must both have a year or both recur every year"}
+		}
+		if from.year != 0 && to.value() < from.value() {
+			return ValidationError{msg: "to must not be before from"}
+		}
+	}
+
+	for _, date := range w.Except {
+		if _, err := parseWindowDate(date); err != nil {
+			return ValidationError{msg: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether t, in the automation's timezone, falls in the window. The
+// window must be valid, and site must be set when it uses the sun. A bound on a sun
+// time that doesn't happen that day, as in polar summers, closes the window.
+func (w *TimeWindow) Matches(t time.Time, site *solar.Site) bool {
+	if w.Sun != "" && site.IsUp(t) != (w.Sun == SunUp) {
+		return false
+	}
+
+	if w.After != "" || w.Before != "" {
+		now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+		var after, before time.Duration
+		var ok bool
+		if w.After != "" {
+			if after, ok = resolveBound(w.After, t, site); !ok {
+				return false
+			}
+		}
+		if w.Before != "" {
+			if before, ok = resolveBound(w.Before, t, site); !ok {
+				return false
+			}
+		}
+		switch {
+		case w.Before == "":
+			if now < after {
+				return false
+			}
+		case w.After == "" || after < before:
+			if now < after || now >= before {
+				return false
+			}
+		default:
+			if now < after && now >= before {
+				return false
+			}
+		}
+	}
+
+	if len(w.Weekdays) > 0 {
+		open := false
+		for _, day := range w.Weekdays {
+			if weekdayNames[strings.ToLower(day)] == t.Weekday() {
+				open = true
+				break
+			}
+		}
+		if !open {
+			return false
+		}
+	}
+
+	if w.From != "" || w.To != "" {
+		from, _ := parseWindowDate(w.From)
+		to, _ := parseWindowDate(w.To)
+		switch {
+		case w.To == "":
+			if from.key(t) < from.value() {
+				return false
+			}
+		case w.From == "":
+			if to.key(t) > to.value() {
+				return false
+			}
+		case from.value() <= to.value():
+			if from.key(t) < from.value() || to.key(t) > to.value() {
+				return false
+			}
+		default:
+			if from.key(t) < from.value() && to.key(t) > to.value() {
+				return false
+			}
+		}
+	}
+
+	for _, date := range w.Except {
+		if except, err := parseWindowDate(date); err == nil && except.key(t) == except.value() {
+			return false
+		}
+	}
+
+	return true
+}
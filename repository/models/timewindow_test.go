@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeWindow_Matches(t *testing.T) {
+	// 2026-03-04 is a Wednesday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		{name: "inside time of day", window: TimeWindow{After: "08:00", Before: "20:00"}, t: at(3, 4, 8, 0), want: true},
+		{name: "before is exclusive", window: TimeWindow{After: "08:00", Before: "20:00"}, t: at(3, 4, 20, 0), want: false},
+		{name: "after midnight in overnight window", window: TimeWindow{After: "22:00", Before: "06:00"}, t: at(3, 4, 2, 30), want: true},
+		{name: "midday outside overnight window", window: TimeWindow{After: "22:00", Before: "06:00"}, t: at(3, 4, 12, 0), want: false},
+		{name: "only after", window: TimeWindow{After: "18:30"}, t: at(3, 4, 18, 29), want: false},
+		{name: "weekday", window: TimeWindow{Weekdays: []string{"mon", "Wed", "fri"}}, t: at(3, 4, 12, 0), want: true},
+		{name: "weekend day", window: TimeWindow{Weekdays: []string{"sat", "sun"}}, t: at(3, 4, 12, 0), want: false},
+		{name: "inside date range", window: TimeWindow{From: "2026-03-01", To: "2026-03-04"}, t: at(3, 4, 23, 59), want: true},
+		{name: "after date range", window: TimeWindow{From: "2026-03-01", To: "2026-03-03"}, t: at(3, 4, 0, 0), want: false},
+		{name: "yearly range across new year", window: TimeWindow{From: "11-01", To: "03-15"}, t: at(3, 4, 12, 0), want: true},
+		{name: "outside yearly range", window: TimeWindow{From: "06-01", To: "08-31"}, t: at(3, 4, 12, 0), want: false},
+		{name: "open ended range", window: TimeWindow{From: "2026-01-01"}, t: at(3, 4, 12, 0), want: true},
+		{name: "excluded date", window: TimeWindow{Weekdays: []string{"wed"}, Except: []string{"2026-03-04"}}, t: at(3, 4, 12, 0), want: false},
+		{name: "excluded yearly date", window: TimeWindow{Except: []string{"03-04"}}, t: at(3, 4, 12, 0), want: false},
+		{name: "other excluded date", window: TimeWindow{Except: []string{"12-25"}}, t: at(3, 4, 12, 0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.window.Validate())
+			assert.Equal(t, tt.want, tt.window.Matches(tt.t, nil))
+		})
+	}
+}
+
+func TestTimeWindow_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  TimeWindow
+		wantErr string
+	}{
+		{name: "empty window", window: TimeWindow{}, wantErr: "time triggers must set"},
+		{name: "invalid time", window: TimeWindow{After: "8am"}, wantErr: "invalid time '8am'"},
+		{name: "equal bounds", window: TimeWindow{After: "08:00", Before: "08:00:00"}, wantErr: "after and before must differ"},
+		{name: "invalid weekday", window: TimeWindow{Weekdays: []string{"weekday"}}, wantErr: "invalid weekday 'weekday'"},
+		{name: "invalid date", window: TimeWindow{From: "2026-02-30"}, wantErr: "invalid date '2026-02-30'"},
+		{name: "mixed date formats", window: TimeWindow{From: "2026-06-01", To: "08-31"}, wantErr: "both have a year"},
+		{name: "reversed dates", window: TimeWindow{From: "2026-08-31", To: "2026-06-01"}, wantErr: "to must not be before from"},
+		{name: "invalid exception", window: TimeWindow{Except: []string{"christmas"}}, wantErr: "invalid date 'christmas'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, tt.window.Validate(), tt.wantErr)
+		})
+	}
+
+	t.Run("leap day recurs every year", func(t *testing.T) {
+		assert.NoError(t, (&TimeWindow{Except: []string{"02-29"}}).Validate())
+	})
+}
+
+func TestAutomation_ValidateTimeTrigger(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    string
+	}{
+		{
+			name:       "time trigger needs no device",
+			definition: "interval: 5m\ntriggers:\n  - time:\n      after: \"08:00\"\n      before: \"20:00\"\n      weekdays: [mon, tue, wed, thu, fri]\nactions: []\n",
+			wantErr:    "actions are required",
+		},
+		{
+			name:       "time trigger with a device",
+			definition: "interval: 5m\ntriggers:\n  - device: sensor\n    action: read_temp\n    time:\n      after: \"08:00\"\n",
+			wantErr:    "time triggers must not read a device or have conditions",
+		},
+		{
+			name:       "invalid window",
+			definition: "interval: 5m\ntriggers:\n  - time:\n      weekdays: [someday]\n",
+			wantErr:    "invalid weekday 'someday'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			a := Automation{Definition: tt.definition}
+			assert.ErrorContains(t, a.Validate(context.Background(), db), tt.wantErr)
+		})
+	}
+}
@@ -4,10 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
 )
 
 type Querier interface {
 	GetIDByName(ctx context.Context, table, name string) (int, error)
+	UpdateDeviceHealth(ctx context.Context, id int, status, lastSeen string, latencyMs int) error
+	UpdateReportedState(ctx context.Context, id int, state, reportedAt string) error
+	GetDeviceActionIDs(ctx context.Context, deviceID int) ([]int, error)
+	GetDeviceActions(ctx context.Context) ([]models.DeviceAction, error)
+	AttachAction(ctx context.Context, deviceID, actionID int) error
+	DetachAction(ctx context.Context, deviceID, actionID int) error
+	GetGroupDeviceIDs(ctx context.Context, groupID int) ([]int, error)
+	GetDeviceGroupIDs(ctx context.Context, deviceID int) ([]int, error)
+	GetGroupDevices(ctx context.Context) ([]models.GroupDevice, error)
+	AddGroupDevice(ctx context.Context, groupID, deviceID int) error
+	RemoveGroupDevice(ctx context.Context, groupID, deviceID int) error
+	UpdateAutomationLastCheck(ctx context.Context, id int, at string) error
+	UpdateAutomationLastTriggersRun(ctx context.Context, id int, at string) error
+	UpdateAutomationLastActionRun(ctx context.Context, id int, at string) error
+	Rename(ctx context.Context, table string, id int, name string, automations []*models.Automation) error
+	DeleteJobsFinishedBefore(ctx context.Context, before string) (int64, error)
 }
 
 type QueryRepo struct {
@@ -37,3 +56,274 @@ func (r *QueryRepo) GetIDByName(ctx context.Context, table, name string) (int, e
 	}
 	return id, nil
 }
+
+// UpdateDeviceHealth writes only the health columns of a device, so it never
+// overwrites changes made to the device through the API in the meantime.
+func (r *QueryRepo) UpdateDeviceHealth(ctx context.Context, id int, status, lastSeen string, latencyMs int) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE devices SET status = ?, last_seen = ?, latency_ms = ? WHERE id = ?", status, lastSeen, latencyMs, id,
+	)
+	if err != nil {
+		return fmt.Errorf("updating health of device %d: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateReportedState stores the state a device pushed to the server.
+func (r *QueryRepo) UpdateReportedState(ctx context.Context, id int, state, reportedAt string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE devices SET reported_state = ?, reported_at = ? WHERE id = ?", state, reportedAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("updating reported state of device %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("updating reported state of device %d: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// UpdateAutomationLastCheck writes only the last check time of an automation, so a
+// run never overwrites changes made to the automation through the API meanwhile.
+func (r *QueryRepo) UpdateAutomationLastCheck(ctx context.Context, id int, at string) error {
+	return r.updateAutomationTime(ctx, "last_check", id, at)
+}
+
+// UpdateAutomationLastTriggersRun writes only the time the triggers of an automation
+// were last evaluated.
+func (r *QueryRepo) UpdateAutomationLastTriggersRun(ctx context.Context, id int, at string) error {
+	return r.updateAutomationTime(ctx, "last_triggers_run", id, at)
+}
+
+// UpdateAutomationLastActionRun writes only the time an action of an automation last
+// succeeded.
+func (r *QueryRepo) UpdateAutomationLastActionRun(ctx context.Context, id int, at string) error {
+	return r.updateAutomationTime(ctx, "last_action_run", id, at)
+}
+
+func (r *QueryRepo) updateAutomationTime(ctx context.Context, column string, id int, at string) error {
+	_, err := r.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE automations SET %s = ? WHERE id = ?", column), at, id,
+	)
+	if err != nil {
+		return fmt.Errorf("updating %s of automation %d: %w", column, id, err)
+	}
+	return nil
+}
+
+// DeleteJobsFinishedBefore deletes the jobs that finished before the given RFC 3339
+// time and returns how many were deleted. Unfinished jobs are kept. The times are
+// compared with datetime, so jobs stored with another UTC offset are ordered correctly.
+func (r *QueryRepo) DeleteJobsFinishedBefore(ctx context.Context, before string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM jobs WHERE finished_at != '' AND datetime(finished_at) < datetime(?)", before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("deleting jobs finished before %s: %w", before, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("deleting jobs finished before %s: %w", before, err)
+	}
+	return n, nil
+}
+
+// Rename changes the name of a record and saves the rewritten definitions of the
+// automations referring to it in one transaction, so either all of them change or
+// none does.
+func (r *QueryRepo) Rename(ctx context.Context, table string, id int, name string, automations []*models.Automation) error {
+	if !r.allowedTables[table] {
+		return fmt.Errorf("invalid table: %s", table)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("renaming %d in %s: %w", id, table, err)
+	}
+	defer tx.Rollback() // nolint
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET name = ?, updated_at = ? WHERE id = ?", table), name, now, id,
+	)
+	if err != nil {
+		return fmt.Errorf("renaming %d in %s: %w", id, table, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("renaming %d in %s: %w", id, table, sql.ErrNoRows)
+	}
+
+	for _, automation := range automations {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE automations SET definition = ?, updated_at = ? WHERE id = ?", automation.Definition, now, automation.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("updating automation '%s': %w", automation.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("renaming %d in %s: %w", id, table, err)
+	}
+	return nil
+}
+
+// GetDeviceActionIDs returns the IDs of the actions assigned to a device, in ID order.
+func (r *QueryRepo) GetDeviceActionIDs(ctx context.Context, deviceID int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT action_id FROM device_actions WHERE device_id = ? ORDER BY action_id", deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting actions of device %d: %w", deviceID, err)
+	}
+	defer rows.Close() // nolint
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("getting actions of device %d: %w", deviceID, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getting actions of device %d: %w", deviceID, err)
+	}
+	return ids, nil
+}
+
+// GetDeviceActions returns every device-action assignment.
+func (r *QueryRepo) GetDeviceActions(ctx context.Context) ([]models.DeviceAction, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT device_id, action_id FROM device_actions ORDER BY device_id, action_id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting device actions: %w", err)
+	}
+	defer rows.Close() // nolint
+
+	deviceActions := []models.DeviceAction{}
+	for rows.Next() {
+		var da models.DeviceAction
+		if err := rows.Scan(&da.DeviceID, &da.ActionID); err != nil {
+			return nil, fmt.Errorf("getting device actions: %w", err)
+		}
+		deviceActions = append(deviceActions, da)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getting device actions: %w", err)
+	}
+	return deviceActions, nil
+}
+
+// AttachAction assigns an action to a device. Assigning it again is a no-op.
+func (r *QueryRepo) AttachAction(ctx context.Context, deviceID, actionID int) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO device_actions (device_id, action_id) VALUES (?, ?)", deviceID, actionID,
+	)
+	if err != nil {
+		return fmt.Errorf("attaching action %d to device %d: %w", actionID, deviceID, err)
+	}
+	return nil
+}
+
+// DetachAction removes an action from a device. It returns sql.ErrNoRows when the
+// action wasn't assigned.
+func (r *QueryRepo) DetachAction(ctx context.Context, deviceID, actionID int) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM device_actions WHERE device_id = ? AND action_id = ?", deviceID, actionID,
+	)
+	if err != nil {
+		return fmt.Errorf("detaching action %d from device %d: %w", actionID, deviceID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("detaching action %d from device %d: %w", actionID, deviceID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetGroupDeviceIDs returns the IDs of the devices in a group, in ID order.
+func (r *QueryRepo) GetGroupDeviceIDs(ctx context.Context, groupID int) ([]int, error) {
+	ids, err := r.queryIDs(ctx, "SELECT device_id FROM group_devices WHERE group_id = ? ORDER BY device_id", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("getting devices of group %d: %w", groupID, err)
+	}
+	return ids, nil
+}
+
+// GetDeviceGroupIDs returns the IDs of the groups a device belongs to, in ID order.
+func (r *QueryRepo) GetDeviceGroupIDs(ctx context.Context, deviceID int) ([]int, error) {
+	ids, err := r.queryIDs(ctx, "SELECT group_id FROM group_devices WHERE device_id = ? ORDER BY group_id", deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("getting groups of device %d: %w", deviceID, err)
+	}
+	return ids, nil
+}
+
+func (r *QueryRepo) queryIDs(ctx context.Context, query string, args ...any) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetGroupDevices returns every group membership.
+func (r *QueryRepo) GetGroupDevices(ctx context.Context) ([]models.GroupDevice, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT group_id, device_id FROM group_devices ORDER BY group_id, device_id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting group devices: %w", err)
+	}
+	defer rows.Close() // nolint
+
+	groupDevices := []models.GroupDevice{}
+	for rows.Next() {
+		var gd models.GroupDevice
+		if err := rows.Scan(&gd.GroupID, &gd.DeviceID); err != nil {
+			return nil, fmt.Errorf("getting group devices: %w", err)
+		}
+		groupDevices = append(groupDevices, gd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getting group devices: %w", err)
+	}
+	return groupDevices, nil
+}
+
+// AddGroupDevice adds a device to a group. Adding a member again is a no-op.
+func (r *QueryRepo) AddGroupDevice(ctx context.Context, groupID, deviceID int) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO group_devices (group_id, device_id) VALUES (?, ?)", groupID, deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("adding device %d to group %d: %w", deviceID, groupID, err)
+	}
+	return nil
+}
+
+// RemoveGroupDevice removes a device from a group. It returns sql.ErrNoRows when the
+// device wasn't a member.
+func (r *QueryRepo) RemoveGroupDevice(ctx context.Context, groupID, deviceID int) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM group_devices WHERE group_id = ? AND device_id = ?", groupID, deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("removing device %d from group %d: %w", deviceID, groupID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("removing device %d from group %d: %w", deviceID, groupID, sql.ErrNoRows)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
 )
 
 func TestQueryRepo_GetIDByName(t *testing.T) {
@@ -78,3 +79,343 @@ func TestQueryRepo_GetIDByName(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryRepo_UpdateDeviceHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		setupMock func(mock sqlmock.Sqlmock)
+		wantErr   string
+	}{
+		{
+			name: "updates health columns only",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE devices SET status = \\?, last_seen = \\?, latency_ms = \\? WHERE id = \\?").
+					WithArgs("online", "2026-01-02T15:04:05Z", 12, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "returns error on db failure",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE devices").WillReturnError(fmt.Errorf("database is locked"))
+			},
+			wantErr: "updating health of device 7: database is locked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			tt.setupMock(mock)
+
+			repo := NewQueryRepo(db, []string{"devices"})
+			err = repo.UpdateDeviceHealth(context.Background(), 7, "online", "2026-01-02T15:04:05Z", 12)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQueryRepo_UpdateReportedState(t *testing.T) {
+	tests := []struct {
+		name      string
+		setupMock func(mock sqlmock.Sqlmock)
+		wantErr   string
+	}{
+		{
+			name: "stores state",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE devices SET reported_state = \\?, reported_at = \\? WHERE id = \\?").
+					WithArgs(`{"leak":true}`, "2026-01-02T15:04:05Z", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "returns no rows for unknown device",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE devices").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: "updating reported state of device 7: sql: no rows in result set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close() // nolint
+
+			tt.setupMock(mock)
+
+			repo := NewQueryRepo(db, []string{"devices"})
+			err = repo.UpdateReportedState(context.Background(), 7, `{"leak":true}`, "2026-01-02T15:04:05Z")
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQueryRepo_DeviceActions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("gets action IDs of a device", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT action_id FROM device_actions WHERE device_id = \\? ORDER BY action_id").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"action_id"}).AddRow(1).AddRow(3))
+
+		ids, err := NewQueryRepo(db, nil).GetDeviceActionIDs(ctx, 7)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 3}, ids)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("gets all assignments", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT device_id, action_id FROM device_actions").
+			WillReturnRows(sqlmock.NewRows([]string{"device_id", "action_id"}).AddRow(1, 2).AddRow(3, 2))
+
+		deviceActions, err := NewQueryRepo(db, nil).GetDeviceActions(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []models.DeviceAction{{DeviceID: 1, ActionID: 2}, {DeviceID: 3, ActionID: 2}}, deviceActions)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("attaches action", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("INSERT OR IGNORE INTO device_actions \\(device_id, action_id\\) VALUES \\(\\?, \\?\\)").
+			WithArgs(7, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, NewQueryRepo(db, nil).AttachAction(ctx, 7, 2))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("attach returns constraint errors", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("INSERT OR IGNORE INTO device_actions").WillReturnError(fmt.Errorf("FOREIGN KEY constraint failed"))
+
+		err = NewQueryRepo(db, nil).AttachAction(ctx, 7, 99)
+		assert.EqualError(t, err, "attaching action 99 to device 7: FOREIGN KEY constraint failed")
+	})
+
+	t.Run("detaches action", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("DELETE FROM device_actions WHERE device_id = \\? AND action_id = \\?").
+			WithArgs(7, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, NewQueryRepo(db, nil).DetachAction(ctx, 7, 2))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("detaching an unassigned action returns no rows", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("DELETE FROM device_actions").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = NewQueryRepo(db, nil).DetachAction(ctx, 7, 2)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestQueryRepo_GroupDevices(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("gets device IDs of a group", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT device_id FROM group_devices WHERE group_id = \\? ORDER BY device_id").
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow(2).AddRow(5))
+
+		ids, err := NewQueryRepo(db, nil).GetGroupDeviceIDs(ctx, 4)
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 5}, ids)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("gets group IDs of a device", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT group_id FROM group_devices WHERE device_id = \\? ORDER BY group_id").
+			WithArgs(5).
+			WillReturnError(fmt.Errorf("database is locked"))
+
+		_, err = NewQueryRepo(db, nil).GetDeviceGroupIDs(ctx, 5)
+		assert.EqualError(t, err, "getting groups of device 5: database is locked")
+	})
+
+	t.Run("gets all memberships", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectQuery("SELECT group_id, device_id FROM group_devices").
+			WillReturnRows(sqlmock.NewRows([]string{"group_id", "device_id"}).AddRow(1, 2).AddRow(1, 3))
+
+		groupDevices, err := NewQueryRepo(db, nil).GetGroupDevices(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []models.GroupDevice{{GroupID: 1, DeviceID: 2}, {GroupID: 1, DeviceID: 3}}, groupDevices)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("adds device", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("INSERT OR IGNORE INTO group_devices \\(group_id, device_id\\) VALUES \\(\\?, \\?\\)").
+			WithArgs(1, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, NewQueryRepo(db, nil).AddGroupDevice(ctx, 1, 7))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("removing a device that isn't a member returns no rows", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectExec("DELETE FROM group_devices WHERE group_id = \\? AND device_id = \\?").
+			WithArgs(1, 7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = NewQueryRepo(db, nil).RemoveGroupDevice(ctx, 1, 7)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestQueryRepo_UpdateAutomationTimes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close() // nolint
+
+	mock.ExpectExec("UPDATE automations SET last_check = \\? WHERE id = \\?").WithArgs("2026-01-02T15:04:05Z", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE automations SET last_triggers_run = \\? WHERE id = \\?").WithArgs("2026-01-02T15:04:05Z", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE automations SET last_action_run = \\? WHERE id = \\?").WithArgs("2026-01-02T15:04:05Z", 3).WillReturnError(fmt.Errorf("database is locked"))
+
+	repo := NewQueryRepo(db, nil)
+	require.NoError(t, repo.UpdateAutomationLastCheck(context.Background(), 3, "2026-01-02T15:04:05Z"))
+	require.NoError(t, repo.UpdateAutomationLastTriggersRun(context.Background(), 3, "2026-01-02T15:04:05Z"))
+	err = repo.UpdateAutomationLastActionRun(context.Background(), 3, "2026-01-02T15:04:05Z")
+	assert.EqualError(t, err, "updating last_action_run of automation 3: database is locked")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryRepo_DeleteJobsFinishedBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close() // nolint
+
+	mock.ExpectExec("DELETE FROM jobs WHERE finished_at != '' AND datetime\\(finished_at\\) < datetime\\(\\?\\)").WithArgs("2026-01-02T15:04:05Z").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM jobs").WithArgs("2026-01-02T15:04:05Z").WillReturnError(fmt.Errorf("database is locked"))
+
+	repo := NewQueryRepo(db, nil)
+	n, err := repo.DeleteJobsFinishedBefore(context.Background(), "2026-01-02T15:04:05Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	_, err = repo.DeleteJobsFinishedBefore(context.Background(), "2026-01-02T15:04:05Z")
+	assert.EqualError(t, err, "deleting jobs finished before 2026-01-02T15:04:05Z: database is locked")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryRepo_Rename(t *testing.T) {
+	ctx := context.Background()
+	automations := []*models.Automation{
+		{ID: 4, Name: "cool-down", Definition: "actions:\n  - device: fan-1\n"},
+		{ID: 5, Name: "vent", Definition: "triggers:\n  - device: fan-1\n"},
+	}
+
+	t.Run("renames record and automations in one transaction", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE devices SET name = \\?, updated_at = \\? WHERE id = \\?").
+			WithArgs("fan-1", sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE automations SET definition = \\?, updated_at = \\? WHERE id = \\?").
+			WithArgs(automations[0].Definition, sqlmock.AnyArg(), 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE automations SET definition = \\?, updated_at = \\? WHERE id = \\?").
+			WithArgs(automations[1].Definition, sqlmock.AnyArg(), 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, NewQueryRepo(db, []string{"devices"}).Rename(ctx, "devices", 7, "fan-1", automations))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failing automation rolls back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE devices").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE automations").WillReturnError(fmt.Errorf("database is locked"))
+		mock.ExpectRollback()
+
+		err = NewQueryRepo(db, []string{"devices"}).Rename(ctx, "devices", 7, "fan-1", automations)
+		assert.EqualError(t, err, "updating automation 'cool-down': database is locked")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown record returns no rows", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close() // nolint
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE devices").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = NewQueryRepo(db, []string{"devices"}).Rename(ctx, "devices", 7, "fan-1", nil)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("table must be allowed", func(t *testing.T) {
+		err := NewQueryRepo(nil, []string{"devices"}).Rename(ctx, "jobs", 7, "fan-1", nil)
+		assert.EqualError(t, err, "invalid table: jobs")
+	})
+}
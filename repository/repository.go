@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
@@ -22,8 +23,34 @@ type GenericRepo[M gocrud.Model] interface {
 	GetDB() *sql.DB
 }
 
+// GuardedRepo replaces the writes of a GenericRepo, e.g. to refuse deleting a record
+// others still refer to. Reads go to the wrapped repository, and so do creates when
+// CreateFunc is nil.
+type GuardedRepo[M gocrud.Model] struct {
+	GenericRepo[M]
+	CreateFunc func(ctx context.Context, model M) (int, error)
+	DeleteFunc func(ctx context.Context, id int) error
+	UpdateFunc func(ctx context.Context, model M, id int) error
+}
+
+func (r *GuardedRepo[M]) Create(ctx context.Context, model M) (int, error) {
+	if r.CreateFunc == nil {
+		return r.GenericRepo.Create(ctx, model)
+	}
+	return r.CreateFunc(ctx, model)
+}
+
+func (r *GuardedRepo[M]) Delete(ctx context.Context, id int) error {
+	return r.DeleteFunc(ctx, id)
+}
+
+func (r *GuardedRepo[M]) Update(ctx context.Context, model M, id int) error {
+	return r.UpdateFunc(ctx, model, id)
+}
+
 func NewDBConnection(dbPath, migrationsPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// SQLite enforces foreign keys only when each connection asks for it
+	db, err := sql.Open("sqlite3", withForeignKeys(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("connecting to db: %v", err)
 	}
@@ -49,3 +76,11 @@ func NewDBConnection(dbPath, migrationsPath string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func withForeignKeys(dbPath string) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + "_foreign_keys=on"
+}
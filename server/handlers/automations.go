@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// DryRunAutomation evaluates an automation without running its actions and answers
+// with the evaluation tree and the actions that would run.
+func (h *CustomHandlers) DryRunAutomation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := h.service.DryRunAutomation(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+			return
+		}
+		h.WriteError(w, r, err, "failed to dry run automation", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, dryRun)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+func TestDryRunAutomation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dryRun := &service.DryRun{
+		Automation: "water",
+		Met:        true,
+		Evaluation: &service.Evaluation{Type: service.EvaluationAll, Met: true},
+		Actions:    []service.DryRunAction{{Action: "pump_on", Devices: []string{"pump"}}},
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "returns the evaluation",
+			path:         "/automations/1/dry-run",
+			svc:          &mockService{dryRun: dryRun},
+			wantCode:     http.StatusOK,
+			wantContains: `"met":true,"evaluation":{"type":"all","met":true},"actions":[{"action":"pump_on","devices":["pump"]}]`,
+		},
+		{
+			name:         "unknown automation returns 404",
+			path:         "/automations/9/dry-run",
+			svc:          &mockService{err: sql.ErrNoRows},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "invalid id returns 400",
+			path:         "/automations/abc/dry-run",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "failing trigger returns 500",
+			path:         "/automations/1/dry-run",
+			svc:          &mockService{err: fmt.Errorf("processing triggers: %w", errors.New("device offline"))},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to dry run automation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /automations/{id}/dry-run", h.DryRunAutomation)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+		})
+	}
+}
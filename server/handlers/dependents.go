@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+// DeviceDependents lists the automations referring to a device and its groups.
+func (h *CustomHandlers) DeviceDependents(w http.ResponseWriter, r *http.Request) {
+	h.dependents(w, r, h.service.DeviceDependents)
+}
+
+// ActionDependents lists the automations referring to an action and the devices it
+// is assigned to.
+func (h *CustomHandlers) ActionDependents(w http.ResponseWriter, r *http.Request) {
+	h.dependents(w, r, h.service.ActionDependents)
+}
+
+// GroupDependents lists the automations referring to a group.
+func (h *CustomHandlers) GroupDependents(w http.ResponseWriter, r *http.Request) {
+	h.dependents(w, r, h.service.GroupDependents)
+}
+
+// AutomationDependents lists the automations running on an automation's
+// automation_finished events.
+func (h *CustomHandlers) AutomationDependents(w http.ResponseWriter, r *http.Request) {
+	h.dependents(w, r, h.service.AutomationDependents)
+}
+
+func (h *CustomHandlers) dependents(w http.ResponseWriter, r *http.Request, get func(context.Context, int) (*service.Dependents, error)) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	dependents, err := get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get dependents", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, dependents)
+}
+
+type RenameReqBody struct {
+	Name string `json:"name"`
+}
+
+// RenameDevice renames a device and the references to it in automations.
+func (h *CustomHandlers) RenameDevice(w http.ResponseWriter, r *http.Request) {
+	h.rename(w, r, h.service.RenameDevice)
+}
+
+// RenameAction renames an action and the references to it in automations.
+func (h *CustomHandlers) RenameAction(w http.ResponseWriter, r *http.Request) {
+	h.rename(w, r, h.service.RenameAction)
+}
+
+// RenameGroup renames a group and the references to it in automations.
+func (h *CustomHandlers) RenameGroup(w http.ResponseWriter, r *http.Request) {
+	h.rename(w, r, h.service.RenameGroup)
+}
+
+// RenameAutomation renames an automation and the automation_finished events waiting
+// for it.
+func (h *CustomHandlers) RenameAutomation(w http.ResponseWriter, r *http.Request) {
+	h.rename(w, r, h.service.RenameAutomation)
+}
+
+// rename answers with the automations that were updated.
+func (h *CustomHandlers) rename(w http.ResponseWriter, r *http.Request, rename func(context.Context, int, string) ([]service.Dependent, error)) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	var body RenameReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.WriteError(w, r, err, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		h.WriteError(w, r, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := rename(r.Context(), id, body.Name)
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		h.WriteError(w, r, err, validationErr.Message(), validationErr.StatusCode())
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to rename", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, updated)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+func TestDependentsRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dependents := &service.Dependents{
+		Automations: []service.Dependent{{ID: 4, Name: "cool-down"}},
+		Devices:     []service.Dependent{{ID: 2, Name: "fan"}},
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+		wantRenamed  string
+	}{
+		{
+			name:         "lists dependents",
+			method:       "GET",
+			path:         "/actions/1/dependents",
+			svc:          &mockService{dependents: dependents},
+			wantCode:     http.StatusOK,
+			wantContains: `{"automations":[{"id":4,"name":"cool-down"}],"devices":[{"id":2,"name":"fan"}]}`,
+		},
+		{
+			name:         "unknown record returns 404",
+			method:       "GET",
+			path:         "/devices/9/dependents",
+			svc:          &mockService{err: fmt.Errorf("getting device: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "invalid id returns 400",
+			method:       "GET",
+			path:         "/groups/abc/dependents",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "rename returns updated automations",
+			method:       "POST",
+			path:         "/devices/1/rename",
+			body:         `{"name":"greenhouse-fan"}`,
+			svc:          &mockService{dependents: dependents},
+			wantCode:     http.StatusOK,
+			wantContains: `[{"id":4,"name":"cool-down"}]`,
+			wantRenamed:  "greenhouse-fan",
+		},
+		{
+			name:         "renames automation",
+			method:       "POST",
+			path:         "/automations/1/rename",
+			body:         `{"name":"cool-down-fast"}`,
+			svc:          &mockService{dependents: dependents},
+			wantCode:     http.StatusOK,
+			wantContains: `[{"id":4,"name":"cool-down"}]`,
+			wantRenamed:  "cool-down-fast",
+		},
+		{
+			name:         "rename without name returns 400",
+			method:       "POST",
+			path:         "/groups/1/rename",
+			body:         `{"name":" "}`,
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid params",
+		},
+		{
+			name:         "rename service error returns 500",
+			method:       "POST",
+			path:         "/actions/1/rename",
+			body:         `{"name":"fan_on"}`,
+			svc:          &mockService{err: errors.New("boom")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to rename",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /devices/{id}/dependents", h.DeviceDependents)
+			mux.HandleFunc("POST /devices/{id}/rename", h.RenameDevice)
+			mux.HandleFunc("GET /actions/{id}/dependents", h.ActionDependents)
+			mux.HandleFunc("POST /actions/{id}/rename", h.RenameAction)
+			mux.HandleFunc("GET /groups/{id}/dependents", h.GroupDependents)
+			mux.HandleFunc("POST /groups/{id}/rename", h.RenameGroup)
+			mux.HandleFunc("GET /automations/{id}/dependents", h.AutomationDependents)
+			mux.HandleFunc("POST /automations/{id}/rename", h.RenameAutomation)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+			assert.Equal(t, tt.wantRenamed, tt.svc.renamed)
+		})
+	}
+}
+
+func TestErrorHandler_Dependents(t *testing.T) {
+	eh := NewErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err := fmt.Errorf("deleting: %w", &service.DependentsError{
+		Kind:       "device",
+		Name:       "fan",
+		Dependents: &service.Dependents{Automations: []service.Dependent{{ID: 4, Name: "cool-down"}}},
+	})
+
+	rec := httptest.NewRecorder()
+	eh.WriteError(rec, httptest.NewRequest("DELETE", "/devices/1", nil), err, "", http.StatusBadRequest)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "device 'fan' is used by automations 'cool-down'")
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+// maxReportSize limits the payload a device can push in one request.
+const maxReportSize = 64 << 10
+
+func (h *CustomHandlers) DeviceStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.service.DeviceStatus(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+			return
+		}
+		h.WriteError(w, r, err, "failed to get device status", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, status)
+}
+
+// DeviceQueues lists the command queues of devices that were called recently.
+func (h *CustomHandlers) DeviceQueues(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, h.service.QueueStatuses())
+}
+
+// ReportState accepts a JSON object pushed by a device and stores it as the device's
+// reported state. The device authenticates with "Authorization: Bearer <ingest_token>".
+func (h *CustomHandlers) ReportState(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		h.WriteError(w, r, nil, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	var state map[string]any
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&state); err != nil || state == nil {
+		h.WriteError(w, r, err, "payload must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ReportState(r.Context(), id, token, state)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidIngestToken) {
+		h.WriteError(w, r, err, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, service.ErrIngestDisabled) {
+		h.WriteError(w, r, err, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to store reported state", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeviceActions lists the actions assigned to a device.
+func (h *CustomHandlers) DeviceActions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	actions, err := h.service.DeviceActions(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get device actions", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, actions)
+}
+
+// AllDeviceActions lists every device-action assignment.
+func (h *CustomHandlers) AllDeviceActions(w http.ResponseWriter, r *http.Request) {
+	deviceActions, err := h.service.AllDeviceActions(r.Context())
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get device actions", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, deviceActions)
+}
+
+// AttachAction assigns an action to a device.
+func (h *CustomHandlers) AttachAction(w http.ResponseWriter, r *http.Request) {
+	deviceId, actionId, ok := h.deviceActionParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.AttachAction(r.Context(), deviceId, actionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to attach action", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DetachAction removes an action from a device.
+func (h *CustomHandlers) DetachAction(w http.ResponseWriter, r *http.Request) {
+	deviceId, actionId, ok := h.deviceActionParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.DetachAction(r.Context(), deviceId, actionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to detach action", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CustomHandlers) deviceActionParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	deviceId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	actionId, err := strconv.Atoi(r.PathValue("actionId"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return deviceId, actionId, true
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+func TestDeviceStatus(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		path         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "returns breaker state",
+			path:         "/devices/1/status",
+			svc:          &mockService{status: &service.DeviceStatus{DeviceID: 1, Breaker: service.BreakerStatus{State: service.BreakerOpen, Failures: 5}}},
+			wantCode:     http.StatusOK,
+			wantContains: `"state":"open"`,
+		},
+		{
+			name:         "invalid id returns 400",
+			path:         "/devices/abc/status",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "unknown device returns 404",
+			path:         "/devices/2/status",
+			svc:          &mockService{err: fmt.Errorf("getting device: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "service error returns 500",
+			path:         "/devices/3/status",
+			svc:          &mockService{err: errors.New("boom")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to get device status",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /devices/{id}/status", h.DeviceStatus)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+			if rec.Code == http.StatusOK {
+				var status service.DeviceStatus
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+				assert.Equal(t, 5, status.Breaker.Failures)
+			}
+		})
+	}
+}
+
+func TestDeviceQueues(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := &mockService{queues: []service.QueueStatus{{DeviceID: 1, Busy: true, Depth: 2, Executed: 7}}}
+	h := NewCustomHandlers(logger, svc, &ErrorHandler{logger: logger})
+
+	rec := httptest.NewRecorder()
+	h.DeviceQueues(rec, httptest.NewRequest("GET", "/devices/queues", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var queues []service.QueueStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queues))
+	assert.Equal(t, svc.queues, queues)
+}
+
+func TestReportState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		path         string
+		auth         string
+		body         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:     "stores pushed state",
+			path:     "/devices/1/events",
+			auth:     "Bearer 0123456789abcdef",
+			body:     `{"leak":true}`,
+			svc:      &mockService{},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:         "missing token returns 401",
+			path:         "/devices/1/events",
+			body:         `{"leak":true}`,
+			svc:          &mockService{},
+			wantCode:     http.StatusUnauthorized,
+			wantContains: "missing bearer token",
+		},
+		{
+			name:         "wrong token returns 401",
+			path:         "/devices/1/events",
+			auth:         "Bearer nope",
+			body:         `{"leak":true}`,
+			svc:          &mockService{err: service.ErrInvalidIngestToken},
+			wantCode:     http.StatusUnauthorized,
+			wantContains: "invalid ingest token",
+		},
+		{
+			name:         "device without token returns 403",
+			path:         "/devices/1/events",
+			auth:         "Bearer nope",
+			body:         `{"leak":true}`,
+			svc:          &mockService{err: service.ErrIngestDisabled},
+			wantCode:     http.StatusForbidden,
+			wantContains: "ingestion is not enabled",
+		},
+		{
+			name:         "non-object payload returns 400",
+			path:         "/devices/1/events",
+			auth:         "Bearer 0123456789abcdef",
+			body:         `[1, 2]`,
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "payload must be a JSON object",
+		},
+		{
+			name:         "oversized payload returns 400",
+			path:         "/devices/1/events",
+			auth:         "Bearer 0123456789abcdef",
+			body:         `{"blob":"` + strings.Repeat("x", maxReportSize) + `"}`,
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "payload must be a JSON object",
+		},
+		{
+			name:         "unknown device returns 404",
+			path:         "/devices/9/events",
+			auth:         "Bearer 0123456789abcdef",
+			body:         `{"leak":true}`,
+			svc:          &mockService{err: fmt.Errorf("getting device: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /devices/{id}/events", h.ReportState)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+			if rec.Code == http.StatusNoContent {
+				assert.Equal(t, "0123456789abcdef", tt.svc.token)
+				assert.Equal(t, map[string]any{"leak": true}, tt.svc.state)
+			}
+		})
+	}
+}
+
+func TestDeviceActionRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "lists device actions",
+			method:       "GET",
+			path:         "/devices/1/actions",
+			svc:          &mockService{actions: []*models.Action{{ID: 2, Name: "water"}}},
+			wantCode:     http.StatusOK,
+			wantContains: `"name":"water"`,
+		},
+		{
+			name:         "lists all assignments",
+			method:       "GET",
+			path:         "/devices/actions",
+			svc:          &mockService{assigned: []models.DeviceAction{{DeviceID: 1, ActionID: 2}}},
+			wantCode:     http.StatusOK,
+			wantContains: `[{"device_id":1,"action_id":2}]`,
+		},
+		{
+			name:     "attaches action",
+			method:   "PUT",
+			path:     "/devices/1/actions/2",
+			svc:      &mockService{},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "detaches action",
+			method:   "DELETE",
+			path:     "/devices/1/actions/2",
+			svc:      &mockService{},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:         "unknown device or action returns 404",
+			method:       "PUT",
+			path:         "/devices/1/actions/9",
+			svc:          &mockService{err: fmt.Errorf("getting action: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "detaching unassigned action returns 404",
+			method:       "DELETE",
+			path:         "/devices/1/actions/9",
+			svc:          &mockService{err: fmt.Errorf("detaching action 9 from device 1: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "invalid action id returns 400",
+			method:       "PUT",
+			path:         "/devices/1/actions/abc",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "service error returns 500",
+			method:       "GET",
+			path:         "/devices/1/actions",
+			svc:          &mockService{err: errors.New("boom")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to get device actions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /devices/actions", h.AllDeviceActions)
+			mux.HandleFunc("GET /devices/{id}/actions", h.DeviceActions)
+			mux.HandleFunc("PUT /devices/{id}/actions/{actionId}", h.AttachAction)
+			mux.HandleFunc("DELETE /devices/{id}/actions/{actionId}", h.DetachAction)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+func (h *CustomHandlers) Discover(w http.ResponseWriter, r *http.Request) {
+	devices, err := h.service.Discover(r.Context())
+	if err != nil {
+		h.WriteError(w, r, err, "failed to discover devices", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, devices)
+}
+
+func (h *CustomHandlers) UnclaimedDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := h.service.UnclaimedDevices(r.Context())
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get unclaimed devices", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, devices)
+}
+
+// AdoptDevice registers an unclaimed device. The optional JSON body overrides the
+// fields reported by the device, e.g. {"name": "greenhouse", "tags": ["garden"]}.
+// A body moving the device to another IP or port is rejected.
+func (h *CustomHandlers) AdoptDevice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.service.UnclaimedDevice(r.Context(), id)
+	if errors.Is(err, service.ErrUnclaimedNotFound) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to adopt device", http.StatusInternalServerError)
+		return
+	}
+
+	device := found.Device()
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(device); err != nil {
+			h.WriteError(w, r, err, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deviceID, err := h.service.AdoptDevice(r.Context(), id, device)
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		h.WriteError(w, r, err, validationErr.Message(), validationErr.StatusCode())
+		return
+	}
+	if errors.Is(err, service.ErrUnclaimedNotFound) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrAdoptEndpointChanged) {
+		h.WriteError(w, r, err, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to adopt device", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONStatus(w, http.StatusCreated, map[string]int{"id": deviceID})
+}
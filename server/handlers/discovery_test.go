@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+var discovered = []service.DiscoveredDevice{
+	{ID: 1, Name: "soil-sensor", Type: "sensor", Chip: "esp32", IP: "192.168.1.50", Port: 8080},
+}
+
+func TestUnclaimedDevices(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "lists unclaimed devices",
+			method:       "GET",
+			path:         "/devices/unclaimed",
+			svc:          &mockService{discovered: discovered},
+			wantCode:     http.StatusOK,
+			wantContains: `"name":"soil-sensor"`,
+		},
+		{
+			name:         "discover returns unclaimed devices",
+			method:       "POST",
+			path:         "/devices/discover",
+			svc:          &mockService{discovered: discovered},
+			wantCode:     http.StatusOK,
+			wantContains: `"ip":"192.168.1.50"`,
+		},
+		{
+			name:         "discovery error returns 500",
+			method:       "POST",
+			path:         "/devices/discover",
+			svc:          &mockService{err: errors.New("no discovery targets configured")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to discover devices",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /devices/discover", h.Discover)
+			mux.HandleFunc("GET /devices/unclaimed", h.UnclaimedDevices)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+		})
+	}
+}
+
+func TestAdoptDevice(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+		wantDevice   *models.Device
+	}{
+		{
+			name:         "adopts with reported fields",
+			path:         "/devices/unclaimed/1/adopt",
+			svc:          &mockService{discovered: discovered},
+			wantCode:     http.StatusCreated,
+			wantContains: `{"id":7}`,
+			wantDevice:   &models.Device{Name: "soil-sensor", Type: "sensor", Chip: "esp32", IP: "192.168.1.50", Port: 8080},
+		},
+		{
+			name:       "body overrides reported fields",
+			path:       "/devices/unclaimed/1/adopt",
+			body:       `{"name":"greenhouse","tags":["garden"]}`,
+			svc:        &mockService{discovered: discovered},
+			wantCode:   http.StatusCreated,
+			wantDevice: &models.Device{Name: "greenhouse", Type: "sensor", Chip: "esp32", IP: "192.168.1.50", Port: 8080, Tags: models.Tags{"garden"}},
+		},
+		{
+			name:         "unknown device returns 404",
+			path:         "/devices/unclaimed/2/adopt",
+			svc:          &mockService{discovered: discovered},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "invalid id returns 400",
+			path:         "/devices/unclaimed/abc/adopt",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "invalid body returns 400",
+			path:         "/devices/unclaimed/1/adopt",
+			body:         `{"name":`,
+			svc:          &mockService{discovered: discovered},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid JSON body",
+		},
+		{
+			name:         "changed endpoint returns 400",
+			path:         "/devices/unclaimed/1/adopt",
+			body:         `{"ip":"10.0.0.1"}`,
+			svc:          &mockService{discovered: discovered, adoptErr: service.ErrAdoptEndpointChanged},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "can't be changed on adoption",
+		},
+		{
+			name:         "invalid device returns 400",
+			path:         "/devices/unclaimed/1/adopt",
+			svc:          &mockService{discovered: discovered, adoptErr: fmt.Errorf("creating device: %w", invalidDeviceErr(t))},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "transport must be one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /devices/unclaimed/{id}/adopt", h.AdoptDevice)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+			if tt.wantDevice != nil {
+				assert.Equal(t, tt.wantDevice, tt.svc.adopted)
+			}
+		})
+	}
+}
+
+// invalidDeviceErr returns the validation error produced for an unknown transport.
+func invalidDeviceErr(t *testing.T) error {
+	err := (&models.Device{Transport: "zigbee"}).Validate(context.Background(), nil)
+	require.Error(t, err)
+	return err
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+
+	"github.com/tender-barbarian/gniotek/service"
 )
 
 type ErrorHandler struct {
@@ -22,5 +25,12 @@ func (h *ErrorHandler) WriteError(w http.ResponseWriter, r *http.Request, err er
 		h.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
 	}
 
+	// Generic routes answer every failed write with 400. A delete or rename refused
+	// because of dependents is a conflict the client can resolve.
+	var dependentsErr *service.DependentsError
+	if errors.As(err, &dependentsErr) {
+		msg, statusCode = dependentsErr.Error(), http.StatusConflict
+	}
+
 	http.Error(w, msg, statusCode)
 }
@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
 )
 
 type ExecuteReqBody struct {
-	DeviceId *int `json:"deviceId"`
-	ActionId *int `json:"actionId"`
+	DeviceId *int           `json:"deviceId"`
+	ActionId *int           `json:"actionId"`
+	Params   map[string]any `json:"params"`
+	// Async queues the call as a job and answers 202 with the job instead of waiting
+	// for the device.
+	Async bool `json:"async"`
 }
 
 func (h *CustomHandlers) Execute(w http.ResponseWriter, r *http.Request) {
@@ -23,22 +33,99 @@ func (h *CustomHandlers) Execute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deviceResponse, err := h.service.Execute(r.Context(), *e.DeviceId, *e.ActionId)
+	if e.Async {
+		h.submitJob(w, r, e)
+		return
+	}
+
+	deviceResponse, err := h.service.Execute(r.Context(), *e.DeviceId, *e.ActionId, e.Params)
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		h.WriteError(w, r, err, validationErr.Message(), validationErr.StatusCode())
+		return
+	}
+	if errors.Is(err, service.ErrMalformedResponse) {
+		h.WriteError(w, r, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if errors.Is(err, service.ErrDeviceQueueFull) || errors.Is(err, service.ErrQueueWaitTimeout) {
+		h.WriteError(w, r, err, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		h.WriteError(w, r, err, "failed to execute", http.StatusInternalServerError)
 		return
 	}
 
-	buf, err := json.Marshal(deviceResponse)
+	h.writeJSON(w, deviceResponse)
+}
+
+func (h *CustomHandlers) submitJob(w http.ResponseWriter, r *http.Request, e ExecuteReqBody) {
+	job, err := h.service.SubmitJob(r.Context(), *e.DeviceId, *e.ActionId, e.Params)
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		h.WriteError(w, r, err, validationErr.Message(), validationErr.StatusCode())
+		return
+	}
+	if errors.Is(err, service.ErrJobQueueFull) {
+		h.WriteError(w, r, err, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to submit job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	h.writeJSONStatus(w, http.StatusAccepted, job)
+}
+
+type BulkExecuteReqBody struct {
+	service.BulkTarget
+	ActionId *int           `json:"actionId"`
+	Params   map[string]any `json:"params"`
+	// Concurrency limits how many devices are called at the same time. Zero uses the
+	// server default.
+	Concurrency int `json:"concurrency"`
+}
+
+// BulkExecute runs an action on several devices and answers with the outcome per
+// device: 200 when every device succeeded, otherwise 207 Multi-Status.
+func (h *CustomHandlers) BulkExecute(w http.ResponseWriter, r *http.Request) {
+	var e BulkExecuteReqBody
+	err := json.NewDecoder(r.Body).Decode(&e)
 	if err != nil {
-		h.WriteError(w, r, err, "failed to encode response", http.StatusInternalServerError)
+		h.WriteError(w, r, err, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if e.ActionId == nil || (len(e.DeviceIDs) == 0 && e.Group == "" && e.Type == "" && len(e.Tags) == 0) || e.Concurrency < 0 {
+		h.WriteError(w, r, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.BulkExecute(r.Context(), e.BulkTarget, *e.ActionId, e.Params, e.Concurrency)
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		h.WriteError(w, r, err, validationErr.Message(), validationErr.StatusCode())
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrNoBulkTarget) {
+		h.WriteError(w, r, err, err.Error(), http.StatusNotFound)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(buf)
 	if err != nil {
-		h.logger.Error("failed to write output", "error", err)
+		h.WriteError(w, r, err, "failed to execute", http.StatusInternalServerError)
 		return
 	}
+
+	status := http.StatusOK
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	h.writeJSONStatus(w, status, result)
 }
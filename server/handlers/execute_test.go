@@ -1,9 +1,9 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -13,23 +13,15 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
 	"github.com/tender-barbarian/gniotek/service"
 )
 
-type mockExecutor struct {
-	response *service.JSONRPCResponse
-	err      error
-}
-
-func (m *mockExecutor) Execute(ctx context.Context, deviceId, actionId int) (*service.JSONRPCResponse, error) {
-	return m.response, m.err
-}
-
 func TestExecute(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
 	t.Run("validation errors", func(t *testing.T) {
-		h := NewCustomHandlers(logger, &mockExecutor{}, &ErrorHandler{logger: logger})
+		h := NewCustomHandlers(logger, &mockService{}, &ErrorHandler{logger: logger})
 		mux := http.NewServeMux()
 		mux.HandleFunc("POST /execute", h.Execute)
 
@@ -88,6 +80,69 @@ func TestExecute(t *testing.T) {
 		}
 	})
 
+	t.Run("params are passed to the service", func(t *testing.T) {
+		svc := &mockService{response: &service.JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{}`)}}
+		h := NewCustomHandlers(logger, svc, &ErrorHandler{logger: logger})
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/execute", strings.NewReader(`{"deviceId":1,"actionId":1,"params":{"duration":90}}`))
+		h.Execute(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, map[string]any{"duration": float64(90)}, svc.params)
+	})
+
+	t.Run("async submits a job", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			mockJob      *models.Job
+			mockErr      error
+			wantCode     int
+			wantLocation string
+			wantContains string
+		}{
+			{
+				name:         "queued job returns 202",
+				mockJob:      &models.Job{ID: 7, DeviceID: 1, ActionID: 1, State: models.JobQueued},
+				wantCode:     http.StatusAccepted,
+				wantLocation: "/jobs/7",
+				wantContains: `"state":"queued"`,
+			},
+			{
+				name:         "full queue returns 503",
+				mockErr:      service.ErrJobQueueFull,
+				wantCode:     http.StatusServiceUnavailable,
+				wantContains: "job queue is full",
+			},
+			{
+				name:         "invalid params return 400",
+				mockErr:      fmt.Errorf("rendering: %w", invalidParamErr(t)),
+				wantCode:     http.StatusBadRequest,
+				wantContains: "unknown parameter 'speed'",
+			},
+			{
+				name:         "service error returns 500",
+				mockErr:      errors.New("db is locked"),
+				wantCode:     http.StatusInternalServerError,
+				wantContains: "failed to submit job",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				h := NewCustomHandlers(logger, &mockService{job: tt.mockJob, err: tt.mockErr}, &ErrorHandler{logger: logger})
+
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/execute", strings.NewReader(`{"deviceId":1,"actionId":1,"async":true}`))
+				h.Execute(rec, req)
+
+				assert.Equal(t, tt.wantCode, rec.Code)
+				assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+				assert.Contains(t, rec.Body.String(), tt.wantContains)
+			})
+		}
+	})
+
 	t.Run("service execution", func(t *testing.T) {
 		tests := []struct {
 			name           string
@@ -119,11 +174,35 @@ func TestExecute(t *testing.T) {
 				wantCode:     http.StatusInternalServerError,
 				wantContains: "failed to execute",
 			},
+			{
+				name:         "malformed device response returns 502",
+				mockErr:      fmt.Errorf("%w: at '/temperature': got string, want number", service.ErrMalformedResponse),
+				wantCode:     http.StatusBadGateway,
+				wantContains: "malformed device response: at '/temperature'",
+			},
+			{
+				name:         "invalid params return 400",
+				mockErr:      fmt.Errorf("rendering: %w", invalidParamErr(t)),
+				wantCode:     http.StatusBadRequest,
+				wantContains: "unknown parameter 'speed'",
+			},
+			{
+				name:         "full device queue returns 503",
+				mockErr:      service.ErrDeviceQueueFull,
+				wantCode:     http.StatusServiceUnavailable,
+				wantContains: "device command queue is full",
+			},
+			{
+				name:         "queue wait timeout returns 503",
+				mockErr:      service.ErrQueueWaitTimeout,
+				wantCode:     http.StatusServiceUnavailable,
+				wantContains: "timed out waiting for device command queue",
+			},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				h := NewCustomHandlers(logger, &mockExecutor{response: tt.mockResponse, err: tt.mockErr}, &ErrorHandler{logger: logger})
+				h := NewCustomHandlers(logger, &mockService{response: tt.mockResponse, err: tt.mockErr}, &ErrorHandler{logger: logger})
 				mux := http.NewServeMux()
 				mux.HandleFunc("POST /execute", h.Execute)
 
@@ -142,3 +221,92 @@ func TestExecute(t *testing.T) {
 		}
 	})
 }
+
+// invalidParamErr returns the validation error produced for an undeclared parameter.
+func invalidParamErr(t *testing.T) error {
+	_, err := (&models.Action{}).RenderParams(map[string]any{"speed": 1})
+	require.Error(t, err)
+	return err
+}
+
+func TestBulkExecute(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	partial := &service.BulkResult{Succeeded: 1, Failed: 1, Results: map[int]service.BulkDeviceResult{
+		1: {Response: &service.JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"ok":true}`), ID: 1}},
+		2: {Error: "calling device: connection refused"},
+	}}
+
+	tests := []struct {
+		name         string
+		body         string
+		mockResult   *service.BulkResult
+		mockErr      error
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "missing target returns 400",
+			body:         `{"actionId":1}`,
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid params",
+		},
+		{
+			name:         "missing actionId returns 400",
+			body:         `{"type":"watering"}`,
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid params",
+		},
+		{
+			name:         "all devices succeed returns 200",
+			body:         `{"type":"watering","actionId":1}`,
+			mockResult:   &service.BulkResult{Succeeded: 1, Results: map[int]service.BulkDeviceResult{1: {}}},
+			wantCode:     http.StatusOK,
+			wantContains: `"succeeded":1`,
+		},
+		{
+			name:         "partial failure returns 207",
+			body:         `{"tags":["garden"],"actionId":1}`,
+			mockResult:   partial,
+			wantCode:     http.StatusMultiStatus,
+			wantContains: `"2":{"error":"calling device: connection refused"}`,
+		},
+		{
+			name:         "no matching devices returns 404",
+			body:         `{"type":"heater","actionId":1}`,
+			mockErr:      service.ErrNoBulkTarget,
+			wantCode:     http.StatusNotFound,
+			wantContains: "no devices match the target",
+		},
+		{
+			name:         "invalid params return 400",
+			body:         `{"deviceIds":[1,2],"actionId":1}`,
+			mockErr:      fmt.Errorf("rendering: %w", invalidParamErr(t)),
+			wantCode:     http.StatusBadRequest,
+			wantContains: "unknown parameter 'speed'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, &mockService{bulk: tt.mockResult, err: tt.mockErr}, &ErrorHandler{logger: logger})
+
+			rec := httptest.NewRecorder()
+			h.BulkExecute(rec, httptest.NewRequest("POST", "/execute/bulk", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+		})
+	}
+
+	t.Run("target is passed to the service", func(t *testing.T) {
+		svc := &mockService{bulk: &service.BulkResult{}}
+		h := NewCustomHandlers(logger, svc, &ErrorHandler{logger: logger})
+
+		rec := httptest.NewRecorder()
+		h.BulkExecute(rec, httptest.NewRequest("POST", "/execute/bulk", strings.NewReader(`{"deviceIds":[3],"type":"watering","tags":["garden"],"actionId":1}`)))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, service.BulkTarget{DeviceIDs: []int{3}, Type: "watering", Tags: []string{"garden"}}, svc.target)
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// GroupDevices lists the devices in a group.
+func (h *CustomHandlers) GroupDevices(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return
+	}
+
+	devices, err := h.service.GroupDevices(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get group devices", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, devices)
+}
+
+// AllGroupDevices lists every group membership.
+func (h *CustomHandlers) AllGroupDevices(w http.ResponseWriter, r *http.Request) {
+	groupDevices, err := h.service.AllGroupDevices(r.Context())
+	if err != nil {
+		h.WriteError(w, r, err, "failed to get group devices", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, groupDevices)
+}
+
+// AddGroupDevice adds a device to a group.
+func (h *CustomHandlers) AddGroupDevice(w http.ResponseWriter, r *http.Request) {
+	groupId, deviceId, ok := h.groupDeviceParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.AddGroupDevice(r.Context(), groupId, deviceId)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to add device to group", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveGroupDevice removes a device from a group.
+func (h *CustomHandlers) RemoveGroupDevice(w http.ResponseWriter, r *http.Request) {
+	groupId, deviceId, ok := h.groupDeviceParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.RemoveGroupDevice(r.Context(), groupId, deviceId)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.WriteError(w, r, err, "resource not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to remove device from group", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CustomHandlers) groupDeviceParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	groupId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	deviceId, err := strconv.Atoi(r.PathValue("deviceId"))
+	if err != nil {
+		h.WriteError(w, r, err, "invalid param", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return groupId, deviceId, true
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestGroupDeviceRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+	}{
+		{
+			name:         "lists group devices",
+			method:       "GET",
+			path:         "/groups/1/devices",
+			svc:          &mockService{devices: []*models.Device{{ID: 2, Name: "fan"}}},
+			wantCode:     http.StatusOK,
+			wantContains: `"name":"fan"`,
+		},
+		{
+			name:         "lists all memberships",
+			method:       "GET",
+			path:         "/groups/devices",
+			svc:          &mockService{members: []models.GroupDevice{{GroupID: 1, DeviceID: 2}}},
+			wantCode:     http.StatusOK,
+			wantContains: `[{"group_id":1,"device_id":2}]`,
+		},
+		{
+			name:     "adds device",
+			method:   "PUT",
+			path:     "/groups/1/devices/2",
+			svc:      &mockService{},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "removes device",
+			method:   "DELETE",
+			path:     "/groups/1/devices/2",
+			svc:      &mockService{},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:         "unknown group or device returns 404",
+			method:       "PUT",
+			path:         "/groups/1/devices/9",
+			svc:          &mockService{err: fmt.Errorf("getting device: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "removing a device that isn't a member returns 404",
+			method:       "DELETE",
+			path:         "/groups/1/devices/9",
+			svc:          &mockService{err: fmt.Errorf("removing device 9 from group 1: %w", sql.ErrNoRows)},
+			wantCode:     http.StatusNotFound,
+			wantContains: "resource not found",
+		},
+		{
+			name:         "invalid device id returns 400",
+			method:       "PUT",
+			path:         "/groups/1/devices/abc",
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "invalid param",
+		},
+		{
+			name:         "service error returns 500",
+			method:       "GET",
+			path:         "/groups/1/devices",
+			svc:          &mockService{err: errors.New("boom")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to get group devices",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /groups/devices", h.AllGroupDevices)
+			mux.HandleFunc("GET /groups/{id}/devices", h.GroupDevices)
+			mux.HandleFunc("PUT /groups/{id}/devices/{deviceId}", h.AddGroupDevice)
+			mux.HandleFunc("DELETE /groups/{id}/devices/{deviceId}", h.RemoveGroupDevice)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+		})
+	}
+}
@@ -2,25 +2,117 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"net/http"
 
+	"github.com/tender-barbarian/gniotek/repository/models"
 	"github.com/tender-barbarian/gniotek/service"
 )
 
 type Executor interface {
-	Execute(ctx context.Context, deviceId, actionId int) (*service.JSONRPCResponse, error)
+	Execute(ctx context.Context, deviceId, actionId int, params map[string]any) (*service.JSONRPCResponse, error)
+}
+
+type DeviceStatusProvider interface {
+	DeviceStatus(ctx context.Context, deviceId int) (*service.DeviceStatus, error)
+	QueueStatuses() []service.QueueStatus
+}
+
+type Discoverer interface {
+	Discover(ctx context.Context) ([]service.DiscoveredDevice, error)
+	UnclaimedDevices(ctx context.Context) ([]service.DiscoveredDevice, error)
+	UnclaimedDevice(ctx context.Context, id int) (*service.DiscoveredDevice, error)
+	AdoptDevice(ctx context.Context, id int, device *models.Device) (int, error)
+}
+
+type StateReporter interface {
+	ReportState(ctx context.Context, deviceId int, token string, state map[string]any) error
+}
+
+type WebhookTrigger interface {
+	TriggerWebhook(ctx context.Context, name string, data map[string]any) error
+}
+
+type BulkExecutor interface {
+	BulkExecute(ctx context.Context, target service.BulkTarget, actionId int, params map[string]any, concurrency int) (*service.BulkResult, error)
+}
+
+type JobSubmitter interface {
+	SubmitJob(ctx context.Context, deviceId, actionId int, params map[string]any) (*models.Job, error)
+}
+
+type DeviceActionManager interface {
+	DeviceActions(ctx context.Context, deviceId int) ([]*models.Action, error)
+	AllDeviceActions(ctx context.Context) ([]models.DeviceAction, error)
+	AttachAction(ctx context.Context, deviceId, actionId int) error
+	DetachAction(ctx context.Context, deviceId, actionId int) error
+}
+
+type GroupDeviceManager interface {
+	GroupDevices(ctx context.Context, groupId int) ([]*models.Device, error)
+	AllGroupDevices(ctx context.Context) ([]models.GroupDevice, error)
+	AddGroupDevice(ctx context.Context, groupId, deviceId int) error
+	RemoveGroupDevice(ctx context.Context, groupId, deviceId int) error
+}
+
+type DependencyManager interface {
+	DeviceDependents(ctx context.Context, id int) (*service.Dependents, error)
+	ActionDependents(ctx context.Context, id int) (*service.Dependents, error)
+	GroupDependents(ctx context.Context, id int) (*service.Dependents, error)
+	AutomationDependents(ctx context.Context, id int) (*service.Dependents, error)
+	RenameDevice(ctx context.Context, id int, name string) ([]service.Dependent, error)
+	RenameAction(ctx context.Context, id int, name string) ([]service.Dependent, error)
+	RenameGroup(ctx context.Context, id int, name string) ([]service.Dependent, error)
+	RenameAutomation(ctx context.Context, id int, name string) ([]service.Dependent, error)
+}
+
+type AutomationDryRunner interface {
+	DryRunAutomation(ctx context.Context, id int) (*service.DryRun, error)
+}
+
+type Service interface {
+	Executor
+	DeviceActionManager
+	GroupDeviceManager
+	DependencyManager
+	BulkExecutor
+	JobSubmitter
+	DeviceStatusProvider
+	Discoverer
+	StateReporter
+	WebhookTrigger
+	AutomationDryRunner
 }
 
 type CustomHandlers struct {
 	logger  *slog.Logger
-	service Executor
+	service Service
 	*ErrorHandler
 }
 
-func NewCustomHandlers(logger *slog.Logger, service Executor, eh *ErrorHandler) *CustomHandlers {
+func NewCustomHandlers(logger *slog.Logger, service Service, eh *ErrorHandler) *CustomHandlers {
 	return &CustomHandlers{
 		logger:       logger,
 		service:      service,
 		ErrorHandler: eh,
 	}
 }
+
+func (h *CustomHandlers) writeJSON(w http.ResponseWriter, v any) {
+	h.writeJSONStatus(w, http.StatusOK, v)
+}
+
+func (h *CustomHandlers) writeJSONStatus(w http.ResponseWriter, statusCode int, v any) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err = w.Write(buf); err != nil {
+		h.logger.Error("failed to write output", "error", err)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+type mockService struct {
+	response   *service.JSONRPCResponse
+	status     *service.DeviceStatus
+	err        error
+	params     map[string]any
+	discovered []service.DiscoveredDevice
+	adoptErr   error
+	adopted    *models.Device
+	token      string
+	state      map[string]any
+	webhook    string
+	job        *models.Job
+	queues     []service.QueueStatus
+	bulk       *service.BulkResult
+	target     service.BulkTarget
+	actions    []*models.Action
+	assigned   []models.DeviceAction
+	devices    []*models.Device
+	members    []models.GroupDevice
+	dependents *service.Dependents
+	renamed    string
+	dryRun     *service.DryRun
+}
+
+func (m *mockService) Execute(ctx context.Context, deviceId, actionId int, params map[string]any) (*service.JSONRPCResponse, error) {
+	m.params = params
+	return m.response, m.err
+}
+
+func (m *mockService) DeviceStatus(ctx context.Context, deviceId int) (*service.DeviceStatus, error) {
+	return m.status, m.err
+}
+
+func (m *mockService) Discover(ctx context.Context) ([]service.DiscoveredDevice, error) {
+	return m.discovered, m.err
+}
+
+func (m *mockService) UnclaimedDevices(ctx context.Context) ([]service.DiscoveredDevice, error) {
+	return m.discovered, m.err
+}
+
+func (m *mockService) UnclaimedDevice(ctx context.Context, id int) (*service.DiscoveredDevice, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, d := range m.discovered {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, service.ErrUnclaimedNotFound
+}
+
+func (m *mockService) AdoptDevice(ctx context.Context, id int, device *models.Device) (int, error) {
+	m.adopted = device
+	return 7, m.adoptErr
+}
+
+func (m *mockService) ReportState(ctx context.Context, deviceId int, token string, state map[string]any) error {
+	m.token = token
+	m.state = state
+	return m.err
+}
+
+func (m *mockService) TriggerWebhook(ctx context.Context, name string, data map[string]any) error {
+	m.webhook = name
+	m.state = data
+	return m.err
+}
+
+func (m *mockService) SubmitJob(ctx context.Context, deviceId, actionId int, params map[string]any) (*models.Job, error) {
+	m.params = params
+	return m.job, m.err
+}
+
+func (m *mockService) QueueStatuses() []service.QueueStatus {
+	return m.queues
+}
+
+func (m *mockService) BulkExecute(ctx context.Context, target service.BulkTarget, actionId int, params map[string]any, concurrency int) (*service.BulkResult, error) {
+	m.target = target
+	m.params = params
+	return m.bulk, m.err
+}
+
+func (m *mockService) DeviceActions(ctx context.Context, deviceId int) ([]*models.Action, error) {
+	return m.actions, m.err
+}
+
+func (m *mockService) AllDeviceActions(ctx context.Context) ([]models.DeviceAction, error) {
+	return m.assigned, m.err
+}
+
+func (m *mockService) AttachAction(ctx context.Context, deviceId, actionId int) error {
+	if m.err == nil {
+		m.assigned = append(m.assigned, models.DeviceAction{DeviceID: deviceId, ActionID: actionId})
+	}
+	return m.err
+}
+
+func (m *mockService) DetachAction(ctx context.Context, deviceId, actionId int) error {
+	return m.err
+}
+
+func (m *mockService) GroupDevices(ctx context.Context, groupId int) ([]*models.Device, error) {
+	return m.devices, m.err
+}
+
+func (m *mockService) AllGroupDevices(ctx context.Context) ([]models.GroupDevice, error) {
+	return m.members, m.err
+}
+
+func (m *mockService) AddGroupDevice(ctx context.Context, groupId, deviceId int) error {
+	if m.err == nil {
+		m.members = append(m.members, models.GroupDevice{GroupID: groupId, DeviceID: deviceId})
+	}
+	return m.err
+}
+
+func (m *mockService) RemoveGroupDevice(ctx context.Context, groupId, deviceId int) error {
+	return m.err
+}
+
+func (m *mockService) DeviceDependents(ctx context.Context, id int) (*service.Dependents, error) {
+	return m.dependents, m.err
+}
+
+func (m *mockService) ActionDependents(ctx context.Context, id int) (*service.Dependents, error) {
+	return m.dependents, m.err
+}
+
+func (m *mockService) GroupDependents(ctx context.Context, id int) (*service.Dependents, error) {
+	return m.dependents, m.err
+}
+
+func (m *mockService) AutomationDependents(ctx context.Context, id int) (*service.Dependents, error) {
+	return m.dependents, m.err
+}
+
+func (m *mockService) RenameDevice(ctx context.Context, id int, name string) ([]service.Dependent, error) {
+	return m.rename(name)
+}
+
+func (m *mockService) RenameAction(ctx context.Context, id int, name string) ([]service.Dependent, error) {
+	return m.rename(name)
+}
+
+func (m *mockService) RenameGroup(ctx context.Context, id int, name string) ([]service.Dependent, error) {
+	return m.rename(name)
+}
+
+func (m *mockService) RenameAutomation(ctx context.Context, id int, name string) ([]service.Dependent, error) {
+	return m.rename(name)
+}
+
+func (m *mockService) rename(name string) ([]service.Dependent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.renamed = name
+	if m.dependents == nil {
+		return []service.Dependent{}, nil
+	}
+	return m.dependents.Automations, nil
+}
+
+func (m *mockService) DryRunAutomation(ctx context.Context, id int) (*service.DryRun, error) {
+	return m.dryRun, m.err
+}
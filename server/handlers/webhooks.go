@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+// Webhook publishes a webhook event for the automations listening on the webhook name.
+// The optional body must be a JSON object; its fields can be used in event conditions.
+func (h *CustomHandlers) Webhook(w http.ResponseWriter, r *http.Request) {
+	var data map[string]any
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		h.WriteError(w, r, err, "payload must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.TriggerWebhook(r.Context(), r.PathValue("name"), data)
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		h.WriteError(w, r, err, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.WriteError(w, r, err, "failed to trigger webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
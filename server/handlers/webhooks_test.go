@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tender-barbarian/gniotek/service"
+)
+
+func TestWebhook(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name         string
+		body         string
+		svc          *mockService
+		wantCode     int
+		wantContains string
+		wantData     map[string]any
+	}{
+		{
+			name:     "payload is passed on",
+			body:     `{"pressed":1}`,
+			svc:      &mockService{},
+			wantCode: http.StatusAccepted,
+			wantData: map[string]any{"pressed": float64(1)},
+		},
+		{
+			name:     "empty body",
+			svc:      &mockService{},
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:         "non-object payload returns 400",
+			body:         `[1,2]`,
+			svc:          &mockService{},
+			wantCode:     http.StatusBadRequest,
+			wantContains: "payload must be a JSON object",
+		},
+		{
+			name:         "unknown webhook returns 404",
+			svc:          &mockService{err: service.ErrWebhookNotFound},
+			wantCode:     http.StatusNotFound,
+			wantContains: "webhook not found",
+		},
+		{
+			name:         "service error returns 500",
+			svc:          &mockService{err: errors.New("db down")},
+			wantCode:     http.StatusInternalServerError,
+			wantContains: "failed to trigger webhook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCustomHandlers(logger, tt.svc, NewErrorHandler(logger))
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /webhooks/{name}", h.Webhook)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("POST", "/webhooks/doorbell", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantContains)
+			if tt.wantCode == http.StatusAccepted {
+				assert.Equal(t, "doorbell", tt.svc.webhook)
+				assert.Equal(t, tt.wantData, tt.svc.state)
+			}
+		})
+	}
+}
@@ -20,7 +20,40 @@ func RegisterGenericRoutes[M gocrud.Model](ctx context.Context, mux *http.ServeM
 	return mux
 }
 
+// RegisterReadOnlyRoutes exposes a resource that only the server writes, such as jobs.
+func RegisterReadOnlyRoutes[M gocrud.Model](mux *http.ServeMux, eh *handlers.ErrorHandler, repo repository.GenericRepo[M]) *http.ServeMux {
+	gocrud.RegisterGet(fmt.Sprintf("GET /%s/{id}", repo.GetTable()), mux, repo.Get, eh)
+	gocrud.RegisterGetAll(fmt.Sprintf("GET /%s", repo.GetTable()), mux, repo.GetAll, eh)
+
+	return mux
+}
+
 func RegisterCustomRoutes(mux *http.ServeMux, h *handlers.CustomHandlers) *http.ServeMux {
 	mux.HandleFunc("POST /execute", h.Execute)
+	mux.HandleFunc("POST /execute/bulk", h.BulkExecute)
+	mux.HandleFunc("GET /devices/{id}/status", h.DeviceStatus)
+	mux.HandleFunc("GET /devices/queues", h.DeviceQueues)
+	mux.HandleFunc("GET /devices/actions", h.AllDeviceActions)
+	mux.HandleFunc("GET /devices/{id}/actions", h.DeviceActions)
+	mux.HandleFunc("PUT /devices/{id}/actions/{actionId}", h.AttachAction)
+	mux.HandleFunc("DELETE /devices/{id}/actions/{actionId}", h.DetachAction)
+	mux.HandleFunc("POST /devices/{id}/events", h.ReportState)
+	mux.HandleFunc("GET /devices/{id}/dependents", h.DeviceDependents)
+	mux.HandleFunc("POST /devices/{id}/rename", h.RenameDevice)
+	mux.HandleFunc("GET /actions/{id}/dependents", h.ActionDependents)
+	mux.HandleFunc("POST /actions/{id}/rename", h.RenameAction)
+	mux.HandleFunc("GET /groups/devices", h.AllGroupDevices)
+	mux.HandleFunc("GET /groups/{id}/devices", h.GroupDevices)
+	mux.HandleFunc("PUT /groups/{id}/devices/{deviceId}", h.AddGroupDevice)
+	mux.HandleFunc("DELETE /groups/{id}/devices/{deviceId}", h.RemoveGroupDevice)
+	mux.HandleFunc("GET /groups/{id}/dependents", h.GroupDependents)
+	mux.HandleFunc("POST /groups/{id}/rename", h.RenameGroup)
+	mux.HandleFunc("POST /devices/discover", h.Discover)
+	mux.HandleFunc("GET /devices/unclaimed", h.UnclaimedDevices)
+	mux.HandleFunc("POST /devices/unclaimed/{id}/adopt", h.AdoptDevice)
+	mux.HandleFunc("POST /webhooks/{name}", h.Webhook)
+	mux.HandleFunc("POST /automations/{id}/dry-run", h.DryRunAutomation)
+	mux.HandleFunc("GET /automations/{id}/dependents", h.AutomationDependents)
+	mux.HandleFunc("POST /automations/{id}/rename", h.RenameAutomation)
 	return mux
 }
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/tender-barbarian/gniotek/server/middleware"
 	"github.com/tender-barbarian/gniotek/server/routes"
 	"github.com/tender-barbarian/gniotek/service"
+	"github.com/tender-barbarian/gniotek/solar"
 	"github.com/tender-barbarian/gniotek/web"
 	gocrud "github.com/tender-barbarian/go-crud"
 )
@@ -30,6 +33,127 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func deviceCallConfig() (service.RetryConfig, service.BreakerConfig, error) {
+	var retryCfg service.RetryConfig
+	var breakerCfg service.BreakerConfig
+	var err error
+
+	if retryCfg.MaxAttempts, err = strconv.Atoi(getEnv("DEVICE_RETRY_ATTEMPTS", "3")); err != nil {
+		return retryCfg, breakerCfg, fmt.Errorf("parsing DEVICE_RETRY_ATTEMPTS: %v", err)
+	}
+	if retryCfg.BaseDelay, err = time.ParseDuration(getEnv("DEVICE_RETRY_BASE_DELAY", "200ms")); err != nil {
+		return retryCfg, breakerCfg, fmt.Errorf("parsing DEVICE_RETRY_BASE_DELAY: %v", err)
+	}
+	if retryCfg.MaxDelay, err = time.ParseDuration(getEnv("DEVICE_RETRY_MAX_DELAY", "5s")); err != nil {
+		return retryCfg, breakerCfg, fmt.Errorf("parsing DEVICE_RETRY_MAX_DELAY: %v", err)
+	}
+	if breakerCfg.FailureThreshold, err = strconv.Atoi(getEnv("DEVICE_BREAKER_THRESHOLD", "5")); err != nil {
+		return retryCfg, breakerCfg, fmt.Errorf("parsing DEVICE_BREAKER_THRESHOLD: %v", err)
+	}
+	if breakerCfg.OpenTimeout, err = time.ParseDuration(getEnv("DEVICE_BREAKER_OPEN_TIMEOUT", "30s")); err != nil {
+		return retryCfg, breakerCfg, fmt.Errorf("parsing DEVICE_BREAKER_OPEN_TIMEOUT: %v", err)
+	}
+
+	return retryCfg, breakerCfg, nil
+}
+
+func healthConfig() (service.HealthConfig, time.Duration, error) {
+	cfg := service.HealthConfig{Method: getEnv("HEALTH_CHECK_METHOD", "ping")}
+
+	interval, err := time.ParseDuration(getEnv("HEALTH_CHECK_INTERVAL", "30s"))
+	if err != nil {
+		return cfg, 0, fmt.Errorf("parsing HEALTH_CHECK_INTERVAL: %v", err)
+	}
+	if cfg.Timeout, err = time.ParseDuration(getEnv("HEALTH_CHECK_TIMEOUT", "5s")); err != nil {
+		return cfg, 0, fmt.Errorf("parsing HEALTH_CHECK_TIMEOUT: %v", err)
+	}
+	if cfg.OfflineAfter, err = strconv.Atoi(getEnv("HEALTH_CHECK_OFFLINE_AFTER", "2")); err != nil {
+		return cfg, 0, fmt.Errorf("parsing HEALTH_CHECK_OFFLINE_AFTER: %v", err)
+	}
+
+	return cfg, interval, nil
+}
+
+func discoveryConfig() (service.DiscoveryConfig, time.Duration, error) {
+	cfg := service.DiscoveryConfig{Method: getEnv("DISCOVERY_METHOD", "gniotek.discover")}
+	for _, target := range strings.Split(getEnv("DISCOVERY_TARGETS", "255.255.255.255:47474"), ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			cfg.Targets = append(cfg.Targets, target)
+		}
+	}
+
+	interval, err := time.ParseDuration(getEnv("DISCOVERY_INTERVAL", "5m"))
+	if err != nil {
+		return cfg, 0, fmt.Errorf("parsing DISCOVERY_INTERVAL: %v", err)
+	}
+	if cfg.Wait, err = time.ParseDuration(getEnv("DISCOVERY_WAIT", "2s")); err != nil {
+		return cfg, 0, fmt.Errorf("parsing DISCOVERY_WAIT: %v", err)
+	}
+	if cfg.MaxAge, err = time.ParseDuration(getEnv("DISCOVERY_MAX_AGE", "15m")); err != nil {
+		return cfg, 0, fmt.Errorf("parsing DISCOVERY_MAX_AGE: %v", err)
+	}
+
+	return cfg, interval, nil
+}
+
+func queueConfig() (service.QueueConfig, error) {
+	var cfg service.QueueConfig
+	var err error
+
+	if cfg.MaxDepth, err = strconv.Atoi(getEnv("DEVICE_QUEUE_DEPTH", "16")); err != nil {
+		return cfg, fmt.Errorf("parsing DEVICE_QUEUE_DEPTH: %v", err)
+	}
+	if cfg.WaitTimeout, err = time.ParseDuration(getEnv("DEVICE_QUEUE_WAIT_TIMEOUT", "30s")); err != nil {
+		return cfg, fmt.Errorf("parsing DEVICE_QUEUE_WAIT_TIMEOUT: %v", err)
+	}
+	if cfg.IdleTTL, err = time.ParseDuration(getEnv("DEVICE_QUEUE_IDLE_TTL", "10m")); err != nil {
+		return cfg, fmt.Errorf("parsing DEVICE_QUEUE_IDLE_TTL: %v", err)
+	}
+
+	return cfg, nil
+}
+
+func jobsConfig() (service.JobsConfig, error) {
+	var cfg service.JobsConfig
+	var err error
+
+	if cfg.Workers, err = strconv.Atoi(getEnv("JOB_WORKERS", "4")); err != nil {
+		return cfg, fmt.Errorf("parsing JOB_WORKERS: %v", err)
+	}
+	if cfg.QueueSize, err = strconv.Atoi(getEnv("JOB_QUEUE_SIZE", "100")); err != nil {
+		return cfg, fmt.Errorf("parsing JOB_QUEUE_SIZE: %v", err)
+	}
+	if cfg.MaxAge, err = time.ParseDuration(getEnv("JOB_MAX_AGE", "168h")); err != nil {
+		return cfg, fmt.Errorf("parsing JOB_MAX_AGE: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// siteConfig returns the site location used for sunrise and sunset, or nil when no
+// coordinates are set.
+func siteConfig() (*solar.Site, error) {
+	lat, lon := getEnv("SITE_LATITUDE", ""), getEnv("SITE_LONGITUDE", "")
+	if lat == "" && lon == "" {
+		return nil, nil
+	}
+
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SITE_LATITUDE: %v", err)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SITE_LONGITUDE: %v", err)
+	}
+	site, err := solar.NewSite(latitude, longitude, getEnv("SITE_TIMEZONE", "Local"))
+	if err != nil {
+		return nil, fmt.Errorf("configuring site: %v", err)
+	}
+
+	return site, nil
+}
+
 func Run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -49,21 +173,87 @@ func Run() error {
 	actionsCache := cache.NewCache[*models.Action]()
 	actionsRepo := gocrud.NewGenericRepository(db, "actions", func() *models.Action { return &models.Action{} }).WithValidate().WithOnMutate(actionsCache.InvalidateCache)
 	automationsRepo := gocrud.NewGenericRepository(db, "automations", func() *models.Automation { return &models.Automation{} }).WithValidate()
+	jobsRepo := gocrud.NewGenericRepository(db, "jobs", func() *models.Job { return &models.Job{} })
+	groupsRepo := gocrud.NewGenericRepository(db, "groups", func() *models.Group { return &models.Group{} }).WithValidate()
 
-	queryRepo := repository.NewQueryRepo(db, []string{"devices", "actions", "automations"})
+	queryRepo := repository.NewQueryRepo(db, []string{"devices", "actions", "automations", "groups"})
 
 	// Initialize helpers
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// Initialize optional transports
+	transports := map[string]service.Transport{}
+	if broker := getEnv("MQTT_BROKER", ""); broker != "" {
+		mqttClient, err := service.NewPahoMQTTClient(broker, getEnv("MQTT_CLIENT_ID", "gniotek"), os.Getenv("MQTT_USERNAME"), os.Getenv("MQTT_PASSWORD"))
+		if err != nil {
+			return fmt.Errorf("starting MQTT client: %v", err)
+		}
+		mqttTransport, err := service.NewMQTTTransport(mqttClient, getEnv("MQTT_TOPIC_PREFIX", "gniotek"))
+		if err != nil {
+			return fmt.Errorf("starting MQTT transport: %v", err)
+		}
+		transports[models.TransportMQTT] = mqttTransport
+	}
+
+	retryCfg, breakerCfg, err := deviceCallConfig()
+	if err != nil {
+		return err
+	}
+	callTimeout, err := time.ParseDuration(getEnv("DEVICE_TIMEOUT", "10s"))
+	if err != nil {
+		return fmt.Errorf("parsing DEVICE_TIMEOUT: %v", err)
+	}
+	healthCfg, healthInterval, err := healthConfig()
+	if err != nil {
+		return err
+	}
+	discoveryCfg, discoveryInterval, err := discoveryConfig()
+	if err != nil {
+		return err
+	}
+	jobsCfg, err := jobsConfig()
+	if err != nil {
+		return err
+	}
+	queueCfg, err := queueConfig()
+	if err != nil {
+		return err
+	}
+	bulkConcurrency, err := strconv.Atoi(getEnv("BULK_CONCURRENCY", "4"))
+	if err != nil {
+		return fmt.Errorf("parsing BULK_CONCURRENCY: %v", err)
+	}
+	site, err := siteConfig()
+	if err != nil {
+		return err
+	}
+	misfireGrace, err := time.ParseDuration(getEnv("AUTOMATIONS_MISFIRE_GRACE", "5m"))
+	if err != nil {
+		return fmt.Errorf("parsing AUTOMATIONS_MISFIRE_GRACE: %v", err)
+	}
+
 	// Initialize service
 	svc := service.NewService(service.ServiceConfig{
 		DevicesRepo:     devicesRepo,
 		ActionsRepo:     actionsRepo,
 		AutomationsRepo: automationsRepo,
+		JobsRepo:        jobsRepo,
+		GroupsRepo:      groupsRepo,
 		QueryRepo:       queryRepo,
 		DevicesCache:    devicesCache,
 		ActionsCache:    actionsCache,
 		Logger:          logger,
+		Transports:      transports,
+		Retry:           retryCfg,
+		Breaker:         breakerCfg,
+		CallTimeout:     callTimeout,
+		Health:          healthCfg,
+		Discovery:       discoveryCfg,
+		Jobs:            jobsCfg,
+		Queue:           queueCfg,
+		BulkConcurrency: bulkConcurrency,
+		Site:            site,
+		MisfireGrace:    misfireGrace,
 	})
 
 	// Initialize handlers and routes
@@ -72,9 +262,12 @@ func Run() error {
 	errorHandler := handlers.NewErrorHandler(logger)
 	customHandlers := handlers.NewCustomHandlers(logger, svc, errorHandler)
 	mux = routes.RegisterCustomRoutes(mux, customHandlers)
-	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, devicesRepo)
-	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, actionsRepo)
-	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, automationsRepo)
+	// Deletes and renames check the automations referring to a record first
+	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, &repository.GuardedRepo[*models.Device]{GenericRepo: devicesRepo, CreateFunc: svc.CreateDevice, DeleteFunc: svc.DeleteDevice, UpdateFunc: svc.UpdateDevice})
+	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, &repository.GuardedRepo[*models.Action]{GenericRepo: actionsRepo, DeleteFunc: svc.DeleteAction, UpdateFunc: svc.UpdateAction})
+	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, &repository.GuardedRepo[*models.Automation]{GenericRepo: automationsRepo, CreateFunc: svc.CreateAutomation, DeleteFunc: svc.DeleteAutomation, UpdateFunc: svc.UpdateAutomation})
+	mux = routes.RegisterGenericRoutes(ctx, mux, errorHandler, &repository.GuardedRepo[*models.Group]{GenericRepo: groupsRepo, DeleteFunc: svc.DeleteGroup, UpdateFunc: svc.UpdateGroup})
+	mux = routes.RegisterReadOnlyRoutes(mux, errorHandler, jobsRepo)
 
 	// Start automation runner
 	automationsInterval, err := time.ParseDuration(getEnv("AUTOMATIONS_INTERVAL", "1m"))
@@ -89,6 +282,43 @@ func Run() error {
 		}
 	}()
 
+	// Start job workers
+	if err := svc.FailInterruptedJobs(ctx); err != nil {
+		return err
+	}
+	if err := svc.PruneJobs(ctx); err != nil {
+		return err
+	}
+	jobErrCh := make(chan error, 100)
+	go svc.RunJobWorkers(ctx, jobErrCh)
+	go func() {
+		for err := range jobErrCh {
+			logger.Error("job error", "error", err)
+		}
+	}()
+
+	// Start health checker
+	if healthInterval > 0 {
+		healthErrCh := make(chan error, 100)
+		go svc.RunHealthChecks(ctx, healthInterval, healthErrCh)
+		go func() {
+			for err := range healthErrCh {
+				logger.Error("health check error", "error", err)
+			}
+		}()
+	}
+
+	// Start device discovery
+	if discoveryInterval > 0 {
+		discoveryErrCh := make(chan error, 100)
+		go svc.RunDiscovery(ctx, discoveryInterval, discoveryErrCh)
+		go func() {
+			for err := range discoveryErrCh {
+				logger.Error("discovery error", "error", err)
+			}
+		}()
+	}
+
 	// Initialize middleware
 	var wrappedMux http.Handler = mux
 	wrappedMux = middleware.NewLoggingMiddleware(wrappedMux, logger)
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestHTTPTransport_Auth(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":1}`)) // nolint
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		device   models.Device
+		validate func(t *testing.T)
+	}{
+		{
+			name:   "no auth",
+			device: models.Device{},
+			validate: func(t *testing.T) {
+				assert.Empty(t, got.Header.Get("Authorization"))
+				assert.Empty(t, got.Header.Get(hmacSignatureHeader))
+			},
+		},
+		{
+			name:   "bearer token",
+			device: models.Device{AuthType: models.AuthBearer, AuthSecret: "s3cret"},
+			validate: func(t *testing.T) {
+				assert.Equal(t, "Bearer s3cret", got.Header.Get("Authorization"))
+			},
+		},
+		{
+			name:   "basic auth",
+			device: models.Device{AuthType: models.AuthBasic, AuthUsername: "admin", AuthSecret: "pass"},
+			validate: func(t *testing.T) {
+				user, pass, ok := got.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "admin", user)
+				assert.Equal(t, "pass", pass)
+			},
+		},
+		{
+			name:   "auth overrides custom authorization header",
+			device: models.Device{Headers: `{"Authorization":"Bearer stale"}`, AuthType: models.AuthBearer, AuthSecret: "fresh"},
+			validate: func(t *testing.T) {
+				assert.Equal(t, "Bearer fresh", got.Header.Get("Authorization"))
+			},
+		},
+		{
+			name:   "hmac signature over timestamp and body",
+			device: models.Device{AuthType: models.AuthHMAC, AuthSecret: "key"},
+			validate: func(t *testing.T) {
+				timestamp := got.Header.Get(hmacTimestampHeader)
+				unix, err := strconv.ParseInt(timestamp, 10, 64)
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now(), time.Unix(unix, 0), 5*time.Second)
+				assert.Equal(t, signRequest("key", timestamp, gotBody), got.Header.Get(hmacSignatureHeader))
+				assert.NotEqual(t, signRequest("other", timestamp, gotBody), got.Header.Get(hmacSignatureHeader))
+			},
+		},
+	}
+
+	transport := newHTTPTransport()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.device.IP = server.Listener.Addr().String()
+			_, err := transport.Call(context.Background(), &tt.device, &JSONRPCRequest{JSONRPC: "2.0", Method: "open", ID: 1})
+			require.NoError(t, err)
+			tt.validate(t)
+		})
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	// echo -n '1700000000.{"id":1}' | openssl dgst -sha256 -hmac key
+	assert.Equal(t, "1d542af0cd7355fefa5c19021ad89d3e2afd77ebff5448db280f180e013d2651", signRequest("key", "1700000000", []byte(`{"id":1}`)))
+}
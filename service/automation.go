@@ -1,8 +1,10 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -10,23 +12,76 @@ import (
 	"github.com/tender-barbarian/gniotek/repository/models"
 )
 
+const defaultMisfireGrace = 5 * time.Minute
+
+// RunAutomations checks the automations every interval and runs those whose interval
+// has elapsed. Scheduled automations are checked at their next fire time as well, so
+// they run on time however long the interval is. Automations with a matching event
+// run as soon as the event is published.
 func (s *Service) RunAutomations(ctx context.Context, interval time.Duration, errCh chan<- error) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// Every event is handled on its own goroutine, so a slow automation neither holds
+	// up nor drops the events published after it
+	s.Subscribe(func(event Event) {
+		if ctx.Err() != nil {
+			return
+		}
+		go func() {
+			if err := s.processEvent(ctx, event); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}()
+	})
+
+	timer := time.NewTimer(s.untilNextCheck(ctx, time.Now(), interval))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			if err := s.processAutomations(ctx); err != nil {
 				select {
 				case errCh <- err:
 				default:
 				}
 			}
+			timer.Reset(s.untilNextCheck(ctx, time.Now(), interval))
+		}
+	}
+}
+
+// untilNextCheck returns how long to wait before checking the automations again: the
+// interval, or less when a scheduled automation fires sooner.
+func (s *Service) untilNextCheck(ctx context.Context, now time.Time, interval time.Duration) time.Duration {
+	automations, err := s.automationsRepo.GetAll(ctx)
+	if err != nil {
+		s.logger.Warn("failed to get automations for scheduling", "error", err)
+		return interval
+	}
+
+	wait := interval
+	for _, automation := range automations {
+		if !automation.Enabled {
+			continue
+		}
+		definition, err := automation.ParseDefinition()
+		if err != nil {
+			continue
+		}
+		schedule, err := definition.ParseSchedule(s.site)
+		if err != nil || schedule == nil {
+			continue
+		}
+		if next := schedule.Next(now); !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
 		}
 	}
+
+	return wait
 }
 
 func (s *Service) processAutomations(ctx context.Context) error {
@@ -58,8 +113,12 @@ func (s *Service) processAutomations(ctx context.Context) error {
 }
 
 func (s *Service) processOneAutomation(ctx context.Context, automation *models.Automation, now time.Time) error {
+	mu := s.getAutomationMutex(automation.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
 	automation.LastCheck = now.Format(time.RFC3339)
-	if err := s.automationsRepo.Update(ctx, automation, automation.ID); err != nil {
+	if err := s.queryRepo.UpdateAutomationLastCheck(ctx, automation.ID, automation.LastCheck); err != nil {
 		s.logger.Warn("failed to update last check", "automation", automation.Name, "error", err)
 	}
 
@@ -68,7 +127,12 @@ func (s *Service) processOneAutomation(ctx context.Context, automation *models.A
 		return fmt.Errorf("parsing definition: %w", err)
 	}
 
-	// Check if the automation interval has elapsed
+	// Automations without an interval or schedule only run on events
+	if definition.Interval == "" && len(definition.Schedule) == 0 {
+		return nil
+	}
+
+	// Check if the automation interval has elapsed or a scheduled time has passed
 	var lastTriggered time.Time
 	if automation.LastTriggersRun != "" {
 		lastTriggered, err = time.Parse(time.RFC3339, automation.LastTriggersRun)
@@ -79,68 +143,241 @@ func (s *Service) processOneAutomation(ctx context.Context, automation *models.A
 		lastTriggered = automation.CreatedAt.Time
 	}
 
-	interval, err := time.ParseDuration(definition.Interval)
-	if err != nil {
-		return fmt.Errorf("parsing interval: %w", err)
-	}
+	if len(definition.Schedule) > 0 {
+		schedule, err := definition.ParseSchedule(s.site)
+		if err != nil {
+			return fmt.Errorf("parsing schedule: %w", err)
+		}
 
-	if lastTriggered.Add(interval).After(now) {
-		return nil
+		if due := schedule.Next(lastTriggered); due.IsZero() || due.After(now) {
+			return nil
+		}
+
+		// Fire times missed while the server was down run once, not once per fire time,
+		// and only when the latest of them is within the grace period
+		since := now.Add(-s.misfireGrace)
+		if lastTriggered.After(since) {
+			since = lastTriggered
+		}
+		if schedule.Next(since).After(now) {
+			s.logger.Warn("skipping missed fire time", "automation", automation.Name, "grace", s.misfireGrace)
+			return s.recordTriggersRun(ctx, automation, now)
+		}
+	} else {
+		interval, err := time.ParseDuration(definition.Interval)
+		if err != nil {
+			return fmt.Errorf("parsing interval: %w", err)
+		}
+
+		if lastTriggered.Add(interval).After(now) {
+			return nil
+		}
 	}
 
-	results, err := s.processTriggers(ctx, definition)
+	return s.runAutomation(ctx, automation, definition, now, []string{automation.Name})
+}
+
+// runAutomation evaluates the triggers and runs the actions when the conditions are met,
+// then publishes an automation_finished event. chain lists the automations whose runs
+// led to this one, ending with the automation itself.
+func (s *Service) runAutomation(ctx context.Context, automation *models.Automation, definition *models.AutomationDefinition, now time.Time, chain []string) error {
+	evaluation, err := s.evaluateAutomation(ctx, definition, now)
+
+	// The run is recorded even when a trigger can't be read, so that an unreachable
+	// device doesn't make the automation retry on every check
+	if err := s.recordTriggersRun(ctx, automation, now); err != nil {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("processing triggers: %w", err)
 	}
 
-	automation.LastTriggersRun = now.Format(time.RFC3339)
-	if err := s.automationsRepo.Update(ctx, automation, automation.ID); err != nil {
-		return fmt.Errorf("update triggers last run time: %w", err)
-	}
-
-	if !s.applyConditionLogic(results, definition.ConditionLogic) {
+	if !evaluation.Met {
 		return nil
 	}
 
+	// A failing action or device doesn't stop the others; the errors are returned
+	// once every action ran
+	var errs []error
 	for _, action := range definition.Actions {
-		result, err := s.executeAction(ctx, action.Device, action.Action)
+		deviceNames, err := s.actionDevices(ctx, action)
 		if err != nil {
-			return fmt.Errorf("executing action [%s] on device [%s]: %w", action.Action, action.Device, err)
+			errs = append(errs, fmt.Errorf("executing action [%s]: %w", action.Action, err))
+			continue
 		}
-
-		automation.LastActionRun = now.Format(time.RFC3339)
-		if err := s.automationsRepo.Update(ctx, automation, automation.ID); err != nil {
-			return fmt.Errorf("update automation action last run time: %w", err)
+		if len(deviceNames) == 0 {
+			s.logger.Warn("automation action selects no devices", "automation", automation.Name, "action", action.Action, "group", action.Group, "tags", action.Tags)
 		}
 
-		s.logger.Info("successfully executed automation action", "automation", automation.Name, "action", action.Action, "device", action.Device, "response from device", result)
+		for _, deviceName := range deviceNames {
+			result, err := s.executeAction(ctx, deviceName, action.Action, action.Params)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("executing action [%s] on device [%s]: %w", action.Action, deviceName, err))
+				continue
+			}
+
+			automation.LastActionRun = now.Format(time.RFC3339)
+			if err := s.queryRepo.UpdateAutomationLastActionRun(ctx, automation.ID, automation.LastActionRun); err != nil {
+				errs = append(errs, fmt.Errorf("update automation action last run time: %w", err))
+			}
+
+			s.logger.Info("successfully executed automation action", "automation", automation.Name, "action", action.Action, "device", deviceName, "response from device", result)
+		}
 	}
 
-	s.logger.Info("automation processed", "automation", automation.Name)
+	s.logger.Info("automation processed", "automation", automation.Name, "failed", len(errs))
+	s.publish(Event{
+		Type:       EventAutomationFinished,
+		Automation: automation.Name,
+		Time:       now,
+		Data:       map[string]any{"actions": len(definition.Actions), "failed": len(errs)},
+		chain:      chain,
+	})
+	return errors.Join(errs...)
+}
+
+// recordTriggersRun marks the fire time at now as handled.
+func (s *Service) recordTriggersRun(ctx context.Context, automation *models.Automation, now time.Time) error {
+	automation.LastTriggersRun = now.Format(time.RFC3339)
+	if err := s.queryRepo.UpdateAutomationLastTriggersRun(ctx, automation.ID, automation.LastTriggersRun); err != nil {
+		return fmt.Errorf("update triggers last run time: %w", err)
+	}
 	return nil
 }
 
-func (s *Service) processTriggers(ctx context.Context, def *models.AutomationDefinition) ([]bool, error) {
-	var results []bool
-	for _, trigger := range def.Triggers {
-		response, err := s.executeAction(ctx, trigger.Device, trigger.Action)
-		if err != nil {
-			return nil, fmt.Errorf("executing trigger, device [%s], action [%s]: %w", trigger.Device, trigger.Action, err)
+// processTriggers evaluates each trigger's conditions. A trigger on a group or tags is
+// met when all selected devices meet them, or any with match "any". Time triggers are
+// checked first; when one fails and all triggers must be met, the devices aren't read
+// at all and their triggers are skipped.
+func (s *Service) processTriggers(ctx context.Context, def *models.AutomationDefinition, now time.Time) ([]*Evaluation, error) {
+	loc, err := def.Location(s.site)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Evaluation, len(def.Triggers))
+	var deviceTriggers []models.AutomationTrigger
+	var indexes []int
+	for i, trigger := range def.Triggers {
+		results[i] = triggerNode(trigger)
+		if !trigger.IsTime() {
+			deviceTriggers = append(deviceTriggers, trigger)
+			indexes = append(indexes, i)
+			continue
+		}
+
+		if trigger.Time.UsesSun() && s.site == nil {
+			return nil, models.ErrNoSite
+		}
+		results[i].Met = trigger.Time.Matches(now.In(loc), s.site)
+	}
+
+	// Without a logic tree, a closed time window decides the result on its own
+	if def.Logic == nil && def.ConditionLogic != "or" {
+		for _, result := range results {
+			if result.Type == EvaluationTime && !result.Met {
+				for _, i := range indexes {
+					results[i].Skipped = true
+				}
+				return results, nil
+			}
 		}
+	}
+
+	triggers, owners, err := s.expandTriggers(ctx, deviceTriggers)
+	if err != nil {
+		return nil, err
+	}
 
-		s.logger.Info("successfully executed trigger", "device", trigger.Device, "action", trigger.Action, "response", response)
+	responses, err := s.readTriggers(ctx, triggers, now)
+	if err != nil {
+		return nil, err
+	}
 
-		met, err := s.evaluateConditions(response, trigger)
+	deviceResults := make([][]bool, len(deviceTriggers))
+	for i, trigger := range triggers {
+		evaluation, err := s.evaluateConditions(responses[i], trigger.Conditions)
 		if err != nil {
 			return nil, fmt.Errorf("evaluating conditions for trigger [%s/%s]: %w", trigger.Device, trigger.Action, err)
 		}
-		results = append(results, met)
+		evaluation.Type = EvaluationDevice
+		evaluation.Device = trigger.Device
+		result := results[indexes[owners[i]]]
+		result.Children = append(result.Children, evaluation)
+		deviceResults[owners[i]] = append(deviceResults[owners[i]], evaluation.Met)
+	}
+
+	for i, trigger := range deviceTriggers {
+		logic := "and"
+		if trigger.Match == models.TriggerMatchAny {
+			logic = "or"
+		}
+		results[indexes[i]].Met = s.applyConditionLogic(deviceResults[i], logic)
 	}
 
 	return results, nil
 }
 
-func (s *Service) executeAction(ctx context.Context, deviceName, actionName string) (map[string]any, error) {
+// readTriggers executes the action of every trigger and returns the parsed responses
+// in trigger order. Triggers reading from the same device are sent as one batch, and
+// reported triggers use the state last pushed by the device without calling it.
+func (s *Service) readTriggers(ctx context.Context, triggers []models.AutomationTrigger, now time.Time) ([]map[string]any, error) {
+	responses := make([]map[string]any, len(triggers))
+
+	var deviceOrder []string
+	byDevice := make(map[string][]int)
+	for i, trigger := range triggers {
+		if trigger.IsReported() {
+			state, err := s.readReportedState(ctx, trigger, now)
+			if err != nil {
+				return nil, fmt.Errorf("reading reported state, device [%s]: %w", trigger.Device, err)
+			}
+			responses[i] = state
+			continue
+		}
+
+		if _, ok := byDevice[trigger.Device]; !ok {
+			deviceOrder = append(deviceOrder, trigger.Device)
+		}
+		byDevice[trigger.Device] = append(byDevice[trigger.Device], i)
+	}
+
+	for _, deviceName := range deviceOrder {
+		indexes := byDevice[deviceName]
+
+		if len(indexes) == 1 {
+			trigger := triggers[indexes[0]]
+			response, err := s.executeAction(ctx, trigger.Device, trigger.Action, trigger.Params)
+			if err != nil {
+				return nil, fmt.Errorf("executing trigger, device [%s], action [%s]: %w", trigger.Device, trigger.Action, err)
+			}
+			responses[indexes[0]] = response
+		} else {
+			actionNames := make([]string, len(indexes))
+			params := make([]map[string]any, len(indexes))
+			for j, i := range indexes {
+				actionNames[j] = triggers[i].Action
+				params[j] = triggers[i].Params
+			}
+
+			batch, err := s.executeActionBatch(ctx, deviceName, actionNames, params)
+			if err != nil {
+				return nil, fmt.Errorf("executing triggers, device [%s]: %w", deviceName, err)
+			}
+			for j, i := range indexes {
+				responses[i] = batch[j]
+			}
+		}
+
+		for _, i := range indexes {
+			s.logger.Info("successfully executed trigger", "device", deviceName, "action", triggers[i].Action, "response", responses[i])
+		}
+	}
+
+	return responses, nil
+}
+
+func (s *Service) executeAction(ctx context.Context, deviceName, actionName string, params map[string]any) (map[string]any, error) {
 	deviceID, err := s.devicesCache.GetIDByName(ctx, s.queryRepo, "devices", deviceName)
 	if err != nil {
 		return nil, fmt.Errorf("looking up device: %w", err)
@@ -151,33 +388,54 @@ func (s *Service) executeAction(ctx context.Context, deviceName, actionName stri
 		return nil, fmt.Errorf("looking up action: %w", err)
 	}
 
-	response, err := s.Execute(ctx, deviceID, actionID)
+	response, err := s.execute(ctx, deviceID, actionID, params, PriorityAutomation)
 	if err != nil {
 		return nil, fmt.Errorf("executing action [%s]: %w", actionName, err)
 	}
 
-	var parsedResponse map[string]any
-	err = json.Unmarshal([]byte(response.Result), &parsedResponse)
+	return parseResult(response, deviceName, actionName)
+}
+
+func (s *Service) executeActionBatch(ctx context.Context, deviceName string, actionNames []string, params []map[string]any) ([]map[string]any, error) {
+	deviceID, err := s.devicesCache.GetIDByName(ctx, s.queryRepo, "devices", deviceName)
 	if err != nil {
-		return nil, fmt.Errorf("parsing trigger response, device [%s], action [%s]: %w", deviceName, actionName, err)
+		return nil, fmt.Errorf("looking up device: %w", err)
 	}
 
-	return parsedResponse, nil
-}
-
-func (s *Service) evaluateConditions(response map[string]any, trigger models.AutomationTrigger) (bool, error) {
-	for _, condition := range trigger.Conditions {
-		val, err := s.getFieldValue(response, condition.Field)
+	actionIDs := make([]int, len(actionNames))
+	for i, actionName := range actionNames {
+		actionIDs[i], err = s.actionsCache.GetIDByName(ctx, s.queryRepo, "actions", actionName)
 		if err != nil {
-			return false, fmt.Errorf("getting field [%s] value: %w", condition.Field, err)
+			return nil, fmt.Errorf("looking up action: %w", err)
 		}
+	}
+
+	results, err := s.executeBatch(ctx, deviceID, actionIDs, params)
+	if err != nil {
+		return nil, err
+	}
 
-		if !evaluateOperator(val, condition.Operator, condition.Threshold) {
-			return false, nil
+	responses := make([]map[string]any, len(results))
+	for i, result := range results {
+		if result.err != nil {
+			return nil, fmt.Errorf("executing action [%s]: %w", actionNames[i], result.err)
+		}
+		if responses[i], err = parseResult(result.response, deviceName, actionNames[i]); err != nil {
+			return nil, err
 		}
 	}
 
-	return true, nil
+	return responses, nil
+}
+
+func parseResult(response *JSONRPCResponse, deviceName, actionName string) (map[string]any, error) {
+	var parsedResponse map[string]any
+	err := json.Unmarshal([]byte(response.Result), &parsedResponse)
+	if err != nil {
+		return nil, fmt.Errorf("parsing trigger response, device [%s], action [%s]: %w", deviceName, actionName, err)
+	}
+
+	return parsedResponse, nil
 }
 
 func (s *Service) applyConditionLogic(results []bool, logic string) bool {
@@ -202,7 +460,40 @@ func (s *Service) applyConditionLogic(results []bool, logic string) bool {
 	return true
 }
 
-func evaluateOperator(value float64, operator string, threshold float64) bool {
+// evaluateOperator compares a field value with a threshold. Numbers and strings take
+// every operator, strings comparing lexically; booleans only compare for equality. A
+// null threshold matches on whether the value is null, whatever its type; otherwise
+// the value must have the type of the threshold.
+func evaluateOperator(value any, operator string, threshold any) (bool, error) {
+	v, valueType, ok := models.NormalizeValue(value)
+	if !ok {
+		return false, fmt.Errorf("value %v is not a number, string, boolean or null", value)
+	}
+	t, thresholdType, ok := models.NormalizeValue(threshold)
+	if !ok {
+		return false, fmt.Errorf("threshold %v is not a number, string, boolean or null", threshold)
+	}
+
+	if thresholdType == models.ValueNull {
+		return compareEqual(valueType == models.ValueNull, operator, true), nil
+	}
+	if valueType != thresholdType {
+		return false, fmt.Errorf("cannot compare %s value %v with %s threshold %v", valueType, v, thresholdType, t)
+	}
+
+	switch v := v.(type) {
+	case float64:
+		return compareOrdered(v, operator, t.(float64)), nil
+	case string:
+		return compareOrdered(v, operator, t.(string)), nil
+	case bool:
+		return compareEqual(v, operator, t.(bool)), nil
+	}
+
+	return false, nil
+}
+
+func compareOrdered[T cmp.Ordered](value T, operator string, threshold T) bool {
 	switch operator {
 	case ">":
 		return value > threshold
@@ -221,29 +512,37 @@ func evaluateOperator(value float64, operator string, threshold float64) bool {
 	return false
 }
 
-func (s *Service) getFieldValue(data map[string]any, field string) (float64, error) {
+func compareEqual(value bool, operator string, threshold bool) bool {
+	switch operator {
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+
+	return false
+}
+
+// getFieldValue returns the value of a field, following dots into nested objects.
+// Numbers are returned as float64.
+func (s *Service) getFieldValue(data map[string]any, field string) (any, error) {
 	parts := strings.Split(field, ".")
 
 	var current any = data
 	for _, part := range parts {
 		m, ok := current.(map[string]any)
 		if !ok {
-			return 0, fmt.Errorf("field '%s' is not an object", part)
+			return nil, fmt.Errorf("field '%s' is not an object", part)
 		}
 		current, ok = m[part]
 		if !ok {
-			return 0, fmt.Errorf("field '%s' not found", part)
+			return nil, fmt.Errorf("field '%s' not found", part)
 		}
 	}
 
-	switch v := current.(type) {
-	case float64:
-		return v, nil
-	case int:
-		return float64(v), nil
-	case int64:
-		return float64(v), nil
-	default:
-		return 0, fmt.Errorf("field '%s' is not a number", field)
+	value, _, ok := models.NormalizeValue(current)
+	if !ok {
+		return nil, fmt.Errorf("field '%s' is not a number, string, boolean or null", field)
 	}
+	return value, nil
 }
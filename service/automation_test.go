@@ -25,6 +25,7 @@ import (
 // Uses the shared mocks from mocks_test.go
 func createTestServiceForAutomation(
 	deviceRepo *mockDeviceRepo,
+	deviceActions map[int][]int,
 	actionRepo *mockActionRepo,
 	automationRepo *mockAutomationRepo,
 	logger *slog.Logger,
@@ -45,7 +46,7 @@ func createTestServiceForAutomation(
 			nameToID["actions:"+a.Name] = a.ID
 		}
 	}
-	querier := &mockQuerier{nameToID: nameToID}
+	querier := &mockQuerier{nameToID: nameToID, deviceActions: deviceActions}
 
 	return NewService(ServiceConfig{
 		DevicesRepo:     deviceRepo,
@@ -110,10 +111,11 @@ func TestProcessAutomations(t *testing.T) {
 		svc := createTestServiceForAutomation(
 			&mockDeviceRepo{
 				devices: []*models.Device{
-					{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String(), Actions: "[1]"},
-					{ID: 2, Name: "heater", IP: server.Listener.Addr().String(), Actions: "[2]"},
+					{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "heater", IP: server.Listener.Addr().String()},
 				},
 			},
+			map[int][]int{1: {1}, 2: {2}},
 			&mockActionRepo{
 				actions: []*models.Action{
 					{ID: 1, Name: "read_temp", Path: "read_temp", Params: `{}`},
@@ -134,10 +136,13 @@ func TestProcessAutomations(t *testing.T) {
 		assert.Equal(t, "read_temp", requests[0].Method)
 		assert.Equal(t, "turn_off", requests[1].Method)
 
-		updated := automationRepo.getUpdated()
-		assert.NotNil(t, updated)
-		parsedTime, _ := time.Parse(time.RFC3339, updated.LastCheck)
+		// Only the run timestamps are written, never the whole automation
+		assert.Zero(t, automationRepo.updateCalls)
+		querier := svc.queryRepo.(*mockQuerier)
+		parsedTime, _ := time.Parse(time.RFC3339, querier.getTime(1, "last_check"))
 		assert.WithinDuration(t, time.Now(), parsedTime, time.Second)
+		assert.Equal(t, querier.getTime(1, "last_check"), querier.getTime(1, "last_triggers_run"))
+		assert.Equal(t, querier.getTime(1, "last_check"), querier.getTime(1, "last_action_run"))
 	})
 
 	t.Run("conditions not met - action skipped", func(t *testing.T) {
@@ -167,8 +172,9 @@ func TestProcessAutomations(t *testing.T) {
 
 		svc := createTestServiceForAutomation(
 			&mockDeviceRepo{
-				devices: []*models.Device{{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String(), Actions: "[1]"}},
+				devices: []*models.Device{{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String()}},
 			},
+			map[int][]int{1: {1}},
 			&mockActionRepo{
 				actions: []*models.Action{{ID: 1, Name: "read_temp", Path: "read_temp", Params: `{}`}},
 			},
@@ -186,8 +192,137 @@ func TestProcessAutomations(t *testing.T) {
 		assert.Equal(t, "read_temp", requests[0].Method)
 	})
 
+	t.Run("failed trigger read is not retried on every check", func(t *testing.T) {
+		server := createRecordingServer(`{}`, http.StatusInternalServerError)
+		defer server.Close()
+
+		yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+			Interval: "5m",
+			Triggers: []models.AutomationTrigger{
+				{Device: "sensor1", Action: "read_temp", Conditions: []models.AutomationCondition{
+					{Field: "temperature", Operator: ">", Threshold: 25.0},
+				}},
+			},
+			Actions: []models.AutomationAction{
+				{Device: "sensor1", Action: "read_temp"},
+			},
+		})
+		require.NoError(t, err)
+
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{
+				devices: []*models.Device{{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String()}},
+			},
+			map[int][]int{1: {1}},
+			&mockActionRepo{
+				actions: []*models.Action{{ID: 1, Name: "read_temp", Path: "read_temp", Params: `{}`}},
+			},
+			&mockAutomationRepo{automations: []*models.Automation{{
+				ID:              1,
+				Name:            "temp_control",
+				Enabled:         true,
+				Definition:      yamlDef,
+				LastTriggersRun: createPastTimestamp(10 * time.Minute),
+			}}},
+			nil,
+		)
+
+		require.Error(t, svc.processAutomations(ctx))
+		assert.Equal(t, 1, server.getCallCount())
+		querier := svc.queryRepo.(*mockQuerier)
+		assert.Equal(t, querier.getTime(1, "last_check"), querier.getTime(1, "last_triggers_run"))
+
+		require.NoError(t, svc.processAutomations(ctx))
+		assert.Equal(t, 1, server.getCallCount())
+	})
+
+	t.Run("action params are passed to the device", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"moisture":10},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+			Interval: "5m",
+			Triggers: []models.AutomationTrigger{
+				{Device: "sensor1", Action: "read_soil", Conditions: []models.AutomationCondition{
+					{Field: "moisture", Operator: "<", Threshold: 30},
+				}},
+			},
+			Actions: []models.AutomationAction{
+				{Device: "valve", Action: "water", Params: map[string]any{"duration": 90}},
+			},
+		})
+		require.NoError(t, err)
+
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{
+				devices: []*models.Device{
+					{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "valve", IP: server.Listener.Addr().String()},
+				},
+			},
+			map[int][]int{1: {1}, 2: {2}},
+			&mockActionRepo{
+				actions: []*models.Action{
+					{ID: 1, Name: "read_soil", Path: "read_soil"},
+					{ID: 2, Name: "water", Path: "water", Params: `{"seconds":"{{duration}}"}`, Parameters: `[{"name":"duration","type":"integer","default":30}]`},
+				},
+			},
+			&mockAutomationRepo{automations: []*models.Automation{{
+				ID:              1,
+				Name:            "watering",
+				Enabled:         true,
+				Definition:      yamlDef,
+				LastTriggersRun: createPastTimestamp(10 * time.Minute),
+			}}},
+			nil,
+		)
+
+		require.NoError(t, svc.processAutomations(ctx))
+
+		requests := server.getRequests()
+		require.Len(t, requests, 2)
+		assert.Equal(t, "water", requests[1].Method)
+		assert.Equal(t, map[string]any{"seconds": float64(90)}, requests[1].Params)
+	})
+
+	t.Run("failing action does not stop the next ones", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		definition := &models.AutomationDefinition{
+			Actions: []models.AutomationAction{
+				{Device: "broken", Action: "close"},
+				{Device: "valve", Action: "close"},
+			},
+		}
+
+		// The close action isn't assigned to the broken device
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{
+				devices: []*models.Device{
+					{ID: 1, Name: "broken", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "valve", IP: server.Listener.Addr().String()},
+				},
+			},
+			map[int][]int{2: {1}},
+			&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "close", Path: "close"}}},
+			&mockAutomationRepo{},
+			nil,
+		)
+		recorder := &eventRecorder{}
+		svc.Subscribe(recorder.record)
+
+		automation := &models.Automation{ID: 1, Name: "shut off"}
+		err := svc.runAutomation(ctx, automation, definition, time.Now(), []string{automation.Name})
+		assert.ErrorContains(t, err, "executing action [close] on device [broken]")
+
+		assert.Equal(t, 1, server.getCallCount())
+		require.Equal(t, []string{EventAutomationFinished}, recorder.types())
+		assert.Equal(t, map[string]any{"actions": 2, "failed": 1}, recorder.events[0].Data)
+	})
+
 	t.Run("error getting automations", func(t *testing.T) {
-		svc := createTestServiceForAutomation(nil, nil, &mockAutomationRepo{err: errors.New("db error")}, nil)
+		svc := createTestServiceForAutomation(nil, nil, nil, &mockAutomationRepo{err: errors.New("db error")}, nil)
 		err := svc.processAutomations(ctx)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "getting automations")
@@ -203,10 +338,11 @@ func TestProcessAutomations(t *testing.T) {
 func TestEvaluateOperator(t *testing.T) {
 	tests := []struct {
 		name      string
-		value     float64
+		value     any
 		operator  string
-		threshold float64
+		threshold any
 		want      bool
+		wantErr   string
 	}{
 		// All six operators
 		{name: "> operator", value: 10.5, operator: ">", threshold: 5.0, want: true},
@@ -220,11 +356,33 @@ func TestEvaluateOperator(t *testing.T) {
 		{name: "negative numbers", value: -3.0, operator: ">", threshold: -5.0, want: true},
 		{name: "zero comparison", value: 0.0, operator: "==", threshold: 0.0, want: true},
 		{name: "invalid operator", value: 10.0, operator: "~", threshold: 5.0, want: false},
+		{name: "integer threshold", value: 30.0, operator: "==", threshold: 30, want: true},
+
+		// Strings, booleans and nulls
+		{name: "string equal", value: "open", operator: "==", threshold: "open", want: true},
+		{name: "string not equal", value: "open", operator: "!=", threshold: "closed", want: true},
+		{name: "strings compare lexically", value: "08:30", operator: ">=", threshold: "08:00", want: true},
+		{name: "boolean equal", value: true, operator: "==", threshold: true, want: true},
+		{name: "boolean not equal", value: false, operator: "!=", threshold: true, want: true},
+		{name: "boolean ordering", value: true, operator: ">", threshold: false, want: false},
+		{name: "null equal", value: nil, operator: "==", threshold: nil, want: true},
+		{name: "string is not null", value: "open", operator: "!=", threshold: nil, want: true},
+		{name: "number equal to null", value: 0.0, operator: "==", threshold: nil, want: false},
+
+		// Mismatched types
+		{name: "string against number", value: "open", operator: "==", threshold: 1.0, wantErr: "cannot compare string value open with number threshold 1"},
+		{name: "null against boolean", value: nil, operator: "==", threshold: false, wantErr: "cannot compare null value"},
+		{name: "unsupported threshold", value: 1.0, operator: "==", threshold: []any{1.0}, wantErr: "threshold [1] is not a number"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := evaluateOperator(tt.value, tt.operator, tt.threshold)
+			got, err := evaluateOperator(tt.value, tt.operator, tt.threshold)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
 			assert.Equal(t, tt.want, got, "evaluateOperator(%v, %q, %v) = %v, want %v",
 				tt.value, tt.operator, tt.threshold, got, tt.want)
 		})
@@ -235,13 +393,13 @@ func TestEvaluateOperator(t *testing.T) {
 // from nested JSON objects. Tests simple fields, nested paths, and error cases.
 func TestGetFieldValue(t *testing.T) {
 	// Create a service instance (needed since getFieldValue is a method)
-	svc := createTestServiceForAutomation(nil, nil, nil, nil)
+	svc := createTestServiceForAutomation(nil, nil, nil, nil, nil)
 
 	tests := []struct {
 		name      string
 		data      map[string]any
 		field     string
-		want      float64
+		want      any
 		wantError bool
 		errorMsg  string
 	}{
@@ -333,13 +491,33 @@ func TestGetFieldValue(t *testing.T) {
 			errorMsg:  "field 'value' is not an object",
 		},
 
-		// Error cases - field is not a number
+		// Strings, booleans and nulls
+		{
+			name:  "string field",
+			data:  map[string]any{"state": "open"},
+			field: "state",
+			want:  "open",
+		},
+		{
+			name:  "boolean field",
+			data:  map[string]any{"leak": true},
+			field: "leak",
+			want:  true,
+		},
+		{
+			name:  "null field",
+			data:  map[string]any{"error": nil},
+			field: "error",
+			want:  nil,
+		},
+
+		// Error cases - field is not a comparable value
 		{
-			name:      "field is string",
-			data:      map[string]any{"name": "sensor1"},
-			field:     "name",
+			name:      "field is list",
+			data:      map[string]any{"readings": []any{1.0, 2.0}},
+			field:     "readings",
 			wantError: true,
-			errorMsg:  "field 'name' is not a number",
+			errorMsg:  "field 'readings' is not a number, string, boolean or null",
 		},
 		{
 			name: "field is object",
@@ -348,7 +526,7 @@ func TestGetFieldValue(t *testing.T) {
 			},
 			field:     "sensor",
 			wantError: true,
-			errorMsg:  "field 'sensor' is not a number",
+			errorMsg:  "field 'sensor' is not a number, string, boolean or null",
 		},
 	}
 
@@ -373,7 +551,7 @@ func TestGetFieldValue(t *testing.T) {
 // boolean condition results with AND/OR logic.
 func TestApplyConditionLogic(t *testing.T) {
 	// Create a service instance (needed since applyConditionLogic is a method)
-	svc := createTestServiceForAutomation(nil, nil, nil, nil)
+	svc := createTestServiceForAutomation(nil, nil, nil, nil, nil)
 
 	tests := []struct {
 		name    string
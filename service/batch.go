@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// batchResult is the outcome of a single request within a batch.
+type batchResult struct {
+	response *JSONRPCResponse
+	err      error
+}
+
+// executeBatch runs several actions on one device, as a single JSON-RPC batch
+// when the device's transport supports it. Each action is rendered with the values
+// at the same index. Results are in the order of actionIds. Batches are only sent
+// by automations and queue with their priority.
+func (s *Service) executeBatch(ctx context.Context, deviceId int, actionIds []int, values []map[string]any) ([]batchResult, error) {
+	release, err := s.acquireDevice(ctx, deviceId, PriorityAutomation)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	device, actions, err := s.getDeviceActions(ctx, deviceId, actionIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.callJSONRPCBatch(ctx, device, actions, values)
+}
+
+func (s *Service) callJSONRPCBatch(ctx context.Context, device *models.Device, actions []*models.Action, values []map[string]any) ([]batchResult, error) {
+	transport, err := s.getTransport(device)
+	if err != nil {
+		return nil, err
+	}
+
+	bt, ok := transport.(BatchTransport)
+	if _, unsupported := s.noBatch.Load(device.ID); !ok || unsupported {
+		return s.callSequentially(ctx, device, actions, values), nil
+	}
+
+	params := make([]any, len(actions))
+	for i, action := range actions {
+		if params[i], err = action.RenderParams(values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	breaker := s.getBreaker(device.ID)
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	idempotent := !slices.ContainsFunc(actions, func(a *models.Action) bool { return !a.Idempotent })
+	timeout := s.callTimeout(device, actions...)
+	results, err := withRetry(ctx, s, idempotent, func() ([]batchResult, error) {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		reqs := make([]*JSONRPCRequest, len(actions))
+		for i, action := range actions {
+			reqs[i] = &JSONRPCRequest{
+				JSONRPC: "2.0",
+				Method:  action.Path,
+				Params:  params[i],
+				ID:      int(s.requestID.Add(1)),
+			}
+		}
+		return s.exchangeBatch(callCtx, bt, device, reqs)
+	})
+	if errors.Is(err, errBatchUnsupported) {
+		breaker.release()
+		s.noBatch.Store(device.ID, true)
+		s.logger.Info("device does not support JSON-RPC batches, falling back to single calls", "device", device.Name)
+		return s.callSequentially(ctx, device, actions, values), nil
+	}
+	if err != nil {
+		breaker.done(ctx, err)
+		return nil, err
+	}
+	breaker.success()
+
+	for i, result := range results {
+		if result.err == nil {
+			results[i].err = s.validateResult(device, actions[i], result.response)
+		}
+	}
+
+	return results, nil
+}
+
+func (s *Service) callSequentially(ctx context.Context, device *models.Device, actions []*models.Action, values []map[string]any) []batchResult {
+	results := make([]batchResult, len(actions))
+	for i, action := range actions {
+		results[i].response, results[i].err = s.callJSONRPC(ctx, device, action, values[i])
+	}
+	return results
+}
+
+// exchangeBatch sends one batch and matches responses back to requests by ID.
+func (s *Service) exchangeBatch(ctx context.Context, bt BatchTransport, device *models.Device, reqs []*JSONRPCRequest) ([]batchResult, error) {
+	ids := make([]int, len(reqs))
+	for i, req := range reqs {
+		ids[i] = req.ID
+	}
+
+	start := time.Now()
+	responses, err := bt.CallBatch(ctx, device, reqs)
+	if err != nil {
+		s.logger.Warn("device batch call failed", "device", device.Name, "rpc_ids", ids, "duration", time.Since(start), "error", err)
+		return nil, err
+	}
+
+	byID := make(map[int]*JSONRPCResponse, len(responses))
+	for _, resp := range responses {
+		byID[resp.ID] = resp
+	}
+
+	results := make([]batchResult, len(reqs))
+	for i, req := range reqs {
+		resp, ok := byID[req.ID]
+		switch {
+		case !ok:
+			results[i].err = fmt.Errorf("no response for request ID %d", req.ID)
+		case resp.Error != nil:
+			results[i] = batchResult{response: resp, err: fmt.Errorf("JSON-RPC error %d: %s", resp.Error.Code, resp.Error.Message)}
+		default:
+			results[i].response = resp
+		}
+	}
+
+	s.logger.Info("device batch call completed", "device", device.Name, "rpc_ids", ids, "duration", time.Since(start))
+	return results, nil
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// batchServer answers JSON-RPC batches with reply, and single requests with the
+// result registered for the method. Every received body is recorded.
+type batchServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	bodies  []json.RawMessage
+	results map[string]string
+	reply   func(w http.ResponseWriter, reqs []JSONRPCRequest)
+}
+
+func newBatchServer(results map[string]string, reply func(w http.ResponseWriter, reqs []JSONRPCRequest)) *batchServer {
+	bs := &batchServer{results: results, reply: reply}
+
+	bs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		bs.mu.Lock()
+		bs.bodies = append(bs.bodies, body)
+		bs.mu.Unlock()
+
+		var reqs []JSONRPCRequest
+		if err := json.Unmarshal(body, &reqs); err == nil {
+			bs.reply(w, reqs)
+			return
+		}
+
+		var req JSONRPCRequest
+		json.Unmarshal(body, &req) // nolint
+
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(bs.results[req.Method]), ID: req.ID}) // nolint
+	}))
+
+	return bs
+}
+
+func (bs *batchServer) getBodies() []json.RawMessage {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return append([]json.RawMessage(nil), bs.bodies...)
+}
+
+// reverseBatch answers a batch with the results registered per method, in reverse order.
+func (bs *batchServer) reverseBatch(w http.ResponseWriter, reqs []JSONRPCRequest) {
+	responses := make([]JSONRPCResponse, 0, len(reqs))
+	for i := len(reqs) - 1; i >= 0; i-- {
+		responses = append(responses, JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(bs.results[reqs[i].Method]), ID: reqs[i].ID})
+	}
+	json.NewEncoder(w).Encode(responses) // nolint
+}
+
+func createBatchTestService(server *batchServer) *Service {
+	return createTestServiceForAutomation(
+		&mockDeviceRepo{
+			devices: []*models.Device{{ID: 1, Name: "esp32", IP: server.Listener.Addr().String()}},
+		},
+		map[int][]int{1: {1, 2, 3}},
+		&mockActionRepo{
+			actions: []*models.Action{
+				{ID: 1, Name: "read_temp", Path: "read_temp"},
+				{ID: 2, Name: "read_humidity", Path: "read_humidity"},
+				{ID: 3, Name: "read_soil", Path: "read_soil"},
+			},
+		},
+		&mockAutomationRepo{},
+		nil,
+	)
+}
+
+var batchTriggers = []models.AutomationTrigger{
+	{Device: "esp32", Action: "read_temp"},
+	{Device: "esp32", Action: "read_humidity"},
+	{Device: "esp32", Action: "read_soil"},
+}
+
+var batchResults = map[string]string{
+	"read_temp":     `{"temperature":21.5}`,
+	"read_humidity": `{"humidity":40}`,
+	"read_soil":     `{"moisture":12}`,
+}
+
+var wantBatchResponses = []map[string]any{
+	{"temperature": 21.5},
+	{"humidity": float64(40)},
+	{"moisture": float64(12)},
+}
+
+func TestReadTriggers_Batch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("triggers on one device are sent as one batch", func(t *testing.T) {
+		var server *batchServer
+		server = newBatchServer(batchResults, func(w http.ResponseWriter, reqs []JSONRPCRequest) { server.reverseBatch(w, reqs) })
+		defer server.Close()
+
+		svc := createBatchTestService(server)
+		responses, err := svc.readTriggers(ctx, batchTriggers, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, wantBatchResponses, responses)
+
+		bodies := server.getBodies()
+		require.Len(t, bodies, 1)
+		var reqs []JSONRPCRequest
+		require.NoError(t, json.Unmarshal(bodies[0], &reqs))
+		require.Len(t, reqs, 3)
+		assert.Equal(t, "read_temp", reqs[0].Method)
+		assert.Equal(t, "read_humidity", reqs[1].Method)
+		assert.Equal(t, "read_soil", reqs[2].Method)
+		assert.NotEqual(t, reqs[0].ID, reqs[1].ID)
+		assert.NotEqual(t, reqs[1].ID, reqs[2].ID)
+	})
+
+	fallbacks := []struct {
+		name  string
+		reply func(w http.ResponseWriter, reqs []JSONRPCRequest)
+	}{
+		{
+			name: "single error object",
+			reply: func(w http.ResponseWriter, _ []JSONRPCRequest) {
+				w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`)) // nolint
+			},
+		},
+		{
+			name:  "client error status",
+			reply: func(w http.ResponseWriter, _ []JSONRPCRequest) { w.WriteHeader(http.StatusBadRequest) },
+		},
+	}
+
+	for _, tt := range fallbacks {
+		t.Run("falls back to single calls on "+tt.name, func(t *testing.T) {
+			server := newBatchServer(batchResults, tt.reply)
+			defer server.Close()
+
+			svc := createBatchTestService(server)
+			responses, err := svc.readTriggers(ctx, batchTriggers, time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, wantBatchResponses, responses)
+			assert.Len(t, server.getBodies(), 4) // rejected batch + 3 single calls
+
+			_, unsupported := svc.noBatch.Load(1)
+			assert.True(t, unsupported)
+
+			// The device is remembered and no batch is attempted again
+			_, err = svc.readTriggers(ctx, batchTriggers, time.Now())
+			require.NoError(t, err)
+			assert.Len(t, server.getBodies(), 7)
+		})
+	}
+
+	failures := []struct {
+		name  string
+		reply func(w http.ResponseWriter, reqs []JSONRPCRequest)
+	}{
+		{name: "unauthorized status", reply: func(w http.ResponseWriter, _ []JSONRPCRequest) { w.WriteHeader(http.StatusUnauthorized) }},
+		{name: "forbidden status", reply: func(w http.ResponseWriter, _ []JSONRPCRequest) { w.WriteHeader(http.StatusForbidden) }},
+		{name: "empty body", reply: func(w http.ResponseWriter, _ []JSONRPCRequest) {}},
+		{
+			name: "single result object",
+			reply: func(w http.ResponseWriter, _ []JSONRPCRequest) {
+				w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":1}`)) // nolint
+			},
+		},
+	}
+
+	for _, tt := range failures {
+		t.Run("does not give up on batches after "+tt.name, func(t *testing.T) {
+			server := newBatchServer(batchResults, tt.reply)
+			defer server.Close()
+
+			svc := createBatchTestService(server)
+			_, err := svc.readTriggers(ctx, batchTriggers, time.Now())
+			require.Error(t, err)
+
+			_, unsupported := svc.noBatch.Load(1)
+			assert.False(t, unsupported)
+		})
+	}
+
+	t.Run("missing response in batch", func(t *testing.T) {
+		server := newBatchServer(batchResults, func(w http.ResponseWriter, reqs []JSONRPCRequest) {
+			json.NewEncoder(w).Encode([]JSONRPCResponse{{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: reqs[0].ID}}) // nolint
+		})
+		defer server.Close()
+
+		svc := createBatchTestService(server)
+		_, err := svc.readTriggers(ctx, batchTriggers, time.Now())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "executing triggers, device [esp32]: executing action [read_humidity]: no response for request ID")
+	})
+
+	t.Run("error for one request in batch", func(t *testing.T) {
+		server := newBatchServer(batchResults, func(w http.ResponseWriter, reqs []JSONRPCRequest) {
+			json.NewEncoder(w).Encode([]JSONRPCResponse{ // nolint
+				{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: reqs[0].ID},
+				{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: reqs[1].ID},
+				{JSONRPC: "2.0", Error: &JSONRPCError{Code: -32601, Message: "Method not found"}, ID: reqs[2].ID},
+			})
+		})
+		defer server.Close()
+
+		svc := createBatchTestService(server)
+		_, err := svc.readTriggers(ctx, batchTriggers, time.Now())
+		assert.EqualError(t, err, "executing triggers, device [esp32]: executing action [read_soil]: JSON-RPC error -32601: Method not found")
+	})
+
+	t.Run("triggers on different devices are not batched", func(t *testing.T) {
+		server := newBatchServer(batchResults, func(w http.ResponseWriter, _ []JSONRPCRequest) {
+			t.Error("unexpected batch request")
+		})
+		defer server.Close()
+
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{
+				devices: []*models.Device{
+					{ID: 1, Name: "sensor1", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "sensor2", IP: server.Listener.Addr().String()},
+				},
+			},
+			map[int][]int{1: {1}, 2: {2}},
+			&mockActionRepo{
+				actions: []*models.Action{
+					{ID: 1, Name: "read_temp", Path: "read_temp"},
+					{ID: 2, Name: "read_humidity", Path: "read_humidity"},
+				},
+			},
+			&mockAutomationRepo{},
+			nil,
+		)
+
+		responses, err := svc.readTriggers(ctx, []models.AutomationTrigger{
+			{Device: "sensor1", Action: "read_temp"},
+			{Device: "sensor2", Action: "read_humidity"},
+		}, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, wantBatchResponses[:2], responses)
+		assert.Len(t, server.getBodies(), 2)
+	})
+	t.Run("trigger params are sent with each request", func(t *testing.T) {
+		var server *batchServer
+		server = newBatchServer(batchResults, func(w http.ResponseWriter, reqs []JSONRPCRequest) { server.reverseBatch(w, reqs) })
+		defer server.Close()
+
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{
+				devices: []*models.Device{
+					{ID: 1, Name: "esp32", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "esp8266", IP: server.Listener.Addr().String()},
+				},
+			},
+			map[int][]int{1: {1, 2}, 2: {2}},
+			&mockActionRepo{
+				actions: []*models.Action{
+					{ID: 1, Name: "read_temp", Path: "read_temp"},
+					{ID: 2, Name: "read_soil", Path: "read_soil", Params: `{"depth":"{{depth}}"}`, Parameters: `[{"name":"depth","type":"integer","default":10}]`},
+				},
+			},
+			&mockAutomationRepo{},
+			nil,
+		)
+
+		_, err := svc.readTriggers(ctx, []models.AutomationTrigger{
+			{Device: "esp32", Action: "read_temp"},
+			{Device: "esp32", Action: "read_soil", Params: map[string]any{"depth": 30}},
+			{Device: "esp8266", Action: "read_soil", Params: map[string]any{"depth": 20}},
+		}, time.Now())
+		require.NoError(t, err)
+
+		bodies := server.getBodies()
+		require.Len(t, bodies, 2)
+		var batch []JSONRPCRequest
+		require.NoError(t, json.Unmarshal(bodies[0], &batch))
+		require.Len(t, batch, 2)
+		assert.Equal(t, map[string]any{"depth": float64(30)}, batch[1].Params)
+
+		var single JSONRPCRequest
+		require.NoError(t, json.Unmarshal(bodies[1], &single))
+		assert.Equal(t, map[string]any{"depth": float64(20)}, single.Params)
+	})
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed calls after which the
+	// breaker opens. Zero disables the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before a trial call is let through.
+	OpenTimeout time.Duration
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker stops calls to a device after repeated failures so an
+// unreachable device is not hammered on every automation run.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, state: BreakerClosed, now: time.Now}
+}
+
+// allow reports whether a call may go to the device. Once the open timeout has
+// passed, a single trial call is let through and the others are rejected until it
+// ends with success, failure or release.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return fmt.Errorf("circuit breaker open after %d consecutive failures", b.failures)
+		}
+		b.state = BreakerHalfOpen
+	}
+
+	if b.probing {
+		return fmt.Errorf("circuit breaker half-open, waiting for the trial call to finish")
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.cfg.FailureThreshold > 0 && (b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold) {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release ends a call that says nothing about the device's health, such as a
+// rejected request or a cancelled one, letting the next call be the trial call.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// done ends a call that failed with err. Permanent errors and cancelled calls are
+// released rather than counted as failures.
+func (b *circuitBreaker) done(ctx context.Context, err error) {
+	if isPermanent(err) || ctx.Err() != nil {
+		b.release()
+		return
+	}
+	b.failure()
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		st.OpenedAt = &openedAt
+	}
+	return st
+}
+
+func (s *Service) getBreaker(deviceId int) *circuitBreaker {
+	b, _ := s.breakers.LoadOrStore(deviceId, newCircuitBreaker(s.breakerCfg))
+	return b.(*circuitBreaker)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, b.allow())
+	b.failure()
+	assert.Equal(t, BreakerClosed, b.status().State)
+
+	b.failure()
+	assert.Equal(t, BreakerOpen, b.status().State)
+	assert.EqualError(t, b.allow(), "circuit breaker open after 2 consecutive failures")
+
+	// After the open timeout a single trial call is allowed
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	assert.Equal(t, BreakerHalfOpen, b.status().State)
+	assert.EqualError(t, b.allow(), "circuit breaker half-open, waiting for the trial call to finish")
+
+	// A failed trial re-opens the breaker immediately
+	b.failure()
+	assert.Equal(t, BreakerOpen, b.status().State)
+	assert.Error(t, b.allow())
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	b.success()
+	st := b.status()
+	assert.Equal(t, BreakerClosed, st.State)
+	assert.Equal(t, 0, st.Failures)
+	assert.Nil(t, st.OpenedAt)
+}
+
+func TestCircuitBreaker_Release(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+
+	// A trial call that says nothing about the device lets the next call try instead
+	b.done(context.Background(), permanent(errors.New("rejected")))
+	assert.Equal(t, BreakerHalfOpen, b.status().State)
+	require.NoError(t, b.allow())
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.done(cancelled, context.Canceled)
+	assert.Equal(t, BreakerHalfOpen, b.status().State)
+	assert.Equal(t, 1, b.status().Failures)
+	require.NoError(t, b.allow())
+
+	b.done(context.Background(), errors.New("unreachable"))
+	assert.Equal(t, BreakerOpen, b.status().State)
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := newCircuitBreaker(BreakerConfig{})
+	for range 10 {
+		b.failure()
+	}
+	assert.NoError(t, b.allow())
+	assert.Equal(t, BreakerClosed, b.status().State)
+}
+
+func TestExecute_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	server := createRecordingServer("", http.StatusServiceUnavailable)
+	defer server.Close()
+
+	svc := NewService(ServiceConfig{
+		DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, IP: server.Listener.Addr().String()}},
+		ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle"}},
+		QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+		DevicesCache: cache.NewCache[*models.Device](),
+		ActionsCache: cache.NewCache[*models.Action](),
+		Breaker:      BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Hour},
+	})
+
+	for range 2 {
+		_, err := svc.Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "device returned status 503")
+	}
+
+	_, err := svc.Execute(ctx, 1, 1, nil)
+	assert.EqualError(t, err, "circuit breaker open after 2 consecutive failures")
+	assert.Equal(t, 2, server.getCallCount())
+
+	status, err := svc.DeviceStatus(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, BreakerOpen, status.Breaker.State)
+}
+
+func TestDeviceStatus_UnknownDevice(t *testing.T) {
+	svc := NewService(ServiceConfig{DevicesRepo: &mockDeviceRepo{err: errors.New("not found")}})
+	_, err := svc.DeviceStatus(context.Background(), 1)
+	assert.EqualError(t, err, "getting device: not found")
+}
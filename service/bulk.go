@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+const defaultBulkConcurrency = 4
+
+// ErrNoBulkTarget is returned when a bulk execution selects no devices.
+var ErrNoBulkTarget = errors.New("no devices match the target")
+
+// BulkTarget selects the devices of a bulk execution. A device is targeted when its
+// ID is listed, when it belongs to Group, or when it matches Type and carries every
+// tag in Tags. Type and Tags only select devices when at least one of them is set.
+type BulkTarget struct {
+	DeviceIDs []int    `json:"deviceIds"`
+	Group     string   `json:"group"`
+	Type      string   `json:"type"`
+	Tags      []string `json:"tags"`
+}
+
+// BulkDeviceResult is the outcome of a bulk execution on one device.
+type BulkDeviceResult struct {
+	Response *JSONRPCResponse `json:"response,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// BulkResult maps device IDs to their outcome. A failure on one device does not
+// stop the others.
+type BulkResult struct {
+	Succeeded int                      `json:"succeeded"`
+	Failed    int                      `json:"failed"`
+	Results   map[int]BulkDeviceResult `json:"results"`
+}
+
+// BulkExecute runs an action on every targeted device, at most concurrency at a time.
+// A concurrency of zero uses the configured default. Params are checked once
+// before any device is called.
+func (s *Service) BulkExecute(ctx context.Context, target BulkTarget, actionId int, params map[string]any, concurrency int) (*BulkResult, error) {
+	action, err := s.actionsRepo.Get(ctx, actionId)
+	if err != nil {
+		return nil, fmt.Errorf("getting action: %w", err)
+	}
+	if _, err := action.RenderParams(params); err != nil {
+		return nil, err
+	}
+
+	deviceIds, err := s.selectDevices(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency <= 0 {
+		concurrency = s.bulkConcurrency
+	}
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	result := &BulkResult{Results: make(map[int]BulkDeviceResult, len(deviceIds))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, min(concurrency, len(deviceIds)))
+	for _, deviceId := range deviceIds {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			response, err := s.Execute(ctx, deviceId, actionId, params)
+
+			mu.Lock()
+			defer mu.Unlock()
+			deviceResult := BulkDeviceResult{Response: response}
+			if err != nil {
+				deviceResult.Error = err.Error()
+				result.Failed++
+			} else {
+				result.Succeeded++
+			}
+			result.Results[deviceId] = deviceResult
+		}()
+	}
+	wg.Wait()
+
+	s.logger.Info("bulk execution finished", "action", action.Name, "devices", len(deviceIds), "failed", result.Failed)
+	return result, nil
+}
+
+// selectDevices returns the IDs of the devices a bulk target selects, in ID order.
+// Listed IDs are not checked here; unknown devices fail like any other call.
+func (s *Service) selectDevices(ctx context.Context, target BulkTarget) ([]int, error) {
+	ids := slices.Clone(target.DeviceIDs)
+	if target.Group != "" {
+		devices, err := s.groupDevices(ctx, target.Group)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			ids = append(ids, device.ID)
+		}
+	}
+	if target.Type != "" || len(target.Tags) > 0 {
+		devices, err := s.devicesRepo.GetAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting devices: %w", err)
+		}
+		for _, device := range devices {
+			if (target.Type == "" || device.Type == target.Type) && device.HasTags(target.Tags) {
+				ids = append(ids, device.ID)
+			}
+		}
+	}
+
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return nil, ErrNoBulkTarget
+	}
+	return ids, nil
+}
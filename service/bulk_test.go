@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestBulkExecute(t *testing.T) {
+	ctx := context.Background()
+
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+	ip := server.Listener.Addr().String()
+
+	devices := []*models.Device{
+		{ID: 1, Name: "bed-1", Type: "watering", IP: ip, Tags: models.Tags{"garden", "north"}},
+		{ID: 2, Name: "bed-2", Type: "watering", IP: ip, Tags: models.Tags{"garden", "south"}},
+		{ID: 3, Name: "bed-3", Type: "watering", IP: ip, Tags: models.Tags{"garden"}},
+		{ID: 4, Name: "lamp", Type: "light", IP: ip, Tags: models.Tags{"north"}},
+	}
+	newBulkService := func() *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{devices: devices},
+			ActionsRepo: &mockActionRepo{action: &models.Action{ID: 1, Name: "water", Path: "water", Params: `{"seconds":"{{duration}}"}`, Parameters: `[{"name":"duration","type":"integer","default":30}]`}},
+			GroupsRepo:  &mockGroupRepo{groups: []*models.Group{{ID: 1, Name: "beds"}}},
+			QueryRepo: &mockQuerier{
+				nameToID:      map[string]int{"groups:beds": 1},
+				deviceActions: map[int][]int{1: {1}, 2: {1}, 3: {2}, 4: {1}},
+				groupDevices:  map[int][]int{1: {2, 1}},
+			},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+		})
+	}
+
+	tests := []struct {
+		name          string
+		target        BulkTarget
+		wantSucceeded []int
+		wantFailed    []int
+		wantErr       error
+	}{
+		{name: "by IDs", target: BulkTarget{DeviceIDs: []int{1, 4}}, wantSucceeded: []int{1, 4}},
+		{name: "by type with partial failure", target: BulkTarget{Type: "watering"}, wantSucceeded: []int{1, 2}, wantFailed: []int{3}},
+		{name: "by tags", target: BulkTarget{Tags: []string{"garden", "north"}}, wantSucceeded: []int{1}},
+		{name: "by type and tag", target: BulkTarget{Type: "light", Tags: []string{"north"}}, wantSucceeded: []int{4}},
+		{name: "by group", target: BulkTarget{Group: "beds"}, wantSucceeded: []int{1, 2}},
+		{name: "group and IDs are merged", target: BulkTarget{DeviceIDs: []int{2, 4}, Group: "beds"}, wantSucceeded: []int{1, 2, 4}},
+		{name: "IDs and selector are merged", target: BulkTarget{DeviceIDs: []int{1, 4}, Tags: []string{"north"}}, wantSucceeded: []int{1, 4}},
+		{name: "no match", target: BulkTarget{Type: "heater"}, wantErr: ErrNoBulkTarget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newBulkService().BulkExecute(ctx, tt.target, 1, map[string]any{"duration": 60}, 2)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, len(tt.wantSucceeded), result.Succeeded)
+			assert.Equal(t, len(tt.wantFailed), result.Failed)
+			assert.Len(t, result.Results, len(tt.wantSucceeded)+len(tt.wantFailed))
+			for _, id := range tt.wantSucceeded {
+				require.Contains(t, result.Results, id)
+				assert.Empty(t, result.Results[id].Error)
+				assert.NotNil(t, result.Results[id].Response)
+			}
+			for _, id := range tt.wantFailed {
+				require.Contains(t, result.Results, id)
+				assert.Equal(t, "action 1 does not belong to device 3", result.Results[id].Error)
+			}
+		})
+	}
+
+	t.Run("runtime params reach every device", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc := NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{devices: []*models.Device{
+				{ID: 1, IP: server.Listener.Addr().String()},
+				{ID: 2, IP: server.Listener.Addr().String()},
+			}},
+			ActionsRepo: &mockActionRepo{action: &models.Action{ID: 1, Path: "water", Params: `{"seconds":"{{duration}}"}`, Parameters: `[{"name":"duration","type":"integer"}]`}},
+			QueryRepo:   &mockQuerier{deviceActions: map[int][]int{1: {1}, 2: {1}}},
+		})
+
+		result, err := svc.BulkExecute(ctx, BulkTarget{DeviceIDs: []int{1, 2}}, 1, map[string]any{"duration": 90}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Succeeded)
+
+		reqs := server.getRequests()
+		require.Len(t, reqs, 2)
+		for _, req := range reqs {
+			assert.Equal(t, map[string]any{"seconds": float64(90)}, req.Params)
+		}
+	})
+
+	t.Run("invalid params fail before any call", func(t *testing.T) {
+		_, err := newBulkService().BulkExecute(ctx, BulkTarget{Type: "watering"}, 1, map[string]any{"duration": "long"}, 0)
+		var validationErr models.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+	})
+}
@@ -0,0 +1,479 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// Dependent is a record referring to a device, action or group.
+type Dependent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Dependents lists the records referring to a device, action or group. Automations
+// refer to them by name in their definitions.
+type Dependents struct {
+	Automations []Dependent `json:"automations"`
+	// Devices lists the devices an action is assigned to.
+	Devices []Dependent `json:"devices,omitempty"`
+	// Groups lists the groups a device belongs to.
+	Groups []Dependent `json:"groups,omitempty"`
+}
+
+// DependentsError is returned when deleting or renaming a device, action or group,
+// or detaching or removing it from a device or group, would break the records
+// referring to it.
+type DependentsError struct {
+	Kind       string
+	Name       string
+	Dependents *Dependents
+	// scope narrows the name, e.g. to an action on one device
+	scope string
+	// hint tells the client how to resolve the conflict
+	hint string
+}
+
+func (e *DependentsError) Error() string {
+	var users []string
+	if len(e.Dependents.Automations) > 0 {
+		users = append(users, "automations "+quoteNames(e.Dependents.Automations))
+	}
+	if len(e.Dependents.Devices) > 0 {
+		users = append(users, "devices "+quoteNames(e.Dependents.Devices))
+	}
+
+	msg := fmt.Sprintf("%s '%s'%s is used by %s", e.Kind, e.Name, e.scope, strings.Join(users, " and "))
+	if e.hint != "" {
+		msg += "; " + e.hint
+	}
+	return msg
+}
+
+func quoteNames(dependents []Dependent) string {
+	names := make([]string, len(dependents))
+	for i, dependent := range dependents {
+		names[i] = "'" + dependent.Name + "'"
+	}
+	return strings.Join(names, ", ")
+}
+
+// DeviceDependents returns the automations referring to a device and the groups it
+// belongs to.
+func (s *Service) DeviceDependents(ctx context.Context, id int) (*Dependents, error) {
+	device, err := s.devicesRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting device: %w", err)
+	}
+
+	automations, err := s.dependentAutomations(ctx, models.RefDevice, device.Name)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.deviceGroups(ctx, device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := &Dependents{Automations: asDependents(automations)}
+	for _, group := range groups {
+		dependents.Groups = append(dependents.Groups, Dependent{ID: group.ID, Name: group.Name})
+	}
+	return dependents, nil
+}
+
+// ActionDependents returns the automations referring to an action and the devices
+// it is assigned to.
+func (s *Service) ActionDependents(ctx context.Context, id int) (*Dependents, error) {
+	action, err := s.actionsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting action: %w", err)
+	}
+	return s.actionDependents(ctx, action)
+}
+
+func (s *Service) actionDependents(ctx context.Context, action *models.Action) (*Dependents, error) {
+	automations, err := s.dependentAutomations(ctx, models.RefAction, action.Name)
+	if err != nil {
+		return nil, err
+	}
+	deviceActions, err := s.queryRepo.GetDeviceActions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := &Dependents{Automations: asDependents(automations)}
+	for _, deviceAction := range deviceActions {
+		if deviceAction.ActionID != action.ID {
+			continue
+		}
+		device, err := s.devicesRepo.Get(ctx, deviceAction.DeviceID)
+		if err != nil {
+			return nil, fmt.Errorf("getting device: %w", err)
+		}
+		dependents.Devices = append(dependents.Devices, Dependent{ID: device.ID, Name: device.Name})
+	}
+	return dependents, nil
+}
+
+// GroupDependents returns the automations referring to a group.
+func (s *Service) GroupDependents(ctx context.Context, id int) (*Dependents, error) {
+	group, err := s.groupsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting group: %w", err)
+	}
+
+	automations, err := s.dependentAutomations(ctx, models.RefGroup, group.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Dependents{Automations: asDependents(automations)}, nil
+}
+
+// AutomationDependents returns the automations running on an automation's
+// automation_finished events.
+func (s *Service) AutomationDependents(ctx context.Context, id int) (*Dependents, error) {
+	automation, err := s.automationsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting automation: %w", err)
+	}
+
+	automations, err := s.dependentAutomations(ctx, models.RefAutomation, automation.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Dependents{Automations: asDependents(automations)}, nil
+}
+
+// DeleteDevice deletes a device unless automations refer to it. Its group
+// memberships and action assignments are deleted with it.
+func (s *Service) DeleteDevice(ctx context.Context, id int) error {
+	device, err := s.devicesRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+	automations, err := s.dependentAutomations(ctx, models.RefDevice, device.Name)
+	if err != nil {
+		return err
+	}
+	if len(automations) > 0 {
+		return &DependentsError{Kind: models.RefDevice, Name: device.Name, Dependents: &Dependents{Automations: asDependents(automations)}}
+	}
+
+	if err := s.devicesRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	// A device created later may get the same ID and must start with a closed breaker
+	// and batch support unknown
+	s.breakers.Delete(id)
+	s.noBatch.Delete(id)
+	return nil
+}
+
+// DeleteAction deletes an action unless automations refer to it or it is assigned
+// to devices.
+func (s *Service) DeleteAction(ctx context.Context, id int) error {
+	action, err := s.actionsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting action: %w", err)
+	}
+	dependents, err := s.actionDependents(ctx, action)
+	if err != nil {
+		return err
+	}
+	if len(dependents.Automations) > 0 || len(dependents.Devices) > 0 {
+		return &DependentsError{Kind: models.RefAction, Name: action.Name, Dependents: dependents}
+	}
+	return s.actionsRepo.Delete(ctx, id)
+}
+
+// DeleteGroup deletes a group unless automations refer to it. Its devices are kept.
+func (s *Service) DeleteGroup(ctx context.Context, id int) error {
+	group, err := s.groupsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting group: %w", err)
+	}
+	automations, err := s.dependentAutomations(ctx, models.RefGroup, group.Name)
+	if err != nil {
+		return err
+	}
+	if len(automations) > 0 {
+		return &DependentsError{Kind: models.RefGroup, Name: group.Name, Dependents: &Dependents{Automations: asDependents(automations)}}
+	}
+	return s.groupsRepo.Delete(ctx, id)
+}
+
+// CreateAutomation creates an automation. It is validated against the configured
+// site, so sunrise and sunset are only accepted when the server knows where it is.
+func (s *Service) CreateAutomation(ctx context.Context, automation *models.Automation) (int, error) {
+	defer s.invalidateEventAutomations()
+	return s.automationsRepo.Create(models.WithSite(ctx, s.site), automation)
+}
+
+// DeleteAutomation deletes an automation unless other automations run on its
+// automation_finished events.
+func (s *Service) DeleteAutomation(ctx context.Context, id int) error {
+	automation, err := s.automationsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting automation: %w", err)
+	}
+	automations, err := s.dependentAutomations(ctx, models.RefAutomation, automation.Name)
+	if err != nil {
+		return err
+	}
+	if len(automations) > 0 {
+		return &DependentsError{Kind: models.RefAutomation, Name: automation.Name, Dependents: &Dependents{Automations: asDependents(automations)}}
+	}
+	defer s.invalidateEventAutomations()
+	return s.automationsRepo.Delete(ctx, id)
+}
+
+// UpdateAction updates an action. Changing the name of an action automations refer
+// to is refused; RenameAction updates the automations along with the action.
+func (s *Service) UpdateAction(ctx context.Context, action *models.Action, id int) error {
+	current, err := s.actionsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting action: %w", err)
+	}
+	if err := s.checkRename(ctx, models.RefAction, current.Name, action.Name); err != nil {
+		return err
+	}
+	return s.actionsRepo.Update(ctx, action, id)
+}
+
+// UpdateGroup updates a group. Changing the name of a group automations refer to is
+// refused; RenameGroup updates the automations along with the group.
+func (s *Service) UpdateGroup(ctx context.Context, group *models.Group, id int) error {
+	current, err := s.groupsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting group: %w", err)
+	}
+	if err := s.checkRename(ctx, models.RefGroup, current.Name, group.Name); err != nil {
+		return err
+	}
+	return s.groupsRepo.Update(ctx, group, id)
+}
+
+// UpdateAutomation updates an automation. Changing the name of an automation others
+// run on is refused; RenameAutomation updates them along with the automation. The
+// run timestamps are written by the runner alone.
+func (s *Service) UpdateAutomation(ctx context.Context, automation *models.Automation, id int) error {
+	current, err := s.automationsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting automation: %w", err)
+	}
+	if err := s.checkRename(ctx, models.RefAutomation, current.Name, automation.Name); err != nil {
+		return err
+	}
+	automation.LastCheck = current.LastCheck
+	automation.LastTriggersRun = current.LastTriggersRun
+	automation.LastActionRun = current.LastActionRun
+	defer s.invalidateEventAutomations()
+	return s.automationsRepo.Update(models.WithSite(ctx, s.site), automation, id)
+}
+
+// RenameDevice renames a device and every reference to it in automation
+// definitions. It returns the automations that were updated.
+func (s *Service) RenameDevice(ctx context.Context, id int, name string) ([]Dependent, error) {
+	device, err := s.devicesRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting device: %w", err)
+	}
+	oldName := device.Name
+	device.Name = name
+	if err := device.Validate(models.WithTransports(ctx, s.transportNames()), s.devicesRepo.GetDB()); err != nil {
+		return nil, err
+	}
+	return s.rename(ctx, models.RefDevice, s.devicesRepo.GetTable(), id, oldName, name)
+}
+
+// RenameAction renames an action and every reference to it in automation
+// definitions. It returns the automations that were updated.
+func (s *Service) RenameAction(ctx context.Context, id int, name string) ([]Dependent, error) {
+	action, err := s.actionsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting action: %w", err)
+	}
+	oldName := action.Name
+	action.Name = name
+	if err := action.Validate(ctx, s.actionsRepo.GetDB()); err != nil {
+		return nil, err
+	}
+	return s.rename(ctx, models.RefAction, s.actionsRepo.GetTable(), id, oldName, name)
+}
+
+// RenameGroup renames a group and every reference to it in automation definitions.
+// It returns the automations that were updated.
+func (s *Service) RenameGroup(ctx context.Context, id int, name string) ([]Dependent, error) {
+	group, err := s.groupsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting group: %w", err)
+	}
+	oldName := group.Name
+	group.Name = name
+	if err := group.Validate(ctx, s.groupsRepo.GetDB()); err != nil {
+		return nil, err
+	}
+	return s.rename(ctx, models.RefGroup, s.groupsRepo.GetTable(), id, oldName, name)
+}
+
+// RenameAutomation renames an automation and every automation_finished event
+// waiting for it. It returns the automations that were updated.
+func (s *Service) RenameAutomation(ctx context.Context, id int, name string) ([]Dependent, error) {
+	automation, err := s.automationsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting automation: %w", err)
+	}
+	oldName := automation.Name
+	automation.Name = name
+	if err := automation.Validate(models.WithSite(ctx, s.site), s.automationsRepo.GetDB()); err != nil {
+		return nil, err
+	}
+	return s.rename(ctx, models.RefAutomation, s.automationsRepo.GetTable(), id, oldName, name)
+}
+
+// rename renames the record with the given ID in table and rewrites the automations
+// that referred to its old name, all in one transaction. Definitions are rewritten
+// before anything is saved, so an automation that can't be rewritten leaves the
+// record untouched. Rewriting only swaps one name for another, so the definitions
+// stay valid.
+func (s *Service) rename(ctx context.Context, kind, table string, id int, oldName, newName string) ([]Dependent, error) {
+	if newName == oldName {
+		return []Dependent{}, nil
+	}
+
+	automations, err := s.dependentAutomations(ctx, kind, oldName)
+	if err != nil {
+		return nil, err
+	}
+	for _, automation := range automations {
+		if _, err := automation.RenameReferences(kind, oldName, newName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.queryRepo.Rename(ctx, table, id, newName, automations); err != nil {
+		return nil, err
+	}
+
+	// The rename bypasses the repositories, which drop the caches on writes
+	switch {
+	case kind == models.RefDevice && s.devicesCache != nil:
+		s.devicesCache.InvalidateCache(ctx)
+	case kind == models.RefAction && s.actionsCache != nil:
+		s.actionsCache.InvalidateCache(ctx)
+	}
+	s.invalidateEventAutomations()
+
+	s.logger.Info("renamed "+kind, "from", oldName, "to", newName, "automations", len(automations))
+	return asDependents(automations), nil
+}
+
+// checkRename refuses to change the name of a record automations refer to.
+func (s *Service) checkRename(ctx context.Context, kind, oldName, newName string) error {
+	if newName == oldName {
+		return nil
+	}
+	automations, err := s.dependentAutomations(ctx, kind, oldName)
+	if err != nil {
+		return err
+	}
+	if len(automations) > 0 {
+		return &DependentsError{Kind: kind, Name: oldName, Dependents: &Dependents{Automations: asDependents(automations)}, hint: "rename it through the rename endpoint to update them"}
+	}
+	return nil
+}
+
+// dependentAutomations returns the automations whose definition refers to the named
+// device, action or group. Automations with a definition that doesn't parse refer
+// to nothing.
+func (s *Service) dependentAutomations(ctx context.Context, kind, name string) ([]*models.Automation, error) {
+	automations, err := s.automationsRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting automations: %w", err)
+	}
+
+	var dependents []*models.Automation
+	for _, automation := range automations {
+		def, err := automation.ParseDefinition()
+		if err != nil {
+			continue
+		}
+		if def.Refers(kind, name) {
+			dependents = append(dependents, automation)
+		}
+	}
+	return dependents, nil
+}
+
+// automationsRunning returns the automations running the named action on a device,
+// either by naming the device or by selecting it through a group or tags.
+func (s *Service) automationsRunning(ctx context.Context, device *models.Device, actionName string) ([]*models.Automation, error) {
+	groups, err := s.deviceGroups(ctx, device.ID)
+	if err != nil {
+		return nil, err
+	}
+	selects := func(name, group string, tags []string) bool {
+		switch {
+		case name != "":
+			return name == device.Name
+		case group != "":
+			return slices.ContainsFunc(groups, func(g *models.Group) bool { return g.Name == group })
+		default:
+			return len(tags) > 0 && device.HasTags(tags)
+		}
+	}
+
+	automations, err := s.automationsRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting automations: %w", err)
+	}
+
+	var running []*models.Automation
+	for _, automation := range automations {
+		def, err := automation.ParseDefinition()
+		if err != nil {
+			continue
+		}
+		triggers := slices.ContainsFunc(def.Triggers, func(t models.AutomationTrigger) bool {
+			return t.Action == actionName && selects(t.Device, t.Group, t.Tags)
+		})
+		actions := slices.ContainsFunc(def.Actions, func(a models.AutomationAction) bool {
+			return a.Action == actionName && selects(a.Device, a.Group, a.Tags)
+		})
+		if triggers || actions {
+			running = append(running, automation)
+		}
+	}
+	return running, nil
+}
+
+// deviceGroups returns the groups a device belongs to.
+func (s *Service) deviceGroups(ctx context.Context, deviceId int) ([]*models.Group, error) {
+	groupIds, err := s.queryRepo.GetDeviceGroupIDs(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*models.Group, 0, len(groupIds))
+	for _, groupId := range groupIds {
+		group, err := s.groupsRepo.Get(ctx, groupId)
+		if err != nil {
+			return nil, fmt.Errorf("getting group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func asDependents(automations []*models.Automation) []Dependent {
+	dependents := make([]Dependent, 0, len(automations))
+	for _, automation := range automations {
+		dependents = append(dependents, Dependent{ID: automation.ID, Name: automation.Name})
+	}
+	return dependents
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestDependents(t *testing.T) {
+	ctx := context.Background()
+
+	type fixture struct {
+		svc         *Service
+		devices     *mockDeviceRepo
+		actions     *mockActionRepo
+		groups      *mockGroupRepo
+		automations *mockAutomationRepo
+		querier     *mockQuerier
+	}
+	newFixture := func() fixture {
+		f := fixture{
+			devices: &mockDeviceRepo{devices: []*models.Device{
+				{ID: 1, Name: "sensor"},
+				{ID: 2, Name: "fan"},
+				{ID: 3, Name: "spare"},
+			}},
+			actions: &mockActionRepo{actions: []*models.Action{
+				{ID: 1, Name: "read_temp"},
+				{ID: 2, Name: "fan_on"},
+				{ID: 3, Name: "unused"},
+			}},
+			groups: &mockGroupRepo{groups: []*models.Group{
+				{ID: 1, Name: "fans"},
+				{ID: 2, Name: "spares"},
+			}},
+			automations: &mockAutomationRepo{automations: []*models.Automation{
+				{ID: 1, Name: "cool-down", Definition: "triggers:\n  - device: sensor\n    action: read_temp\nactions:\n  - device: fan\n    action: fan_on\n"},
+				{ID: 2, Name: "vent", Definition: "actions:\n  - group: fans\n    action: fan_on\n"},
+				{ID: 3, Name: "broken", Definition: "actions: ["},
+				{ID: 4, Name: "chain", Definition: "events:\n  - type: automation_finished\n    automation: cool-down\n"},
+			}},
+			querier: &mockQuerier{deviceActions: map[int][]int{1: {1}, 2: {2}}, groupDevices: map[int][]int{1: {2, 3}, 2: {3}}},
+		}
+		f.svc = NewService(ServiceConfig{
+			DevicesRepo:     f.devices,
+			ActionsRepo:     f.actions,
+			GroupsRepo:      f.groups,
+			AutomationsRepo: f.automations,
+			QueryRepo:       f.querier,
+		})
+		return f
+	}
+
+	t.Run("lists dependents", func(t *testing.T) {
+		f := newFixture()
+
+		deviceDeps, err := f.svc.DeviceDependents(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 1, Name: "cool-down"}}, deviceDeps.Automations)
+		assert.Equal(t, []Dependent{{ID: 1, Name: "fans"}}, deviceDeps.Groups)
+
+		actionDeps, err := f.svc.ActionDependents(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 1, Name: "cool-down"}, {ID: 2, Name: "vent"}}, actionDeps.Automations)
+		assert.Equal(t, []Dependent{{ID: 2, Name: "fan"}}, actionDeps.Devices)
+
+		groupDeps, err := f.svc.GroupDependents(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 2, Name: "vent"}}, groupDeps.Automations)
+
+		unused, err := f.svc.ActionDependents(ctx, 3)
+		require.NoError(t, err)
+		assert.Empty(t, unused.Automations)
+		assert.Empty(t, unused.Devices)
+	})
+
+	t.Run("delete is refused while referenced", func(t *testing.T) {
+		f := newFixture()
+
+		err := f.svc.DeleteDevice(ctx, 1)
+		var dependentsErr *DependentsError
+		require.ErrorAs(t, err, &dependentsErr)
+		assert.EqualError(t, err, "device 'sensor' is used by automations 'cool-down'")
+
+		err = f.svc.DeleteAction(ctx, 1)
+		assert.EqualError(t, err, "action 'read_temp' is used by automations 'cool-down' and devices 'sensor'")
+
+		err = f.svc.DeleteGroup(ctx, 1)
+		assert.EqualError(t, err, "group 'fans' is used by automations 'vent'")
+
+		assert.Empty(t, f.devices.deleted)
+		assert.Empty(t, f.actions.deleted)
+		assert.Empty(t, f.groups.deleted)
+	})
+
+	t.Run("unreferenced device is deleted", func(t *testing.T) {
+		f := newFixture()
+
+		deps, err := f.svc.DeviceDependents(ctx, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 1, Name: "fans"}, {ID: 2, Name: "spares"}}, deps.Groups)
+
+		f.svc.getBreaker(3).failure()
+		f.svc.noBatch.Store(3, true)
+		require.NoError(t, f.svc.DeleteDevice(ctx, 3))
+		assert.Equal(t, []int{3}, f.devices.deleted)
+		assert.Empty(t, f.groups.updated)
+
+		// A device reusing the ID starts with a fresh breaker and tries batches
+		_, tracked := f.svc.breakers.Load(3)
+		assert.False(t, tracked)
+		_, tracked = f.svc.noBatch.Load(3)
+		assert.False(t, tracked)
+	})
+
+	t.Run("unreferenced action is deleted", func(t *testing.T) {
+		f := newFixture()
+
+		require.NoError(t, f.svc.DeleteAction(ctx, 3))
+		assert.Equal(t, []int{3}, f.actions.deleted)
+	})
+
+	t.Run("update refuses to rename a referenced record", func(t *testing.T) {
+		f := newFixture()
+
+		err := f.svc.UpdateDevice(ctx, &models.Device{Name: "fan-1"}, 2)
+		assert.EqualError(t, err, "device 'fan' is used by automations 'cool-down'; rename it through the rename endpoint to update them")
+		assert.Nil(t, f.devices.updated)
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "fan", IP: "192.168.1.20"}, 2))
+		assert.Equal(t, "192.168.1.20", f.devices.updated.IP)
+
+		require.NoError(t, f.svc.UpdateGroup(ctx, &models.Group{Name: "reserve"}, 2))
+		require.Len(t, f.groups.updated, 1)
+	})
+
+	t.Run("rename propagates into automations", func(t *testing.T) {
+		f := newFixture()
+
+		updated, err := f.svc.RenameAction(ctx, 2, "fan_start")
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 1, Name: "cool-down"}, {ID: 2, Name: "vent"}}, updated)
+		assert.Equal(t, []renameCall{{table: "actions", id: 2, name: "fan_start", automations: []string{"cool-down", "vent"}}}, f.querier.renamed)
+		assert.Zero(t, f.automations.updateCalls)
+
+		for _, automation := range f.automations.automations[:2] {
+			def, err := automation.ParseDefinition()
+			require.NoError(t, err)
+			assert.True(t, def.Refers(models.RefAction, "fan_start"), automation.Name)
+			assert.False(t, def.Refers(models.RefAction, "fan_on"), automation.Name)
+		}
+	})
+
+	t.Run("rename to the same name updates nothing", func(t *testing.T) {
+		f := newFixture()
+
+		updated, err := f.svc.RenameGroup(ctx, 1, "fans")
+		require.NoError(t, err)
+		assert.Empty(t, updated)
+		assert.Empty(t, f.querier.renamed)
+	})
+
+	t.Run("invalid name is refused before renaming", func(t *testing.T) {
+		f := newFixture()
+
+		_, err := f.svc.RenameGroup(ctx, 1, "")
+		assert.EqualError(t, err, "name is required")
+		assert.Empty(t, f.querier.renamed)
+	})
+
+	t.Run("automations waiting for another are dependents", func(t *testing.T) {
+		f := newFixture()
+
+		deps, err := f.svc.AutomationDependents(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []Dependent{{ID: 4, Name: "chain"}}, deps.Automations)
+
+		err = f.svc.DeleteAutomation(ctx, 1)
+		assert.EqualError(t, err, "automation 'cool-down' is used by automations 'chain'")
+
+		err = f.svc.UpdateAutomation(ctx, &models.Automation{Name: "cool-down-fast", Definition: f.automations.automations[0].Definition}, 1)
+		assert.EqualError(t, err, "automation 'cool-down' is used by automations 'chain'; rename it through the rename endpoint to update them")
+		assert.Zero(t, f.automations.updateCalls)
+
+		require.NoError(t, f.svc.DeleteAutomation(ctx, 4))
+	})
+
+	t.Run("automation update keeps the run timestamps", func(t *testing.T) {
+		f := newFixture()
+		f.automations.automations[1].LastCheck = "2026-01-02T03:04:05Z"
+		f.automations.automations[1].LastTriggersRun = "2026-01-02T03:04:05Z"
+
+		require.NoError(t, f.svc.UpdateAutomation(ctx, &models.Automation{Name: "vent", Definition: "actions: []\n"}, 2))
+		assert.Equal(t, "2026-01-02T03:04:05Z", f.automations.updated.LastCheck)
+		assert.Equal(t, "2026-01-02T03:04:05Z", f.automations.updated.LastTriggersRun)
+		assert.Empty(t, f.automations.updated.LastActionRun)
+	})
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// DeviceActions returns the actions assigned to a device.
+func (s *Service) DeviceActions(ctx context.Context, deviceId int) ([]*models.Action, error) {
+	if _, err := s.devicesRepo.Get(ctx, deviceId); err != nil {
+		return nil, fmt.Errorf("getting device: %w", err)
+	}
+
+	actionIds, err := s.queryRepo.GetDeviceActionIDs(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]*models.Action, 0, len(actionIds))
+	for _, actionId := range actionIds {
+		action, err := s.actionsRepo.Get(ctx, actionId)
+		if err != nil {
+			return nil, fmt.Errorf("getting action: %w", err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// AllDeviceActions returns every device-action assignment.
+func (s *Service) AllDeviceActions(ctx context.Context) ([]models.DeviceAction, error) {
+	return s.queryRepo.GetDeviceActions(ctx)
+}
+
+// AttachAction assigns an action to a device. Attaching an assigned action is a no-op.
+func (s *Service) AttachAction(ctx context.Context, deviceId, actionId int) error {
+	if _, err := s.devicesRepo.Get(ctx, deviceId); err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+	if _, err := s.actionsRepo.Get(ctx, actionId); err != nil {
+		return fmt.Errorf("getting action: %w", err)
+	}
+	return s.queryRepo.AttachAction(ctx, deviceId, actionId)
+}
+
+// DetachAction removes an action from a device unless automations run the action on
+// the device, by name or through a group or tags. It fails with sql.ErrNoRows when
+// the action isn't assigned to the device.
+func (s *Service) DetachAction(ctx context.Context, deviceId, actionId int) error {
+	device, err := s.devicesRepo.Get(ctx, deviceId)
+	if err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+	action, err := s.actionsRepo.Get(ctx, actionId)
+	if err != nil {
+		return fmt.Errorf("getting action: %w", err)
+	}
+
+	automations, err := s.automationsRunning(ctx, device, action.Name)
+	if err != nil {
+		return err
+	}
+	if len(automations) > 0 {
+		return &DependentsError{
+			Kind:       models.RefAction,
+			Name:       action.Name,
+			Dependents: &Dependents{Automations: asDependents(automations)},
+			scope:      fmt.Sprintf(" on device '%s'", device.Name),
+		}
+	}
+
+	return s.queryRepo.DetachAction(ctx, deviceId, actionId)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestDeviceActions(t *testing.T) {
+	ctx := context.Background()
+
+	newDeviceActionService := func(querier *mockQuerier, automations ...*models.Automation) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "valve"}, {ID: 2, Name: "pump"}}},
+			ActionsRepo: &mockActionRepo{actions: []*models.Action{
+				{ID: 1, Name: "open"},
+				{ID: 2, Name: "close"},
+			}},
+			AutomationsRepo: &mockAutomationRepo{automations: automations},
+			GroupsRepo:      &mockGroupRepo{groups: []*models.Group{{ID: 1, Name: "valves"}}},
+			QueryRepo:       querier,
+		})
+	}
+
+	t.Run("attach and list", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := newDeviceActionService(querier)
+
+		require.NoError(t, svc.AttachAction(ctx, 1, 2))
+		require.NoError(t, svc.AttachAction(ctx, 1, 1))
+		require.NoError(t, svc.AttachAction(ctx, 1, 2))
+
+		actions, err := svc.DeviceActions(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, actions, 2)
+		assert.Equal(t, "close", actions[0].Name)
+		assert.Equal(t, "open", actions[1].Name)
+
+		all, err := svc.AllDeviceActions(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []models.DeviceAction{{DeviceID: 1, ActionID: 2}, {DeviceID: 1, ActionID: 1}}, all)
+	})
+
+	t.Run("detach", func(t *testing.T) {
+		querier := &mockQuerier{deviceActions: map[int][]int{1: {1, 2}}}
+		svc := newDeviceActionService(querier)
+
+		require.NoError(t, svc.DetachAction(ctx, 1, 1))
+		assert.Equal(t, []int{2}, querier.deviceActions[1])
+
+		err := svc.DetachAction(ctx, 1, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("detach refused while automations run the action on the device", func(t *testing.T) {
+		automation := func(id int, name string, action models.AutomationAction) *models.Automation {
+			def, err := createYAMLDefinition(models.AutomationDefinition{Interval: "5m", Actions: []models.AutomationAction{action}})
+			require.NoError(t, err)
+			return &models.Automation{ID: id, Name: name, Definition: def}
+		}
+		querier := &mockQuerier{deviceActions: map[int][]int{1: {1, 2}, 2: {1}}, groupDevices: map[int][]int{1: {1}}}
+		svc := newDeviceActionService(querier,
+			automation(1, "open valve", models.AutomationAction{Device: "valve", Action: "open"}),
+			automation(2, "open valves", models.AutomationAction{Group: "valves", Action: "open"}),
+			automation(3, "close valve", models.AutomationAction{Device: "valve", Action: "close"}),
+			automation(4, "open pump", models.AutomationAction{Device: "pump", Action: "open"}),
+		)
+
+		err := svc.DetachAction(ctx, 1, 1)
+		var dependentsErr *DependentsError
+		require.ErrorAs(t, err, &dependentsErr)
+		assert.EqualError(t, err, "action 'open' on device 'valve' is used by automations 'open valve', 'open valves'")
+		assert.Equal(t, []int{1, 2}, querier.deviceActions[1])
+
+		// The pump isn't in the group, so only its own automation runs open on it
+		err = svc.DetachAction(ctx, 2, 1)
+		assert.EqualError(t, err, "action 'open' on device 'pump' is used by automations 'open pump'")
+	})
+
+	t.Run("attach to missing device", func(t *testing.T) {
+		svc := NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{err: sql.ErrNoRows},
+			ActionsRepo: &mockActionRepo{},
+			QueryRepo:   &mockQuerier{},
+		})
+
+		err := svc.AttachAction(ctx, 7, 1)
+		assert.EqualError(t, err, "getting device: sql: no rows in result set")
+	})
+
+	t.Run("attach missing action", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{device: &models.Device{ID: 1}},
+			ActionsRepo: &mockActionRepo{err: errors.New("not found")},
+			QueryRepo:   querier,
+		})
+
+		err := svc.AttachAction(ctx, 1, 9)
+		assert.EqualError(t, err, "getting action: not found")
+		assert.Empty(t, querier.deviceActions)
+	})
+}
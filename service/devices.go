@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// CreateDevice creates a device. Its transport must be one the server has registered.
+// The health and reported state columns are written by the server and the device
+// alone, so any sent along are dropped.
+func (s *Service) CreateDevice(ctx context.Context, device *models.Device) (int, error) {
+	device.Status = ""
+	device.LastSeen = ""
+	device.LatencyMs = 0
+	device.ReportedState = ""
+	device.ReportedAt = ""
+	return s.devicesRepo.Create(models.WithTransports(ctx, s.transportNames()), device)
+}
+
+// UpdateDevice updates a device. Changing the name of a device automations refer
+// to is refused; RenameDevice updates the automations along with the device.
+func (s *Service) UpdateDevice(ctx context.Context, device *models.Device, id int) error {
+	current, err := s.devicesRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+	if err := s.checkRename(ctx, models.RefDevice, current.Name, device.Name); err != nil {
+		return err
+	}
+	if err := s.devicesRepo.Update(models.WithTransports(ctx, s.transportNames()), mergeDevice(current, device), id); err != nil {
+		return err
+	}
+	// The device may have been reflashed or moved, so batches are tried again
+	s.noBatch.Delete(id)
+	return nil
+}
+
+// mergeDevice applies an update to the stored device. The auth secret and ingest
+// token are never returned, so a client sending back the device it read leaves them
+// empty; the stored secret is kept unless the auth type changes, and the stored
+// token unless a new one is sent. Redacted header values keep the stored ones. The
+// health and reported state columns are written by the server and the device alone.
+func mergeDevice(current, update *models.Device) *models.Device {
+	merged := *current
+	merged.Name = update.Name
+	merged.Type = update.Type
+	merged.Chip = update.Chip
+	merged.Board = update.Board
+	merged.IP = update.IP
+	merged.Tags = update.Tags
+	merged.Transport = update.Transport
+	merged.Scheme = update.Scheme
+	merged.Port = update.Port
+	merged.RPCPath = update.RPCPath
+	merged.Headers = models.RestoreHeaders(update.Headers, current.Headers)
+	merged.Timeout = update.Timeout
+	merged.AuthType = update.AuthType
+	merged.AuthUsername = update.AuthUsername
+	if update.AuthSecret != "" || update.AuthType != current.AuthType {
+		merged.AuthSecret = update.AuthSecret
+	}
+	if update.IngestToken != "" {
+		merged.IngestToken = update.IngestToken
+	}
+	return &merged
+}
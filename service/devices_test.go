@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestCreateAndUpdateDevice(t *testing.T) {
+	ctx := context.Background()
+
+	type fixture struct {
+		svc     *Service
+		devices *mockDeviceRepo
+	}
+	newDeviceFixture := func() fixture {
+		f := fixture{devices: &mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "sensor"}}}}
+		f.svc = NewService(ServiceConfig{
+			DevicesRepo:     f.devices,
+			AutomationsRepo: &mockAutomationRepo{},
+			QueryRepo:       &mockQuerier{},
+		})
+		return f
+	}
+
+	t.Run("update keeps the stored auth secret", func(t *testing.T) {
+		f := newDeviceFixture()
+		f.devices.devices[0] = &models.Device{ID: 1, Name: "sensor", Transport: models.TransportHTTP, Port: 8443, AuthType: models.AuthBearer, AuthSecret: "s3cret"}
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", Transport: models.TransportHTTP, Port: 8443, AuthType: models.AuthBearer, IP: "192.168.1.30"}, 1))
+		assert.Equal(t, "s3cret", f.devices.updated.AuthSecret)
+		assert.Equal(t, 8443, f.devices.updated.Port)
+		assert.Equal(t, "192.168.1.30", f.devices.updated.IP)
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", AuthType: models.AuthNone}, 1))
+		assert.Empty(t, f.devices.updated.AuthSecret)
+	})
+
+	t.Run("update tries batches again", func(t *testing.T) {
+		f := newDeviceFixture()
+		f.svc.noBatch.Store(1, true)
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", IP: "192.168.1.30"}, 1))
+		_, unsupported := f.svc.noBatch.Load(1)
+		assert.False(t, unsupported)
+	})
+
+	t.Run("update keeps redacted header values", func(t *testing.T) {
+		f := newDeviceFixture()
+		f.devices.devices[0] = &models.Device{ID: 1, Name: "sensor", Headers: `{"X-Api-Key":"k3y","X-Zone":"north"}`}
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", Headers: `{"X-Api-Key":"********","X-Zone":"south"}`}, 1))
+		assert.JSONEq(t, `{"X-Api-Key":"k3y","X-Zone":"south"}`, f.devices.updated.Headers)
+	})
+
+	t.Run("reported state is only written by the device", func(t *testing.T) {
+		f := newDeviceFixture()
+		f.devices.devices[0] = &models.Device{ID: 1, Name: "sensor", IngestToken: "0123456789abcdef", ReportedState: `{"temp":21}`, ReportedAt: "2026-01-02T03:04:05Z"}
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", ReportedState: `{"temp":99}`, ReportedAt: "2030-01-01T00:00:00Z"}, 1))
+		assert.Equal(t, "0123456789abcdef", f.devices.updated.IngestToken)
+		assert.Equal(t, `{"temp":21}`, f.devices.updated.ReportedState)
+		assert.Equal(t, "2026-01-02T03:04:05Z", f.devices.updated.ReportedAt)
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", IngestToken: "fedcba9876543210"}, 1))
+		assert.Equal(t, "fedcba9876543210", f.devices.updated.IngestToken)
+
+		_, err := f.svc.CreateDevice(ctx, &models.Device{Name: "new", ReportedState: `{"temp":99}`, ReportedAt: "2030-01-01T00:00:00Z"})
+		require.NoError(t, err)
+		require.Len(t, f.devices.created, 1)
+		assert.Empty(t, f.devices.created[0].ReportedState)
+		assert.Empty(t, f.devices.created[0].ReportedAt)
+	})
+
+	t.Run("health is only written by health checks", func(t *testing.T) {
+		f := newDeviceFixture()
+		f.devices.devices[0] = &models.Device{ID: 1, Name: "sensor", Status: models.StatusOnline, LastSeen: "2026-01-02T03:04:05Z", LatencyMs: 12}
+
+		require.NoError(t, f.svc.UpdateDevice(ctx, &models.Device{Name: "sensor", Status: models.StatusOffline, LatencyMs: 999}, 1))
+		assert.Equal(t, models.StatusOnline, f.devices.updated.Status)
+		assert.Equal(t, "2026-01-02T03:04:05Z", f.devices.updated.LastSeen)
+		assert.Equal(t, 12, f.devices.updated.LatencyMs)
+
+		_, err := f.svc.CreateDevice(ctx, &models.Device{Name: "new", Status: models.StatusOnline, LastSeen: "2030-01-01T00:00:00Z", LatencyMs: 1})
+		require.NoError(t, err)
+		require.Len(t, f.devices.created, 1)
+		assert.Empty(t, f.devices.created[0].Status)
+		assert.Empty(t, f.devices.created[0].LastSeen)
+		assert.Zero(t, f.devices.created[0].LatencyMs)
+	})
+}
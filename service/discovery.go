@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+type DiscoveryConfig struct {
+	// Targets are the UDP addresses the probe is sent to, usually the broadcast
+	// address of the local network, e.g. 255.255.255.255:47474.
+	Targets []string
+	// Method is the JSON-RPC method of the probe. Defaults to "gniotek.discover".
+	Method string
+	// Wait is how long replies are collected after the probe is sent. Defaults to 2s.
+	Wait time.Duration
+	// MaxAge is how long a device that stopped answering probes stays listed.
+	// Defaults to 15m.
+	MaxAge time.Duration
+}
+
+const (
+	defaultDiscoveryMethod = "gniotek.discover"
+	defaultDiscoveryWait   = 2 * time.Second
+	defaultDiscoveryMaxAge = 15 * time.Minute
+)
+
+// ErrUnclaimedNotFound is returned when adopting a device that was not discovered
+// or has been claimed in the meantime.
+var ErrUnclaimedNotFound = errors.New("unclaimed device not found")
+
+// ErrAdoptEndpointChanged is returned when adopting a device at another address than
+// the one it was discovered at.
+var ErrAdoptEndpointChanged = errors.New("the address and port of a discovered device can't be changed on adoption")
+
+// DiscoveredDevice is a device that answered a discovery probe. The IP is the
+// source address of the reply, the other fields are reported by the device.
+type DiscoveredDevice struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Chip      string    `json:"chip"`
+	Board     string    `json:"board"`
+	IP        string    `json:"ip"`
+	Port      int       `json:"port,omitempty"`
+	Scheme    string    `json:"scheme,omitempty"`
+	RPCPath   string    `json:"rpc_path,omitempty"`
+	Transport string    `json:"transport,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Device returns the device registration proposed by the discovered device.
+func (d *DiscoveredDevice) Device() *models.Device {
+	name := d.Name
+	if name == "" {
+		name = d.IP
+	}
+	return &models.Device{
+		Name:      name,
+		Type:      d.Type,
+		Chip:      d.Chip,
+		Board:     d.Board,
+		IP:        d.IP,
+		Port:      d.Port,
+		Scheme:    d.Scheme,
+		RPCPath:   d.RPCPath,
+		Transport: d.Transport,
+	}
+}
+
+// discoveryRegistry holds the devices found by probes, keyed by their endpoint.
+type discoveryRegistry struct {
+	mu      sync.Mutex
+	devices map[string]*DiscoveredDevice
+	nextID  int
+}
+
+func (r *discoveryRegistry) record(found DiscoveredDevice) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.devices == nil {
+		r.devices = map[string]*DiscoveredDevice{}
+	}
+
+	key := endpointKey(found.Device())
+	if existing, ok := r.devices[key]; ok {
+		found.ID = existing.ID
+	} else {
+		r.nextID++
+		found.ID = r.nextID
+	}
+	r.devices[key] = &found
+}
+
+// list returns the devices seen since the given time, dropping the others.
+func (r *discoveryRegistry) list(since time.Time) []DiscoveredDevice {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(since)
+	list := make([]DiscoveredDevice, 0, len(r.devices))
+	for _, d := range r.devices {
+		list = append(list, *d)
+	}
+	slices.SortFunc(list, func(a, b DiscoveredDevice) int { return a.ID - b.ID })
+	return list
+}
+
+// expire drops the devices last seen before the given time. The caller holds r.mu.
+func (r *discoveryRegistry) expire(before time.Time) {
+	for key, d := range r.devices {
+		if d.LastSeen.Before(before) {
+			delete(r.devices, key)
+		}
+	}
+}
+
+func (r *discoveryRegistry) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, d := range r.devices {
+		if d.ID == id {
+			delete(r.devices, key)
+		}
+	}
+}
+
+// endpointKey identifies a device by host and RPC port, so several devices behind
+// one address (e.g. test responders on loopback) are told apart. Registered and
+// discovered devices are both keyed from a models.Device, so that they compare equal.
+func endpointKey(device *models.Device) string {
+	host, port := device.IP, device.Port
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if port == 0 {
+			port, _ = strconv.Atoi(p)
+		}
+	}
+	if port == 0 {
+		port = 80
+		if device.Scheme == "https" {
+			port = 443
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (s *Service) discoveryMaxAge() time.Duration {
+	if s.discoveryCfg.MaxAge > 0 {
+		return s.discoveryCfg.MaxAge
+	}
+	return defaultDiscoveryMaxAge
+}
+
+func (s *Service) RunDiscovery(ctx context.Context, interval time.Duration, errCh chan<- error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.probe(ctx); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Discover sends a discovery probe and returns the devices that are not registered yet.
+func (s *Service) Discover(ctx context.Context) ([]DiscoveredDevice, error) {
+	if err := s.probe(ctx); err != nil {
+		return nil, err
+	}
+	return s.UnclaimedDevices(ctx)
+}
+
+// UnclaimedDevices returns the recently discovered devices whose endpoint is not used
+// by a registered device.
+func (s *Service) UnclaimedDevices(ctx context.Context) ([]DiscoveredDevice, error) {
+	devices, err := s.devicesRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting devices: %w", err)
+	}
+
+	claimed := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		claimed[endpointKey(d)] = true
+	}
+
+	unclaimed := []DiscoveredDevice{}
+	for _, d := range s.discovered.list(time.Now().Add(-s.discoveryMaxAge())) {
+		if !claimed[endpointKey(d.Device())] {
+			unclaimed = append(unclaimed, d)
+		}
+	}
+	return unclaimed, nil
+}
+
+// UnclaimedDevice returns a single unclaimed device by its discovery ID.
+func (s *Service) UnclaimedDevice(ctx context.Context, id int) (*DiscoveredDevice, error) {
+	unclaimed, err := s.UnclaimedDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range unclaimed {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, ErrUnclaimedNotFound
+}
+
+// AdoptDevice registers a discovered device. The device is usually the one proposed by
+// DiscoveredDevice.Device, with fields such as the name or tags changed by the caller.
+// It must keep the endpoint the device was discovered at, so that adopting can't be
+// used to register an arbitrary address.
+func (s *Service) AdoptDevice(ctx context.Context, id int, device *models.Device) (int, error) {
+	found, err := s.UnclaimedDevice(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if endpointKey(device) != endpointKey(found.Device()) {
+		return 0, ErrAdoptEndpointChanged
+	}
+
+	deviceID, err := s.CreateDevice(ctx, device)
+	if err != nil {
+		return 0, fmt.Errorf("creating device: %w", err)
+	}
+
+	s.discovered.remove(id)
+	s.logger.Info("adopted discovered device", "device", device.Name, "ip", device.IP)
+	return deviceID, nil
+}
+
+// probe broadcasts a JSON-RPC discovery request and records every device that replies
+// before the wait time runs out.
+func (s *Service) probe(ctx context.Context) error {
+	if len(s.discoveryCfg.Targets) == 0 {
+		return fmt.Errorf("no discovery targets configured")
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return fmt.Errorf("opening discovery socket: %w", err)
+	}
+	defer conn.Close() // nolint
+
+	method := s.discoveryCfg.Method
+	if method == "" {
+		method = defaultDiscoveryMethod
+	}
+	req := JSONRPCRequest{JSONRPC: "2.0", Method: method, ID: int(s.requestID.Add(1))}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshaling discovery request: %w", err)
+	}
+
+	for _, target := range s.discoveryCfg.Targets {
+		addr, err := net.ResolveUDPAddr("udp4", target)
+		if err != nil {
+			return fmt.Errorf("resolving discovery target %s: %w", target, err)
+		}
+		if _, err := conn.WriteToUDP(payload, addr); err != nil {
+			return fmt.Errorf("sending discovery probe to %s: %w", target, err)
+		}
+	}
+
+	wait := s.discoveryCfg.Wait
+	if wait <= 0 {
+		wait = defaultDiscoveryWait
+	}
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return fmt.Errorf("setting discovery deadline: %w", err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return fmt.Errorf("reading discovery replies: %w", err)
+		}
+
+		found, ok := parseDiscoveryReply(buf[:n], req.ID)
+		if !ok {
+			s.logger.Debug("ignoring invalid discovery reply", "from", from.String())
+			continue
+		}
+		found.IP = from.IP.String()
+		found.LastSeen = time.Now()
+		s.discovered.record(found)
+	}
+}
+
+func parseDiscoveryReply(data []byte, id int) (DiscoveredDevice, bool) {
+	var found DiscoveredDevice
+
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(data, &resp); err != nil || resp.ID != id || resp.Error != nil {
+		return found, false
+	}
+	if err := json.Unmarshal(resp.Result, &found); err != nil {
+		return found, false
+	}
+
+	// Only the fields a device may report are kept
+	return DiscoveredDevice{
+		Name:      found.Name,
+		Type:      found.Type,
+		Chip:      found.Chip,
+		Board:     found.Board,
+		Port:      found.Port,
+		Scheme:    found.Scheme,
+		RPCPath:   found.RPCPath,
+		Transport: found.Transport,
+	}, true
+}
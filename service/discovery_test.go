@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// startResponder listens on loopback and answers discovery probes like a device would.
+// reply builds the raw reply for a probe; returning nil stays silent.
+func startResponder(t *testing.T, reply func(req JSONRPCRequest) []byte) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() }) // nolint
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var req JSONRPCRequest
+			if err := json.Unmarshal(buf[:n], &req); err != nil {
+				continue
+			}
+			if data := reply(req); data != nil {
+				conn.WriteToUDP(data, from) // nolint
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// deviceResponder answers probes with the given device description.
+func deviceResponder(t *testing.T, result string) string {
+	return startResponder(t, func(req JSONRPCRequest) []byte {
+		data, _ := json.Marshal(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(result), ID: req.ID})
+		return data
+	})
+}
+
+func createDiscoveryTestService(repo *mockDeviceRepo, targets ...string) *Service {
+	return NewService(ServiceConfig{
+		DevicesRepo: repo,
+		Discovery:   DiscoveryConfig{Targets: targets, Wait: 200 * time.Millisecond},
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("devices answering the probe are listed as unclaimed", func(t *testing.T) {
+		methods := make(chan string, 1)
+		soil := startResponder(t, func(req JSONRPCRequest) []byte {
+			methods <- req.Method
+			data, _ := json.Marshal(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"name":"soil","type":"sensor","chip":"esp32","port":8081}`), ID: req.ID})
+			return data
+		})
+		valve := deviceResponder(t, `{"name":"valve","type":"actuator","port":8082,"rpc_path":"/api"}`)
+
+		svc := createDiscoveryTestService(&mockDeviceRepo{devices: []*models.Device{}}, soil, valve)
+		found, err := svc.Discover(ctx)
+		require.NoError(t, err)
+		require.Len(t, found, 2)
+		assert.Equal(t, defaultDiscoveryMethod, <-methods)
+
+		byName := map[string]DiscoveredDevice{}
+		for _, d := range found {
+			byName[d.Name] = d
+		}
+		assert.Equal(t, "127.0.0.1", byName["soil"].IP)
+		assert.Equal(t, 8081, byName["soil"].Port)
+		assert.Equal(t, "esp32", byName["soil"].Chip)
+		assert.Equal(t, "/api", byName["valve"].RPCPath)
+		assert.NotEqual(t, byName["soil"].ID, byName["valve"].ID)
+	})
+
+	t.Run("registered devices are not listed", func(t *testing.T) {
+		soil := deviceResponder(t, `{"name":"soil","port":8081}`)
+		valve := deviceResponder(t, `{"name":"valve","port":8082}`)
+
+		repo := &mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "my-valve", IP: "127.0.0.1:8082"}}}
+		svc := createDiscoveryTestService(repo, soil, valve)
+		found, err := svc.Discover(ctx)
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, "soil", found[0].Name)
+	})
+
+	t.Run("repeated probes keep the discovery ID", func(t *testing.T) {
+		soil := deviceResponder(t, `{"name":"soil","port":8081}`)
+
+		svc := createDiscoveryTestService(&mockDeviceRepo{devices: []*models.Device{}}, soil)
+		first, err := svc.Discover(ctx)
+		require.NoError(t, err)
+		second, err := svc.Discover(ctx)
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.Equal(t, first[0].ID, second[0].ID)
+	})
+
+	t.Run("invalid replies are ignored", func(t *testing.T) {
+		garbage := startResponder(t, func(JSONRPCRequest) []byte { return []byte("hello") })
+		wrongID := startResponder(t, func(req JSONRPCRequest) []byte {
+			data, _ := json.Marshal(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"name":"x"}`), ID: req.ID + 1})
+			return data
+		})
+		rpcError := startResponder(t, func(req JSONRPCRequest) []byte {
+			data, _ := json.Marshal(JSONRPCResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: -32601, Message: "Method not found"}, ID: req.ID})
+			return data
+		})
+		silent := startResponder(t, func(JSONRPCRequest) []byte { return nil })
+
+		svc := createDiscoveryTestService(&mockDeviceRepo{devices: []*models.Device{}}, garbage, wrongID, rpcError, silent)
+		found, err := svc.Discover(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("no targets", func(t *testing.T) {
+		svc := createDiscoveryTestService(&mockDeviceRepo{})
+		_, err := svc.Discover(ctx)
+		assert.EqualError(t, err, "no discovery targets configured")
+	})
+}
+
+func TestAdoptDevice(t *testing.T) {
+	ctx := context.Background()
+	soil := deviceResponder(t, `{"name":"soil","type":"sensor","chip":"esp32","board":"devkit","port":8081,"rpc_path":"/rpc"}`)
+
+	repo := &mockDeviceRepo{devices: []*models.Device{}}
+	svc := createDiscoveryTestService(repo, soil)
+	found, err := svc.Discover(ctx)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	device := found[0].Device()
+	assert.Equal(t, &models.Device{Name: "soil", Type: "sensor", Chip: "esp32", Board: "devkit", IP: "127.0.0.1", Port: 8081, RPCPath: "/rpc"}, device)
+
+	// The endpoint the device was discovered at can't be swapped for another one
+	for _, moved := range []models.Device{
+		{Name: "soil", IP: "192.168.1.1", Port: 8081},
+		{Name: "soil", IP: "127.0.0.1", Port: 22},
+		{Name: "soil", IP: "127.0.0.1", Port: 0, Scheme: "https"},
+	} {
+		_, err = svc.AdoptDevice(ctx, found[0].ID, &moved)
+		assert.ErrorIs(t, err, ErrAdoptEndpointChanged)
+	}
+	assert.Empty(t, repo.created)
+
+	device.Name = "greenhouse-soil"
+	id, err := svc.AdoptDevice(ctx, found[0].ID, device)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	require.Len(t, repo.created, 1)
+	assert.Equal(t, "greenhouse-soil", repo.created[0].Name)
+
+	// The adopted device is no longer offered
+	unclaimed, err := svc.UnclaimedDevices(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, unclaimed)
+
+	_, err = svc.AdoptDevice(ctx, found[0].ID, device)
+	assert.ErrorIs(t, err, ErrUnclaimedNotFound)
+}
+
+func TestEndpointKey(t *testing.T) {
+	tests := []struct {
+		device models.Device
+		want   string
+	}{
+		{device: models.Device{IP: "192.168.1.5"}, want: "192.168.1.5:80"},
+		{device: models.Device{IP: "192.168.1.5", Scheme: "https"}, want: "192.168.1.5:443"},
+		{device: models.Device{IP: "192.168.1.5:8080"}, want: "192.168.1.5:8080"},
+		{device: models.Device{IP: "192.168.1.5", Port: 8081}, want: "192.168.1.5:8081"},
+		{device: models.Device{IP: "192.168.1.5:8080", Port: 8081}, want: "192.168.1.5:8081"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, endpointKey(&tt.device))
+		})
+	}
+}
+
+func TestDiscoveryRegistry(t *testing.T) {
+	t.Run("stale devices are dropped", func(t *testing.T) {
+		var r discoveryRegistry
+		now := time.Now()
+		r.record(DiscoveredDevice{Name: "old", IP: "192.168.1.5", LastSeen: now.Add(-time.Hour)})
+		r.record(DiscoveredDevice{Name: "new", IP: "192.168.1.6", LastSeen: now})
+
+		list := r.list(now.Add(-time.Minute))
+		require.Len(t, list, 1)
+		assert.Equal(t, "new", list[0].Name)
+		assert.Len(t, r.devices, 1)
+	})
+
+	t.Run("https devices are claimed on their default port", func(t *testing.T) {
+		repo := &mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "gate", IP: "192.168.1.5", Scheme: "https"}}}
+		svc := createDiscoveryTestService(repo)
+		svc.discovered.record(DiscoveredDevice{Name: "gate", IP: "192.168.1.5", Scheme: "https", LastSeen: time.Now()})
+		svc.discovered.record(DiscoveredDevice{Name: "fan", IP: "192.168.1.5", LastSeen: time.Now()})
+
+		unclaimed, err := svc.UnclaimedDevices(context.Background())
+		require.NoError(t, err)
+		require.Len(t, unclaimed, 1)
+		assert.Equal(t, "fan", unclaimed[0].Name)
+	})
+}
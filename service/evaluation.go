@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// Types of the nodes of an evaluation tree.
+const (
+	EvaluationAll       = "all"
+	EvaluationAny       = "any"
+	EvaluationNot       = "not"
+	EvaluationCondition = "condition"
+	EvaluationTrigger   = "trigger"
+	EvaluationDevice    = "device"
+	EvaluationTime      = "time"
+)
+
+// Evaluation is a node of the tree that decides whether an automation runs. Blocks
+// combine their children, a trigger combines the devices it read, and a device
+// combines the conditions checked against its response. Nodes that weren't needed to
+// reach the result are marked skipped.
+type Evaluation struct {
+	Type      string        `json:"type"`
+	Trigger   string        `json:"trigger,omitempty"`
+	Device    string        `json:"device,omitempty"`
+	Group     string        `json:"group,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	Action    string        `json:"action,omitempty"`
+	Field     string        `json:"field,omitempty"`
+	Operator  string        `json:"operator,omitempty"`
+	Threshold any           `json:"threshold,omitempty"`
+	Value     any           `json:"value,omitempty"`
+	Met       bool          `json:"met"`
+	Skipped   bool          `json:"skipped,omitempty"`
+	Children  []*Evaluation `json:"children,omitempty"`
+}
+
+// MarshalJSON always writes the threshold and value of an evaluated condition, so
+// that comparisons with null show up.
+func (e *Evaluation) MarshalJSON() ([]byte, error) {
+	type plain Evaluation
+	if e.Type != EvaluationCondition || e.Skipped {
+		return json.Marshal((*plain)(e))
+	}
+	return json.Marshal(struct {
+		*plain
+		Threshold any `json:"threshold"`
+		Value     any `json:"value"`
+	}{(*plain)(e), e.Threshold, e.Value})
+}
+
+// DryRun is what running an automation would do right now. Its triggers are read,
+// but no actions run and its timestamps are left alone.
+type DryRun struct {
+	Automation string         `json:"automation"`
+	Met        bool           `json:"met"`
+	Evaluation *Evaluation    `json:"evaluation"`
+	Actions    []DryRunAction `json:"actions"`
+}
+
+// DryRunAction is an action a dry run would have executed.
+type DryRunAction struct {
+	Action  string         `json:"action"`
+	Devices []string       `json:"devices"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// DryRunAutomation evaluates the automation as if it were due now and returns the
+// evaluation tree and the actions that would run.
+func (s *Service) DryRunAutomation(ctx context.Context, id int) (*DryRun, error) {
+	automation, err := s.automationsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	definition, err := automation.ParseDefinition()
+	if err != nil {
+		return nil, fmt.Errorf("parsing definition: %w", err)
+	}
+
+	evaluation, err := s.evaluateAutomation(ctx, definition, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("processing triggers: %w", err)
+	}
+
+	dryRun := &DryRun{Automation: automation.Name, Met: evaluation.Met, Evaluation: evaluation, Actions: []DryRunAction{}}
+	if !evaluation.Met {
+		return dryRun, nil
+	}
+
+	for _, action := range definition.Actions {
+		deviceNames, err := s.actionDevices(ctx, action)
+		if err != nil {
+			return nil, fmt.Errorf("resolving action [%s]: %w", action.Action, err)
+		}
+		dryRun.Actions = append(dryRun.Actions, DryRunAction{Action: action.Action, Devices: deviceNames, Params: action.Params})
+	}
+
+	return dryRun, nil
+}
+
+// evaluateAutomation evaluates the triggers of def and combines them with its logic
+// tree, or with condition_logic when it has none.
+func (s *Service) evaluateAutomation(ctx context.Context, def *models.AutomationDefinition, now time.Time) (*Evaluation, error) {
+	triggers, err := s.processTriggers(ctx, def, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if def.Logic != nil {
+		byName := make(map[string]*Evaluation, len(triggers))
+		for _, trigger := range triggers {
+			byName[trigger.Trigger] = trigger
+		}
+		return evaluateLogic(*def.Logic, byName), nil
+	}
+
+	root := &Evaluation{Type: EvaluationAll, Children: triggers}
+	if def.ConditionLogic == "or" {
+		root.Type = EvaluationAny
+	}
+	results := make([]bool, len(triggers))
+	for i, trigger := range triggers {
+		results[i] = trigger.Met
+	}
+	root.Met = s.applyConditionLogic(results, def.ConditionLogic)
+	return root, nil
+}
+
+// evaluateLogic combines the evaluated triggers as described by node.
+func evaluateLogic(node models.LogicNode, triggers map[string]*Evaluation) *Evaluation {
+	switch {
+	case node.Trigger != "":
+		return triggers[node.Trigger]
+	case node.Not != nil:
+		child := evaluateLogic(*node.Not, triggers)
+		return &Evaluation{Type: EvaluationNot, Met: !child.Met, Children: []*Evaluation{child}}
+	case len(node.Any) > 0:
+		result := &Evaluation{Type: EvaluationAny}
+		for _, n := range node.Any {
+			child := evaluateLogic(n, triggers)
+			result.Met = result.Met || child.Met
+			result.Children = append(result.Children, child)
+		}
+		return result
+	default:
+		result := &Evaluation{Type: EvaluationAll, Met: true}
+		for _, n := range node.All {
+			child := evaluateLogic(n, triggers)
+			result.Met = result.Met && child.Met
+			result.Children = append(result.Children, child)
+		}
+		return result
+	}
+}
+
+// evaluateConditions checks the conditions against a response. They must all be met;
+// those after the first that isn't are skipped.
+func (s *Service) evaluateConditions(response map[string]any, conditions []models.AutomationCondition) (*Evaluation, error) {
+	return s.evaluateBlock(EvaluationAll, response, conditions)
+}
+
+// evaluateBlock checks conditions until the result of the block is known, with all of
+// them needing to be met for an "all" block and one for an "any" block.
+func (s *Service) evaluateBlock(kind string, response map[string]any, conditions []models.AutomationCondition) (*Evaluation, error) {
+	result := &Evaluation{Type: kind, Met: kind == EvaluationAll}
+	decided := false
+	for _, condition := range conditions {
+		if decided {
+			result.Children = append(result.Children, skippedCondition(condition))
+			continue
+		}
+
+		child, err := s.evaluateCondition(response, condition)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, child)
+		if child.Met != (kind == EvaluationAll) {
+			result.Met = child.Met
+			decided = true
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) evaluateCondition(response map[string]any, condition models.AutomationCondition) (*Evaluation, error) {
+	switch {
+	case len(condition.All) > 0:
+		return s.evaluateBlock(EvaluationAll, response, condition.All)
+	case len(condition.Any) > 0:
+		return s.evaluateBlock(EvaluationAny, response, condition.Any)
+	case condition.Not != nil:
+		child, err := s.evaluateCondition(response, *condition.Not)
+		if err != nil {
+			return nil, err
+		}
+		return &Evaluation{Type: EvaluationNot, Met: !child.Met, Children: []*Evaluation{child}}, nil
+	}
+
+	val, err := s.getFieldValue(response, condition.Field)
+	if err != nil {
+		return nil, fmt.Errorf("getting field [%s] value: %w", condition.Field, err)
+	}
+
+	met, err := evaluateOperator(val, condition.Operator, condition.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("comparing field [%s]: %w", condition.Field, err)
+	}
+
+	return &Evaluation{
+		Type:      EvaluationCondition,
+		Field:     condition.Field,
+		Operator:  condition.Operator,
+		Threshold: condition.Threshold,
+		Value:     val,
+		Met:       met,
+	}, nil
+}
+
+// skippedCondition describes a condition that wasn't checked.
+func skippedCondition(condition models.AutomationCondition) *Evaluation {
+	result := &Evaluation{Skipped: true}
+	switch {
+	case len(condition.All) > 0:
+		result.Type = EvaluationAll
+		for _, c := range condition.All {
+			result.Children = append(result.Children, skippedCondition(c))
+		}
+	case len(condition.Any) > 0:
+		result.Type = EvaluationAny
+		for _, c := range condition.Any {
+			result.Children = append(result.Children, skippedCondition(c))
+		}
+	case condition.Not != nil:
+		result.Type = EvaluationNot
+		result.Children = []*Evaluation{skippedCondition(*condition.Not)}
+	default:
+		result.Type = EvaluationCondition
+		result.Field = condition.Field
+		result.Operator = condition.Operator
+		result.Threshold = condition.Threshold
+	}
+	return result
+}
+
+// triggerNode returns the unevaluated node of a trigger.
+func triggerNode(trigger models.AutomationTrigger) *Evaluation {
+	result := &Evaluation{Type: EvaluationTrigger, Trigger: trigger.Name, Device: trigger.Device, Group: trigger.Group, Tags: trigger.Tags, Action: trigger.Action}
+	if trigger.IsTime() {
+		result.Type = EvaluationTime
+	}
+	return result
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestEvaluateConditions_Nested(t *testing.T) {
+	svc := &Service{}
+	response := map[string]any{"soil": 20.0, "tank": 5.0, "override": 1.0}
+	soilDry := models.AutomationCondition{Field: "soil", Operator: "<", Threshold: 30}
+	tankFull := models.AutomationCondition{Field: "tank", Operator: ">", Threshold: 10}
+	override := models.AutomationCondition{Field: "override", Operator: "==", Threshold: 1}
+
+	tests := []struct {
+		name       string
+		conditions []models.AutomationCondition
+		want       bool
+	}{
+		{
+			name: "any of a failing all and a met condition",
+			conditions: []models.AutomationCondition{{Any: []models.AutomationCondition{
+				{All: []models.AutomationCondition{soilDry, tankFull}},
+				override,
+			}}},
+			want: true,
+		},
+		{
+			name:       "not negates its condition",
+			conditions: []models.AutomationCondition{soilDry, {Not: &override}},
+			want:       false,
+		},
+		{
+			name:       "all of nested blocks",
+			conditions: []models.AutomationCondition{{All: []models.AutomationCondition{soilDry, {Not: &tankFull}}}},
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluation, err := svc.evaluateConditions(response, tt.conditions)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, evaluation.Met)
+		})
+	}
+
+	t.Run("conditions after the result is known are skipped", func(t *testing.T) {
+		missing := models.AutomationCondition{Field: "missing", Operator: ">", Threshold: 0}
+		evaluation, err := svc.evaluateConditions(response, []models.AutomationCondition{
+			{Any: []models.AutomationCondition{override, missing}},
+			tankFull,
+			{All: []models.AutomationCondition{missing}},
+		})
+		require.NoError(t, err)
+		assert.False(t, evaluation.Met)
+
+		anyNode := evaluation.Children[0]
+		assert.True(t, anyNode.Met)
+		assert.Equal(t, 1.0, anyNode.Children[0].Value)
+		assert.True(t, anyNode.Children[1].Skipped)
+		assert.False(t, evaluation.Children[1].Met)
+		assert.Equal(t, EvaluationAll, evaluation.Children[2].Type)
+		assert.True(t, evaluation.Children[2].Skipped)
+	})
+
+	t.Run("missing field fails", func(t *testing.T) {
+		_, err := svc.evaluateConditions(response, []models.AutomationCondition{
+			{Not: &models.AutomationCondition{Field: "missing", Operator: ">", Threshold: 0}},
+		})
+		assert.ErrorContains(t, err, "getting field [missing] value")
+	})
+}
+
+func TestEvaluateLogic(t *testing.T) {
+	triggers := map[string]*Evaluation{
+		"soil":     {Type: EvaluationTrigger, Trigger: "soil", Met: true},
+		"tank":     {Type: EvaluationTrigger, Trigger: "tank", Met: false},
+		"override": {Type: EvaluationTrigger, Trigger: "override", Met: true},
+	}
+
+	tests := []struct {
+		name  string
+		logic models.LogicNode
+		want  bool
+	}{
+		{
+			name:  "all",
+			logic: models.LogicNode{All: []models.LogicNode{{Trigger: "soil"}, {Trigger: "tank"}}},
+			want:  false,
+		},
+		{
+			name: "any of all and a trigger",
+			logic: models.LogicNode{Any: []models.LogicNode{
+				{All: []models.LogicNode{{Trigger: "soil"}, {Trigger: "tank"}}},
+				{Trigger: "override"},
+			}},
+			want: true,
+		},
+		{
+			name:  "not",
+			logic: models.LogicNode{All: []models.LogicNode{{Trigger: "soil"}, {Not: &models.LogicNode{Trigger: "tank"}}}},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluation := evaluateLogic(tt.logic, triggers)
+			assert.Equal(t, tt.want, evaluation.Met)
+		})
+	}
+}
+
+func TestDryRunAutomation(t *testing.T) {
+	ctx := context.Background()
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"moisture":10,"tank":5},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+		Interval: "5m",
+		Timezone: "UTC",
+		Triggers: []models.AutomationTrigger{
+			{Name: "night", Time: &models.TimeWindow{Except: []string{time.Now().UTC().Format("2006-01-02")}}},
+			{Name: "dry", Device: "sensor", Action: "read_soil", Conditions: []models.AutomationCondition{
+				{Field: "moisture", Operator: "<", Threshold: 30},
+				{Any: []models.AutomationCondition{
+					{Field: "tank", Operator: ">", Threshold: 10},
+					{Not: &models.AutomationCondition{Field: "tank", Operator: "<", Threshold: 1}},
+				}},
+			}},
+		},
+		Logic: &models.LogicNode{Any: []models.LogicNode{
+			{Trigger: "night"},
+			{Trigger: "dry"},
+		}},
+		Actions: []models.AutomationAction{{Device: "mister", Action: "mist", Params: map[string]any{"seconds": 5}}},
+	})
+	require.NoError(t, err)
+
+	automationRepo := &mockAutomationRepo{automations: []*models.Automation{{ID: 1, Name: "misting", Enabled: true, Definition: yamlDef}}}
+	svc := createTestServiceForAutomation(
+		&mockDeviceRepo{devices: []*models.Device{
+			{ID: 1, Name: "sensor", IP: server.Listener.Addr().String()},
+			{ID: 2, Name: "mister", IP: server.Listener.Addr().String()},
+		}},
+		map[int][]int{1: {1}, 2: {2}},
+		&mockActionRepo{actions: []*models.Action{
+			{ID: 1, Name: "read_soil", Path: "read_soil"},
+			{ID: 2, Name: "mist", Path: "mist"},
+		}},
+		automationRepo,
+		nil,
+	)
+
+	dryRun, err := svc.DryRunAutomation(ctx, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, "misting", dryRun.Automation)
+	assert.True(t, dryRun.Met)
+	assert.Equal(t, []DryRunAction{{Action: "mist", Devices: []string{"mister"}, Params: map[string]any{"seconds": 5}}}, dryRun.Actions)
+
+	root := dryRun.Evaluation
+	require.Len(t, root.Children, 2)
+	assert.Equal(t, EvaluationAny, root.Type)
+	assert.Equal(t, &Evaluation{Type: EvaluationTime, Trigger: "night"}, root.Children[0])
+	dry := root.Children[1]
+	assert.Equal(t, "dry", dry.Trigger)
+	require.Len(t, dry.Children, 1)
+	assert.Equal(t, EvaluationDevice, dry.Children[0].Type)
+	assert.Equal(t, "sensor", dry.Children[0].Device)
+	assert.Equal(t, EvaluationAny, dry.Children[0].Children[1].Type)
+	assert.True(t, dry.Children[0].Children[1].Children[1].Met)
+
+	// Only the trigger was read, and the automation was left alone
+	var calls []string
+	for _, request := range server.getRequests() {
+		calls = append(calls, request.Method)
+	}
+	assert.Equal(t, []string{"read_soil"}, calls)
+	assert.Zero(t, automationRepo.updateCalls)
+
+	_, err = svc.DryRunAutomation(ctx, 2)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestEvaluateConditions_Typed(t *testing.T) {
+	svc := &Service{}
+	a := models.Automation{Definition: `events:
+  - type: webhook
+    webhook: door
+    conditions:
+      - field: state
+        operator: "=="
+        threshold: "open"
+      - field: leak
+        operator: "!="
+        threshold: true
+      - field: error
+        operator: "=="
+        threshold: null
+actions: []
+`}
+	def, err := a.ParseDefinition()
+	require.NoError(t, err)
+	conditions := def.Events[0].Conditions
+
+	tests := []struct {
+		name    string
+		data    map[string]any
+		want    bool
+		wantErr string
+	}{
+		{name: "all met", data: map[string]any{"state": "open", "leak": false, "error": nil}, want: true},
+		{name: "other state", data: map[string]any{"state": "closed", "leak": false, "error": nil}, want: false},
+		{name: "leaking", data: map[string]any{"state": "open", "leak": true, "error": nil}, want: false},
+		{name: "error reported", data: map[string]any{"state": "open", "leak": false, "error": "sensor fault"}, want: false},
+		{name: "wrong type", data: map[string]any{"state": 1.0}, wantErr: "comparing field [state]: cannot compare number value 1 with string threshold open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluation, err := svc.evaluateConditions(tt.data, conditions)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, evaluation.Met)
+		})
+	}
+}
+
+func TestEvaluation_MarshalJSON(t *testing.T) {
+	evaluation := &Evaluation{Type: EvaluationAll, Children: []*Evaluation{
+		{Type: EvaluationCondition, Field: "error", Operator: "==", Met: true},
+		{Type: EvaluationCondition, Field: "state", Operator: "==", Threshold: "open", Skipped: true},
+	}}
+
+	data, err := json.Marshal(evaluation)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"all","met":false,"children":[
+		{"type":"condition","field":"error","operator":"==","threshold":null,"value":null,"met":true},
+		{"type":"condition","field":"state","operator":"==","threshold":"open","met":false,"skipped":true}
+	]}`, string(data))
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+const (
+	EventDeviceOnline       = models.EventTypeDeviceOnline
+	EventDeviceOffline      = models.EventTypeDeviceOffline
+	EventDeviceReported     = models.EventTypeDeviceReported
+	EventAutomationFinished = models.EventTypeAutomationFinished
+	EventWebhook            = models.EventTypeWebhook
+)
+
+// ErrWebhookNotFound is returned when no enabled automation listens on a webhook.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Event is something that happened on the server, such as a device going offline.
+type Event struct {
+	Type       string         `json:"type"`
+	DeviceID   int            `json:"device_id,omitempty"`
+	Device     string         `json:"device,omitempty"`
+	Automation string         `json:"automation,omitempty"`
+	Webhook    string         `json:"webhook,omitempty"`
+	Time       time.Time      `json:"time"`
+	Data       map[string]any `json:"data,omitempty"`
+
+	// chain lists the automations whose runs led to this event, so an automation
+	// is never run again by an event it caused.
+	chain []string
+}
+
+// eventBus delivers events to the subscribed handlers in the order they were published.
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers []func(Event)
+}
+
+// Subscribe registers a handler called for every event. Handlers run on the
+// publishing goroutine and must not block.
+func (s *Service) Subscribe(handler func(Event)) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.handlers = append(s.events.handlers, handler)
+}
+
+func (s *Service) publish(event Event) {
+	s.logger.Info("event", "type", event.Type, "device", event.Device, "automation", event.Automation, "webhook", event.Webhook)
+
+	s.events.mu.RLock()
+	handlers := s.events.handlers
+	s.events.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// eventAutomation is an enabled automation with events, along with its parsed definition.
+type eventAutomation struct {
+	automation *models.Automation
+	definition *models.AutomationDefinition
+}
+
+// eventIndex holds the enabled automations with events, so published events are
+// matched without reading and parsing every automation. It is loaded on first use
+// and dropped whenever the service writes an automation.
+type eventIndex struct {
+	mu          sync.Mutex
+	loaded      bool
+	automations []eventAutomation
+}
+
+// eventAutomations returns the enabled automations with events.
+func (s *Service) eventAutomations(ctx context.Context) ([]eventAutomation, error) {
+	s.eventIndex.mu.Lock()
+	defer s.eventIndex.mu.Unlock()
+	if s.eventIndex.loaded {
+		return s.eventIndex.automations, nil
+	}
+
+	automations, err := s.automationsRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting automations: %w", err)
+	}
+
+	var indexed []eventAutomation
+	for _, automation := range automations {
+		if !automation.Enabled {
+			continue
+		}
+		definition, err := automation.ParseDefinition()
+		if err != nil {
+			s.logger.Error("skipping automation on events", "automation", automation.Name, "error", fmt.Errorf("parsing definition: %w", err))
+			continue
+		}
+		if len(definition.Events) > 0 {
+			indexed = append(indexed, eventAutomation{automation: automation, definition: definition})
+		}
+	}
+
+	s.eventIndex.automations = indexed
+	s.eventIndex.loaded = true
+	return indexed, nil
+}
+
+// invalidateEventAutomations drops the indexed automations after an automation was written.
+func (s *Service) invalidateEventAutomations() {
+	s.eventIndex.mu.Lock()
+	s.eventIndex.automations = nil
+	s.eventIndex.loaded = false
+	s.eventIndex.mu.Unlock()
+}
+
+// TriggerWebhook publishes a webhook event with the given payload. It fails when no
+// enabled automation listens on the webhook, so typos in the caller are noticed.
+func (s *Service) TriggerWebhook(ctx context.Context, name string, data map[string]any) error {
+	automations, err := s.eventAutomations(ctx)
+	if err != nil {
+		return err
+	}
+
+	found := slices.ContainsFunc(automations, func(entry eventAutomation) bool {
+		return slices.ContainsFunc(entry.definition.Events, func(e models.AutomationEvent) bool {
+			return e.Type == EventWebhook && e.Webhook == name
+		})
+	})
+	if !found {
+		return ErrWebhookNotFound
+	}
+
+	s.publish(Event{Type: EventWebhook, Webhook: name, Time: time.Now(), Data: data})
+	return nil
+}
+
+// processEvent runs every enabled automation with an event matching the published
+// one, each on its own goroutine, and waits for them to finish.
+func (s *Service) processEvent(ctx context.Context, event Event) error {
+	automations, err := s.eventAutomations(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var hadErrors atomic.Bool
+	for _, entry := range automations {
+		if !slices.ContainsFunc(entry.definition.Events, func(e models.AutomationEvent) bool { return s.matchEvent(e, event) }) {
+			continue
+		}
+
+		name := entry.automation.Name
+		if slices.Contains(event.chain, name) {
+			s.logger.Warn("skipping automation caused by its own run", "automation", name, "chain", event.chain)
+			continue
+		}
+
+		s.logger.Info("processing automation on event", "automation", name, "event", event.Type)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Runs record their timestamps on the automation, so each gets its own copy
+			automation := *entry.automation
+			if err := s.processEventAutomation(ctx, &automation, entry.definition, append(slices.Clone(event.chain), name)); err != nil {
+				s.logger.Error("automation failed", "automation", name, "error", err)
+				hadErrors.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if hadErrors.Load() {
+		return fmt.Errorf("one or more automations encountered errors on event %s", event.Type)
+	}
+
+	return nil
+}
+
+func (s *Service) processEventAutomation(ctx context.Context, automation *models.Automation, definition *models.AutomationDefinition, chain []string) error {
+	mu := s.getAutomationMutex(automation.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.runAutomation(ctx, automation, definition, time.Now(), chain)
+}
+
+// matchEvent reports whether an automation event matches a published event. Events
+// whose data does not meet the conditions, or lacks the condition fields, do not match.
+func (s *Service) matchEvent(want models.AutomationEvent, event Event) bool {
+	if want.Type != event.Type {
+		return false
+	}
+
+	switch want.Type {
+	case EventAutomationFinished:
+		if want.Automation != event.Automation {
+			return false
+		}
+	case EventWebhook:
+		if want.Webhook != event.Webhook {
+			return false
+		}
+	default:
+		if want.Device != event.Device {
+			return false
+		}
+	}
+
+	evaluation, err := s.evaluateConditions(event.Data, want.Conditions)
+	if err != nil {
+		s.logger.Warn("event does not match conditions", "type", event.Type, "error", err)
+		return false
+	}
+	return evaluation.Met
+}
+
+func (s *Service) getAutomationMutex(automationId int) *sync.Mutex {
+	mu, _ := s.automationMu.LoadOrStore(automationId, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// createEventTestService returns a service with a "valve" device behind the recording
+// server and the given automations, each closing the valve when it runs.
+func createEventTestService(t *testing.T, server *recordingServer, automations map[string][]models.AutomationEvent) (*Service, *eventRecorder) {
+	t.Helper()
+
+	var list []*models.Automation
+	for name, events := range automations {
+		yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+			Events:  events,
+			Actions: []models.AutomationAction{{Device: "valve", Action: "close"}},
+		})
+		require.NoError(t, err)
+		list = append(list, &models.Automation{ID: len(list) + 1, Name: name, Enabled: true, Definition: yamlDef})
+	}
+
+	svc := createTestServiceForAutomation(
+		&mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "valve", IP: server.Listener.Addr().String()}}},
+		map[int][]int{1: {1}},
+		&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "close", Path: "close"}}},
+		&mockAutomationRepo{automations: list},
+		nil,
+	)
+	recorder := &eventRecorder{}
+	svc.Subscribe(recorder.record)
+	return svc, recorder
+}
+
+func TestProcessEvent(t *testing.T) {
+	ctx := context.Background()
+	leak := []models.AutomationEvent{{
+		Type: models.EventTypeDeviceReported, Device: "leak-sensor",
+		Conditions: []models.AutomationCondition{{Field: "water", Operator: ">", Threshold: 0}},
+	}}
+
+	tests := []struct {
+		name    string
+		event   Event
+		wantRun bool
+	}{
+		{
+			name:    "matching event runs the automation",
+			event:   Event{Type: EventDeviceReported, Device: "leak-sensor", Data: map[string]any{"water": 3.0}},
+			wantRun: true,
+		},
+		{
+			name:  "conditions not met",
+			event: Event{Type: EventDeviceReported, Device: "leak-sensor", Data: map[string]any{"water": 0.0}},
+		},
+		{
+			name:  "condition field missing",
+			event: Event{Type: EventDeviceReported, Device: "leak-sensor", Data: map[string]any{"battery": 80.0}},
+		},
+		{
+			name:  "other device",
+			event: Event{Type: EventDeviceReported, Device: "soil-sensor", Data: map[string]any{"water": 3.0}},
+		},
+		{
+			name:  "other event type",
+			event: Event{Type: EventDeviceOffline, Device: "leak-sensor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+			defer server.Close()
+
+			svc, recorder := createEventTestService(t, server, map[string][]models.AutomationEvent{"leak": leak})
+			require.NoError(t, svc.processEvent(ctx, tt.event))
+
+			if !tt.wantRun {
+				assert.Zero(t, server.getCallCount())
+				assert.Empty(t, recorder.types())
+				return
+			}
+			requests := server.getRequests()
+			require.Len(t, requests, 1)
+			assert.Equal(t, "close", requests[0].Method)
+			assert.Equal(t, []string{EventAutomationFinished}, recorder.types())
+			assert.Equal(t, "leak", recorder.events[0].Automation)
+			assert.Equal(t, []string{"leak"}, recorder.events[0].chain)
+		})
+	}
+}
+
+func TestProcessEvent_AutomationChain(t *testing.T) {
+	ctx := context.Background()
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	// ping and pong run on each other's automation_finished event
+	svc, recorder := createEventTestService(t, server, map[string][]models.AutomationEvent{
+		"ping": {{Type: models.EventTypeAutomationFinished, Automation: "pong"}},
+		"pong": {{Type: models.EventTypeAutomationFinished, Automation: "ping"}},
+	})
+
+	require.NoError(t, svc.processEvent(ctx, Event{Type: EventAutomationFinished, Automation: "ping", chain: []string{"ping"}}))
+	require.Len(t, recorder.types(), 1)
+	finished := recorder.events[0]
+	assert.Equal(t, "pong", finished.Automation)
+	assert.Equal(t, []string{"ping", "pong"}, finished.chain)
+
+	// ping caused this event, so it is not run again
+	require.NoError(t, svc.processEvent(ctx, finished))
+	assert.Len(t, recorder.types(), 1)
+	assert.Equal(t, 1, server.getCallCount())
+}
+
+func TestProcessAutomations_EventOnly(t *testing.T) {
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	svc, _ := createEventTestService(t, server, map[string][]models.AutomationEvent{
+		"doorbell": {{Type: models.EventTypeWebhook, Webhook: "doorbell"}},
+	})
+
+	require.NoError(t, svc.processAutomations(context.Background()))
+	assert.Zero(t, server.getCallCount(), "automations without an interval do not run on ticks")
+}
+
+func TestTriggerWebhook(t *testing.T) {
+	ctx := context.Background()
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	svc, recorder := createEventTestService(t, server, map[string][]models.AutomationEvent{
+		"doorbell": {{Type: models.EventTypeWebhook, Webhook: "doorbell"}},
+	})
+
+	err := svc.TriggerWebhook(ctx, "garage", nil)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+	assert.Empty(t, recorder.types())
+
+	require.NoError(t, svc.TriggerWebhook(ctx, "doorbell", map[string]any{"pressed": 1.0}))
+	require.Equal(t, []string{EventWebhook}, recorder.types())
+	assert.Equal(t, "doorbell", recorder.events[0].Webhook)
+	assert.Equal(t, map[string]any{"pressed": 1.0}, recorder.events[0].Data)
+}
+
+func TestRunAutomations_Events(t *testing.T) {
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	svc, _ := createEventTestService(t, server, map[string][]models.AutomationEvent{
+		"offline": {{Type: models.EventTypeDeviceOffline, Device: "leak-sensor"}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.RunAutomations(ctx, time.Hour, make(chan error, 10))
+
+	// The event handler is subscribed when the runner starts
+	require.Eventually(t, func() bool {
+		svc.events.mu.RLock()
+		defer svc.events.mu.RUnlock()
+		return len(svc.events.handlers) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	svc.publish(Event{Type: EventDeviceOffline, Device: "leak-sensor", Time: time.Now()})
+	assert.Eventually(t, func() bool { return server.getCallCount() == 1 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestProcessEvent_Concurrent(t *testing.T) {
+	// Each device answers only once both have been called, so the automations must
+	// run at the same time for either to finish before the timeout
+	var mu sync.Mutex
+	calls := 0
+	both := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req) // nolint
+
+		mu.Lock()
+		calls++
+		if calls == 2 {
+			close(both)
+		}
+		mu.Unlock()
+
+		select {
+		case <-both:
+			w.Write(echoRequestID(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, req.ID)) // nolint
+		case <-time.After(2 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var automations []*models.Automation
+	for i, device := range []string{"valve-1", "valve-2"} {
+		yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+			Events:  []models.AutomationEvent{{Type: models.EventTypeWebhook, Webhook: "flood"}},
+			Actions: []models.AutomationAction{{Device: device, Action: "close"}},
+		})
+		require.NoError(t, err)
+		automations = append(automations, &models.Automation{ID: i + 1, Name: "close-" + device, Enabled: true, Definition: yamlDef})
+	}
+
+	svc := createTestServiceForAutomation(
+		&mockDeviceRepo{devices: []*models.Device{
+			{ID: 1, Name: "valve-1", IP: server.Listener.Addr().String()},
+			{ID: 2, Name: "valve-2", IP: server.Listener.Addr().String()},
+		}},
+		map[int][]int{1: {1}, 2: {1}},
+		&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "close", Path: "close"}}},
+		&mockAutomationRepo{automations: automations},
+		nil,
+	)
+
+	require.NoError(t, svc.processEvent(context.Background(), Event{Type: EventWebhook, Webhook: "flood"}))
+}
+
+func TestEventAutomations_Invalidated(t *testing.T) {
+	ctx := context.Background()
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	svc, _ := createEventTestService(t, server, map[string][]models.AutomationEvent{
+		"doorbell": {{Type: models.EventTypeWebhook, Webhook: "doorbell"}},
+	})
+	require.NoError(t, svc.TriggerWebhook(ctx, "doorbell", nil))
+
+	// The indexed automations are kept until the service writes one
+	repo := svc.automationsRepo.(*mockAutomationRepo)
+	yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+		Events:  []models.AutomationEvent{{Type: models.EventTypeWebhook, Webhook: "garage"}},
+		Actions: []models.AutomationAction{{Device: "valve", Action: "close"}},
+	})
+	require.NoError(t, err)
+	updated := &models.Automation{ID: 1, Name: "doorbell", Enabled: true, Definition: yamlDef}
+	repo.automations = []*models.Automation{updated}
+	assert.ErrorIs(t, svc.TriggerWebhook(ctx, "garage", nil), ErrWebhookNotFound)
+
+	require.NoError(t, svc.UpdateAutomation(ctx, updated, 1))
+	require.NoError(t, svc.TriggerWebhook(ctx, "garage", nil))
+	assert.ErrorIs(t, svc.TriggerWebhook(ctx, "doorbell", nil), ErrWebhookNotFound)
+}
@@ -2,49 +2,63 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"net"
 	"slices"
-	"sync"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
 )
 
-func (s *Service) Execute(ctx context.Context, deviceId, actionId int) (*JSONRPCResponse, error) {
-	mu := s.getDeviceMutex(deviceId)
-	mu.Lock()
-	defer mu.Unlock()
+// Execute runs an action on a device. Params holds values for the parameters the
+// action declares; parameters without a value fall back to their defaults.
+func (s *Service) Execute(ctx context.Context, deviceId, actionId int, params map[string]any) (*JSONRPCResponse, error) {
+	return s.execute(ctx, deviceId, actionId, params, PriorityManual)
+}
 
-	device, err := s.devicesRepo.Get(ctx, deviceId)
+// execute runs an action once the device's command queue gives the call its turn.
+func (s *Service) execute(ctx context.Context, deviceId, actionId int, params map[string]any, priority Priority) (*JSONRPCResponse, error) {
+	release, err := s.acquireDevice(ctx, deviceId, priority)
 	if err != nil {
-		return nil, fmt.Errorf("getting device: %w", err)
+		return nil, err
 	}
+	defer release()
 
-	action, err := s.actionsRepo.Get(ctx, actionId)
+	device, actions, err := s.getDeviceActions(ctx, deviceId, actionId)
 	if err != nil {
-		return nil, fmt.Errorf("getting action: %w", err)
+		return nil, err
 	}
 
-	var actionIds []int
-	err = json.Unmarshal([]byte(device.Actions), &actionIds)
+	return s.callJSONRPC(ctx, device, actions[0], params)
+}
+
+// getDeviceActions loads a device and the given actions, checking that every
+// action is assigned to the device.
+func (s *Service) getDeviceActions(ctx context.Context, deviceId int, actionIds ...int) (*models.Device, []*models.Action, error) {
+	device, err := s.devicesRepo.Get(ctx, deviceId)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshalling device actions: %w", err)
+		return nil, nil, fmt.Errorf("getting device: %w", err)
 	}
 
-	if !slices.Contains(actionIds, actionId) {
-		return nil, fmt.Errorf("action %d does not belong to device %d", actionId, deviceId)
+	deviceActionIds, err := s.queryRepo.GetDeviceActionIDs(ctx, deviceId)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if !isPrivateIP(device.IP) {
-		return nil, errors.New("device IP must be in private range")
-	}
+	actions := make([]*models.Action, 0, len(actionIds))
+	for _, actionId := range actionIds {
+		action, err := s.actionsRepo.Get(ctx, actionId)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting action: %w", err)
+		}
 
-	return s.callJSONRPC(ctx, device.IP, action.Path, action.Params)
-}
+		if !slices.Contains(deviceActionIds, actionId) {
+			return nil, nil, fmt.Errorf("action %d does not belong to device %d", actionId, deviceId)
+		}
+
+		actions = append(actions, action)
+	}
 
-func (s *Service) getDeviceMutex(deviceId int) *sync.Mutex {
-	mu, _ := s.deviceMu.LoadOrStore(deviceId, &sync.Mutex{})
-	return mu.(*sync.Mutex)
+	return device, actions, nil
 }
 
 func isPrivateIP(ipStr string) bool {
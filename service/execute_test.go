@@ -17,10 +17,11 @@ func TestExecute(t *testing.T) {
 
 	t.Run("validation errors", func(t *testing.T) {
 		tests := []struct {
-			name       string
-			deviceRepo *mockDeviceRepo
-			actionRepo *mockActionRepo
-			wantErr    string
+			name          string
+			deviceRepo    *mockDeviceRepo
+			deviceActions []int
+			actionRepo    *mockActionRepo
+			wantErr       string
 		}{
 			{
 				name:       "device not found",
@@ -29,28 +30,32 @@ func TestExecute(t *testing.T) {
 				wantErr:    "getting device: not found",
 			},
 			{
-				name:       "action not found",
-				deviceRepo: &mockDeviceRepo{device: &models.Device{ID: 1, Actions: "[1]"}},
-				actionRepo: &mockActionRepo{err: errors.New("not found")},
-				wantErr:    "getting action: not found",
+				name:          "action not found",
+				deviceRepo:    &mockDeviceRepo{device: &models.Device{ID: 1}},
+				deviceActions: []int{1},
+				actionRepo:    &mockActionRepo{err: errors.New("not found")},
+				wantErr:       "getting action: not found",
 			},
 			{
-				name:       "action does not belong to device",
-				deviceRepo: &mockDeviceRepo{device: &models.Device{ID: 1, Actions: "[2,3]"}},
-				actionRepo: &mockActionRepo{action: &models.Action{ID: 1}},
-				wantErr:    "action 1 does not belong to device 1",
+				name:          "action does not belong to device",
+				deviceRepo:    &mockDeviceRepo{device: &models.Device{ID: 1}},
+				deviceActions: []int{2, 3},
+				actionRepo:    &mockActionRepo{action: &models.Action{ID: 1}},
+				wantErr:       "action 1 does not belong to device 1",
 			},
 			{
-				name:       "device unreachable",
-				deviceRepo: &mockDeviceRepo{device: &models.Device{ID: 1, IP: "127.0.0.1:99999", Actions: "[1]"}},
-				actionRepo: &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle", Params: `{}`}},
-				wantErr:    "calling device: Post \"http://127.0.0.1:99999/rpc\": dial tcp: address 99999: invalid port",
+				name:          "device unreachable",
+				deviceRepo:    &mockDeviceRepo{device: &models.Device{ID: 1, IP: "127.0.0.1:99999"}},
+				deviceActions: []int{1},
+				actionRepo:    &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle", Params: `{}`}},
+				wantErr:       "calling device: Post \"http://127.0.0.1:99999/rpc\": dial tcp: address 99999: invalid port",
 			},
 			{
-				name:       "public IP rejected",
-				deviceRepo: &mockDeviceRepo{device: &models.Device{ID: 1, IP: "8.8.8.8:80", Actions: "[1]"}},
-				actionRepo: &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle", Params: `{}`}},
-				wantErr:    "device IP must be in private range",
+				name:          "public IP rejected",
+				deviceRepo:    &mockDeviceRepo{device: &models.Device{ID: 1, IP: "8.8.8.8:80"}},
+				deviceActions: []int{1},
+				actionRepo:    &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle", Params: `{}`}},
+				wantErr:       "device IP must be in private range",
 			},
 		}
 
@@ -59,11 +64,11 @@ func TestExecute(t *testing.T) {
 				svc := NewService(ServiceConfig{
 					DevicesRepo:  tt.deviceRepo,
 					ActionsRepo:  tt.actionRepo,
-					QueryRepo:    &mockQuerier{},
+					QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: tt.deviceActions}},
 					DevicesCache: cache.NewCache[*models.Device](),
 					ActionsCache: cache.NewCache[*models.Action](),
 				})
-				_, err := svc.Execute(ctx, 1, 1)
+				_, err := svc.Execute(ctx, 1, 1, nil)
 				assert.EqualError(t, err, tt.wantErr)
 			})
 		}
@@ -125,17 +130,17 @@ func TestExecute(t *testing.T) {
 				server := createRecordingServer(tt.deviceResponse, tt.serverStatus)
 				defer server.Close()
 
-				deviceRepo := &mockDeviceRepo{device: &models.Device{ID: 1, IP: server.Listener.Addr().String(), Actions: "[1,2]"}}
+				deviceRepo := &mockDeviceRepo{device: &models.Device{ID: 1, IP: server.Listener.Addr().String()}}
 				actionRepo := &mockActionRepo{action: &models.Action{ID: 1, Path: tt.actionPath, Params: tt.actionParams}}
 				svc := NewService(ServiceConfig{
 					DevicesRepo:  deviceRepo,
 					ActionsRepo:  actionRepo,
-					QueryRepo:    &mockQuerier{},
+					QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1, 2}}},
 					DevicesCache: cache.NewCache[*models.Device](),
 					ActionsCache: cache.NewCache[*models.Action](),
 				})
 
-				_, err := svc.Execute(ctx, 1, 1)
+				_, err := svc.Execute(ctx, 1, 1, nil)
 
 				if tt.wantErr == "" {
 					require.NoError(t, err)
@@ -151,4 +156,109 @@ func TestExecute(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("result schema", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			deviceResponse string
+			wantErr        string
+		}{
+			{name: "conforming result", deviceResponse: `{"jsonrpc":"2.0","result":{"temperature":21.5},"id":1}`},
+			{
+				name:           "malformed result is flagged",
+				deviceResponse: `{"jsonrpc":"2.0","result":{"temperature":"n/a"},"id":1}`,
+				wantErr:        "malformed device response: at '/temperature': got string, want number",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server := createRecordingServer(tt.deviceResponse, http.StatusOK)
+				defer server.Close()
+
+				svc := NewService(ServiceConfig{
+					DevicesRepo: &mockDeviceRepo{device: &models.Device{ID: 1, IP: server.Listener.Addr().String()}},
+					ActionsRepo: &mockActionRepo{action: &models.Action{
+						ID:           1,
+						Path:         "read_temp",
+						ResultSchema: `{"type":"object","properties":{"temperature":{"type":"number"}}}`,
+					}},
+					QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+					DevicesCache: cache.NewCache[*models.Device](),
+					ActionsCache: cache.NewCache[*models.Action](),
+				})
+
+				resp, err := svc.Execute(ctx, 1, 1, nil)
+				if tt.wantErr == "" {
+					require.NoError(t, err)
+					return
+				}
+				assert.EqualError(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, ErrMalformedResponse)
+				assert.NotNil(t, resp)
+			})
+		}
+	})
+
+	t.Run("parameterised action", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			params     map[string]any
+			wantErr    string
+			wantParams any
+		}{
+			{
+				name:       "defaults are used without values",
+				params:     nil,
+				wantParams: map[string]any{"zone": nil, "seconds": float64(30)},
+			},
+			{
+				name:       "values replace placeholders",
+				params:     map[string]any{"duration": float64(90), "zone": "tomatoes"},
+				wantParams: map[string]any{"zone": "tomatoes", "seconds": float64(90)},
+			},
+			{
+				name:    "value of wrong type is rejected before calling the device",
+				params:  map[string]any{"duration": "long"},
+				wantErr: "parameter 'duration' must be of type integer",
+			},
+			{
+				name:    "unknown parameter is rejected",
+				params:  map[string]any{"speed": 3},
+				wantErr: "unknown parameter 'speed'",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+				defer server.Close()
+
+				svc := NewService(ServiceConfig{
+					DevicesRepo: &mockDeviceRepo{device: &models.Device{ID: 1, IP: server.Listener.Addr().String()}},
+					ActionsRepo: &mockActionRepo{action: &models.Action{
+						ID:         1,
+						Path:       "water",
+						Params:     `{"zone":"{{zone}}","seconds":"{{duration}}"}`,
+						Parameters: `[{"name":"duration","type":"integer","default":30},{"name":"zone","type":"string"}]`,
+					}},
+					QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+					DevicesCache: cache.NewCache[*models.Device](),
+					ActionsCache: cache.NewCache[*models.Action](),
+				})
+
+				_, err := svc.Execute(ctx, 1, 1, tt.params)
+
+				if tt.wantErr != "" {
+					assert.EqualError(t, err, tt.wantErr)
+					assert.Zero(t, server.getCallCount())
+					return
+				}
+				require.NoError(t, err)
+				reqs := server.getRequests()
+				require.Len(t, reqs, 1)
+				assert.Equal(t, tt.wantParams, reqs[0].Params)
+			})
+		}
+	})
 }
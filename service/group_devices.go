@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// GroupDevices returns the devices in a group, in ID order.
+func (s *Service) GroupDevices(ctx context.Context, groupId int) ([]*models.Device, error) {
+	if _, err := s.groupsRepo.Get(ctx, groupId); err != nil {
+		return nil, fmt.Errorf("getting group: %w", err)
+	}
+
+	deviceIds, err := s.queryRepo.GetGroupDeviceIDs(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*models.Device, 0, len(deviceIds))
+	for _, deviceId := range deviceIds {
+		device, err := s.devicesRepo.Get(ctx, deviceId)
+		if err != nil {
+			return nil, fmt.Errorf("getting device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// AllGroupDevices returns every group membership.
+func (s *Service) AllGroupDevices(ctx context.Context) ([]models.GroupDevice, error) {
+	return s.queryRepo.GetGroupDevices(ctx)
+}
+
+// AddGroupDevice adds a device to a group. Adding a member is a no-op.
+func (s *Service) AddGroupDevice(ctx context.Context, groupId, deviceId int) error {
+	if _, err := s.groupsRepo.Get(ctx, groupId); err != nil {
+		return fmt.Errorf("getting group: %w", err)
+	}
+	if _, err := s.devicesRepo.Get(ctx, deviceId); err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+	return s.queryRepo.AddGroupDevice(ctx, groupId, deviceId)
+}
+
+// RemoveGroupDevice removes a device from a group. The last device can't be removed
+// while automations refer to the group, since their triggers and actions would select
+// no devices. It fails with sql.ErrNoRows when the device isn't a member of the group.
+func (s *Service) RemoveGroupDevice(ctx context.Context, groupId, deviceId int) error {
+	group, err := s.groupsRepo.Get(ctx, groupId)
+	if err != nil {
+		return fmt.Errorf("getting group: %w", err)
+	}
+
+	deviceIds, err := s.queryRepo.GetGroupDeviceIDs(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	if len(deviceIds) == 1 && deviceIds[0] == deviceId {
+		automations, err := s.dependentAutomations(ctx, models.RefGroup, group.Name)
+		if err != nil {
+			return err
+		}
+		if len(automations) > 0 {
+			return &DependentsError{
+				Kind:       models.RefGroup,
+				Name:       group.Name,
+				Dependents: &Dependents{Automations: asDependents(automations)},
+				hint:       "its last device can't be removed",
+			}
+		}
+	}
+
+	return s.queryRepo.RemoveGroupDevice(ctx, groupId, deviceId)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestGroupDevices(t *testing.T) {
+	ctx := context.Background()
+
+	newGroupDeviceService := func(querier *mockQuerier, automations ...*models.Automation) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{devices: []*models.Device{
+				{ID: 1, Name: "fan-1"},
+				{ID: 2, Name: "fan-2"},
+			}},
+			GroupsRepo:      &mockGroupRepo{groups: []*models.Group{{ID: 1, Name: "fans"}}},
+			AutomationsRepo: &mockAutomationRepo{automations: automations},
+			QueryRepo:       querier,
+		})
+	}
+
+	t.Run("add and list", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := newGroupDeviceService(querier)
+
+		require.NoError(t, svc.AddGroupDevice(ctx, 1, 2))
+		require.NoError(t, svc.AddGroupDevice(ctx, 1, 1))
+		require.NoError(t, svc.AddGroupDevice(ctx, 1, 2))
+
+		devices, err := svc.GroupDevices(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, devices, 2)
+		assert.Equal(t, "fan-1", devices[0].Name)
+		assert.Equal(t, "fan-2", devices[1].Name)
+
+		all, err := svc.AllGroupDevices(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []models.GroupDevice{{GroupID: 1, DeviceID: 2}, {GroupID: 1, DeviceID: 1}}, all)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		querier := &mockQuerier{groupDevices: map[int][]int{1: {1, 2}}}
+		svc := newGroupDeviceService(querier)
+
+		require.NoError(t, svc.RemoveGroupDevice(ctx, 1, 1))
+		assert.Equal(t, []int{2}, querier.groupDevices[1])
+
+		err := svc.RemoveGroupDevice(ctx, 1, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("last device kept while automations use the group", func(t *testing.T) {
+		def, err := createYAMLDefinition(models.AutomationDefinition{
+			Interval: "5m",
+			Actions:  []models.AutomationAction{{Group: "fans", Action: "turn_on"}},
+		})
+		require.NoError(t, err)
+		querier := &mockQuerier{groupDevices: map[int][]int{1: {1, 2}}}
+		svc := newGroupDeviceService(querier, &models.Automation{ID: 1, Name: "cool down", Definition: def})
+
+		require.NoError(t, svc.RemoveGroupDevice(ctx, 1, 1))
+
+		err = svc.RemoveGroupDevice(ctx, 1, 2)
+		var dependentsErr *DependentsError
+		require.ErrorAs(t, err, &dependentsErr)
+		assert.EqualError(t, err, "group 'fans' is used by automations 'cool down'; its last device can't be removed")
+		assert.Equal(t, []int{2}, querier.groupDevices[1])
+	})
+
+	t.Run("add to missing group", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := newGroupDeviceService(querier)
+
+		err := svc.AddGroupDevice(ctx, 7, 1)
+		assert.EqualError(t, err, "getting group: sql: no rows in result set")
+		assert.Empty(t, querier.groupDevices)
+	})
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+type HealthConfig struct {
+	// Method is the JSON-RPC method used to ping devices. Any JSON-RPC response,
+	// including an error such as "Method not found", means the device is online.
+	Method string
+	// Timeout limits a single ping. Defaults to the device call timeout.
+	Timeout time.Duration
+	// OfflineAfter is the number of consecutive failed pings after which a device
+	// is reported offline. Defaults to 1.
+	OfflineAfter int
+}
+
+const defaultHealthMethod = "ping"
+
+// errHealthSkipped is returned for pings that weren't sent, because the device was
+// busy or its circuit breaker rejected the call. They don't change its health.
+var errHealthSkipped = errors.New("health check skipped")
+
+// deviceHealth is the health checker's view of a device between checks.
+type deviceHealth struct {
+	status   string
+	failures int
+}
+
+func (s *Service) RunHealthChecks(ctx context.Context, interval time.Duration, errCh chan<- error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.checkHealth(ctx); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// checkHealth pings all devices concurrently and records the outcome.
+func (s *Service) checkHealth(ctx context.Context) error {
+	devices, err := s.devicesRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting devices: %w", err)
+	}
+
+	known := make(map[int]bool, len(devices))
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		known[device.ID] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.checkDevice(ctx, device)
+		}()
+	}
+	wg.Wait()
+
+	// Forget the health, breakers and batch support of devices that were deleted
+	for _, states := range []*sync.Map{&s.health, &s.breakers, &s.noBatch} {
+		states.Range(func(key, _ any) bool {
+			if !known[key.(int)] {
+				states.Delete(key)
+			}
+			return true
+		})
+	}
+
+	return nil
+}
+
+func (s *Service) checkDevice(ctx context.Context, device *models.Device) {
+	// Start from the stored status so a restart does not report every device as changed
+	value, _ := s.health.LoadOrStore(device.ID, &deviceHealth{status: device.Status})
+	health := value.(*deviceHealth)
+
+	now := time.Now()
+	latency, err := s.pingDevice(ctx, device)
+	if ctx.Err() != nil {
+		return
+	}
+	if errors.Is(err, errHealthSkipped) {
+		s.logger.Debug("health check skipped", "device", device.Name, "error", err)
+		return
+	}
+
+	lastSeen, latencyMs := device.LastSeen, device.LatencyMs
+	previous := health.status
+	if err != nil {
+		s.logger.Debug("health check failed", "device", device.Name, "error", err)
+		health.failures++
+		if health.failures >= max(s.healthCfg.OfflineAfter, 1) {
+			health.status = models.StatusOffline
+		}
+	} else {
+		health.failures = 0
+		health.status = models.StatusOnline
+		lastSeen = now.UTC().Format(time.RFC3339)
+		latencyMs = int(latency.Milliseconds())
+	}
+
+	if health.status == previous && err != nil {
+		return
+	}
+
+	if err := s.queryRepo.UpdateDeviceHealth(ctx, device.ID, health.status, lastSeen, latencyMs); err != nil {
+		s.logger.Warn("failed to record device health", "device", device.Name, "error", err)
+	}
+
+	if health.status == previous {
+		return
+	}
+
+	event := Event{Type: EventDeviceOnline, DeviceID: device.ID, Device: device.Name, Time: now}
+	if health.status == models.StatusOffline {
+		event.Type = EventDeviceOffline
+		event.Data = map[string]any{"error": err.Error()}
+	} else {
+		event.Data = map[string]any{"latency_ms": latencyMs}
+	}
+	s.publish(event)
+}
+
+// pingDevice sends the health check method to the device and returns the round trip
+// time. Pings wait their turn in the device's command queue behind any command and
+// go through its circuit breaker, but are not retried.
+func (s *Service) pingDevice(ctx context.Context, device *models.Device) (time.Duration, error) {
+	transport, err := s.getTransport(device)
+	if err != nil {
+		return 0, err
+	}
+
+	release, err := s.acquireDevice(ctx, device.ID, PriorityHealth)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errHealthSkipped, err)
+	}
+	defer release()
+
+	breaker := s.getBreaker(device.ID)
+	if err := breaker.allow(); err != nil {
+		return 0, fmt.Errorf("%w: %w", errHealthSkipped, err)
+	}
+
+	timeout := s.healthCfg.Timeout
+	if timeout <= 0 {
+		timeout = s.callTimeout(device)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := s.healthCfg.Method
+	if method == "" {
+		method = defaultHealthMethod
+	}
+
+	req := &JSONRPCRequest{JSONRPC: "2.0", Method: method, ID: int(s.requestID.Add(1))}
+	start := time.Now()
+	response, err := transport.Call(callCtx, device, req)
+	if err == nil && response.ID != req.ID && !(response.ID == 0 && response.Error != nil) {
+		err = fmt.Errorf("response ID %d does not match request ID %d", response.ID, req.ID)
+	}
+	if err != nil {
+		breaker.done(ctx, err)
+		return 0, err
+	}
+	breaker.success()
+
+	return time.Since(start), nil
+}
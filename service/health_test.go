@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// eventRecorder collects published events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []string
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func createHealthTestService(devices []*models.Device, cfg HealthConfig) (*Service, *mockQuerier, *eventRecorder) {
+	querier := &mockQuerier{}
+	svc := NewService(ServiceConfig{
+		DevicesRepo: &mockDeviceRepo{devices: devices},
+		QueryRepo:   querier,
+		Health:      cfg,
+	})
+	recorder := &eventRecorder{}
+	svc.Subscribe(recorder.record)
+	return svc, querier, recorder
+}
+
+// unreachableAddr returns the address of a server that is no longer listening.
+func unreachableAddr() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.Listener.Addr().String()
+	server.Close()
+	return addr
+}
+
+func TestCheckHealth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("responding device is recorded online", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, recorder := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String()}},
+			HealthConfig{Method: "health.ping"},
+		)
+		require.NoError(t, svc.checkHealth(ctx))
+
+		requests := server.getRequests()
+		require.Len(t, requests, 1)
+		assert.Equal(t, "health.ping", requests[0].Method)
+
+		health, ok := querier.getHealth(1)
+		require.True(t, ok)
+		assert.Equal(t, models.StatusOnline, health.status)
+		lastSeen, err := time.Parse(time.RFC3339, health.lastSeen)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), lastSeen, time.Minute)
+
+		assert.Equal(t, []string{EventDeviceOnline}, recorder.types())
+		assert.Equal(t, "sensor", recorder.events[0].Device)
+	})
+
+	t.Run("JSON-RPC error still means online", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, _ := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String()}},
+			HealthConfig{},
+		)
+		require.NoError(t, svc.checkHealth(ctx))
+
+		assert.Equal(t, defaultHealthMethod, server.getRequests()[0].Method)
+		health, _ := querier.getHealth(1)
+		assert.Equal(t, models.StatusOnline, health.status)
+	})
+
+	t.Run("device goes offline after consecutive failures", func(t *testing.T) {
+		device := &models.Device{ID: 1, Name: "sensor", IP: unreachableAddr(), Status: models.StatusOnline, LastSeen: "2026-01-02T15:04:05Z", LatencyMs: 12}
+		svc, querier, recorder := createHealthTestService([]*models.Device{device}, HealthConfig{OfflineAfter: 2})
+
+		require.NoError(t, svc.checkHealth(ctx))
+		_, updated := querier.getHealth(1)
+		assert.False(t, updated)
+		assert.Empty(t, recorder.types())
+
+		require.NoError(t, svc.checkHealth(ctx))
+		health, ok := querier.getHealth(1)
+		require.True(t, ok)
+		assert.Equal(t, healthUpdate{status: models.StatusOffline, lastSeen: "2026-01-02T15:04:05Z", latencyMs: 12}, health)
+		assert.Equal(t, []string{EventDeviceOffline}, recorder.types())
+		assert.Contains(t, recorder.events[0].Data["error"], "connection refused")
+
+		// No further events while the device stays offline
+		require.NoError(t, svc.checkHealth(ctx))
+		assert.Len(t, recorder.types(), 1)
+	})
+
+	t.Run("stored status is not reported as a change", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, recorder := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String(), Status: models.StatusOnline}},
+			HealthConfig{},
+		)
+		require.NoError(t, svc.checkHealth(ctx))
+
+		_, updated := querier.getHealth(1)
+		assert.True(t, updated, "last seen is still recorded")
+		assert.Empty(t, recorder.types())
+	})
+
+	t.Run("offline device coming back is reported online", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, _, recorder := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String(), Status: models.StatusOffline}},
+			HealthConfig{},
+		)
+		require.NoError(t, svc.checkHealth(ctx))
+		assert.Equal(t, []string{EventDeviceOnline}, recorder.types())
+	})
+
+	t.Run("deleted devices are forgotten", func(t *testing.T) {
+		repo := &mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "sensor", IP: unreachableAddr()}}}
+		svc := NewService(ServiceConfig{DevicesRepo: repo, QueryRepo: &mockQuerier{}})
+
+		require.NoError(t, svc.checkHealth(ctx))
+		_, tracked := svc.health.Load(1)
+		assert.True(t, tracked)
+		_, tracked = svc.breakers.Load(1)
+		assert.True(t, tracked)
+
+		repo.devices = []*models.Device{}
+		require.NoError(t, svc.checkHealth(ctx))
+		_, tracked = svc.health.Load(1)
+		assert.False(t, tracked)
+		_, tracked = svc.breakers.Load(1)
+		assert.False(t, tracked)
+	})
+
+	t.Run("busy device is not pinged", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, recorder := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String(), Status: models.StatusOffline}},
+			HealthConfig{},
+		)
+		svc.queueCfg = QueueConfig{WaitTimeout: 20 * time.Millisecond}
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		defer release()
+
+		require.NoError(t, svc.checkHealth(ctx))
+		assert.Zero(t, server.getCallCount())
+		_, updated := querier.getHealth(1)
+		assert.False(t, updated)
+		assert.Empty(t, recorder.types())
+	})
+
+	t.Run("open circuit breaker skips the ping", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, _ := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String(), Status: models.StatusOffline}},
+			HealthConfig{},
+		)
+		svc.breakerCfg = BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour}
+		svc.getBreaker(1).failure()
+
+		require.NoError(t, svc.checkHealth(ctx))
+		assert.Zero(t, server.getCallCount())
+		_, updated := querier.getHealth(1)
+		assert.False(t, updated)
+	})
+
+	t.Run("ping is the trial call of a half-open breaker", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":"pong","id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, querier, _ := createHealthTestService(
+			[]*models.Device{{ID: 1, Name: "sensor", IP: server.Listener.Addr().String(), Status: models.StatusOffline}},
+			HealthConfig{},
+		)
+		svc.breakerCfg = BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}
+		breaker := svc.getBreaker(1)
+		breaker.failure()
+		breaker.now = func() time.Time { return time.Now().Add(time.Minute) }
+
+		require.NoError(t, svc.checkHealth(ctx))
+		assert.Equal(t, 1, server.getCallCount())
+		health, _ := querier.getHealth(1)
+		assert.Equal(t, models.StatusOnline, health.status)
+		assert.Equal(t, BreakerClosed, breaker.status().State)
+	})
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// httpTransport sends JSON-RPC requests as HTTP POSTs to the device's RPC endpoint.
+// All devices share one client so connections are pooled and reused between calls.
+// Call timeouts come from the request context.
+type httpTransport struct {
+	client *http.Client
+}
+
+func newHTTPTransport() *httpTransport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.MaxIdleConnsPerHost = 4
+	transport.IdleConnTimeout = 60 * time.Second
+	transport.TLSHandshakeTimeout = 5 * time.Second
+
+	return &httpTransport{client: &http.Client{Transport: transport}}
+}
+
+// statusError is returned when a device answers with a non-200 HTTP status.
+type statusError struct {
+	code int
+}
+
+func (e statusError) Error() string { return fmt.Sprintf("device returned status %d", e.code) }
+
+func (t *httpTransport) Call(ctx context.Context, device *models.Device, req *JSONRPCRequest) (*JSONRPCResponse, error) {
+	body, err := t.post(ctx, device, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *JSONRPCResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return response, nil
+}
+
+// CallBatch sends the requests as one JSON-RPC batch. It only reports
+// errBatchUnsupported when the device rejected the batch format itself, so that
+// failures such as a wrong auth secret aren't mistaken for a lack of batch support.
+func (t *httpTransport) CallBatch(ctx context.Context, device *models.Device, reqs []*JSONRPCRequest) ([]*JSONRPCResponse, error) {
+	body, err := t.post(ctx, device, reqs)
+	if err != nil {
+		var se statusError
+		if errors.As(err, &se) && rejectsBatchStatus(se.code) {
+			return nil, permanent(errBatchUnsupported)
+		}
+		return nil, err
+	}
+
+	// Devices without batch support typically answer with a single error object
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		var response JSONRPCResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("decoding batch response: %w", err)
+		}
+		if response.Error != nil && rejectsBatchCode(response.Error.Code) {
+			return nil, permanent(errBatchUnsupported)
+		}
+		return nil, errors.New("device answered a batch with a single response")
+	}
+
+	var responses []*JSONRPCResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return nil, fmt.Errorf("decoding batch response: %w", err)
+	}
+
+	return responses, nil
+}
+
+// rejectsBatchStatus reports whether an HTTP status means the device couldn't parse
+// or doesn't accept the batch body.
+func rejectsBatchStatus(code int) bool {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// rejectsBatchCode reports whether a JSON-RPC error code means the device couldn't
+// parse the batch or doesn't take an array as a request.
+func rejectsBatchCode(code int) bool {
+	return code == jsonRPCParseError || code == jsonRPCInvalidRequest
+}
+
+func (t *httpTransport) post(ctx context.Context, device *models.Device, payload any) ([]byte, error) {
+	if !isPrivateIP(device.IP) {
+		return nil, permanent(errors.New("device IP must be in private range"))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("marshaling JSON-RPC request: %w", err))
+	}
+
+	headers, err := device.ParseHeaders()
+	if err != nil {
+		return nil, permanent(fmt.Errorf("parsing device headers: %w", err))
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, deviceURL(device), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, permanent(fmt.Errorf("constructing HTTP call: %w", err))
+	}
+
+	httpReq.Header.Add("Content-Type", "application/json")
+	for name, value := range headers {
+		httpReq.Header.Set(name, value)
+	}
+	authenticate(httpReq, device, body, time.Now())
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("calling device: %w", err)
+	}
+	defer resp.Body.Close() // nolint
+
+	if resp.StatusCode != http.StatusOK {
+		err := statusError{code: resp.StatusCode}
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	return respBody, nil
+}
+
+// deviceURL builds the RPC endpoint URL, defaulting to http://<ip>/rpc.
+func deviceURL(device *models.Device) string {
+	u := url.URL{Scheme: "http", Host: device.IP, Path: "/rpc"}
+
+	if device.Scheme != "" {
+		u.Scheme = device.Scheme
+	}
+
+	if device.Port != 0 {
+		host, _, err := net.SplitHostPort(device.IP)
+		if err != nil {
+			host = device.IP
+		}
+		u.Host = net.JoinHostPort(host, strconv.Itoa(device.Port))
+	}
+
+	if device.RPCPath != "" {
+		u.Path = device.RPCPath
+	}
+
+	return u.String()
+}
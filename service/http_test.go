@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestDeviceURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		device models.Device
+		want   string
+	}{
+		{name: "defaults", device: models.Device{IP: "192.168.1.10"}, want: "http://192.168.1.10/rpc"},
+		{name: "ip with port", device: models.Device{IP: "192.168.1.10:8080"}, want: "http://192.168.1.10:8080/rpc"},
+		{name: "https scheme", device: models.Device{IP: "192.168.1.10", Scheme: "https"}, want: "https://192.168.1.10/rpc"},
+		{name: "custom port", device: models.Device{IP: "192.168.1.10", Port: 8443}, want: "http://192.168.1.10:8443/rpc"},
+		{name: "custom rpc path", device: models.Device{IP: "192.168.1.10", RPCPath: "/cm"}, want: "http://192.168.1.10/cm"},
+		{
+			name:   "all fields",
+			device: models.Device{IP: "10.0.0.5", Scheme: "https", Port: 4443, RPCPath: "/api/v1/rpc"},
+			want:   "https://10.0.0.5:4443/api/v1/rpc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, deviceURL(&tt.device))
+		})
+	}
+}
+
+func TestHTTPTransport_CustomEndpoint(t *testing.T) {
+	var gotPath, gotToken, gotContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotToken = r.Header.Get("X-Api-Key")
+		gotContentType = r.Header.Get("Content-Type")
+		w.Write([]byte(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)) // nolint
+	}))
+	defer server.Close()
+
+	device := &models.Device{
+		IP:      server.Listener.Addr().String(),
+		RPCPath: "/rpc/Switch.Set",
+		Headers: `{"X-Api-Key":"secret"}`,
+	}
+
+	transport := newHTTPTransport()
+	_, err := transport.Call(context.Background(), device, &JSONRPCRequest{JSONRPC: "2.0", Method: "Switch.Set", ID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "/rpc/Switch.Set", gotPath)
+	assert.Equal(t, "secret", gotToken)
+	assert.Equal(t, "application/json", gotContentType)
+}
+
+func TestHTTPTransport_ReusesConnections(t *testing.T) {
+	var newConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":1}`)) // nolint
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	device := &models.Device{IP: server.Listener.Addr().String()}
+	transport := newHTTPTransport()
+	for range 5 {
+		_, err := transport.Call(context.Background(), device, &JSONRPCRequest{JSONRPC: "2.0", Method: "ping", ID: 1})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(1), newConns.Load())
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+var (
+	// ErrIngestDisabled is returned when a device without an ingest token pushes data.
+	ErrIngestDisabled = errors.New("ingestion is not enabled for this device")
+	// ErrInvalidIngestToken is returned when the pushed token does not match the device's.
+	ErrInvalidIngestToken = errors.New("invalid ingest token")
+)
+
+// ReportState stores a payload pushed by a device as the device's latest reported
+// state, replacing the previous one.
+func (s *Service) ReportState(ctx context.Context, deviceId int, token string, state map[string]any) error {
+	device, err := s.devicesRepo.Get(ctx, deviceId)
+	if err != nil {
+		return fmt.Errorf("getting device: %w", err)
+	}
+
+	if device.IngestToken == "" {
+		return ErrIngestDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(device.IngestToken)) != 1 {
+		return ErrInvalidIngestToken
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding reported state: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.queryRepo.UpdateReportedState(ctx, deviceId, string(data), now.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	s.publish(Event{Type: EventDeviceReported, DeviceID: device.ID, Device: device.Name, Time: now, Data: state})
+	return nil
+}
+
+// readReportedState returns the state last pushed by the trigger's device, checking
+// that it is not older than the trigger's max_age.
+func (s *Service) readReportedState(ctx context.Context, trigger models.AutomationTrigger, now time.Time) (map[string]any, error) {
+	deviceID, err := s.devicesCache.GetIDByName(ctx, s.queryRepo, "devices", trigger.Device)
+	if err != nil {
+		return nil, fmt.Errorf("looking up device: %w", err)
+	}
+
+	device, err := s.devicesRepo.Get(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("getting device: %w", err)
+	}
+
+	if device.ReportedAt == "" {
+		return nil, fmt.Errorf("device has not reported any state")
+	}
+
+	if trigger.MaxAge != "" {
+		maxAge, err := time.ParseDuration(trigger.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("parsing max_age: %w", err)
+		}
+		reportedAt, err := time.Parse(time.RFC3339, device.ReportedAt)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reported_at: %w", err)
+		}
+		if age := now.Sub(reportedAt); age > maxAge {
+			return nil, fmt.Errorf("reported state is %s old, older than max_age %s", age.Truncate(time.Second), maxAge)
+		}
+	}
+
+	state, err := device.ParseReportedState()
+	if err != nil {
+		return nil, fmt.Errorf("parsing reported state: %w", err)
+	}
+	return state, nil
+}
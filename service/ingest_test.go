@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+const testIngestToken = "0123456789abcdef"
+
+func TestReportState(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		repo    *mockDeviceRepo
+		token   string
+		wantErr error
+	}{
+		{
+			name:  "stores state",
+			repo:  &mockDeviceRepo{device: &models.Device{ID: 1, Name: "leak-sensor", IngestToken: testIngestToken}},
+			token: testIngestToken,
+		},
+		{
+			name:    "wrong token",
+			repo:    &mockDeviceRepo{device: &models.Device{ID: 1, Name: "leak-sensor", IngestToken: testIngestToken}},
+			token:   "fedcba9876543210",
+			wantErr: ErrInvalidIngestToken,
+		},
+		{
+			name:    "device without token",
+			repo:    &mockDeviceRepo{device: &models.Device{ID: 1, Name: "leak-sensor"}},
+			token:   "",
+			wantErr: ErrIngestDisabled,
+		},
+		{
+			name:    "unknown device",
+			repo:    &mockDeviceRepo{err: sql.ErrNoRows},
+			token:   testIngestToken,
+			wantErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &mockQuerier{}
+			svc := NewService(ServiceConfig{DevicesRepo: tt.repo, QueryRepo: querier})
+			recorder := &eventRecorder{}
+			svc.Subscribe(recorder.record)
+
+			err := svc.ReportState(ctx, 1, tt.token, map[string]any{"leak": true, "battery": 87})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, querier.reported)
+				assert.Empty(t, recorder.types())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"leak":true,"battery":87}`, querier.reported[1])
+			assert.Equal(t, []string{EventDeviceReported}, recorder.types())
+			assert.Equal(t, map[string]any{"leak": true, "battery": 87}, recorder.events[0].Data)
+		})
+	}
+}
+
+func TestReadTriggers_Reported(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	createService := func(device *models.Device) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{devices: []*models.Device{device}},
+			QueryRepo:    &mockQuerier{nameToID: map[string]int{"devices:" + device.Name: device.ID}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+		})
+	}
+
+	t.Run("reported state is used without calling the device", func(t *testing.T) {
+		svc := createService(&models.Device{
+			ID: 1, Name: "leak-sensor", IP: unreachableAddr(),
+			ReportedState: `{"leak":true}`, ReportedAt: now.Add(-time.Minute).Format(time.RFC3339),
+		})
+
+		responses, err := svc.readTriggers(ctx, []models.AutomationTrigger{
+			{Device: "leak-sensor", Source: models.TriggerSourceReported, MaxAge: "5m"},
+		}, now)
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"leak": true}}, responses)
+	})
+
+	t.Run("stale state", func(t *testing.T) {
+		svc := createService(&models.Device{
+			ID: 1, Name: "leak-sensor",
+			ReportedState: `{"leak":true}`, ReportedAt: now.Add(-time.Hour).Format(time.RFC3339),
+		})
+
+		_, err := svc.readTriggers(ctx, []models.AutomationTrigger{
+			{Device: "leak-sensor", Source: models.TriggerSourceReported, MaxAge: "15m"},
+		}, now)
+		assert.EqualError(t, err, "reading reported state, device [leak-sensor]: reported state is 1h0m0s old, older than max_age 15m0s")
+	})
+
+	t.Run("device never reported", func(t *testing.T) {
+		svc := createService(&models.Device{ID: 1, Name: "leak-sensor"})
+
+		_, err := svc.readTriggers(ctx, []models.AutomationTrigger{
+			{Device: "leak-sensor", Source: models.TriggerSourceReported},
+		}, now)
+		assert.EqualError(t, err, "reading reported state, device [leak-sensor]: device has not reported any state")
+	})
+}
+
+func TestProcessAutomations_ReportedTrigger(t *testing.T) {
+	server := createRecordingServer(`{"jsonrpc":"2.0","result":{"closed":true},"id":1}`, http.StatusOK)
+	defer server.Close()
+
+	yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+		Interval: "1m",
+		Triggers: []models.AutomationTrigger{
+			{Device: "leak-sensor", Source: models.TriggerSourceReported, Conditions: []models.AutomationCondition{
+				{Field: "water", Operator: ">", Threshold: 0},
+			}},
+		},
+		Actions: []models.AutomationAction{{Device: "valve", Action: "close"}},
+	})
+	require.NoError(t, err)
+
+	svc := createTestServiceForAutomation(
+		&mockDeviceRepo{devices: []*models.Device{
+			{ID: 1, Name: "leak-sensor", ReportedState: `{"water":3}`, ReportedAt: time.Now().Format(time.RFC3339)},
+			{ID: 2, Name: "valve", IP: server.Listener.Addr().String()},
+		}},
+		map[int][]int{2: {1}},
+		&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "close", Path: "close"}}},
+		&mockAutomationRepo{automations: []*models.Automation{{
+			ID: 1, Name: "leak", Enabled: true, Definition: yamlDef, LastTriggersRun: createPastTimestamp(10 * time.Minute),
+		}}},
+		nil,
+	)
+
+	require.NoError(t, svc.processAutomations(context.Background()))
+
+	requests := server.getRequests()
+	require.Len(t, requests, 1, fmt.Sprintf("only the action is sent, got %v", requests))
+	assert.Equal(t, "close", requests[0].Method)
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+type JobsConfig struct {
+	// Workers is the number of jobs run at the same time. Defaults to 4.
+	Workers int
+	// QueueSize is the number of jobs that may wait for a worker. Defaults to 100.
+	QueueSize int
+	// MaxAge is how long finished jobs are kept before they are deleted. Defaults
+	// to 7 days.
+	MaxAge time.Duration
+}
+
+const (
+	defaultJobWorkers   = 4
+	defaultJobQueueSize = 100
+	defaultJobMaxAge    = 7 * 24 * time.Hour
+	jobPruneInterval    = time.Hour
+)
+
+// ErrJobQueueFull is returned when a job is submitted while every queue slot is taken.
+var ErrJobQueueFull = errors.New("job queue is full")
+
+// errJobInterrupted is recorded for jobs that were still queued or running when the
+// server stopped. They are not retried, since the device may have run the action.
+var errJobInterrupted = errors.New("server stopped before the job finished")
+
+// SubmitJob queues an action execution and returns the job at once. The device, action
+// and params are checked before queueing, so mistakes are reported to the caller.
+func (s *Service) SubmitJob(ctx context.Context, deviceId, actionId int, params map[string]any) (*models.Job, error) {
+	_, actions, err := s.getDeviceActions(ctx, deviceId, actionId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := actions[0].RenderParams(params); err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{DeviceID: deviceId, ActionID: actionId, State: models.JobQueued}
+	if len(params) > 0 {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling params: %w", err)
+		}
+		job.Params = string(data)
+	}
+
+	job.ID, err = s.jobsRepo.Create(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("creating job: %w", err)
+	}
+
+	select {
+	case s.jobQueue <- job.ID:
+	default:
+		s.finishJob(ctx, job, time.Now(), nil, ErrJobQueueFull)
+		return nil, ErrJobQueueFull
+	}
+
+	return s.jobsRepo.Get(ctx, job.ID)
+}
+
+// RunJobWorkers runs queued jobs until the context is done. Old finished jobs are
+// pruned every hour.
+func (s *Service) RunJobWorkers(ctx context.Context, errCh chan<- error) {
+	workers := s.jobsCfg.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(jobPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.PruneJobs(ctx); err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-s.jobQueue:
+					if err := s.runJob(ctx, id); err != nil {
+						select {
+						case errCh <- err:
+						default:
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Service) runJob(ctx context.Context, id int) error {
+	job, err := s.jobsRepo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting job %d: %w", id, err)
+	}
+
+	started := time.Now()
+	job.State = models.JobRunning
+	job.StartedAt = started.Format(time.RFC3339)
+	if err := s.jobsRepo.Update(ctx, job, job.ID); err != nil {
+		return fmt.Errorf("updating job %d: %w", id, err)
+	}
+
+	var params map[string]any
+	if job.Params != "" {
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return s.finishJob(ctx, job, started, nil, fmt.Errorf("parsing params: %w", err))
+		}
+	}
+
+	response, err := s.Execute(ctx, job.DeviceID, job.ActionID, params)
+	return s.finishJob(ctx, job, started, response, err)
+}
+
+// finishJob records the outcome of a job. A JSON-RPC error response is stored along
+// with the error.
+func (s *Service) finishJob(ctx context.Context, job *models.Job, started time.Time, response *JSONRPCResponse, callErr error) error {
+	finished := time.Now()
+	job.State = models.JobSucceeded
+	job.FinishedAt = finished.Format(time.RFC3339)
+	if job.StartedAt != "" {
+		job.DurationMs = int(finished.Sub(started).Milliseconds())
+	}
+
+	if response != nil {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("marshaling response of job %d: %w", job.ID, err)
+		}
+		job.Response = string(data)
+	}
+	if callErr != nil {
+		job.State = models.JobFailed
+		job.Error = callErr.Error()
+	}
+
+	if err := s.jobsRepo.Update(ctx, job, job.ID); err != nil {
+		return fmt.Errorf("updating job %d: %w", job.ID, err)
+	}
+
+	s.logger.Info("job finished", "job", job.ID, "state", job.State, "duration_ms", job.DurationMs)
+	return nil
+}
+
+// FailInterruptedJobs marks jobs left unfinished by a previous run of the server as
+// failed. It must run before any job is submitted.
+func (s *Service) FailInterruptedJobs(ctx context.Context) error {
+	jobs, err := s.jobsRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting jobs: %w", err)
+	}
+
+	for _, job := range jobs {
+		if job.Finished() {
+			continue
+		}
+		var started time.Time
+		if job.StartedAt != "" {
+			started, _ = time.Parse(time.RFC3339, job.StartedAt)
+		}
+		if err := s.finishJob(ctx, job, started, nil, errJobInterrupted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneJobs deletes the jobs that finished longer ago than the configured max age, so
+// the jobs table doesn't grow without bound.
+func (s *Service) PruneJobs(ctx context.Context) error {
+	maxAge := s.jobsCfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultJobMaxAge
+	}
+
+	before := time.Now().Add(-maxAge).Format(time.RFC3339)
+	n, err := s.queryRepo.DeleteJobsFinishedBefore(ctx, before)
+	if err != nil {
+		return fmt.Errorf("pruning jobs: %w", err)
+	}
+	if n > 0 {
+		s.logger.Info("pruned finished jobs", "count", n, "before", before)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestSubmitJob(t *testing.T) {
+	ctx := context.Background()
+
+	newJobService := func(ip string, jobs *mockJobRepo, queueSize int) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, IP: ip}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "blinds_down", Params: `{"pct":"{{pct}}"}`, Parameters: `[{"name":"pct","type":"integer","default":100}]`}},
+			JobsRepo:     jobs,
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Jobs:         JobsConfig{Workers: 1, QueueSize: queueSize},
+		})
+	}
+
+	t.Run("runs the job and stores the response", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		jobs := &mockJobRepo{}
+		svc := newJobService(server.Listener.Addr().String(), jobs, 10)
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go svc.RunJobWorkers(runCtx, make(chan error, 10))
+
+		job, err := svc.SubmitJob(ctx, 1, 1, map[string]any{"pct": 40})
+		require.NoError(t, err)
+		assert.Equal(t, models.JobQueued, job.State)
+		assert.JSONEq(t, `{"pct":40}`, job.Params)
+
+		require.Eventually(t, func() bool { return jobs.getJob(job.ID).Finished() }, 2*time.Second, 10*time.Millisecond)
+		done := jobs.getJob(job.ID)
+		assert.Equal(t, models.JobSucceeded, done.State)
+		assert.Contains(t, done.Response, `"ok":true`)
+		assert.Empty(t, done.Error)
+		assert.NotEmpty(t, done.StartedAt)
+		assert.NotEmpty(t, done.FinishedAt)
+
+		reqs := server.getRequests()
+		require.Len(t, reqs, 1)
+		assert.Equal(t, map[string]any{"pct": float64(40)}, reqs[0].Params)
+	})
+
+	t.Run("device error fails the job", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		jobs := &mockJobRepo{}
+		svc := newJobService(server.Listener.Addr().String(), jobs, 10)
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go svc.RunJobWorkers(runCtx, make(chan error, 10))
+
+		job, err := svc.SubmitJob(ctx, 1, 1, nil)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return jobs.getJob(job.ID).Finished() }, 2*time.Second, 10*time.Millisecond)
+		done := jobs.getJob(job.ID)
+		assert.Equal(t, models.JobFailed, done.State)
+		assert.Equal(t, "JSON-RPC error -32601: Method not found", done.Error)
+		assert.Contains(t, done.Response, "Method not found")
+	})
+
+	t.Run("invalid params are rejected before queueing", func(t *testing.T) {
+		jobs := &mockJobRepo{}
+		svc := newJobService("127.0.0.1:80", jobs, 10)
+
+		_, err := svc.SubmitJob(ctx, 1, 1, map[string]any{"pct": "half"})
+		var validationErr models.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		assert.Empty(t, jobs.jobs)
+	})
+
+	t.Run("full queue fails the job", func(t *testing.T) {
+		jobs := &mockJobRepo{}
+		svc := newJobService("127.0.0.1:80", jobs, 1)
+
+		_, err := svc.SubmitJob(ctx, 1, 1, nil)
+		require.NoError(t, err)
+		_, err = svc.SubmitJob(ctx, 1, 1, nil)
+		assert.ErrorIs(t, err, ErrJobQueueFull)
+
+		assert.Equal(t, models.JobQueued, jobs.getJob(1).State)
+		assert.Equal(t, models.JobFailed, jobs.getJob(2).State)
+		assert.Equal(t, ErrJobQueueFull.Error(), jobs.getJob(2).Error)
+	})
+}
+
+func TestFailInterruptedJobs(t *testing.T) {
+	jobs := &mockJobRepo{jobs: map[int]*models.Job{
+		1: {ID: 1, State: models.JobRunning, StartedAt: time.Now().Add(-time.Second).Format(time.RFC3339)},
+		2: {ID: 2, State: models.JobQueued},
+		3: {ID: 3, State: models.JobSucceeded, Response: `{"result":true}`},
+	}}
+	svc := NewService(ServiceConfig{JobsRepo: jobs, Jobs: JobsConfig{Workers: 1}})
+
+	require.NoError(t, svc.FailInterruptedJobs(context.Background()))
+
+	assert.Equal(t, models.JobFailed, jobs.getJob(1).State)
+	assert.Equal(t, errJobInterrupted.Error(), jobs.getJob(1).Error)
+	assert.Positive(t, jobs.getJob(1).DurationMs)
+	assert.Equal(t, models.JobFailed, jobs.getJob(2).State)
+	assert.Zero(t, jobs.getJob(2).DurationMs)
+	assert.Equal(t, models.JobSucceeded, jobs.getJob(3).State)
+}
+
+func TestPruneJobs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deletes jobs finished before the max age", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := NewService(ServiceConfig{QueryRepo: querier, Jobs: JobsConfig{MaxAge: time.Hour}})
+
+		require.NoError(t, svc.PruneJobs(ctx))
+		require.Len(t, querier.jobsPruned, 1)
+		before, err := time.Parse(time.RFC3339, querier.jobsPruned[0])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), before, 2*time.Second)
+	})
+
+	t.Run("keeps jobs for 7 days by default", func(t *testing.T) {
+		querier := &mockQuerier{}
+		svc := NewService(ServiceConfig{QueryRepo: querier})
+
+		require.NoError(t, svc.PruneJobs(ctx))
+		require.Len(t, querier.jobsPruned, 1)
+		before, err := time.Parse(time.RFC3339, querier.jobsPruned[0])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), before, 2*time.Second)
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		svc := NewService(ServiceConfig{QueryRepo: &mockQuerier{err: errors.New("database is locked")}})
+		assert.EqualError(t, svc.PruneJobs(ctx), "pruning jobs: database is locked")
+	})
+}
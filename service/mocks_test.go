@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"sync"
 
 	"github.com/tender-barbarian/gniotek/repository/models"
@@ -17,8 +18,29 @@ import (
 // ============================================================================
 
 type mockQuerier struct {
-	nameToID map[string]int // key: "table:name"
-	err      error
+	nameToID      map[string]int // key: "table:name"
+	deviceActions map[int][]int  // key: device ID
+	groupDevices  map[int][]int  // key: group ID
+	err           error
+	mu            sync.Mutex
+	health        map[int]healthUpdate
+	reported      map[int]string
+	times         map[int]map[string]string // key: automation ID, then column
+	renamed       []renameCall
+	jobsPruned    []string // cutoff of each DeleteJobsFinishedBefore call
+}
+
+type renameCall struct {
+	table       string
+	id          int
+	name        string
+	automations []string
+}
+
+type healthUpdate struct {
+	status    string
+	lastSeen  string
+	latencyMs int
 }
 
 func (m *mockQuerier) GetIDByName(_ context.Context, table, name string) (int, error) {
@@ -32,6 +54,179 @@ func (m *mockQuerier) GetIDByName(_ context.Context, table, name string) (int, e
 	return id, nil
 }
 
+func (m *mockQuerier) UpdateDeviceHealth(_ context.Context, id int, status, lastSeen string, latencyMs int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.health == nil {
+		m.health = map[int]healthUpdate{}
+	}
+	m.health[id] = healthUpdate{status: status, lastSeen: lastSeen, latencyMs: latencyMs}
+	return m.err
+}
+
+func (m *mockQuerier) UpdateReportedState(_ context.Context, id int, state, reportedAt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reported == nil {
+		m.reported = map[int]string{}
+	}
+	m.reported[id] = state
+	return m.err
+}
+
+func (m *mockQuerier) GetDeviceActionIDs(_ context.Context, deviceID int) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.deviceActions[deviceID]), m.err
+}
+
+func (m *mockQuerier) GetDeviceActions(_ context.Context) ([]models.DeviceAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deviceActions []models.DeviceAction
+	for deviceID, actionIDs := range m.deviceActions {
+		for _, actionID := range actionIDs {
+			deviceActions = append(deviceActions, models.DeviceAction{DeviceID: deviceID, ActionID: actionID})
+		}
+	}
+	return deviceActions, m.err
+}
+
+func (m *mockQuerier) AttachAction(_ context.Context, deviceID, actionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deviceActions == nil {
+		m.deviceActions = map[int][]int{}
+	}
+	if !slices.Contains(m.deviceActions[deviceID], actionID) {
+		m.deviceActions[deviceID] = append(m.deviceActions[deviceID], actionID)
+	}
+	return m.err
+}
+
+func (m *mockQuerier) DetachAction(_ context.Context, deviceID, actionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.Index(m.deviceActions[deviceID], actionID)
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+	m.deviceActions[deviceID] = slices.Delete(m.deviceActions[deviceID], i, i+1)
+	return m.err
+}
+
+func (m *mockQuerier) GetGroupDeviceIDs(_ context.Context, groupID int) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := slices.Clone(m.groupDevices[groupID])
+	slices.Sort(ids)
+	return ids, m.err
+}
+
+func (m *mockQuerier) GetDeviceGroupIDs(_ context.Context, deviceID int) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []int
+	for groupID, deviceIDs := range m.groupDevices {
+		if slices.Contains(deviceIDs, deviceID) {
+			ids = append(ids, groupID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, m.err
+}
+
+func (m *mockQuerier) GetGroupDevices(_ context.Context) ([]models.GroupDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var groupDevices []models.GroupDevice
+	for groupID, deviceIDs := range m.groupDevices {
+		for _, deviceID := range deviceIDs {
+			groupDevices = append(groupDevices, models.GroupDevice{GroupID: groupID, DeviceID: deviceID})
+		}
+	}
+	return groupDevices, m.err
+}
+
+func (m *mockQuerier) AddGroupDevice(_ context.Context, groupID, deviceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groupDevices == nil {
+		m.groupDevices = map[int][]int{}
+	}
+	if !slices.Contains(m.groupDevices[groupID], deviceID) {
+		m.groupDevices[groupID] = append(m.groupDevices[groupID], deviceID)
+	}
+	return m.err
+}
+
+func (m *mockQuerier) RemoveGroupDevice(_ context.Context, groupID, deviceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.Index(m.groupDevices[groupID], deviceID)
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+	m.groupDevices[groupID] = slices.Delete(m.groupDevices[groupID], i, i+1)
+	return m.err
+}
+
+func (m *mockQuerier) UpdateAutomationLastCheck(_ context.Context, id int, at string) error {
+	return m.setTime(id, "last_check", at)
+}
+
+func (m *mockQuerier) UpdateAutomationLastTriggersRun(_ context.Context, id int, at string) error {
+	return m.setTime(id, "last_triggers_run", at)
+}
+
+func (m *mockQuerier) UpdateAutomationLastActionRun(_ context.Context, id int, at string) error {
+	return m.setTime(id, "last_action_run", at)
+}
+
+func (m *mockQuerier) DeleteJobsFinishedBefore(_ context.Context, before string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobsPruned = append(m.jobsPruned, before)
+	return 0, m.err
+}
+
+func (m *mockQuerier) setTime(id int, column, at string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.times == nil {
+		m.times = map[int]map[string]string{}
+	}
+	if m.times[id] == nil {
+		m.times[id] = map[string]string{}
+	}
+	m.times[id][column] = at
+	return m.err
+}
+
+func (m *mockQuerier) getTime(id int, column string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.times[id][column]
+}
+
+func (m *mockQuerier) Rename(_ context.Context, table string, id int, name string, automations []*models.Automation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	call := renameCall{table: table, id: id, name: name}
+	for _, automation := range automations {
+		call.automations = append(call.automations, automation.Name)
+	}
+	m.renamed = append(m.renamed, call)
+	return m.err
+}
+
+func (m *mockQuerier) getHealth(id int) (healthUpdate, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.health[id]
+	return h, ok
+}
+
 // ============================================================================
 // Mock Device Repository
 // ============================================================================
@@ -40,10 +235,17 @@ type mockDeviceRepo struct {
 	device  *models.Device
 	devices []*models.Device
 	err     error
+	created []*models.Device
+	updated *models.Device
+	deleted []int
 }
 
 func (m *mockDeviceRepo) Create(ctx context.Context, model *models.Device) (int, error) {
-	return 0, nil
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.created = append(m.created, model)
+	return len(m.created), nil
 }
 
 func (m *mockDeviceRepo) Get(ctx context.Context, id int) (*models.Device, error) {
@@ -70,10 +272,12 @@ func (m *mockDeviceRepo) GetAll(ctx context.Context) ([]*models.Device, error) {
 }
 
 func (m *mockDeviceRepo) Delete(ctx context.Context, id int) error {
+	m.deleted = append(m.deleted, id)
 	return nil
 }
 
 func (m *mockDeviceRepo) Update(ctx context.Context, model *models.Device, id int) error {
+	m.updated = model
 	return nil
 }
 
@@ -93,6 +297,7 @@ type mockActionRepo struct {
 	action  *models.Action
 	actions []*models.Action
 	err     error
+	deleted []int
 }
 
 func (m *mockActionRepo) Create(ctx context.Context, model *models.Action) (int, error) {
@@ -123,6 +328,7 @@ func (m *mockActionRepo) GetAll(ctx context.Context) ([]*models.Action, error) {
 }
 
 func (m *mockActionRepo) Delete(ctx context.Context, id int) error {
+	m.deleted = append(m.deleted, id)
 	return nil
 }
 
@@ -156,7 +362,15 @@ func (m *mockAutomationRepo) Create(ctx context.Context, model *models.Automatio
 }
 
 func (m *mockAutomationRepo) Get(ctx context.Context, id int) (*models.Automation, error) {
-	return nil, m.err
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, automation := range m.automations {
+		if automation.ID == id {
+			return automation, nil
+		}
+	}
+	return nil, sql.ErrNoRows
 }
 
 func (m *mockAutomationRepo) GetAll(ctx context.Context) ([]*models.Automation, error) {
@@ -189,6 +403,123 @@ func (m *mockAutomationRepo) getUpdated() *models.Automation {
 	return m.updated
 }
 
+// ============================================================================
+// Mock Job Repository
+// ============================================================================
+
+type mockJobRepo struct {
+	jobs map[int]*models.Job
+	err  error
+	mu   sync.Mutex
+}
+
+func (m *mockJobRepo) Create(ctx context.Context, model *models.Job) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	if m.jobs == nil {
+		m.jobs = map[int]*models.Job{}
+	}
+	model.ID = len(m.jobs) + 1
+	job := *model
+	m.jobs[model.ID] = &job
+	return model.ID, nil
+}
+
+func (m *mockJobRepo) Get(ctx context.Context, id int) (*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *job
+	return &c, nil
+}
+
+func (m *mockJobRepo) GetAll(ctx context.Context) ([]*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]*models.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		c := *job
+		jobs = append(jobs, &c)
+	}
+	return jobs, m.err
+}
+
+func (m *mockJobRepo) Delete(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockJobRepo) Update(ctx context.Context, model *models.Job, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := *model
+	m.jobs[id] = &job
+	return m.err
+}
+
+func (m *mockJobRepo) GetTable() string {
+	return "jobs"
+}
+
+func (m *mockJobRepo) GetDB() *sql.DB {
+	return nil
+}
+
+func (m *mockJobRepo) getJob(id int) *models.Job {
+	job, _ := m.Get(context.Background(), id)
+	return job
+}
+
+// ============================================================================
+// Mock Group Repository
+// ============================================================================
+
+type mockGroupRepo struct {
+	groups  []*models.Group
+	updated []*models.Group
+	deleted []int
+}
+
+func (m *mockGroupRepo) Create(ctx context.Context, model *models.Group) (int, error) {
+	return 0, nil
+}
+
+func (m *mockGroupRepo) Get(ctx context.Context, id int) (*models.Group, error) {
+	for _, group := range m.groups {
+		if group.ID == id {
+			return group, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockGroupRepo) GetAll(ctx context.Context) ([]*models.Group, error) {
+	return m.groups, nil
+}
+
+func (m *mockGroupRepo) Delete(ctx context.Context, id int) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *mockGroupRepo) Update(ctx context.Context, model *models.Group, id int) error {
+	m.updated = append(m.updated, model)
+	return nil
+}
+
+func (m *mockGroupRepo) GetTable() string {
+	return "groups"
+}
+
+func (m *mockGroupRepo) GetDB() *sql.DB {
+	return nil
+}
+
 // ============================================================================
 // Recording Server (for verification)
 // ============================================================================
@@ -220,7 +551,7 @@ func createRecordingServer(response string, statusCode int) *recordingServer {
 
 		w.WriteHeader(statusCode)
 		if rs.response != "" {
-			w.Write([]byte(rs.response)) // nolint
+			w.Write(echoRequestID(rs.response, req.ID)) // nolint
 		}
 	}))
 
@@ -240,3 +571,19 @@ func (rs *recordingServer) getRequests() []JSONRPCRequest {
 	copy(result, rs.requests)
 	return result
 }
+
+// echoRequestID sets the response "id" to the request ID, as a real device would.
+func echoRequestID(response string, id int) []byte {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(response), &m); err != nil {
+		return []byte(response)
+	}
+	if _, ok := m["id"]; ok {
+		m["id"] = id
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return []byte(response)
+	}
+	return data
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// MQTTClient is the subset of an MQTT client used by MQTTTransport.
+type MQTTClient interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+}
+
+// MQTTTransport publishes JSON-RPC requests to <prefix>/<device>/rpc and waits for
+// the reply with the same request ID on <prefix>/<device>/rpc/response. How long it
+// waits is up to the deadline of the call's context.
+type MQTTTransport struct {
+	client      MQTTClient
+	topicPrefix string
+	mu          sync.Mutex
+	pending     map[string]chan *JSONRPCResponse
+}
+
+func NewMQTTTransport(client MQTTClient, topicPrefix string) (*MQTTTransport, error) {
+	t := &MQTTTransport{
+		client:      client,
+		topicPrefix: topicPrefix,
+		pending:     make(map[string]chan *JSONRPCResponse),
+	}
+
+	if err := client.Subscribe(topicPrefix+"/+/rpc/response", t.handleResponse); err != nil {
+		return nil, fmt.Errorf("subscribing to response topic: %w", err)
+	}
+
+	return t, nil
+}
+
+func (t *MQTTTransport) Call(ctx context.Context, device *models.Device, req *JSONRPCRequest) (*JSONRPCResponse, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling JSON-RPC request: %w", err)
+	}
+
+	key := pendingKey(device.Name, req.ID)
+	ch := make(chan *JSONRPCResponse, 1)
+	t.mu.Lock()
+	t.pending[key] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, key)
+		t.mu.Unlock()
+	}()
+
+	if err := t.client.Publish(ctx, fmt.Sprintf("%s/%s/rpc", t.topicPrefix, device.Name), payload); err != nil {
+		return nil, fmt.Errorf("publishing to device: %w", err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for device response: %w", ctx.Err())
+	}
+}
+
+func (t *MQTTTransport) handleResponse(topic string, payload []byte) {
+	deviceName := strings.TrimSuffix(strings.TrimPrefix(topic, t.topicPrefix+"/"), "/rpc/response")
+
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	ch, ok := t.pending[pendingKey(deviceName, resp.ID)]
+	t.mu.Unlock()
+	if !ok {
+		// Late reply to a call that already timed out, or a reply meant for someone else.
+		return
+	}
+
+	select {
+	case ch <- &resp:
+	default:
+	}
+}
+
+func pendingKey(deviceName string, id int) string {
+	return fmt.Sprintf("%s#%d", deviceName, id)
+}
+
+// pahoClient adapts a paho MQTT client to MQTTClient. Subscriptions are
+// re-established whenever the client reconnects to the broker.
+type pahoClient struct {
+	client    mqtt.Client
+	mu        sync.Mutex
+	subs      map[string]mqtt.MessageHandler
+	connected bool
+}
+
+// NewPahoMQTTClient connects to the given broker (e.g. tcp://192.168.1.2:1883).
+func NewPahoMQTTClient(broker, clientID, username, password string) (MQTTClient, error) {
+	c := &pahoClient{subs: make(map[string]mqtt.MessageHandler)}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(c.resubscribe)
+
+	c.client = mqtt.NewClient(opts)
+	token := c.client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, fmt.Errorf("timed out connecting to MQTT broker %s", broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("connecting to MQTT broker %s: %w", broker, err)
+	}
+
+	return c, nil
+}
+
+func (c *pahoClient) Publish(ctx context.Context, topic string, payload []byte) error {
+	token := c.client.Publish(topic, 1, false, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *pahoClient) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	h := func(_ mqtt.Client, m mqtt.Message) { handler(m.Topic(), m.Payload()) }
+
+	c.mu.Lock()
+	c.subs[topic] = h
+	c.mu.Unlock()
+
+	token := c.client.Subscribe(topic, 1, h)
+	token.Wait()
+	return token.Error()
+}
+
+// resubscribe runs on every connection. The first one has nothing to restore, since
+// Subscribe is only called once NewPahoMQTTClient has connected.
+func (c *pahoClient) resubscribe(client mqtt.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		c.connected = true
+		return
+	}
+	for topic, h := range c.subs {
+		client.Subscribe(topic, 1, h)
+	}
+}
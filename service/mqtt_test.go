@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+const testMQTTClientID = "gniotek-test"
+
+// testBroker is an in-process MQTT broker listening on a local port. Its inline client
+// plays the devices, and it records the QoS the server publishes and subscribes with.
+type testBroker struct {
+	mochi.HookBase
+	server  *mochi.Server
+	addr    string
+	subID   atomic.Int32
+	mu      sync.Mutex
+	publish map[string]byte
+	subs    map[string][]byte
+}
+
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	b := &testBroker{publish: make(map[string]byte), subs: make(map[string][]byte)}
+	b.server = mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, b.server.AddHook(new(auth.AllowHook), nil))
+	require.NoError(t, b.server.AddHook(b, nil))
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	require.NoError(t, b.server.AddListener(tcp))
+	require.NoError(t, b.server.Serve())
+	t.Cleanup(func() { b.server.Close() }) // nolint
+	b.addr = tcp.Address()
+	return b
+}
+
+func (b *testBroker) ID() string { return "recorder" }
+
+func (b *testBroker) Provides(hook byte) bool {
+	return hook == mochi.OnPublish || hook == mochi.OnSubscribe
+}
+
+func (b *testBroker) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.ID == testMQTTClientID {
+		b.mu.Lock()
+		b.publish[pk.TopicName] = pk.FixedHeader.Qos
+		b.mu.Unlock()
+	}
+	return pk, nil
+}
+
+func (b *testBroker) OnSubscribe(cl *mochi.Client, pk packets.Packet) packets.Packet {
+	if cl.ID == testMQTTClientID {
+		b.mu.Lock()
+		for _, sub := range pk.Filters {
+			b.subs[sub.Filter] = append(b.subs[sub.Filter], sub.Qos)
+		}
+		b.mu.Unlock()
+	}
+	return pk
+}
+
+func (b *testBroker) publishQoS(topic string) (byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	qos, ok := b.publish[topic]
+	return qos, ok
+}
+
+func (b *testBroker) subscriptions(filter string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.subs[filter]...)
+}
+
+// connect returns a paho client connected to the broker, as the server would use it.
+func (b *testBroker) connect(t *testing.T) MQTTClient {
+	t.Helper()
+	client, err := NewPahoMQTTClient("tcp://"+b.addr, testMQTTClientID, "", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { client.(*pahoClient).client.Disconnect(0) })
+	return client
+}
+
+// startDevice simulates a device that answers every request on its command topic.
+func (b *testBroker) startDevice(t *testing.T, name string, reply func(req JSONRPCRequest) *JSONRPCResponse) {
+	t.Helper()
+	err := b.server.Subscribe("gniotek/"+name+"/rpc", int(b.subID.Add(1)), func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		var req JSONRPCRequest
+		if err := json.Unmarshal(pk.Payload, &req); err != nil {
+			return
+		}
+		resp := reply(req)
+		if resp == nil {
+			return
+		}
+		data, _ := json.Marshal(resp)
+		go b.server.Publish("gniotek/"+name+"/rpc/response", data, false, 1) // nolint
+	})
+	require.NoError(t, err)
+}
+
+func TestMQTTTransport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("request is published and correlated reply returned", func(t *testing.T) {
+		broker := startTestBroker(t)
+		var received JSONRPCRequest
+		broker.startDevice(t, "sensor1", func(req JSONRPCRequest) *JSONRPCResponse {
+			received = req
+			return &JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"temperature":21.5}`), ID: req.ID}
+		})
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		resp, err := transport.Call(ctx, &models.Device{Name: "sensor1"}, &JSONRPCRequest{JSONRPC: "2.0", Method: "read_temp", Params: map[string]any{"unit": "c"}})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"temperature":21.5}`, string(resp.Result))
+		assert.Equal(t, "read_temp", received.Method)
+		assert.Equal(t, map[string]any{"unit": "c"}, received.Params)
+	})
+
+	t.Run("requests and subscriptions use QoS 1", func(t *testing.T) {
+		broker := startTestBroker(t)
+		broker.startDevice(t, "sensor1", func(req JSONRPCRequest) *JSONRPCResponse {
+			return &JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: req.ID}
+		})
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		_, err = transport.Call(ctx, &models.Device{Name: "sensor1"}, &JSONRPCRequest{JSONRPC: "2.0", Method: "read_temp"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []byte{1}, broker.subscriptions("gniotek/+/rpc/response"))
+		qos, ok := broker.publishQoS("gniotek/sensor1/rpc")
+		require.True(t, ok)
+		assert.Equal(t, byte(1), qos)
+	})
+
+	t.Run("subscription is restored after reconnecting", func(t *testing.T) {
+		broker := startTestBroker(t)
+		broker.startDevice(t, "sensor1", func(req JSONRPCRequest) *JSONRPCResponse {
+			return &JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"temperature":21.5}`), ID: req.ID}
+		})
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		cl, ok := broker.server.Clients.Get(testMQTTClientID)
+		require.True(t, ok)
+		cl.Stop(errors.New("dropped by test"))
+
+		// The clean session drops the subscription, so a reply only arrives once the
+		// client has subscribed again
+		require.Eventually(t, func() bool {
+			return len(broker.subscriptions("gniotek/+/rpc/response")) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		resp, err := transport.Call(ctx, &models.Device{Name: "sensor1"}, &JSONRPCRequest{JSONRPC: "2.0", Method: "read_temp", ID: 1})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"temperature":21.5}`, string(resp.Result))
+	})
+
+	t.Run("replies with other request IDs are ignored", func(t *testing.T) {
+		broker := startTestBroker(t)
+		broker.startDevice(t, "sensor1", func(req JSONRPCRequest) *JSONRPCResponse {
+			return &JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: req.ID + 100}
+		})
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		callCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = transport.Call(callCtx, &models.Device{Name: "sensor1"}, &JSONRPCRequest{JSONRPC: "2.0", Method: "read_temp"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("sleeping device times out", func(t *testing.T) {
+		broker := startTestBroker(t)
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		callCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = transport.Call(callCtx, &models.Device{Name: "sleepy"}, &JSONRPCRequest{JSONRPC: "2.0", Method: "read_temp"})
+		assert.EqualError(t, err, "waiting for device response: context deadline exceeded")
+	})
+
+	t.Run("concurrent calls to different devices are not mixed up", func(t *testing.T) {
+		broker := startTestBroker(t)
+		for _, name := range []string{"a", "b"} {
+			broker.startDevice(t, name, func(req JSONRPCRequest) *JSONRPCResponse {
+				result, _ := json.Marshal(map[string]string{"device": name})
+				return &JSONRPCResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+			})
+		}
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			for _, name := range []string{"a", "b"} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := transport.Call(ctx, &models.Device{Name: name}, &JSONRPCRequest{JSONRPC: "2.0", Method: "whoami", ID: i + 1})
+					if assert.NoError(t, err) {
+						assert.JSONEq(t, `{"device":"`+name+`"}`, string(resp.Result))
+					}
+				}()
+			}
+		}
+		wg.Wait()
+	})
+
+	t.Run("executes actions through service", func(t *testing.T) {
+		broker := startTestBroker(t)
+		broker.startDevice(t, "valve", func(req JSONRPCRequest) *JSONRPCResponse {
+			return &JSONRPCResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: -32601, Message: "Method not found"}, ID: req.ID}
+		})
+
+		transport, err := NewMQTTTransport(broker.connect(t), "gniotek")
+		require.NoError(t, err)
+
+		svc := NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, Name: "valve", Transport: models.TransportMQTT}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "open"}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Transports:   map[string]Transport{models.TransportMQTT: transport},
+		})
+
+		_, err = svc.Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "JSON-RPC error -32601: Method not found")
+	})
+}
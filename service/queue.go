@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type QueueConfig struct {
+	// MaxDepth is the number of commands that may wait for a busy device. Defaults to 16.
+	MaxDepth int
+	// WaitTimeout limits how long a command waits for its turn. Defaults to 30s.
+	WaitTimeout time.Duration
+	// IdleTTL is how long the queue of an idle device is kept before it and its
+	// metrics are dropped. Defaults to 10m.
+	IdleTTL time.Duration
+}
+
+const (
+	defaultQueueDepth       = 16
+	defaultQueueWaitTimeout = 30 * time.Second
+	defaultQueueIdleTTL     = 10 * time.Minute
+)
+
+// Priority orders commands waiting for the same device. Lower values run first;
+// commands of equal priority run in arrival order.
+type Priority int
+
+const (
+	PriorityManual Priority = iota
+	PriorityAutomation
+	PriorityHealth
+	priorityLevels
+)
+
+var (
+	ErrDeviceQueueFull  = errors.New("device command queue is full")
+	ErrQueueWaitTimeout = errors.New("timed out waiting for device command queue")
+)
+
+// QueueStatus reports the command queue of a device. Executed counts commands that
+// got their turn, Rejected those refused by a full queue and TimedOut those that gave
+// up waiting.
+type QueueStatus struct {
+	DeviceID  int   `json:"device_id"`
+	Busy      bool  `json:"busy"`
+	Depth     int   `json:"depth"`
+	Executed  int64 `json:"executed"`
+	Rejected  int64 `json:"rejected"`
+	TimedOut  int64 `json:"timed_out"`
+	MaxWaitMs int64 `json:"max_wait_ms"`
+	AvgWaitMs int64 `json:"avg_wait_ms"`
+}
+
+// deviceQueue serialises the commands sent to one device.
+type deviceQueue struct {
+	busy      bool
+	waiters   [priorityLevels][]chan struct{}
+	idleSince time.Time
+	executed  int64
+	rejected  int64
+	timedOut  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+func (q *deviceQueue) depth() int {
+	n := 0
+	for _, w := range q.waiters {
+		n += len(w)
+	}
+	return n
+}
+
+// commandQueues holds the queues of all devices. A single lock guards every queue, so
+// idle queues can be dropped without racing a command that is about to use them.
+type commandQueues struct {
+	mu        sync.Mutex
+	queues    map[int]*deviceQueue
+	lastSweep time.Time
+}
+
+// acquireDevice waits until the device is free and returns a function that hands it
+// to the next command. Commands are rejected when the queue is full, and give up
+// after the wait timeout or when the context is done.
+func (s *Service) acquireDevice(ctx context.Context, deviceId int, priority Priority) (func(), error) {
+	cq := &s.queues
+	start := time.Now()
+
+	cq.mu.Lock()
+	s.sweepIdleQueues(start)
+	q, ok := cq.queues[deviceId]
+	if !ok {
+		if cq.queues == nil {
+			cq.queues = make(map[int]*deviceQueue)
+		}
+		q = &deviceQueue{}
+		cq.queues[deviceId] = q
+	}
+
+	if !q.busy {
+		q.busy = true
+		q.executed++
+		cq.mu.Unlock()
+		return func() { s.releaseDevice(q) }, nil
+	}
+
+	if q.depth() >= s.queueDepth() {
+		q.rejected++
+		cq.mu.Unlock()
+		return nil, ErrDeviceQueueFull
+	}
+
+	ready := make(chan struct{})
+	q.waiters[priority] = append(q.waiters[priority], ready)
+	cq.mu.Unlock()
+
+	timer := time.NewTimer(s.queueWaitTimeout())
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+	case <-timer.C:
+		err = ErrQueueWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	if err != nil {
+		if i := slices.Index(q.waiters[priority], ready); i >= 0 {
+			q.waiters[priority] = append(q.waiters[priority][:i], q.waiters[priority][i+1:]...)
+			q.timedOut++
+			return nil, err
+		}
+		// The device was handed over while giving up; take the turn rather than
+		// stall the queue.
+	}
+
+	wait := time.Since(start)
+	q.executed++
+	q.totalWait += wait
+	q.maxWait = max(q.maxWait, wait)
+	return func() { s.releaseDevice(q) }, nil
+}
+
+// releaseDevice hands the device to the next waiting command, highest priority first.
+func (s *Service) releaseDevice(q *deviceQueue) {
+	s.queues.mu.Lock()
+	defer s.queues.mu.Unlock()
+
+	for p := range q.waiters {
+		if len(q.waiters[p]) > 0 {
+			next := q.waiters[p][0]
+			q.waiters[p] = q.waiters[p][1:]
+			close(next)
+			return
+		}
+	}
+
+	q.busy = false
+	q.idleSince = time.Now()
+}
+
+// sweepIdleQueues drops queues that have been idle longer than the idle TTL. It is
+// called with the queues lock held and does the work at most once per TTL.
+func (s *Service) sweepIdleQueues(now time.Time) {
+	cq := &s.queues
+	ttl := s.queueIdleTTL()
+	if now.Sub(cq.lastSweep) < ttl {
+		return
+	}
+	cq.lastSweep = now
+
+	for id, q := range cq.queues {
+		if !q.busy && now.Sub(q.idleSince) >= ttl {
+			delete(cq.queues, id)
+		}
+	}
+}
+
+// QueueStatus returns the command queue of a device. Devices without a queue report
+// an empty one.
+func (s *Service) QueueStatus(deviceId int) QueueStatus {
+	s.queues.mu.Lock()
+	defer s.queues.mu.Unlock()
+
+	q, ok := s.queues.queues[deviceId]
+	if !ok {
+		return QueueStatus{DeviceID: deviceId}
+	}
+	return q.status(deviceId)
+}
+
+// QueueStatuses returns the command queues of all devices that used one recently,
+// ordered by device ID.
+func (s *Service) QueueStatuses() []QueueStatus {
+	s.queues.mu.Lock()
+	defer s.queues.mu.Unlock()
+
+	statuses := make([]QueueStatus, 0, len(s.queues.queues))
+	for id, q := range s.queues.queues {
+		statuses = append(statuses, q.status(id))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].DeviceID < statuses[j].DeviceID })
+	return statuses
+}
+
+func (q *deviceQueue) status(deviceId int) QueueStatus {
+	st := QueueStatus{
+		DeviceID:  deviceId,
+		Busy:      q.busy,
+		Depth:     q.depth(),
+		Executed:  q.executed,
+		Rejected:  q.rejected,
+		TimedOut:  q.timedOut,
+		MaxWaitMs: q.maxWait.Milliseconds(),
+	}
+	if q.executed > 0 {
+		st.AvgWaitMs = q.totalWait.Milliseconds() / q.executed
+	}
+	return st
+}
+
+func (s *Service) queueDepth() int {
+	if s.queueCfg.MaxDepth > 0 {
+		return s.queueCfg.MaxDepth
+	}
+	return defaultQueueDepth
+}
+
+func (s *Service) queueWaitTimeout() time.Duration {
+	if s.queueCfg.WaitTimeout > 0 {
+		return s.queueCfg.WaitTimeout
+	}
+	return defaultQueueWaitTimeout
+}
+
+func (s *Service) queueIdleTTL() time.Duration {
+	if s.queueCfg.IdleTTL > 0 {
+		return s.queueCfg.IdleTTL
+	}
+	return defaultQueueIdleTTL
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForDepth blocks until the device queue holds the given number of waiting commands.
+func waitForDepth(t *testing.T, svc *Service, deviceId, depth int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return svc.QueueStatus(deviceId).Depth == depth }, time.Second, time.Millisecond)
+}
+
+func TestDeviceQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("manual commands run before automations and health checks", func(t *testing.T) {
+		svc := NewService(ServiceConfig{})
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+
+		var mu sync.Mutex
+		var order []string
+		var wg sync.WaitGroup
+		enqueue := func(name string, priority Priority) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := svc.acquireDevice(ctx, 1, priority)
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				release()
+			}()
+		}
+
+		enqueue("health", PriorityHealth)
+		waitForDepth(t, svc, 1, 1)
+		enqueue("automation-1", PriorityAutomation)
+		waitForDepth(t, svc, 1, 2)
+		enqueue("automation-2", PriorityAutomation)
+		waitForDepth(t, svc, 1, 3)
+		enqueue("manual", PriorityManual)
+		waitForDepth(t, svc, 1, 4)
+
+		release()
+		wg.Wait()
+
+		assert.Equal(t, []string{"manual", "automation-1", "automation-2", "health"}, order)
+		st := svc.QueueStatus(1)
+		assert.False(t, st.Busy)
+		assert.Zero(t, st.Depth)
+		assert.EqualValues(t, 5, st.Executed)
+	})
+
+	t.Run("full queue rejects commands", func(t *testing.T) {
+		svc := NewService(ServiceConfig{Queue: QueueConfig{MaxDepth: 1}})
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		defer release()
+
+		go svc.acquireDevice(ctx, 1, PriorityAutomation) // nolint
+		waitForDepth(t, svc, 1, 1)
+
+		_, err = svc.acquireDevice(ctx, 1, PriorityManual)
+		assert.ErrorIs(t, err, ErrDeviceQueueFull)
+		assert.EqualValues(t, 1, svc.QueueStatus(1).Rejected)
+	})
+
+	t.Run("waiting commands time out", func(t *testing.T) {
+		svc := NewService(ServiceConfig{Queue: QueueConfig{WaitTimeout: 20 * time.Millisecond}})
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+
+		_, err = svc.acquireDevice(ctx, 1, PriorityManual)
+		assert.ErrorIs(t, err, ErrQueueWaitTimeout)
+
+		st := svc.QueueStatus(1)
+		assert.Zero(t, st.Depth)
+		assert.EqualValues(t, 1, st.TimedOut)
+
+		// The device is free again once the holder releases it
+		release()
+		release, err = svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("cancelled context stops waiting", func(t *testing.T) {
+		svc := NewService(ServiceConfig{})
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		defer release()
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err = svc.acquireDevice(cancelCtx, 1, PriorityManual)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("devices queue independently", func(t *testing.T) {
+		svc := NewService(ServiceConfig{Queue: QueueConfig{WaitTimeout: 20 * time.Millisecond}})
+		release1, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		defer release1()
+
+		release2, err := svc.acquireDevice(ctx, 2, PriorityManual)
+		require.NoError(t, err)
+		release2()
+
+		statuses := svc.QueueStatuses()
+		require.Len(t, statuses, 2)
+		assert.Equal(t, 1, statuses[0].DeviceID)
+		assert.True(t, statuses[0].Busy)
+		assert.Equal(t, 2, statuses[1].DeviceID)
+		assert.False(t, statuses[1].Busy)
+	})
+
+	t.Run("idle queues are dropped", func(t *testing.T) {
+		svc := NewService(ServiceConfig{Queue: QueueConfig{IdleTTL: 10 * time.Millisecond}})
+		release, err := svc.acquireDevice(ctx, 1, PriorityManual)
+		require.NoError(t, err)
+		release()
+		busy, err := svc.acquireDevice(ctx, 2, PriorityManual)
+		require.NoError(t, err)
+		defer busy()
+
+		time.Sleep(20 * time.Millisecond)
+		release, err = svc.acquireDevice(ctx, 3, PriorityManual)
+		require.NoError(t, err)
+		release()
+
+		statuses := svc.QueueStatuses()
+		require.Len(t, statuses, 2)
+		assert.Equal(t, 2, statuses[0].DeviceID)
+		assert.Equal(t, 3, statuses[1].DeviceID)
+	})
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts per call, including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// permanentError marks failures that retrying cannot fix, such as a rejected
+// device address. They are neither retried nor counted by the circuit breaker.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// backoff returns the delay before the given retry (1-based): exponential
+// growth capped at MaxDelay, with the upper half randomised to spread retries.
+func (c RetryConfig) backoff(retry int) time.Duration {
+	delay := c.BaseDelay << (retry - 1)
+	if delay <= 0 || (c.MaxDelay > 0 && delay > c.MaxDelay) {
+		delay = c.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// withRetry runs call until it succeeds, fails permanently, or runs out of attempts.
+// Once ctx is done it returns ctx.Err() rather than the error of the last attempt.
+func withRetry[T any](ctx context.Context, s *Service, retry bool, call func() (T, error)) (T, error) {
+	attempts := 1
+	if retry && s.retryCfg.MaxAttempts > 1 {
+		attempts = s.retryCfg.MaxAttempts
+	}
+
+	var (
+		resp T
+		err  error
+	)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(s.retryCfg.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return resp, ctx.Err()
+			case <-timer.C:
+			}
+			s.logger.Warn("retrying device call", "attempt", attempt, "previous error", err)
+		}
+
+		resp, err = call()
+		if err == nil || isPermanent(err) {
+			return resp, err
+		}
+		if ctx.Err() != nil {
+			return resp, ctx.Err()
+		}
+	}
+
+	return resp, err
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	cfg := RetryConfig{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{retry: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{retry: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{retry: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{retry: 5, min: 500 * time.Millisecond, max: time.Second},
+		{retry: 40, min: 500 * time.Millisecond, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			d := cfg.backoff(tt.retry)
+			assert.GreaterOrEqual(t, d, tt.min, "retry %d", tt.retry)
+			assert.LessOrEqual(t, d, tt.max, "retry %d", tt.retry)
+		}
+	}
+}
+
+func TestExecute_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	// flakyServer fails the first `failures` calls with 502 and then succeeds
+	flakyServer := func(failures int32) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			var req JSONRPCRequest
+			json.NewDecoder(r.Body).Decode(&req) // nolint
+
+			w.Write(echoRequestID(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, req.ID)) // nolint
+		}))
+		return srv, &calls
+	}
+
+	newSvc := func(ip string, idempotent bool) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, IP: ip}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "read", Idempotent: idempotent}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Retry:        RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+		})
+	}
+
+	t.Run("idempotent action recovers after transient failures", func(t *testing.T) {
+		srv, calls := flakyServer(2)
+		defer srv.Close()
+
+		_, err := newSvc(srv.Listener.Addr().String(), true).Execute(ctx, 1, 1, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("idempotent action gives up after max attempts", func(t *testing.T) {
+		srv, calls := flakyServer(5)
+		defer srv.Close()
+
+		_, err := newSvc(srv.Listener.Addr().String(), true).Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "device returned status 502")
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("non-idempotent action is not retried", func(t *testing.T) {
+		srv, calls := flakyServer(1)
+		defer srv.Close()
+
+		_, err := newSvc(srv.Listener.Addr().String(), false).Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "device returned status 502")
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		_, err := newSvc("8.8.8.8:80", true).Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "device IP must be in private range")
+	})
+}
+
+func TestWithRetry_ContextCancelled(t *testing.T) {
+	svc := NewService(ServiceConfig{Retry: RetryConfig{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	_, err := withRetry(ctx, svc, true, func() (*JSONRPCResponse, error) {
+		calls++
+		cancel()
+		return nil, errors.New("unreachable")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
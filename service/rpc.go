@@ -1,12 +1,13 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
 )
 
 // JSONRPCRequest represents a JSON-RPC 2.0 request
@@ -25,60 +26,89 @@ type JSONRPCResponse struct {
 	ID      int             `json:"id"`
 }
 
+// Standard JSON-RPC 2.0 error codes for requests the device couldn't parse.
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+)
+
 type JSONRPCError struct {
 	Code    int             `json:"code"`
 	Data    json.RawMessage `json:"data,omitempty"`
 	Message string          `json:"message"`
 }
 
-func (s *Service) callJSONRPC(ctx context.Context, ip, method, params string) (*JSONRPCResponse, error) {
-	var paramsObj interface{}
-	if params != "" {
-		if err := json.Unmarshal([]byte(params), &paramsObj); err != nil {
-			return nil, fmt.Errorf("parsing action params: %w", err)
-		}
+func (s *Service) callJSONRPC(ctx context.Context, device *models.Device, action *models.Action, values map[string]any) (*JSONRPCResponse, error) {
+	paramsObj, err := action.RenderParams(values)
+	if err != nil {
+		return nil, err
 	}
 
-	data := JSONRPCRequest{
-		JSONRPC: "2.0",
-		Method:  method,
-		Params:  paramsObj,
-		ID:      1,
+	transport, err := s.getTransport(device)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := json.Marshal(data)
-	if err != nil {
-		return nil, fmt.Errorf("marshaling JSON-RPC request: %w", err)
+	breaker := s.getBreaker(device.ID)
+	if err := breaker.allow(); err != nil {
+		return nil, err
 	}
 
-	url := fmt.Sprintf("http://%s/rpc", ip)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	timeout := s.callTimeout(device, action)
+	response, err := withRetry(ctx, s, action.Idempotent, func() (*JSONRPCResponse, error) {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		req := &JSONRPCRequest{
+			JSONRPC: "2.0",
+			Method:  action.Path,
+			Params:  paramsObj,
+			ID:      int(s.requestID.Add(1)),
+		}
+		return s.exchange(callCtx, transport, device, req)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("constructing HTTP call: %w", err)
+		breaker.done(ctx, err)
+		return nil, err
 	}
+	breaker.success()
 
-	req.Header.Add("Content-Type", "application/json")
+	if response.Error != nil {
+		return response, fmt.Errorf("JSON-RPC error %d: %s", response.Error.Code, response.Error.Message)
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("calling device: %w", err)
+	if err := s.validateResult(device, action, response); err != nil {
+		return response, err
 	}
-	defer resp.Body.Close() // nolint
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("device returned status %d", resp.StatusCode)
+	return response, nil
+}
+
+// ErrMalformedResponse is returned when a device result does not match the action's result schema.
+var ErrMalformedResponse = errors.New("malformed device response")
+
+func (s *Service) validateResult(device *models.Device, action *models.Action, response *JSONRPCResponse) error {
+	if err := action.ValidateResult(response.Result); err != nil {
+		s.logger.Warn("device response does not match result schema", "device", device.Name, "method", action.Path, "rpc_id", response.ID, "error", err)
+		return fmt.Errorf("%w: %w", ErrMalformedResponse, err)
 	}
+	return nil
+}
 
-	var response *JSONRPCResponse
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+// exchange performs a single request/response round trip and checks that the
+// response belongs to the request. Every exchange is logged with its request ID.
+func (s *Service) exchange(ctx context.Context, transport Transport, device *models.Device, req *JSONRPCRequest) (*JSONRPCResponse, error) {
+	start := time.Now()
+	response, err := transport.Call(ctx, device, req)
+	if err == nil && response.ID != req.ID && !(response.ID == 0 && response.Error != nil) {
+		err = fmt.Errorf("response ID %d does not match request ID %d", response.ID, req.ID)
 	}
 
-	if response.Error != nil {
-		return response, fmt.Errorf("JSON-RPC error %d: %s", response.Error.Code, response.Error.Message)
+	if err != nil {
+		s.logger.Warn("device call failed", "device", device.Name, "method", req.Method, "rpc_id", req.ID, "duration", time.Since(start), "error", err)
+		return nil, err
 	}
 
+	s.logger.Info("device call completed", "device", device.Name, "method", req.Method, "rpc_id", req.ID, "duration", time.Since(start))
 	return response, nil
 }
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestCallJSONRPC_RequestIDs(t *testing.T) {
+	ctx := context.Background()
+
+	newSvc := func(ip string) *Service {
+		return NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, IP: ip}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "read"}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+		})
+	}
+
+	t.Run("each call gets a new ID echoed back in the response", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{},"id":1}`, http.StatusOK)
+		defer server.Close()
+		svc := newSvc(server.Listener.Addr().String())
+
+		var responseIDs []int
+		for range 3 {
+			resp, err := svc.Execute(ctx, 1, 1, nil)
+			require.NoError(t, err)
+			responseIDs = append(responseIDs, resp.ID)
+		}
+
+		reqs := server.getRequests()
+		require.Len(t, reqs, 3)
+		assert.Less(t, reqs[0].ID, reqs[1].ID)
+		assert.Less(t, reqs[1].ID, reqs[2].ID)
+		assert.Equal(t, []int{reqs[0].ID, reqs[1].ID, reqs[2].ID}, responseIDs)
+	})
+
+	t.Run("mismatched response ID is rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":12345}`)) // nolint
+		}))
+		defer server.Close()
+
+		_, err := newSvc(server.Listener.Addr().String()).Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "response ID 12345 does not match request ID 1")
+	})
+
+	t.Run("error response without ID is accepted", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`)) // nolint
+		}))
+		defer server.Close()
+
+		_, err := newSvc(server.Listener.Addr().String()).Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "JSON-RPC error -32700: Parse error")
+	})
+}
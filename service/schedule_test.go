@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/solar"
+)
+
+func TestProcessAutomations_Schedule(t *testing.T) {
+	ctx := context.Background()
+
+	// dailyAt returns a daily schedule whose last fire time was ago
+	dailyAt := func(ago time.Duration) string {
+		at := time.Now().UTC().Add(-ago)
+		return fmt.Sprintf("%d %d %d * * *", at.Second(), at.Minute(), at.Hour())
+	}
+
+	tests := []struct {
+		name            string
+		schedule        models.Schedules
+		lastTriggersRun string
+		wantRun         bool
+		wantSkip        bool
+	}{
+		{
+			name:            "fire time passed since last run",
+			schedule:        models.Schedules{"* * * * *"},
+			lastTriggersRun: createPastTimestamp(2 * time.Minute),
+			wantRun:         true,
+		},
+		{
+			name:            "next fire time still ahead",
+			schedule:        models.Schedules{"0 0 0 1 1 *"},
+			lastTriggersRun: createPastTimestamp(time.Minute),
+			wantRun:         false,
+		},
+		{
+			name:            "missed fire times run once",
+			schedule:        models.Schedules{dailyAt(2 * time.Minute), dailyAt(12 * time.Hour)},
+			lastTriggersRun: createPastTimestamp(72 * time.Hour),
+			wantRun:         true,
+		},
+		{
+			name:            "fire time missed by more than the grace period is skipped",
+			schedule:        models.Schedules{dailyAt(time.Hour)},
+			lastTriggersRun: createPastTimestamp(72 * time.Hour),
+			wantRun:         false,
+			wantSkip:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+			defer server.Close()
+
+			yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+				Schedule: tt.schedule,
+				Timezone: "UTC",
+				Actions:  []models.AutomationAction{{Device: "valve", Action: "water"}},
+			})
+			require.NoError(t, err)
+
+			automationRepo := &mockAutomationRepo{automations: []*models.Automation{{
+				ID:              1,
+				Name:            "watering",
+				Enabled:         true,
+				Definition:      yamlDef,
+				LastTriggersRun: tt.lastTriggersRun,
+			}}}
+			svc := createTestServiceForAutomation(
+				&mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "valve", IP: server.Listener.Addr().String()}}},
+				map[int][]int{1: {1}},
+				&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "water", Path: "water"}}},
+				automationRepo,
+				nil,
+			)
+
+			require.NoError(t, svc.processAutomations(ctx))
+			switch {
+			case tt.wantRun:
+				assert.Equal(t, 1, server.getCallCount())
+				assert.NotEqual(t, tt.lastTriggersRun, automationRepo.automations[0].LastTriggersRun)
+			case tt.wantSkip:
+				// The fire time is recorded as handled, so the next check waits for the next one
+				assert.Zero(t, server.getCallCount())
+				assert.NotEqual(t, tt.lastTriggersRun, automationRepo.automations[0].LastTriggersRun)
+				require.NoError(t, svc.processAutomations(ctx))
+				assert.Zero(t, server.getCallCount())
+			default:
+				assert.Zero(t, server.getCallCount())
+				assert.Equal(t, tt.lastTriggersRun, automationRepo.automations[0].LastTriggersRun)
+			}
+		})
+	}
+}
+
+func TestUntilNextCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 5, 4, 6, 29, 30, 0, time.UTC)
+
+	automation := func(enabled bool, definition string) *models.Automation {
+		return &models.Automation{Enabled: enabled, Definition: definition}
+	}
+
+	tests := []struct {
+		name        string
+		automations []*models.Automation
+		want        time.Duration
+	}{
+		{
+			name:        "no schedules waits the interval",
+			automations: []*models.Automation{automation(true, "interval: 5m\n")},
+			want:        time.Minute,
+		},
+		{
+			name: "earliest fire time within the interval",
+			automations: []*models.Automation{
+				automation(true, "schedule: \"0 0 19 * * *\"\ntimezone: UTC\n"),
+				automation(true, "schedule: \"0 30 6 * * *\"\ntimezone: UTC\n"),
+				automation(false, "schedule: \"45 29 6 * * *\"\ntimezone: UTC\n"),
+			},
+			want: 30 * time.Second,
+		},
+		{
+			name:        "fire time beyond the interval",
+			automations: []*models.Automation{automation(true, "schedule: \"0 0 19 * * *\"\ntimezone: UTC\n")},
+			want:        time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := createTestServiceForAutomation(nil, nil, nil, &mockAutomationRepo{automations: tt.automations}, nil)
+			assert.Equal(t, tt.want, svc.untilNextCheck(ctx, now, time.Minute))
+		})
+	}
+}
+
+func TestProcessAutomations_SunSchedule(t *testing.T) {
+	ctx := context.Background()
+	site, err := solar.NewSite(52.52, 13.405, "Europe/Berlin")
+	require.NoError(t, err)
+
+	newService := func(server *recordingServer, site *solar.Site) (*Service, *mockAutomationRepo) {
+		automationRepo := &mockAutomationRepo{automations: []*models.Automation{{
+			ID:              1,
+			Name:            "grow-lights",
+			Enabled:         true,
+			Definition:      "schedule: sunset-30m\nactions:\n  - device: lamp\n    action: light_on\n",
+			LastTriggersRun: createPastTimestamp(48 * time.Hour),
+		}}}
+		svc := createTestServiceForAutomation(
+			&mockDeviceRepo{devices: []*models.Device{{ID: 1, Name: "lamp", IP: server.Listener.Addr().String()}}},
+			map[int][]int{1: {1}},
+			&mockActionRepo{actions: []*models.Action{{ID: 1, Name: "light_on", Path: "light_on"}}},
+			automationRepo,
+			nil,
+		)
+		svc.site = site
+		// Sunset may have been up to a day ago
+		svc.misfireGrace = 25 * time.Hour
+		return svc, automationRepo
+	}
+
+	t.Run("runs once the sun time passed", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, _ := newService(server, site)
+		require.NoError(t, svc.processAutomations(ctx))
+		assert.Equal(t, 1, server.getCallCount())
+	})
+
+	t.Run("fails without a site", func(t *testing.T) {
+		server := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+		defer server.Close()
+
+		svc, _ := newService(server, nil)
+		assert.Error(t, svc.processAutomations(ctx))
+		assert.Zero(t, server.getCallCount())
+	})
+}
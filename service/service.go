@@ -3,41 +3,128 @@ package service
 import (
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/tender-barbarian/gniotek/cache"
 	"github.com/tender-barbarian/gniotek/repository"
 	"github.com/tender-barbarian/gniotek/repository/models"
+	"github.com/tender-barbarian/gniotek/solar"
 )
 
 type ServiceConfig struct {
 	DevicesRepo     repository.GenericRepo[*models.Device]
 	ActionsRepo     repository.GenericRepo[*models.Action]
 	AutomationsRepo repository.GenericRepo[*models.Automation]
+	JobsRepo        repository.GenericRepo[*models.Job]
+	GroupsRepo      repository.GenericRepo[*models.Group]
 	QueryRepo       repository.Querier
 	DevicesCache    *cache.Cache[*models.Device]
 	ActionsCache    *cache.Cache[*models.Action]
 	Logger          *slog.Logger
+	// Transports registers additional device transports by name. The HTTP
+	// JSON-RPC transport is always available under models.TransportHTTP.
+	Transports map[string]Transport
+	Retry      RetryConfig
+	Breaker    BreakerConfig
+	// CallTimeout limits a single device call unless the device or action sets its
+	// own timeout. Defaults to 10s.
+	CallTimeout time.Duration
+	Health      HealthConfig
+	Discovery   DiscoveryConfig
+	Jobs        JobsConfig
+	Queue       QueueConfig
+	// BulkConcurrency is the number of devices a bulk execution calls at the same
+	// time unless the request sets its own. Defaults to 4.
+	BulkConcurrency int
+	// Site is where the server runs, used for sunrise and sunset. Automations
+	// referring to the sun fail without it.
+	Site *solar.Site
+	// MisfireGrace is how late a scheduled automation may still run after its fire
+	// time, e.g. when the server was down. Later fire times are skipped. Defaults to 5m.
+	MisfireGrace time.Duration
 }
 
 type Service struct {
 	devicesRepo     repository.GenericRepo[*models.Device]
 	actionsRepo     repository.GenericRepo[*models.Action]
 	automationsRepo repository.GenericRepo[*models.Automation]
+	jobsRepo        repository.GenericRepo[*models.Job]
+	groupsRepo      repository.GenericRepo[*models.Group]
 	queryRepo       repository.Querier
 	devicesCache    *cache.Cache[*models.Device]
 	actionsCache    *cache.Cache[*models.Action]
 	logger          *slog.Logger
-	deviceMu        sync.Map
+	transports      map[string]Transport
+	retryCfg        RetryConfig
+	breakerCfg      BreakerConfig
+	defaultTimeout  time.Duration
+	healthCfg       HealthConfig
+	discoveryCfg    DiscoveryConfig
+	jobsCfg         JobsConfig
+	jobQueue        chan int
+	queueCfg        QueueConfig
+	queues          commandQueues
+	bulkConcurrency int
+	site            *solar.Site
+	misfireGrace    time.Duration
+	discovered      discoveryRegistry
+	events          eventBus
+	eventIndex      eventIndex
+	health          sync.Map
+	automationMu    sync.Map
+	breakers        sync.Map
+	noBatch         sync.Map
+	requestID       atomic.Int64
 }
 
 func NewService(cfg ServiceConfig) *Service {
+	transports := map[string]Transport{models.TransportHTTP: newHTTPTransport()}
+	for name, t := range cfg.Transports {
+		transports[name] = t
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	callTimeout := cfg.CallTimeout
+	if callTimeout <= 0 {
+		callTimeout = defaultCallTimeout
+	}
+
+	misfireGrace := cfg.MisfireGrace
+	if misfireGrace <= 0 {
+		misfireGrace = defaultMisfireGrace
+	}
+
+	jobQueueSize := cfg.Jobs.QueueSize
+	if jobQueueSize <= 0 {
+		jobQueueSize = defaultJobQueueSize
+	}
+
 	return &Service{
 		devicesRepo:     cfg.DevicesRepo,
 		actionsRepo:     cfg.ActionsRepo,
 		automationsRepo: cfg.AutomationsRepo,
+		jobsRepo:        cfg.JobsRepo,
+		groupsRepo:      cfg.GroupsRepo,
 		queryRepo:       cfg.QueryRepo,
 		devicesCache:    cfg.DevicesCache,
 		actionsCache:    cfg.ActionsCache,
-		logger:          cfg.Logger,
+		logger:          logger,
+		transports:      transports,
+		retryCfg:        cfg.Retry,
+		breakerCfg:      cfg.Breaker,
+		defaultTimeout:  callTimeout,
+		healthCfg:       cfg.Health,
+		discoveryCfg:    cfg.Discovery,
+		jobsCfg:         cfg.Jobs,
+		jobQueue:        make(chan int, jobQueueSize),
+		queueCfg:        cfg.Queue,
+		bulkConcurrency: cfg.BulkConcurrency,
+		site:            cfg.Site,
+		misfireGrace:    misfireGrace,
 	}
 }
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeviceStatus is the runtime state the server keeps about a device.
+type DeviceStatus struct {
+	DeviceID int           `json:"device_id"`
+	Breaker  BreakerStatus `json:"breaker"`
+	Queue    QueueStatus   `json:"queue"`
+}
+
+func (s *Service) DeviceStatus(ctx context.Context, deviceId int) (*DeviceStatus, error) {
+	if _, err := s.devicesRepo.Get(ctx, deviceId); err != nil {
+		return nil, fmt.Errorf("getting device: %w", err)
+	}
+
+	return &DeviceStatus{
+		DeviceID: deviceId,
+		Breaker:  s.getBreaker(deviceId).status(),
+		Queue:    s.QueueStatus(deviceId),
+	}, nil
+}
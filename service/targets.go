@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// resolveDevices returns the members of a group, or the devices carrying every tag,
+// in ID order. Exactly one of group and tags is expected to be set.
+func (s *Service) resolveDevices(ctx context.Context, group string, tags []string) ([]*models.Device, error) {
+	if group != "" {
+		return s.groupDevices(ctx, group)
+	}
+
+	all, err := s.devicesRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting devices: %w", err)
+	}
+
+	var devices []*models.Device
+	for _, device := range all {
+		if device.HasTags(tags) {
+			devices = append(devices, device)
+		}
+	}
+	slices.SortFunc(devices, func(a, b *models.Device) int { return a.ID - b.ID })
+	return devices, nil
+}
+
+func (s *Service) groupDevices(ctx context.Context, name string) ([]*models.Device, error) {
+	groupID, err := s.queryRepo.GetIDByName(ctx, "groups", name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up group: %w", err)
+	}
+
+	deviceIDs, err := s.queryRepo.GetGroupDeviceIDs(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("getting devices of group [%s]: %w", name, err)
+	}
+
+	devices := make([]*models.Device, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		device, err := s.devicesRepo.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("getting device %d of group [%s]: %w", id, name, err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// expandTriggers replaces every trigger on a group or tags with one trigger per
+// selected device. owners maps each returned trigger to the index of the trigger it
+// came from.
+func (s *Service) expandTriggers(ctx context.Context, triggers []models.AutomationTrigger) ([]models.AutomationTrigger, []int, error) {
+	var expanded []models.AutomationTrigger
+	var owners []int
+	for i, trigger := range triggers {
+		if !trigger.IsSelector() {
+			expanded = append(expanded, trigger)
+			owners = append(owners, i)
+			continue
+		}
+
+		devices, err := s.resolveDevices(ctx, trigger.Group, trigger.Tags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolving trigger devices: %w", err)
+		}
+		if len(devices) == 0 {
+			return nil, nil, fmt.Errorf("no devices match trigger %s", describeSelector(trigger.Group, trigger.Tags))
+		}
+
+		for _, device := range devices {
+			t := trigger
+			t.Device, t.Group, t.Tags = device.Name, "", nil
+			expanded = append(expanded, t)
+			owners = append(owners, i)
+		}
+	}
+	return expanded, owners, nil
+}
+
+// actionDevices returns the names of the devices an automation action runs on.
+func (s *Service) actionDevices(ctx context.Context, action models.AutomationAction) ([]string, error) {
+	if !action.IsSelector() {
+		return []string{action.Device}, nil
+	}
+
+	devices, err := s.resolveDevices(ctx, action.Group, action.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("resolving action devices: %w", err)
+	}
+
+	names := make([]string, len(devices))
+	for i, device := range devices {
+		names[i] = device.Name
+	}
+	return names, nil
+}
+
+func describeSelector(group string, tags []string) string {
+	if group != "" {
+		return fmt.Sprintf("group [%s]", group)
+	}
+	return fmt.Sprintf("tags %v", tags)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestProcessAutomations_Selectors(t *testing.T) {
+	ctx := context.Background()
+
+	hot := createRecordingServer(`{"jsonrpc":"2.0","result":{"temperature":30.0},"id":1}`, http.StatusOK)
+	defer hot.Close()
+	cold := createRecordingServer(`{"jsonrpc":"2.0","result":{"temperature":20.0},"id":1}`, http.StatusOK)
+	defer cold.Close()
+	fans := createRecordingServer(`{"jsonrpc":"2.0","result":{"ok":true},"id":1}`, http.StatusOK)
+	defer fans.Close()
+
+	newSelectorService := func(def models.AutomationDefinition) (*Service, *mockAutomationRepo) {
+		yamlDef, err := createYAMLDefinition(def)
+		require.NoError(t, err)
+
+		automationRepo := &mockAutomationRepo{automations: []*models.Automation{{
+			ID:              1,
+			Name:            "cooling",
+			Enabled:         true,
+			Definition:      yamlDef,
+			LastTriggersRun: createPastTimestamp(10 * time.Minute),
+		}}}
+
+		return NewService(ServiceConfig{
+			DevicesRepo: &mockDeviceRepo{devices: []*models.Device{
+				{ID: 1, Name: "sensor-hot", IP: hot.Listener.Addr().String(), Tags: models.Tags{"greenhouse"}},
+				{ID: 2, Name: "sensor-cold", IP: cold.Listener.Addr().String(), Tags: models.Tags{"greenhouse"}},
+				{ID: 3, Name: "fan-1", IP: fans.Listener.Addr().String()},
+				{ID: 4, Name: "fan-2", IP: fans.Listener.Addr().String()},
+				{ID: 5, Name: "fan-3", IP: fans.Listener.Addr().String()},
+			}},
+			ActionsRepo: &mockActionRepo{actions: []*models.Action{
+				{ID: 1, Name: "read_temp", Path: "read_temp"},
+				{ID: 2, Name: "fan_on", Path: "fan_on"},
+				{ID: 3, Name: "fan_off", Path: "fan_off"},
+			}},
+			AutomationsRepo: automationRepo,
+			GroupsRepo:      &mockGroupRepo{groups: []*models.Group{{ID: 1, Name: "fans"}}},
+			QueryRepo: &mockQuerier{
+				nameToID: map[string]int{
+					"devices:sensor-hot": 1, "devices:sensor-cold": 2, "devices:fan-1": 3, "devices:fan-2": 4, "devices:fan-3": 5,
+					"actions:read_temp": 1, "actions:fan_on": 2, "actions:fan_off": 3,
+					"groups:fans": 1,
+				},
+				deviceActions: map[int][]int{1: {1}, 2: {1}, 3: {2}, 4: {3}, 5: {2}},
+				groupDevices:  map[int][]int{1: {3, 4, 5}},
+			},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}), automationRepo
+	}
+
+	tagTrigger := func(match string) models.AutomationDefinition {
+		return models.AutomationDefinition{
+			Interval: "5m",
+			Triggers: []models.AutomationTrigger{
+				{Tags: []string{"greenhouse"}, Match: match, Action: "read_temp", Conditions: []models.AutomationCondition{
+					{Field: "temperature", Operator: ">", Threshold: 25.0},
+				}},
+			},
+			Actions: []models.AutomationAction{{Device: "fan-1", Action: "fan_on"}},
+		}
+	}
+
+	t.Run("tag trigger requires every device by default", func(t *testing.T) {
+		svc, _ := newSelectorService(tagTrigger(""))
+		before := fans.getCallCount()
+
+		require.NoError(t, svc.processAutomations(ctx))
+		assert.Equal(t, before, fans.getCallCount())
+	})
+
+	t.Run("tag trigger with match any", func(t *testing.T) {
+		svc, _ := newSelectorService(tagTrigger(models.TriggerMatchAny))
+		before := fans.getCallCount()
+
+		require.NoError(t, svc.processAutomations(ctx))
+		assert.Equal(t, before+1, fans.getCallCount())
+	})
+
+	t.Run("group action runs on every member", func(t *testing.T) {
+		def := tagTrigger(models.TriggerMatchAny)
+		def.Actions = []models.AutomationAction{{Group: "fans", Action: "fan_on"}}
+		svc, _ := newSelectorService(def)
+		before := fans.getCallCount()
+
+		// fan-2 doesn't have fan_on; the other members still run
+		err := svc.processAutomations(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, before+2, fans.getCallCount())
+		assert.NotEmpty(t, svc.queryRepo.(*mockQuerier).getTime(1, "last_action_run"))
+	})
+
+	t.Run("trigger selector without devices fails", func(t *testing.T) {
+		def := tagTrigger("")
+		def.Triggers[0].Tags = []string{"cellar"}
+		svc, _ := newSelectorService(def)
+
+		_, err := svc.processTriggers(ctx, &def, time.Now())
+		assert.ErrorContains(t, err, "no devices match trigger tags [cellar]")
+	})
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"time"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+const defaultCallTimeout = 10 * time.Second
+
+// callTimeout returns how long a single call may take: the action timeout if set,
+// otherwise the device timeout, otherwise the service default. When several actions
+// are sent together, the longest action timeout applies.
+func (s *Service) callTimeout(device *models.Device, actions ...*models.Action) time.Duration {
+	var timeout time.Duration
+	for _, action := range actions {
+		timeout = max(timeout, parseTimeout(action.Timeout))
+	}
+
+	if timeout == 0 {
+		timeout = parseTimeout(device.Timeout)
+	}
+
+	if timeout == 0 {
+		timeout = s.defaultTimeout
+	}
+
+	return timeout
+}
+
+// parseTimeout returns 0 for an unset or invalid timeout. Timeouts are validated
+// when devices and actions are saved.
+func parseTimeout(timeout string) time.Duration {
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
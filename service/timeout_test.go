@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestCallTimeout(t *testing.T) {
+	svc := NewService(ServiceConfig{CallTimeout: 5 * time.Second})
+
+	tests := []struct {
+		name    string
+		device  models.Device
+		actions []*models.Action
+		want    time.Duration
+	}{
+		{name: "service default", device: models.Device{}, actions: []*models.Action{{}}, want: 5 * time.Second},
+		{name: "device overrides default", device: models.Device{Timeout: "2s"}, actions: []*models.Action{{}}, want: 2 * time.Second},
+		{name: "action overrides device", device: models.Device{Timeout: "2s"}, actions: []*models.Action{{Timeout: "60s"}}, want: time.Minute},
+		{
+			name:    "longest action timeout in batch",
+			device:  models.Device{Timeout: "2s"},
+			actions: []*models.Action{{Timeout: "1s"}, {}, {Timeout: "3s"}},
+			want:    3 * time.Second,
+		},
+		{name: "invalid timeout is ignored", device: models.Device{Timeout: "soon"}, actions: []*models.Action{{}}, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, svc.callTimeout(&tt.device, tt.actions...))
+		})
+	}
+
+	t.Run("defaults to 10s", func(t *testing.T) {
+		assert.Equal(t, 10*time.Second, NewService(ServiceConfig{}).callTimeout(&models.Device{}))
+	})
+}
+
+func TestExecute_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // a slow actuator that never answers in time
+	}))
+	defer server.Close()
+	defer close(release)
+
+	svc := NewService(ServiceConfig{
+		DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, Name: "valve", IP: server.Listener.Addr().String(), Timeout: "10s"}},
+		ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "open", Timeout: "50ms"}},
+		QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+		DevicesCache: cache.NewCache[*models.Device](),
+		ActionsCache: cache.NewCache[*models.Action](),
+	})
+
+	start := time.Now()
+	_, err := svc.Execute(context.Background(), 1, 1, nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+func TestProcessAutomations_TimeTriggers(t *testing.T) {
+	ctx := context.Background()
+	open := &models.TimeWindow{Weekdays: []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}}
+	closed := &models.TimeWindow{Except: []string{time.Now().UTC().Format("2006-01-02")}}
+
+	tests := []struct {
+		name      string
+		window    *models.TimeWindow
+		logic     string
+		wantCalls []string
+	}{
+		{name: "open window reads the device and acts", window: open, wantCalls: []string{"read_soil", "mist"}},
+		{name: "closed window skips the device", window: closed, wantCalls: nil},
+		{name: "closed window with or logic still reads the device", window: closed, logic: "or", wantCalls: []string{"read_soil", "mist"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createRecordingServer(`{"jsonrpc":"2.0","result":{"moisture":10},"id":1}`, http.StatusOK)
+			defer server.Close()
+
+			yamlDef, err := createYAMLDefinition(models.AutomationDefinition{
+				Interval:       "5m",
+				Timezone:       "UTC",
+				ConditionLogic: tt.logic,
+				Triggers: []models.AutomationTrigger{
+					{Time: tt.window},
+					{Device: "sensor", Action: "read_soil", Conditions: []models.AutomationCondition{
+						{Field: "moisture", Operator: "<", Threshold: 30},
+					}},
+				},
+				Actions: []models.AutomationAction{{Device: "mister", Action: "mist"}},
+			})
+			require.NoError(t, err)
+
+			svc := createTestServiceForAutomation(
+				&mockDeviceRepo{devices: []*models.Device{
+					{ID: 1, Name: "sensor", IP: server.Listener.Addr().String()},
+					{ID: 2, Name: "mister", IP: server.Listener.Addr().String()},
+				}},
+				map[int][]int{1: {1}, 2: {2}},
+				&mockActionRepo{actions: []*models.Action{
+					{ID: 1, Name: "read_soil", Path: "read_soil"},
+					{ID: 2, Name: "mist", Path: "mist"},
+				}},
+				&mockAutomationRepo{automations: []*models.Automation{{
+					ID:              1,
+					Name:            "misting",
+					Enabled:         true,
+					Definition:      yamlDef,
+					LastTriggersRun: createPastTimestamp(10 * time.Minute),
+				}}},
+				nil,
+			)
+
+			require.NoError(t, svc.processAutomations(ctx))
+
+			var calls []string
+			for _, request := range server.getRequests() {
+				calls = append(calls, request.Method)
+			}
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
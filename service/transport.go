@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+// Transport delivers a JSON-RPC request to a device and returns the device's response.
+// Implementations are selected per device through models.Device.Transport.
+type Transport interface {
+	Call(ctx context.Context, device *models.Device, req *JSONRPCRequest) (*JSONRPCResponse, error)
+}
+
+// BatchTransport is implemented by transports that can send several requests to a
+// device in a single JSON-RPC 2.0 batch. Responses may come back in any order.
+type BatchTransport interface {
+	CallBatch(ctx context.Context, device *models.Device, reqs []*JSONRPCRequest) ([]*JSONRPCResponse, error)
+}
+
+// errBatchUnsupported is returned by a BatchTransport when the device rejected the batch format.
+var errBatchUnsupported = errors.New("device does not support JSON-RPC batches")
+
+// transportNames returns the names of the registered transports, in sorted order.
+func (s *Service) transportNames() []string {
+	return slices.Sorted(maps.Keys(s.transports))
+}
+
+func (s *Service) getTransport(device *models.Device) (Transport, error) {
+	name := device.Transport
+	if name == "" {
+		name = models.TransportHTTP
+	}
+
+	t, ok := s.transports[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported transport '%s'", name)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tender-barbarian/gniotek/cache"
+	"github.com/tender-barbarian/gniotek/repository/models"
+)
+
+type mockTransport struct {
+	response *JSONRPCResponse
+	err      error
+	calls    []*JSONRPCRequest
+}
+
+func (m *mockTransport) Call(_ context.Context, _ *models.Device, req *JSONRPCRequest) (*JSONRPCResponse, error) {
+	m.calls = append(m.calls, req)
+	if m.response == nil {
+		return nil, m.err
+	}
+	resp := *m.response
+	resp.ID = req.ID
+	return &resp, m.err
+}
+
+func TestExecute_TransportDispatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("custom transport is used for device", func(t *testing.T) {
+		transport := &mockTransport{response: &JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`{"ok":true}`), ID: 1}}
+		svc := NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, IP: "8.8.8.8", Transport: "fake"}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle", Params: `{"pin":5}`}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Transports:   map[string]Transport{"fake": transport},
+		})
+
+		resp, err := svc.Execute(ctx, 1, 1, nil)
+		require.NoError(t, err)
+		assert.Equal(t, json.RawMessage(`{"ok":true}`), resp.Result)
+		require.Len(t, transport.calls, 1)
+		assert.Equal(t, "toggle", transport.calls[0].Method)
+		assert.Equal(t, map[string]any{"pin": float64(5)}, transport.calls[0].Params)
+	})
+
+	t.Run("JSON-RPC error from transport is surfaced", func(t *testing.T) {
+		transport := &mockTransport{response: &JSONRPCResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: -32601, Message: "Method not found"}, ID: 1}}
+		svc := NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, Transport: "fake"}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle"}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+			Transports:   map[string]Transport{"fake": transport},
+		})
+
+		resp, err := svc.Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "JSON-RPC error -32601: Method not found")
+		assert.NotNil(t, resp)
+	})
+
+	t.Run("unknown transport returns error", func(t *testing.T) {
+		svc := NewService(ServiceConfig{
+			DevicesRepo:  &mockDeviceRepo{device: &models.Device{ID: 1, Transport: "carrier-pigeon"}},
+			ActionsRepo:  &mockActionRepo{action: &models.Action{ID: 1, Path: "toggle"}},
+			QueryRepo:    &mockQuerier{deviceActions: map[int][]int{1: {1}}},
+			DevicesCache: cache.NewCache[*models.Device](),
+			ActionsCache: cache.NewCache[*models.Action](),
+		})
+
+		_, err := svc.Execute(ctx, 1, 1, nil)
+		assert.EqualError(t, err, "unsupported transport 'carrier-pigeon'")
+	})
+}
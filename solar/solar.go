@@ -0,0 +1,114 @@
+// Package solar computes sunrise and sunset offline with the sunrise equation, which
+// is accurate to about a minute away from the polar circles.
+package solar
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Sun events.
+const (
+	Sunrise = "sunrise"
+	Sunset  = "sunset"
+)
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	// Sunrise and sunset are when the top of the sun touches the horizon, corrected
+	// for refraction
+	horizon = -0.833
+	// Obliquity of the ecliptic
+	obliquity = 23.4397
+)
+
+// Site is where the sun is observed from.
+type Site struct {
+	Latitude  float64
+	Longitude float64
+	// Location is the timezone days are counted in.
+	Location *time.Location
+}
+
+// NewSite checks the coordinates and loads the timezone of a site.
+func NewSite(latitude, longitude float64, timezone string) (*Site, error) {
+	if latitude < -90 || latitude > 90 {
+		return nil, fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if longitude < -180 || longitude > 180 {
+		return nil, fmt.Errorf("longitude must be between -180 and 180")
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone '%s'", timezone)
+	}
+	return &Site{Latitude: latitude, Longitude: longitude, Location: loc}, nil
+}
+
+// Day returns sunrise and sunset on the day of date in the site's timezone. ok is
+// false when the sun doesn't rise or set that day; up then tells whether it stays up.
+func (s *Site) Day(date time.Time) (rise, set time.Time, up, ok bool) {
+	y, m, d := date.In(s.Location).Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, s.Location)
+
+	// The solar noon closest to local noon
+	n := math.Round(toJulian(noon) - julian2000 + s.Longitude/360)
+	j := n - s.Longitude/360
+
+	meanAnomaly := math.Mod(357.5291+0.98560028*j, 360)
+	center := 1.9148*sin(meanAnomaly) + 0.0200*sin(2*meanAnomaly) + 0.0003*sin(3*meanAnomaly)
+	eclipticLongitude := math.Mod(meanAnomaly+center+180+102.9372, 360)
+	transit := julian2000 + j + 0.0053*sin(meanAnomaly) - 0.0069*sin(2*eclipticLongitude)
+
+	declination := math.Asin(sin(eclipticLongitude) * sin(obliquity))
+	cosHourAngle := (sin(horizon) - sin(s.Latitude)*math.Sin(declination)) / (cos(s.Latitude) * math.Cos(declination))
+	if cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false, false
+	}
+	if cosHourAngle < -1 {
+		return time.Time{}, time.Time{}, true, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulian(transit - hourAngle/360).In(s.Location), fromJulian(transit + hourAngle/360).In(s.Location), false, true
+}
+
+// Event returns the sunrise or sunset on the day of date. ok is false when it
+// doesn't happen that day.
+func (s *Site) Event(event string, date time.Time) (time.Time, bool) {
+	rise, set, _, ok := s.Day(date)
+	if !ok {
+		return time.Time{}, false
+	}
+	if event == Sunset {
+		return set, true
+	}
+	return rise, true
+}
+
+// IsUp reports whether the sun is above the horizon at t.
+func (s *Site) IsUp(t time.Time) bool {
+	rise, set, up, ok := s.Day(t)
+	if !ok {
+		return up
+	}
+	return !t.Before(rise) && t.Before(set)
+}
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(j float64) time.Time {
+	return time.Unix(0, int64((j-julianUnixEpoch)*86400*float64(time.Second))).Truncate(time.Second)
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
@@ -0,0 +1,83 @@
+package solar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSite_Day(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		timezone string
+		date     time.Time
+		wantRise string
+		wantSet  string
+	}{
+		// Published sunrise and sunset times, rounded to the minute
+		{name: "Berlin midsummer", lat: 52.52, lon: 13.405, timezone: "Europe/Berlin", date: time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC), wantRise: "04:43", wantSet: "21:33"},
+		{name: "Berlin midwinter", lat: 52.52, lon: 13.405, timezone: "Europe/Berlin", date: time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC), wantRise: "08:15", wantSet: "15:54"},
+		{name: "Sydney", lat: -33.8688, lon: 151.2093, timezone: "Australia/Sydney", date: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), wantRise: "05:59", wantSet: "20:09"},
+		{name: "New York", lat: 40.7128, lon: -74.006, timezone: "America/New_York", date: time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC), wantRise: "06:59", wantSet: "19:08"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := NewSite(tt.lat, tt.lon, tt.timezone)
+			require.NoError(t, err)
+
+			rise, set, _, ok := site.Day(tt.date)
+			require.True(t, ok)
+			assertClock(t, tt.wantRise, rise)
+			assertClock(t, tt.wantSet, set)
+
+			y, m, d := tt.date.In(site.Location).Date()
+			ry, rm, rd := rise.Date()
+			assert.Equal(t, []int{y, int(m), d}, []int{ry, int(rm), rd})
+		})
+	}
+}
+
+// assertClock checks t against a wall clock time, allowing two minutes of error.
+func assertClock(t *testing.T, want string, got time.Time) {
+	t.Helper()
+	clock, err := time.Parse("15:04", want)
+	require.NoError(t, err)
+	expected := time.Date(got.Year(), got.Month(), got.Day(), clock.Hour(), clock.Minute(), 0, 0, got.Location())
+	assert.WithinDuration(t, expected, got, 2*time.Minute)
+}
+
+func TestSite_PolarDays(t *testing.T) {
+	tromso, err := NewSite(69.6492, 18.9553, "Europe/Oslo")
+	require.NoError(t, err)
+
+	_, _, up, ok := tromso.Day(time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+	assert.True(t, up)
+	assert.True(t, tromso.IsUp(time.Date(2026, 6, 21, 0, 30, 0, 0, tromso.Location)))
+
+	_, ok = tromso.Event(Sunrise, time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+	assert.False(t, tromso.IsUp(time.Date(2026, 12, 21, 12, 0, 0, 0, tromso.Location)))
+}
+
+func TestSite_IsUp(t *testing.T) {
+	berlin, err := NewSite(52.52, 13.405, "Europe/Berlin")
+	require.NoError(t, err)
+
+	assert.True(t, berlin.IsUp(time.Date(2026, 6, 21, 12, 0, 0, 0, berlin.Location)))
+	assert.False(t, berlin.IsUp(time.Date(2026, 6, 21, 23, 0, 0, 0, berlin.Location)))
+	assert.False(t, berlin.IsUp(time.Date(2026, 12, 21, 7, 0, 0, 0, berlin.Location)))
+}
+
+func TestNewSite(t *testing.T) {
+	_, err := NewSite(91, 0, "UTC")
+	assert.ErrorContains(t, err, "latitude")
+	_, err = NewSite(0, -181, "UTC")
+	assert.ErrorContains(t, err, "longitude")
+	_, err = NewSite(0, 0, "Mars/Olympus")
+	assert.ErrorContains(t, err, "unknown timezone")
+}
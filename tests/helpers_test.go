@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 
@@ -14,21 +16,23 @@ import (
 )
 
 type capturedRequest struct {
-	mu          sync.Mutex
-	Method      string
-	Path        string
-	ContentType string
-	Body        service.JSONRPCRequest
+	mu            sync.Mutex
+	Method        string
+	Path          string
+	ContentType   string
+	Authorization string
+	Body          service.JSONRPCRequest
 }
 
 func (c *capturedRequest) Get() capturedRequest {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return capturedRequest{
-		Method:      c.Method,
-		Path:        c.Path,
-		ContentType: c.ContentType,
-		Body:        c.Body,
+		Method:        c.Method,
+		Path:          c.Path,
+		ContentType:   c.ContentType,
+		Authorization: c.Authorization,
+		Body:          c.Body,
 	}
 }
 
@@ -36,20 +40,62 @@ func newMockDevice(t *testing.T, response string) (*httptest.Server, *capturedRe
 	t.Helper()
 	captured := &capturedRequest{}
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		captured.mu.Lock()
-		captured.Method = r.Method
-		captured.Path = r.URL.Path
-		captured.ContentType = r.Header.Get("Content-Type")
-		json.NewDecoder(r.Body).Decode(&captured.Body) // nolint
-		captured.mu.Unlock()
+		var body service.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&body) // nolint
+
+		// Health checks run in the background and must not replace the captured call
+		if body.Method != healthCheckMethod {
+			captured.mu.Lock()
+			captured.Method = r.Method
+			captured.Path = r.URL.Path
+			captured.ContentType = r.Header.Get("Content-Type")
+			captured.Authorization = r.Header.Get("Authorization")
+			captured.Body = body
+			captured.mu.Unlock()
+		}
+		id := body.ID
 
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(response)) // nolint
+		w.Write([]byte(strings.Replace(response, `"id":1`, fmt.Sprintf(`"id":%d`, id), 1))) // nolint
 	}))
 	t.Cleanup(srv.Close)
 	return srv, captured
 }
 
+// unreachableAddr returns the address of a server that is no longer listening.
+func unreachableAddr(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.Listener.Addr().String()
+}
+
+// startDiscoveryResponder answers discovery probes on addr with the given device description.
+func startDiscoveryResponder(t *testing.T, addr, result string) {
+	t.Helper()
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	require.NoError(t, err)
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() }) // nolint
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var req service.JSONRPCRequest
+			if json.Unmarshal(buf[:n], &req) != nil {
+				continue
+			}
+			reply, _ := json.Marshal(service.JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(result), ID: req.ID})
+			conn.WriteToUDP(reply, from) // nolint
+		}
+	}()
+}
+
 func createResource(t *testing.T, path, body string) int {
 	t.Helper()
 	req, err := http.NewRequest(http.MethodPost, baseURL+path, bytes.NewBufferString(body))
@@ -69,9 +115,43 @@ func createResource(t *testing.T, path, body string) int {
 	return result["id"]
 }
 
+// createDevice creates a device and assigns the given actions to it.
+func createDevice(t *testing.T, body string, actionIDs ...int) int {
+	t.Helper()
+	id := createResource(t, "/devices", body)
+	for _, actionID := range actionIDs {
+		attachAction(t, id, actionID)
+	}
+	return id
+}
+
+func attachAction(t *testing.T, deviceID, actionID int) {
+	t.Helper()
+	require.Equal(t, http.StatusNoContent, doRequest(t, http.MethodPut, fmt.Sprintf("/devices/%d/actions/%d", deviceID, actionID)))
+}
+
+func doRequest(t *testing.T, method, path string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, baseURL+path, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	return resp.StatusCode
+}
+
 func getResource[T any](t *testing.T, path string, id int) T {
 	t.Helper()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s/%d", baseURL, path, id), nil)
+	return getJSON[T](t, fmt.Sprintf("%s/%d", path, id))
+}
+
+func getJSON[T any](t *testing.T, path string) T {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, baseURL+path, nil)
 	require.NoError(t, err)
 
 	resp, err := http.DefaultClient.Do(req)
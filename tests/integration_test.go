@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"testing"
@@ -14,16 +15,26 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tender-barbarian/gniotek/repository/models"
 	server "github.com/tender-barbarian/gniotek/server"
+	"github.com/tender-barbarian/gniotek/service"
 	"gopkg.in/yaml.v3"
 )
 
-const baseURL = "http://127.0.0.1:8080"
+const (
+	baseURL           = "http://127.0.0.1:8080"
+	healthCheckMethod = "ping"
+	discoveryTarget   = "127.0.0.1:47475"
+)
 
 var serverErrCh chan error
 
 func TestMain(m *testing.M) {
 	os.Setenv("AUTOMATIONS_INTERVAL", "1s") // nolint
 
+	os.Setenv("HEALTH_CHECK_INTERVAL", "1s") // nolint
+
+	os.Setenv("DISCOVERY_TARGETS", discoveryTarget) // nolint
+	os.Setenv("DISCOVERY_WAIT", "300ms")            // nolint
+
 	serverErrCh = make(chan error, 1)
 	go func() {
 		if err := server.Run(); err != nil {
@@ -117,6 +128,17 @@ func TestDevices_CRUD(t *testing.T) {
 		assert.Equal(t, wantUpdated.IP, updated.IP)
 	})
 
+	t.Run("transport must be registered", func(t *testing.T) {
+		// No MQTT broker is configured, so the MQTT transport isn't registered
+		resp, err := http.Post(baseURL+"/devices", "application/json", bytes.NewBufferString(`{"name":"balcony","ip":"192.168.1.150","transport":"mqtt"}`))
+		if err != nil {
+			checkServerError(t, err)
+		}
+		defer resp.Body.Close() // nolint
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
 	t.Run("test device delete", func(t *testing.T) {
 		for _, id := range ids {
 			deleteResource(t, "/devices", id)
@@ -125,69 +147,121 @@ func TestDevices_CRUD(t *testing.T) {
 	})
 }
 
-func TestDevices_ActionValidation(t *testing.T) {
-	validActionID := createResource(t, "/actions", `{"name":"valid-action","path":"test","params":"{}"}`)
-	deviceID := createResource(t, "/devices", `{"name":"dev-for-update","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.60"}`)
+func TestDevices_Actions(t *testing.T) {
+	actionID := createResource(t, "/actions", `{"name":"valid-action","path":"test","params":"{}"}`)
+	deviceID := createResource(t, "/devices", `{"name":"dev-with-actions","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.60"}`)
 
 	tests := []struct {
 		name     string
+		method   string
 		path     string
-		body     string
 		wantCode int
 	}{
-		{
-			name:     "create with non-existent action fails",
-			path:     "/devices",
-			body:     `{"name":"d1","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.50","actions":"[99999]"}`,
-			wantCode: http.StatusBadRequest,
-		},
-		{
-			name:     "create with mixed valid and invalid actions fails",
-			path:     "/devices",
-			body:     fmt.Sprintf(`{"name":"d2","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.51","actions":"[%d, 99999]"}`, validActionID),
-			wantCode: http.StatusBadRequest,
-		},
-		{
-			name:     "create with valid action succeeds",
-			path:     "/devices",
-			body:     fmt.Sprintf(`{"name":"d3","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.52","actions":"[%d]"}`, validActionID),
-			wantCode: http.StatusCreated,
-		},
-		{
-			name:     "create with empty actions succeeds",
-			path:     "/devices",
-			body:     `{"name":"d4","type":"sensor","chip":"esp32","board":"devkit","ip":"192.168.1.53","actions":""}`,
-			wantCode: http.StatusCreated,
-		},
-		{
-			name:     "update with non-existent action fails",
-			path:     fmt.Sprintf("/devices/%d", deviceID),
-			body:     `{"actions":"[99999]"}`,
-			wantCode: http.StatusBadRequest,
-		},
-		{
-			name:     "update with valid action succeeds",
-			path:     fmt.Sprintf("/devices/%d", deviceID),
-			body:     fmt.Sprintf(`{"actions":"[%d]"}`, validActionID),
-			wantCode: http.StatusOK,
-		},
+		{name: "attach non-existent action fails", method: http.MethodPut, path: fmt.Sprintf("/devices/%d/actions/99999", deviceID), wantCode: http.StatusNotFound},
+		{name: "attach to non-existent device fails", method: http.MethodPut, path: fmt.Sprintf("/devices/99999/actions/%d", actionID), wantCode: http.StatusNotFound},
+		{name: "attach valid action succeeds", method: http.MethodPut, path: fmt.Sprintf("/devices/%d/actions/%d", deviceID, actionID), wantCode: http.StatusNoContent},
+		{name: "attach twice is a no-op", method: http.MethodPut, path: fmt.Sprintf("/devices/%d/actions/%d", deviceID, actionID), wantCode: http.StatusNoContent},
+		{name: "delete attached action fails", method: http.MethodDelete, path: fmt.Sprintf("/actions/%d", actionID), wantCode: http.StatusConflict},
+		{name: "detach succeeds", method: http.MethodDelete, path: fmt.Sprintf("/devices/%d/actions/%d", deviceID, actionID), wantCode: http.StatusNoContent},
+		{name: "detach unassigned action fails", method: http.MethodDelete, path: fmt.Sprintf("/devices/%d/actions/%d", deviceID, actionID), wantCode: http.StatusNotFound},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp, err := http.Post(baseURL+tt.path, "application/json", bytes.NewBufferString(tt.body))
-			if err != nil {
-				checkServerError(t, err)
-			}
-			defer resp.Body.Close() // nolint
-
-			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			assert.Equal(t, tt.wantCode, doRequest(t, tt.method, tt.path))
 		})
 	}
 
-	t.Cleanup(func() {
-		deleteResource(t, "/actions", validActionID)
+	t.Run("assignments are listed", func(t *testing.T) {
+		attachAction(t, deviceID, actionID)
+
+		actions := getAllResources[models.Action](t, fmt.Sprintf("/devices/%d/actions", deviceID))
+		require.Len(t, actions, 1)
+		assert.Equal(t, "valid-action", actions[0].Name)
+
+		deviceActions := getAllResources[models.DeviceAction](t, "/devices/actions")
+		assert.Contains(t, deviceActions, models.DeviceAction{DeviceID: deviceID, ActionID: actionID})
+	})
+
+	t.Run("deleting the device removes its assignments", func(t *testing.T) {
+		deleteResource(t, "/devices", deviceID)
+
+		deviceActions := getAllResources[models.DeviceAction](t, "/devices/actions")
+		assert.NotContains(t, deviceActions, models.DeviceAction{DeviceID: deviceID, ActionID: actionID})
+		deleteResource(t, "/actions", actionID)
+	})
+}
+
+func TestDependents_DeleteAndRename(t *testing.T) {
+	actionID := createResource(t, "/actions", `{"name":"vent-open","path":"vent_open","params":"{}"}`)
+	deviceID := createDevice(t, `{"name":"vent","type":"actuator","chip":"esp32","board":"devkit","ip":"192.168.1.70"}`, actionID)
+	automationID := createResource(t, "/automations", `{"name":"airing","enabled":false,"definition":"interval: 1h\ntriggers: []\nactions:\n  - device: vent\n    action: vent-open\n"}`)
+	chainID := createResource(t, "/automations", `{"name":"after-airing","enabled":false,"definition":"events:\n  - type: automation_finished\n    automation: airing\nactions:\n  - device: vent\n    action: vent-open\n"}`)
+
+	t.Run("dependents are listed", func(t *testing.T) {
+		dependents := getJSON[service.Dependents](t, fmt.Sprintf("/devices/%d/dependents", deviceID))
+		assert.Equal(t, []service.Dependent{{ID: automationID, Name: "airing"}, {ID: chainID, Name: "after-airing"}}, dependents.Automations)
+
+		dependents = getJSON[service.Dependents](t, fmt.Sprintf("/actions/%d/dependents", actionID))
+		assert.Equal(t, []service.Dependent{{ID: automationID, Name: "airing"}, {ID: chainID, Name: "after-airing"}}, dependents.Automations)
+		assert.Equal(t, []service.Dependent{{ID: deviceID, Name: "vent"}}, dependents.Devices)
+
+		dependents = getJSON[service.Dependents](t, fmt.Sprintf("/automations/%d/dependents", automationID))
+		assert.Equal(t, []service.Dependent{{ID: chainID, Name: "after-airing"}}, dependents.Automations)
+	})
+
+	t.Run("referenced records can't be deleted", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, doRequest(t, http.MethodDelete, fmt.Sprintf("/devices/%d", deviceID)))
+		assert.Equal(t, http.StatusConflict, doRequest(t, http.MethodDelete, fmt.Sprintf("/actions/%d", actionID)))
+		assert.Equal(t, http.StatusConflict, doRequest(t, http.MethodDelete, fmt.Sprintf("/automations/%d", automationID)))
+	})
+
+	t.Run("update can't rename a referenced device", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/devices/%d", baseURL, deviceID), "application/json",
+			bytes.NewBufferString(`{"name":"roof-vent","type":"actuator","chip":"esp32","board":"devkit","ip":"192.168.1.70"}`))
+		if err != nil {
+			checkServerError(t, err)
+		}
+		defer resp.Body.Close() // nolint
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("rename propagates into automations", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/devices/%d/rename", baseURL, deviceID), "application/json", bytes.NewBufferString(`{"name":"roof-vent"}`))
+		if err != nil {
+			checkServerError(t, err)
+		}
+		defer resp.Body.Close() // nolint
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, "roof-vent", getResource[models.Device](t, "/devices", deviceID).Name)
+		automation := getResource[models.Automation](t, "/automations", automationID)
+		def, err := automation.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, "roof-vent", def.Actions[0].Device)
+	})
+
+	t.Run("rename propagates into automation_finished events", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("%s/automations/%d/rename", baseURL, automationID), "application/json", bytes.NewBufferString(`{"name":"morning-airing"}`))
+		if err != nil {
+			checkServerError(t, err)
+		}
+		defer resp.Body.Close() // nolint
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, "morning-airing", getResource[models.Automation](t, "/automations", automationID).Name)
+		chain := getResource[models.Automation](t, "/automations", chainID)
+		def, err := chain.ParseDefinition()
+		require.NoError(t, err)
+		assert.Equal(t, "morning-airing", def.Events[0].Automation)
+		assert.Equal(t, "roof-vent", def.Actions[0].Device)
+	})
+
+	t.Run("unreferenced records can be deleted", func(t *testing.T) {
+		deleteResource(t, "/automations", chainID)
+		deleteResource(t, "/automations", automationID)
 		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
 	})
 }
 
@@ -196,8 +270,8 @@ func TestExecuteRoute_E2E(t *testing.T) {
 
 	// Setup
 	actionID := createResource(t, "/actions", `{"name":"test-action","path":"toggle","params":"{}"}`)
-	deviceID := createResource(t, "/devices", fmt.Sprintf(`{"name":"mock-device","type":"sensor","chip":"esp32","board":"devkit","ip":"%s","actions":"[%d]"}`, mockDevice.Listener.Addr().String(), actionID))
-	unreachableDeviceID := createResource(t, "/devices", fmt.Sprintf(`{"name":"mock-unreachable-device","type":"sensor","chip":"esp32","board":"devkit","ip":"127.0.0.1:9999","actions":"[%d]"}`, actionID))
+	deviceID := createDevice(t, fmt.Sprintf(`{"name":"mock-device","type":"sensor","chip":"esp32","board":"devkit","ip":"%s"}`, mockDevice.Listener.Addr().String()), actionID)
+	unreachableDeviceID := createDevice(t, `{"name":"mock-unreachable-device","type":"sensor","chip":"esp32","board":"devkit","ip":"127.0.0.1:9999"}`, actionID)
 	otherActionID := createResource(t, "/actions", `{"name":"other-action","path":"other","params":"{}"}`)
 
 	tests := []struct {
@@ -231,7 +305,7 @@ func TestExecuteRoute_E2E(t *testing.T) {
 				assert.Equal(t, "application/json", receivedReq.ContentType)
 				assert.Equal(t, "2.0", receivedReq.Body.JSONRPC)
 				assert.Equal(t, "toggle", receivedReq.Body.Method)
-				assert.Equal(t, 1, receivedReq.Body.ID)
+				assert.NotZero(t, receivedReq.Body.ID)
 			},
 		},
 		{
@@ -257,18 +331,496 @@ func TestExecuteRoute_E2E(t *testing.T) {
 	}
 }
 
+func TestExecuteRoute_CustomEndpoint(t *testing.T) {
+	mockDevice, receivedReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+	host, port, err := net.SplitHostPort(mockDevice.Listener.Addr().String())
+	require.NoError(t, err)
+
+	actionID := createResource(t, "/actions", `{"name":"shelly-toggle","path":"Switch.Toggle","params":"{\"id\":0}"}`)
+	deviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"shelly-plug","type":"actuator","chip":"esp32","board":"shelly","ip":"%s","port":%s,"rpc_path":"/rpc/Switch.Toggle","headers":"{\"X-Api-Key\":\"k\"}"}`,
+		host, port), actionID)
+
+	resp, err := http.Post(baseURL+"/execute", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"deviceId": %d, "actionId": %d}`, deviceID, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	snap := receivedReq.Get()
+	assert.Equal(t, "/rpc/Switch.Toggle", snap.Path)
+	assert.Equal(t, "Switch.Toggle", snap.Body.Method)
+
+	t.Cleanup(func() {
+		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
+	})
+}
+
+func TestExecuteRoute_Params(t *testing.T) {
+	mockDevice, receivedReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+
+	actionID := createResource(t, "/actions", `{"name":"water-zone","path":"water","params":"{\"seconds\":\"{{duration}}\"}","parameters":"[{\"name\":\"duration\",\"type\":\"integer\",\"default\":30}]"}`)
+	deviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"valve-1","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		mockDevice.Listener.Addr().String()), actionID)
+
+	tests := []struct {
+		name       string
+		params     string
+		wantCode   int
+		wantParams any
+	}{
+		{name: "default value", params: `{}`, wantCode: http.StatusOK, wantParams: map[string]any{"seconds": float64(30)}},
+		{name: "runtime value", params: `{"duration": 90}`, wantCode: http.StatusOK, wantParams: map[string]any{"seconds": float64(90)}},
+		{name: "wrong type", params: `{"duration": "long"}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"deviceId": %d, "actionId": %d, "params": %s}`, deviceID, actionID, tt.params)
+			resp, err := http.Post(baseURL+"/execute", "application/json", bytes.NewBufferString(body))
+			if err != nil {
+				checkServerError(t, err)
+			}
+			defer resp.Body.Close() // nolint
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			if tt.wantParams != nil {
+				assert.Equal(t, tt.wantParams, receivedReq.Get().Body.Params)
+			}
+		})
+	}
+
+	t.Cleanup(func() {
+		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
+	})
+}
+
+func TestExecuteRoute_DeviceAuth(t *testing.T) {
+	mockDevice, receivedReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+
+	actionID := createResource(t, "/actions", `{"name":"pump-on","path":"pump_on","params":"{}"}`)
+	deviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"pump","type":"actuator","chip":"esp32","board":"devkit","ip":"%s","auth_type":"bearer","auth_secret":"s3cret"}`,
+		mockDevice.Listener.Addr().String()), actionID)
+
+	resp, err := http.Post(baseURL+"/execute", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"deviceId": %d, "actionId": %d}`, deviceID, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Bearer s3cret", receivedReq.Get().Authorization)
+
+	device := getResource[map[string]any](t, "/devices", deviceID)
+	assert.Equal(t, "bearer", device["auth_type"])
+	assert.NotContains(t, device, "auth_secret")
+
+	for _, d := range getAllResources[map[string]any](t, "/devices") {
+		assert.NotContains(t, d, "auth_secret")
+	}
+
+	t.Cleanup(func() {
+		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
+	})
+}
+
+func TestExecuteRoute_Async(t *testing.T) {
+	mockDevice, receivedReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+
+	actionID := createResource(t, "/actions", `{"name":"blinds-down","path":"blinds_down","params":"{}"}`)
+	deviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"blinds","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		mockDevice.Listener.Addr().String()), actionID)
+
+	resp, err := http.Post(baseURL+"/execute", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"deviceId": %d, "actionId": %d, "async": true}`, deviceID, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var job models.Job
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	assert.Equal(t, fmt.Sprintf("/jobs/%d", job.ID), resp.Header.Get("Location"))
+
+	require.Eventually(t, func() bool {
+		polled := getResource[models.Job](t, "/jobs", job.ID)
+		return polled.Finished()
+	}, 10*time.Second, 100*time.Millisecond)
+
+	job = getResource[models.Job](t, "/jobs", job.ID)
+	assert.Equal(t, models.JobSucceeded, job.State)
+	assert.Contains(t, job.Response, `"ok":true`)
+	assert.NotEmpty(t, job.StartedAt)
+	assert.NotEmpty(t, job.FinishedAt)
+	assert.Equal(t, "blinds_down", receivedReq.Get().Body.Method)
+
+	t.Cleanup(func() {
+		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
+	})
+}
+
+func TestExecuteRoute_Bulk(t *testing.T) {
+	mockDevice, _ := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+	addr := mockDevice.Listener.Addr().String()
+
+	actionID := createResource(t, "/actions", `{"name":"water-bed","path":"water","params":"{}"}`)
+	otherActionID := createResource(t, "/actions", `{"name":"mist-bed","path":"mist","params":"{}"}`)
+	deviceIDs := []int{
+		createDevice(t, fmt.Sprintf(`{"name":"bed-a","type":"waterer","chip":"esp32","board":"devkit","ip":"%s","tags":["beds"]}`, addr), actionID),
+		createDevice(t, fmt.Sprintf(`{"name":"bed-b","type":"waterer","chip":"esp32","board":"devkit","ip":"%s","tags":["beds"]}`, addr), actionID),
+		createDevice(t, fmt.Sprintf(`{"name":"bed-c","type":"waterer","chip":"esp32","board":"devkit","ip":"%s","tags":["beds"]}`, addr), otherActionID),
+	}
+	t.Cleanup(func() {
+		for _, id := range deviceIDs {
+			deleteResource(t, "/devices", id)
+		}
+		deleteResource(t, "/actions", actionID)
+		deleteResource(t, "/actions", otherActionID)
+	})
+
+	resp, err := http.Post(baseURL+"/execute/bulk", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"tags": ["beds"], "actionId": %d, "concurrency": 2}`, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	var result service.BulkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Empty(t, result.Results[deviceIDs[0]].Error)
+	assert.Empty(t, result.Results[deviceIDs[1]].Error)
+	assert.Contains(t, result.Results[deviceIDs[2]].Error, "does not belong to device")
+}
+
+func TestGroups_BulkExecute(t *testing.T) {
+	mockDevice, captured := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+	addr := mockDevice.Listener.Addr().String()
+
+	actionID := createResource(t, "/actions", `{"name":"fan-on","path":"fan_on","params":"{}"}`)
+	deviceIDs := []int{
+		createDevice(t, fmt.Sprintf(`{"name":"fan-a","type":"fan","chip":"esp32","board":"devkit","ip":"%s"}`, addr), actionID),
+		createDevice(t, fmt.Sprintf(`{"name":"fan-b","type":"fan","chip":"esp32","board":"devkit","ip":"%s"}`, addr), actionID),
+	}
+	groupID := createResource(t, "/groups", `{"name":"roof-fans","description":"Roof fans"}`)
+	for _, id := range deviceIDs {
+		require.Equal(t, http.StatusNoContent, doRequest(t, http.MethodPut, fmt.Sprintf("/groups/%d/devices/%d", groupID, id)))
+	}
+	t.Cleanup(func() {
+		deleteResource(t, "/groups", groupID)
+		for _, id := range deviceIDs {
+			deleteResource(t, "/devices", id)
+		}
+		deleteResource(t, "/actions", actionID)
+	})
+
+	group := getResource[models.Group](t, "/groups", groupID)
+	assert.Equal(t, "roof-fans", group.Name)
+	members := getJSON[[]models.Device](t, fmt.Sprintf("/groups/%d/devices", groupID))
+	require.Len(t, members, 2)
+	assert.Equal(t, deviceIDs, []int{members[0].ID, members[1].ID})
+
+	resp, err := http.Post(baseURL+"/execute/bulk", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"group": "roof-fans", "actionId": %d}`, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result service.BulkResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, "fan_on", captured.Get().Body.Method)
+
+	resp, err = http.Post(baseURL+"/execute/bulk", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"group": "cellar-fans", "actionId": %d}`, actionID)))
+	require.NoError(t, err)
+	defer resp.Body.Close() // nolint
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, http.MethodPut, fmt.Sprintf("/groups/%d/devices/999999", groupID)))
+	assert.Equal(t, http.StatusNotFound, doRequest(t, http.MethodDelete, fmt.Sprintf("/groups/%d/devices/999999", groupID)))
+
+	// Deleting a device drops its memberships
+	spareID := createDevice(t, fmt.Sprintf(`{"name":"fan-spare","type":"fan","chip":"esp32","board":"devkit","ip":"%s"}`, addr))
+	require.Equal(t, http.StatusNoContent, doRequest(t, http.MethodPut, fmt.Sprintf("/groups/%d/devices/%d", groupID, spareID)))
+	deleteResource(t, "/devices", spareID)
+	assert.Len(t, getJSON[[]models.Device](t, fmt.Sprintf("/groups/%d/devices", groupID)), 2)
+}
+
+func TestDevices_Queues(t *testing.T) {
+	mockDevice, _ := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
+
+	actionID := createResource(t, "/actions", `{"name":"gate-open","path":"gate_open","params":"{}"}`)
+	deviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"gate","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		mockDevice.Listener.Addr().String()), actionID)
+	t.Cleanup(func() {
+		deleteResource(t, "/devices", deviceID)
+		deleteResource(t, "/actions", actionID)
+	})
+
+	resp, err := http.Post(baseURL+"/execute", "application/json", bytes.NewBufferString(fmt.Sprintf(`{"deviceId": %d, "actionId": %d}`, deviceID, actionID)))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	resp.Body.Close() // nolint
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var found bool
+	for _, queue := range getAllResources[service.QueueStatus](t, "/devices/queues") {
+		if queue.DeviceID == deviceID {
+			found = true
+			assert.False(t, queue.Busy)
+			assert.Zero(t, queue.Depth)
+			assert.EqualValues(t, 1, queue.Executed)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestDevices_Health(t *testing.T) {
+	mockDevice, _ := newMockDevice(t, `{"jsonrpc":"2.0","result":"pong","id":1}`)
+
+	deviceID := createResource(t, "/devices", fmt.Sprintf(
+		`{"name":"heartbeat","type":"sensor","chip":"esp32","board":"devkit","ip":"%s"}`,
+		mockDevice.Listener.Addr().String()))
+	t.Cleanup(func() { deleteResource(t, "/devices", deviceID) })
+
+	require.Eventually(t, func() bool {
+		device := getResource[models.Device](t, "/devices", deviceID)
+		return device.Status == models.StatusOnline && device.LastSeen != ""
+	}, 10*time.Second, 200*time.Millisecond)
+
+	var listed bool
+	for _, device := range getAllResources[models.Device](t, "/devices") {
+		if device.ID == deviceID {
+			listed = true
+			assert.Equal(t, models.StatusOnline, device.Status)
+		}
+	}
+	assert.True(t, listed)
+
+	mockDevice.Close()
+	require.Eventually(t, func() bool {
+		return getResource[models.Device](t, "/devices", deviceID).Status == models.StatusOffline
+	}, 10*time.Second, 200*time.Millisecond)
+}
+
+func TestDevices_Discovery(t *testing.T) {
+	mockDevice, _ := newMockDevice(t, `{"jsonrpc":"2.0","result":"pong","id":1}`)
+	_, port, err := net.SplitHostPort(mockDevice.Listener.Addr().String())
+	require.NoError(t, err)
+	startDiscoveryResponder(t, discoveryTarget, fmt.Sprintf(`{"name":"found-sensor","type":"sensor","chip":"esp32","board":"devkit","port":%s}`, port))
+
+	resp, err := http.Post(baseURL+"/devices/discover", "application/json", nil)
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer resp.Body.Close() // nolint
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var found []service.DiscoveredDevice
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&found))
+	require.Len(t, found, 1)
+	assert.Equal(t, "found-sensor", found[0].Name)
+	assert.Equal(t, "127.0.0.1", found[0].IP)
+
+	adoptResp, err := http.Post(fmt.Sprintf("%s/devices/unclaimed/%d/adopt", baseURL, found[0].ID), "application/json", bytes.NewBufferString(`{"name":"greenhouse"}`))
+	if err != nil {
+		checkServerError(t, err)
+	}
+	defer adoptResp.Body.Close() // nolint
+	require.Equal(t, http.StatusCreated, adoptResp.StatusCode)
+
+	var created struct {
+		ID int `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(adoptResp.Body).Decode(&created))
+	t.Cleanup(func() { deleteResource(t, "/devices", created.ID) })
+
+	device := getResource[models.Device](t, "/devices", created.ID)
+	assert.Equal(t, "greenhouse", device.Name)
+	assert.Equal(t, "esp32", device.Chip)
+	assert.Equal(t, "127.0.0.1", device.IP)
+	assert.Equal(t, port, fmt.Sprint(device.Port))
+
+	assert.Empty(t, getAllResources[service.DiscoveredDevice](t, "/devices/unclaimed"))
+}
+
+func TestDevices_ReportedState(t *testing.T) {
+	const token = "leak-sensor-token-0001"
+	valve, valveReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"closed":true},"id":1}`)
+
+	closeID := createResource(t, "/actions", `{"name":"close-valve","path":"close"}`)
+	valveID := createDevice(t, fmt.Sprintf(
+		`{"name":"main-valve","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		valve.Listener.Addr().String()), closeID)
+	sensorID := createResource(t, "/devices", fmt.Sprintf(
+		`{"name":"leak-sensor","type":"sensor","chip":"esp32","board":"devkit","ip":"%s","ingest_token":"%s"}`,
+		unreachableAddr(t), token))
+
+	report := func(token, body string) int {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/devices/%d/events", baseURL, sensorID), bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			checkServerError(t, err)
+		}
+		resp.Body.Close() // nolint
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, report("wrong-token", `{"water":3}`))
+	require.Equal(t, http.StatusNoContent, report(token, `{"water":3}`))
+
+	sensor := getResource[map[string]any](t, "/devices", sensorID)
+	assert.JSONEq(t, `{"water":3}`, sensor["reported_state"].(string))
+	assert.NotEmpty(t, sensor["reported_at"])
+	assert.NotContains(t, sensor, "ingest_token")
+
+	defYAML, err := yaml.Marshal(models.AutomationDefinition{
+		Interval: "1s",
+		Triggers: []models.AutomationTrigger{{
+			Device:     "leak-sensor",
+			Source:     models.TriggerSourceReported,
+			MaxAge:     "1m",
+			Conditions: []models.AutomationCondition{{Field: "water", Operator: ">", Threshold: 0}},
+		}},
+		Actions: []models.AutomationAction{{Device: "main-valve", Action: "close-valve"}},
+	})
+	require.NoError(t, err)
+	body, err := json.Marshal(map[string]any{"name": "leak-shutoff", "enabled": true, "definition": string(defYAML)})
+	require.NoError(t, err)
+	automationID := createResource(t, "/automations", string(body))
+
+	require.Eventually(t, func() bool {
+		return valveReq.Get().Body.Method == "close"
+	}, 10*time.Second, 200*time.Millisecond, "automation should have closed the valve")
+
+	t.Cleanup(func() {
+		deleteResource(t, "/automations", automationID)
+		deleteResource(t, "/devices", sensorID)
+		deleteResource(t, "/devices", valveID)
+		deleteResource(t, "/actions", closeID)
+	})
+}
+
+func TestAutomations_Events(t *testing.T) {
+	const token = "event-sensor-token-0001"
+	valve, valveReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"closed":true},"id":1}`)
+	light, lightReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"on":true},"id":1}`)
+	chime, chimeReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"rung":true},"id":1}`)
+
+	closeID := createResource(t, "/actions", `{"name":"close-event-valve","path":"close"}`)
+	lightOnID := createResource(t, "/actions", `{"name":"light-on","path":"light_on"}`)
+	ringID := createResource(t, "/actions", `{"name":"ring","path":"ring"}`)
+	valveID := createDevice(t, fmt.Sprintf(
+		`{"name":"event-valve","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		valve.Listener.Addr().String()), closeID)
+	lightID := createDevice(t, fmt.Sprintf(
+		`{"name":"event-light","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		light.Listener.Addr().String()), lightOnID)
+	chimeID := createDevice(t, fmt.Sprintf(
+		`{"name":"event-chime","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`,
+		chime.Listener.Addr().String()), ringID)
+	sensorID := createResource(t, "/devices", fmt.Sprintf(
+		`{"name":"event-sensor","type":"sensor","chip":"esp32","board":"devkit","ip":"%s","ingest_token":"%s"}`,
+		unreachableAddr(t), token))
+
+	createAutomation := func(name string, def models.AutomationDefinition) int {
+		defYAML, err := yaml.Marshal(def)
+		require.NoError(t, err)
+		body, err := json.Marshal(map[string]any{"name": name, "enabled": true, "definition": string(defYAML)})
+		require.NoError(t, err)
+		return createResource(t, "/automations", string(body))
+	}
+	post := func(path, token, body string) int {
+		req, err := http.NewRequest(http.MethodPost, baseURL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			checkServerError(t, err)
+		}
+		resp.Body.Close() // nolint
+		return resp.StatusCode
+	}
+
+	leakID := createAutomation("leak-event", models.AutomationDefinition{
+		Events: []models.AutomationEvent{{
+			Type:       models.EventTypeDeviceReported,
+			Device:     "event-sensor",
+			Conditions: []models.AutomationCondition{{Field: "water", Operator: ">", Threshold: 0}},
+		}},
+		Actions: []models.AutomationAction{{Device: "event-valve", Action: "close-event-valve"}},
+	})
+	afterLeakID := createAutomation("after-leak", models.AutomationDefinition{
+		Events:  []models.AutomationEvent{{Type: models.EventTypeAutomationFinished, Automation: "leak-event"}},
+		Actions: []models.AutomationAction{{Device: "event-light", Action: "light-on"}},
+	})
+	doorbellID := createAutomation("doorbell", models.AutomationDefinition{
+		Events:  []models.AutomationEvent{{Type: models.EventTypeWebhook, Webhook: "doorbell"}},
+		Actions: []models.AutomationAction{{Device: "event-chime", Action: "ring"}},
+	})
+
+	t.Cleanup(func() {
+		deleteResource(t, "/automations", doorbellID)
+		deleteResource(t, "/automations", afterLeakID)
+		deleteResource(t, "/automations", leakID)
+		deleteResource(t, "/devices", sensorID)
+		deleteResource(t, "/devices", chimeID)
+		deleteResource(t, "/devices", lightID)
+		deleteResource(t, "/devices", valveID)
+		deleteResource(t, "/actions", ringID)
+		deleteResource(t, "/actions", lightOnID)
+		deleteResource(t, "/actions", closeID)
+	})
+
+	t.Run("pushed state runs the automation and its follow-up", func(t *testing.T) {
+		require.Equal(t, http.StatusNoContent, post(fmt.Sprintf("/devices/%d/events", sensorID), token, `{"water":2}`))
+
+		require.Eventually(t, func() bool {
+			return valveReq.Get().Body.Method == "close"
+		}, 5*time.Second, 50*time.Millisecond, "leak event should have closed the valve")
+		require.Eventually(t, func() bool {
+			return lightReq.Get().Body.Method == "light_on"
+		}, 5*time.Second, 50*time.Millisecond, "finished leak automation should have turned on the light")
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, post("/webhooks/garage", "", ""))
+
+		require.Equal(t, http.StatusAccepted, post("/webhooks/doorbell", "", `{"pressed":1}`))
+		require.Eventually(t, func() bool {
+			return chimeReq.Get().Body.Method == "ring"
+		}, 5*time.Second, 50*time.Millisecond, "webhook should have rung the chime")
+	})
+}
+
 func TestAutomations_DefinitionValidation(t *testing.T) {
 	readTempID := createResource(t, "/actions", `{"name":"read-temp","path":"read_temp","params":"{}"}`)
 	turnOnID := createResource(t, "/actions", `{"name":"turn-on","path":"turn_on","params":"{}"}`)
 	unassignedActionID := createResource(t, "/actions", `{"name":"unassigned-action","path":"unassigned","params":"{}"}`)
 
 	triggerDevice, triggerReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"temperature":30},"id":1}`)
-	triggerDeviceID := createResource(t, "/devices", fmt.Sprintf(
-		`{"name":"sensor-1","type":"sensor","chip":"esp32","board":"devkit","ip":"%s","actions":"[%d]"}`, triggerDevice.Listener.Addr().String(), readTempID))
+	triggerDeviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"sensor-1","type":"sensor","chip":"esp32","board":"devkit","ip":"%s"}`, triggerDevice.Listener.Addr().String()), readTempID)
 
 	actionDevice, actionReq := newMockDevice(t, `{"jsonrpc":"2.0","result":{"ok":true},"id":1}`)
-	actionDeviceID := createResource(t, "/devices", fmt.Sprintf(
-		`{"name":"actuator-1","type":"actuator","chip":"esp32","board":"devkit","ip":"%s","actions":"[%d]"}`, actionDevice.Listener.Addr().String(), turnOnID))
+	actionDeviceID := createDevice(t, fmt.Sprintf(
+		`{"name":"actuator-1","type":"actuator","chip":"esp32","board":"devkit","ip":"%s"}`, actionDevice.Listener.Addr().String()), turnOnID)
 
 	tests := []struct {
 		name               string
@@ -324,6 +876,13 @@ func TestAutomations_DefinitionValidation(t *testing.T) {
 			actions:  []models.AutomationAction{{Device: "actuator-1", Action: "unassigned-action"}},
 			wantCode: http.StatusBadRequest,
 		},
+		{
+			name:     "sun window without a site",
+			interval: "5m",
+			triggers: []models.AutomationTrigger{{Time: &models.TimeWindow{Sun: models.SunUp}}},
+			actions:  []models.AutomationAction{{Device: "actuator-1", Action: "turn-on"}},
+			wantCode: http.StatusBadRequest,
+		},
 		{
 			name:     "valid definition succeeds",
 			interval: "1s",
@@ -339,7 +898,7 @@ func TestAutomations_DefinitionValidation(t *testing.T) {
 				assert.Equal(t, "application/json", snap.ContentType)
 				assert.Equal(t, "2.0", snap.Body.JSONRPC)
 				assert.Equal(t, "read_temp", snap.Body.Method)
-				assert.Equal(t, 1, snap.Body.ID)
+				assert.NotZero(t, snap.Body.ID)
 			},
 			validateActionReq: func(t *testing.T) {
 				snap := actionReq.Get()
@@ -348,7 +907,7 @@ func TestAutomations_DefinitionValidation(t *testing.T) {
 				assert.Equal(t, "application/json", snap.ContentType)
 				assert.Equal(t, "2.0", snap.Body.JSONRPC)
 				assert.Equal(t, "turn_on", snap.Body.Method)
-				assert.Equal(t, 1, snap.Body.ID)
+				assert.NotZero(t, snap.Body.ID)
 			},
 		},
 	}
@@ -15,6 +15,10 @@ const API = {
     const text = await res.text();
     return text ? JSON.parse(text) : {};
   },
+  async put(path) {
+    const res = await fetch(path, { method: 'PUT' });
+    if (!res.ok) throw new Error(await res.text());
+  },
   async del(path) {
     const res = await fetch(path, { method: 'DELETE' });
     if (!res.ok) throw new Error(await res.text());
@@ -23,8 +27,12 @@ const API = {
 
 // ============ State ============
 let devices = [];
+let unclaimed = [];
 let actions = [];
+let deviceActions = [];
 let automations = [];
+let groups = [];
+let groupDevices = [];
 
 // ============ Helpers ============
 function showBanner(id, msg, type) {
@@ -34,11 +42,6 @@ function showBanner(id, msg, type) {
   setTimeout(() => { el.className = 'banner'; }, 4000);
 }
 
-function parseActions(actionsStr) {
-  if (!actionsStr || actionsStr === '') return [];
-  try { return JSON.parse(actionsStr); } catch { return []; }
-}
-
 function actionNamesByIds(ids) {
   return ids.map(id => {
     const a = actions.find(a => a.id === id);
@@ -46,12 +49,47 @@ function actionNamesByIds(ids) {
   });
 }
 
+function actionIdsForDevice(deviceId) {
+  return deviceActions.filter(da => da.device_id === deviceId).map(da => da.action_id);
+}
+
 function getActionsForDevice(device) {
-  const ids = parseActions(device.actions);
+  const ids = actionIdsForDevice(device.id);
   return actions.filter(a => ids.includes(a.id));
 }
 
-function populateDeviceSelect(selectEl, selectedName) {
+// renameReferenced renames a record through the rename endpoint when automations
+// refer to it, so their definitions follow. Returns false if the user backs out.
+async function renameReferenced(path, id, oldName, newName) {
+  if (!id || oldName === undefined || oldName === newName) return true;
+  const deps = await API.get(`${path}/${id}/dependents`);
+  if (deps.automations.length === 0) return true;
+  const names = deps.automations.map(a => a.name).join(', ');
+  if (!confirm(`'${oldName}' is used by automations ${names}. Rename it there too?`)) return false;
+  await API.post(`${path}/${id}/rename`, { name: newName });
+  return true;
+}
+
+// schemaFields lists the dotted paths of the properties declared in a result schema.
+function schemaFields(schema, prefix = '') {
+  if (!schema || typeof schema !== 'object' || !schema.properties) return [];
+  return Object.entries(schema.properties).flatMap(([name, prop]) => {
+    const path = prefix + name;
+    const nested = schemaFields(prop, path + '.');
+    return nested.length ? nested : [path];
+  });
+}
+
+function resultFieldsForAction(actionName) {
+  const a = actions.find(a => a.name === actionName);
+  if (!a || !a.result_schema) return [];
+  try { return schemaFields(JSON.parse(a.result_schema)); } catch { return []; }
+}
+
+// Group targets are kept in device selects as "group:<name>".
+const GROUP_PREFIX = 'group:';
+
+function populateDeviceSelect(selectEl, selectedName, withGroups) {
   selectEl.innerHTML = '<option value="">Select device...</option>';
   devices.forEach(d => {
     const opt = document.createElement('option');
@@ -60,14 +98,35 @@ function populateDeviceSelect(selectEl, selectedName) {
     if (d.name === selectedName) opt.selected = true;
     selectEl.appendChild(opt);
   });
+  if (!withGroups || groups.length === 0) return;
+  const optgroup = document.createElement('optgroup');
+  optgroup.label = 'Groups';
+  groups.forEach(g => {
+    const opt = document.createElement('option');
+    opt.value = GROUP_PREFIX + g.name;
+    opt.textContent = g.name;
+    if (opt.value === selectedName) opt.selected = true;
+    optgroup.appendChild(opt);
+  });
+  selectEl.appendChild(optgroup);
+}
+
+// splitTarget turns a device select value into the device or group of a trigger or action.
+function splitTarget(value) {
+  if (value.startsWith(GROUP_PREFIX)) return { device: '', group: value.slice(GROUP_PREFIX.length) };
+  return { device: value, group: '' };
 }
 
 function populateActionSelect(selectEl, device, selectedName) {
   selectEl.innerHTML = '<option value="">Select action...</option>';
   if (!device) return;
-  const dev = devices.find(d => d.name === device || d.id === device);
-  if (!dev) return;
-  const devActions = getActionsForDevice(dev);
+  // Members of a group can have different actions, so offer all of them
+  let devActions = actions;
+  if (!String(device).startsWith(GROUP_PREFIX)) {
+    const dev = devices.find(d => d.name === device || d.id === device);
+    if (!dev) return;
+    devActions = getActionsForDevice(dev);
+  }
   devActions.forEach(a => {
     const opt = document.createElement('option');
     opt.value = a.name;
@@ -92,16 +151,26 @@ async function loadTab(tab) {
   try {
     if (tab === 'devices' || tab === 'automations' || tab === 'execute') {
       actions = await API.get('/actions');
+      deviceActions = await API.get('/devices/actions');
     }
     if (tab === 'devices') {
       devices = await API.get('/devices');
+      unclaimed = await API.get('/devices/unclaimed');
       renderDevices();
+      renderUnclaimed();
       renderDeviceActionCheckboxes();
+    } else if (tab === 'groups') {
+      devices = await API.get('/devices');
+      groups = await API.get('/groups');
+      groupDevices = await API.get('/groups/devices');
+      renderGroups();
+      renderGroupDeviceCheckboxes();
     } else if (tab === 'actions') {
       actions = await API.get('/actions');
       renderActions();
     } else if (tab === 'automations') {
       devices = await API.get('/devices');
+      groups = await API.get('/groups');
       automations = await API.get('/automations');
       renderAutomations();
     } else if (tab === 'execute') {
@@ -132,12 +201,18 @@ function renderActions() {
 document.getElementById('actions-form').addEventListener('submit', async (e) => {
   e.preventDefault();
   const id = document.getElementById('action-id').value;
+  // Updates replace the whole action, so keep fields the form doesn't edit
+  const existing = actions.find(a => a.id === Number(id));
   const body = {
+    ...existing,
     name: document.getElementById('action-name').value,
     path: document.getElementById('action-path').value,
     params: document.getElementById('action-params').value || '',
+    params_schema: document.getElementById('action-params-schema').value || '',
+    result_schema: document.getElementById('action-result-schema').value || '',
   };
   try {
+    if (!(await renameReferenced('/actions', id, existing?.name, body.name))) return;
     if (id) {
       await API.post('/actions/' + id, body);
     } else {
@@ -158,6 +233,8 @@ function editAction(id) {
   document.getElementById('action-name').value = a.name;
   document.getElementById('action-path').value = a.path;
   document.getElementById('action-params').value = a.params || '';
+  document.getElementById('action-params-schema').value = a.params_schema || '';
+  document.getElementById('action-result-schema').value = a.result_schema || '';
   document.getElementById('actions-form-title').textContent = 'Edit Action';
 }
 
@@ -182,15 +259,16 @@ function resetActionForm() {
 function renderDevices() {
   const tbody = document.getElementById('devices-table');
   tbody.innerHTML = devices.map(d => {
-    const ids = parseActions(d.actions);
-    const names = actionNamesByIds(ids);
+    const names = actionNamesByIds(actionIdsForDevice(d.id));
     return `
       <tr>
         <td>${esc(d.name)}</td>
         <td>${esc(d.type)}</td>
+        <td>${(d.tags || []).map(t => esc(t)).join(', ')}</td>
         <td>${esc(d.chip)}</td>
         <td>${esc(d.board)}</td>
         <td>${esc(d.ip)}</td>
+        <td>${deviceStatusBadge(d)}</td>
         <td>${names.map(n => esc(n)).join(', ')}</td>
         <td>
           <button class="btn btn-secondary btn-sm" onclick="editDevice(${d.id})">Edit</button>
@@ -201,6 +279,53 @@ function renderDevices() {
   }).join('');
 }
 
+function deviceStatusBadge(d) {
+  if (!d.status) return '-';
+  const title = d.last_seen ? `Last seen ${formatTime(d.last_seen)} (${d.latency_ms} ms)` : 'Never seen';
+  const cls = d.status === 'online' ? 'badge-on' : 'badge-off';
+  return `<span class="badge ${cls}" title="${esc(title)}">${esc(d.status.toUpperCase())}</span>`;
+}
+
+function renderUnclaimed() {
+  const tbody = document.getElementById('unclaimed-table');
+  tbody.innerHTML = unclaimed.map(d => `
+    <tr>
+      <td>${esc(d.name)}</td>
+      <td>${esc(d.type)}</td>
+      <td>${esc(d.chip)}</td>
+      <td>${esc(d.ip)}</td>
+      <td>${d.port || ''}</td>
+      <td>
+        <button class="btn btn-secondary btn-sm" onclick="adoptDevice(${d.id})">Adopt</button>
+      </td>
+    </tr>
+  `).join('');
+}
+
+document.getElementById('discover-btn').addEventListener('click', async () => {
+  try {
+    unclaimed = await API.post('/devices/discover', {});
+    renderUnclaimed();
+    showBanner('devices-banner', `Found ${unclaimed.length} unclaimed device(s)`, 'success');
+  } catch (e) {
+    showBanner('devices-banner', e.message, 'error');
+  }
+});
+
+async function adoptDevice(id) {
+  try {
+    await API.post('/devices/unclaimed/' + id + '/adopt', {});
+    await loadTab('devices');
+    showBanner('devices-banner', 'Device adopted', 'success');
+  } catch (e) {
+    showBanner('devices-banner', e.message, 'error');
+  }
+}
+
+function parseTagInput(str) {
+  return str.split(',').map(t => t.trim()).filter(t => t !== '');
+}
+
 function renderDeviceActionCheckboxes() {
   const container = document.getElementById('device-actions-checkboxes');
   container.innerHTML = actions.map(a => `
@@ -212,19 +337,31 @@ document.getElementById('devices-form').addEventListener('submit', async (e) =>
   e.preventDefault();
   const id = document.getElementById('device-id').value;
   const checkedIds = [...document.querySelectorAll('.device-action-cb:checked')].map(cb => Number(cb.value));
+  // Updates replace the whole device, so keep fields the form doesn't edit
+  const existing = devices.find(d => d.id === Number(id));
   const body = {
+    ...existing,
     name: document.getElementById('device-name').value,
     type: document.getElementById('device-type').value,
     chip: document.getElementById('device-chip').value,
     board: document.getElementById('device-board').value,
     ip: document.getElementById('device-ip').value,
-    actions: JSON.stringify(checkedIds),
+    tags: parseTagInput(document.getElementById('device-tags').value),
   };
   try {
+    if (!(await renameReferenced('/devices', id, existing?.name, body.name))) return;
+    let deviceId = Number(id);
     if (id) {
       await API.post('/devices/' + id, body);
     } else {
-      await API.post('/devices', body);
+      deviceId = (await API.post('/devices', body)).id;
+    }
+    const assigned = actionIdsForDevice(deviceId);
+    for (const actionId of checkedIds.filter(a => !assigned.includes(a))) {
+      await API.put(`/devices/${deviceId}/actions/${actionId}`);
+    }
+    for (const actionId of assigned.filter(a => !checkedIds.includes(a))) {
+      await API.del(`/devices/${deviceId}/actions/${actionId}`);
     }
     resetDeviceForm();
     await loadTab('devices');
@@ -243,8 +380,9 @@ function editDevice(id) {
   document.getElementById('device-chip').value = d.chip;
   document.getElementById('device-board').value = d.board;
   document.getElementById('device-ip').value = d.ip;
+  document.getElementById('device-tags').value = (d.tags || []).join(', ');
   document.getElementById('devices-form-title').textContent = 'Edit Device';
-  const ids = parseActions(d.actions);
+  const ids = actionIdsForDevice(d.id);
   document.querySelectorAll('.device-action-cb').forEach(cb => {
     cb.checked = ids.includes(Number(cb.value));
   });
@@ -268,6 +406,102 @@ function resetDeviceForm() {
   document.querySelectorAll('.device-action-cb').forEach(cb => cb.checked = false);
 }
 
+// ============ GROUPS CRUD ============
+function deviceIdsForGroup(groupId) {
+  return groupDevices.filter(gd => gd.group_id === groupId).map(gd => gd.device_id);
+}
+
+function renderGroups() {
+  const tbody = document.getElementById('groups-table');
+  tbody.innerHTML = groups.map(g => {
+    const names = deviceIdsForGroup(g.id).map(id => {
+      const d = devices.find(d => d.id === id);
+      return d ? d.name : `#${id}`;
+    });
+    return `
+      <tr>
+        <td>${esc(g.name)}</td>
+        <td>${esc(g.description || '')}</td>
+        <td>${names.map(n => esc(n)).join(', ')}</td>
+        <td>
+          <button class="btn btn-secondary btn-sm" onclick="editGroup(${g.id})">Edit</button>
+          <button class="btn btn-danger btn-sm" onclick="deleteGroup(${g.id})">Delete</button>
+        </td>
+      </tr>
+    `;
+  }).join('');
+}
+
+function renderGroupDeviceCheckboxes() {
+  const container = document.getElementById('group-devices-checkboxes');
+  container.innerHTML = devices.map(d => `
+    <label><input type="checkbox" value="${d.id}" class="group-device-cb"> ${esc(d.name)}</label>
+  `).join('');
+}
+
+document.getElementById('groups-form').addEventListener('submit', async (e) => {
+  e.preventDefault();
+  const id = document.getElementById('group-id').value;
+  const checkedIds = [...document.querySelectorAll('.group-device-cb:checked')].map(cb => Number(cb.value));
+  const body = {
+    name: document.getElementById('group-name').value,
+    description: document.getElementById('group-description').value,
+  };
+  try {
+    const existing = groups.find(g => g.id === Number(id));
+    if (!(await renameReferenced('/groups', id, existing?.name, body.name))) return;
+    let groupId = Number(id);
+    if (id) {
+      await API.post('/groups/' + id, body);
+    } else {
+      groupId = (await API.post('/groups', body)).id;
+    }
+    const members = deviceIdsForGroup(groupId);
+    for (const deviceId of checkedIds.filter(d => !members.includes(d))) {
+      await API.put(`/groups/${groupId}/devices/${deviceId}`);
+    }
+    for (const deviceId of members.filter(d => !checkedIds.includes(d))) {
+      await API.del(`/groups/${groupId}/devices/${deviceId}`);
+    }
+    resetGroupForm();
+    await loadTab('groups');
+    showBanner('groups-banner', 'Group saved', 'success');
+  } catch (e) {
+    showBanner('groups-banner', e.message, 'error');
+  }
+});
+
+function editGroup(id) {
+  const g = groups.find(g => g.id === id);
+  if (!g) return;
+  document.getElementById('group-id').value = g.id;
+  document.getElementById('group-name').value = g.name;
+  document.getElementById('group-description').value = g.description || '';
+  document.getElementById('groups-form-title').textContent = 'Edit Group';
+  const ids = deviceIdsForGroup(g.id);
+  document.querySelectorAll('.group-device-cb').forEach(cb => {
+    cb.checked = ids.includes(Number(cb.value));
+  });
+}
+
+async function deleteGroup(id) {
+  if (!confirm('Delete this group?')) return;
+  try {
+    await API.del('/groups/' + id);
+    await loadTab('groups');
+    showBanner('groups-banner', 'Group deleted', 'success');
+  } catch (e) {
+    showBanner('groups-banner', e.message, 'error');
+  }
+}
+
+function resetGroupForm() {
+  document.getElementById('groups-form').reset();
+  document.getElementById('group-id').value = '';
+  document.getElementById('groups-form-title').textContent = 'Add Group';
+  document.querySelectorAll('.group-device-cb').forEach(cb => cb.checked = false);
+}
+
 // ============ EXECUTE ============
 function populateExecDropdowns() {
   const devSel = document.getElementById('exec-device');
@@ -319,7 +553,10 @@ function renderAutomations() {
     try {
       const lines = a.definition.split('\n');
       const line = lines.find(l => l.startsWith('interval:'));
+      const schedule = parseSimpleYAML(a.definition).schedule;
       if (line) interval = line.split(':')[1].trim().replace(/"/g, '');
+      else if (schedule.length > 0) interval = schedule.join(', ');
+      else if (lines.some(l => l.startsWith('events:'))) interval = 'on event';
     } catch {}
     return `
       <tr>
@@ -329,6 +566,7 @@ function renderAutomations() {
         <td>${formatTime(a.last_check)}</td>
         <td>${formatTime(a.last_action_run)}</td>
         <td>
+          <button class="btn btn-secondary btn-sm" onclick="dryRunAutomation(${a.id})">Dry Run</button>
           <button class="btn btn-secondary btn-sm" onclick="editAutomation(${a.id})">Edit</button>
           <button class="btn btn-danger btn-sm" onclick="deleteAutomation(${a.id})">Delete</button>
         </td>
@@ -356,6 +594,25 @@ async function deleteAutomation(id) {
   }
 }
 
+// dryRunAutomation shows whether the automation would run now and why, without
+// running its actions.
+async function dryRunAutomation(id) {
+  const el = document.getElementById('dry-run-response');
+  el.style.display = '';
+  try {
+    const res = await API.post(`/automations/${id}/dry-run`);
+    el.textContent = JSON.stringify(res, null, 2);
+  } catch (e) {
+    el.textContent = 'Error: ' + e.message;
+  }
+}
+
+// usesNestedLogic reports whether a definition has logic the builder can't show:
+// condition blocks, a logic tree or named triggers.
+function usesNestedLogic(yamlStr) {
+  return /^\s*(- )?(all|any|not):/m.test(yamlStr) || /^logic:/m.test(yamlStr) || /^  - name:/m.test(yamlStr);
+}
+
 function editAutomation(id) {
   const a = automations.find(a => a.id === id);
   if (!a) return;
@@ -364,6 +621,9 @@ function editAutomation(id) {
   document.getElementById('auto-enabled').checked = a.enabled;
   document.getElementById('automations-form-title').textContent = 'Edit Automation';
   populateBuilderFromYAML(a.definition);
+  if (usesNestedLogic(a.definition)) {
+    showBanner('automations-banner', 'This automation uses all/any/not blocks or a logic tree, which the builder cannot show; saving it here drops them', 'error');
+  }
 }
 
 function resetAutomationForm() {
@@ -371,63 +631,122 @@ function resetAutomationForm() {
   document.getElementById('automation-id').value = '';
   document.getElementById('auto-enabled').checked = true;
   document.getElementById('automations-form-title').textContent = 'Add Automation';
+  document.getElementById('events-container').innerHTML = '';
   document.getElementById('triggers-container').innerHTML = '';
   document.getElementById('auto-actions-container').innerHTML = '';
   updateYAMLPreview();
 }
 
+function validateConditionRows(section) {
+  for (const row of section.querySelectorAll('.condition-row')) {
+    const fieldInput = row.querySelector('.cond-field');
+    if (!fieldInput.value.trim()) {
+      fieldInput.classList.add('invalid');
+      return 'Condition field cannot be empty';
+    }
+    const threshInput = row.querySelector('.cond-threshold');
+    if (threshInput.value.trim() === '') {
+      threshInput.classList.add('invalid');
+      return 'Condition threshold is required';
+    }
+    const threshold = parseThreshold(threshInput.value);
+    const op = row.querySelector('.cond-op').value;
+    if (['>', '<', '>=', '<='].includes(op) && (threshold === null || typeof threshold === 'boolean')) {
+      threshInput.classList.add('invalid');
+      return `Operator ${op} cannot compare ${threshold === null ? 'null' : 'a boolean'}: use == or !=`;
+    }
+  }
+  return null;
+}
+
 function validateAutomationForm() {
   // Clear previous invalid markers
   document.querySelectorAll('#automations-form .invalid').forEach(el => el.classList.remove('invalid'));
 
-  // Validate interval
+  // Validate interval, which is optional when the automation runs on a schedule or events
   const intervalInput = document.getElementById('auto-interval');
   const interval = intervalInput.value.trim();
-  if (!interval) {
-    intervalInput.classList.add('invalid');
-    return 'Interval is required';
+  const scheduleInput = document.getElementById('auto-schedule');
+  const schedule = splitSchedule(scheduleInput.value);
+  const eventSections = document.querySelectorAll('#events-container .dynamic-section');
+  if (interval && schedule.length > 0) {
+    scheduleInput.classList.add('invalid');
+    return 'Interval and schedule cannot be combined';
   }
-  const match = interval.match(/^(\d+)(ms|[smh])$/);
-  if (!match) {
-    intervalInput.classList.add('invalid');
-    return "Interval must be a valid duration (e.g. '5m', '1h', '30s')";
+  for (const expr of schedule) {
+    const fields = expr.split(/\s+/).length;
+    if (!expr.startsWith('@') && !SUN_TIME.test(expr) && fields !== 5 && fields !== 6) {
+      scheduleInput.classList.add('invalid');
+      return `Schedule '${expr}' must be a cron expression with 5 or 6 fields, or a sun time like 'sunset-30m'`;
+    }
   }
-  const num = parseInt(match[1], 10);
-  const unit = match[2];
-  if ((unit === 's' && num < 1) || (unit === 'ms' && num < 1000)) {
+  if (!interval && schedule.length === 0 && eventSections.length === 0) {
     intervalInput.classList.add('invalid');
-    return 'Interval must be at least 1s';
+    return 'Interval is required unless the automation runs on a schedule or events';
+  }
+  if (interval) {
+    const match = interval.match(/^(\d+)(ms|[smh])$/);
+    if (!match) {
+      intervalInput.classList.add('invalid');
+      return "Interval must be a valid duration (e.g. '5m', '1h', '30s')";
+    }
+    const num = parseInt(match[1], 10);
+    const unit = match[2];
+    if ((unit === 's' && num < 1) || (unit === 'ms' && num < 1000)) {
+      intervalInput.classList.add('invalid');
+      return 'Interval must be at least 1s';
+    }
+  }
+
+  // Validate events (optional, conditions on the event data are optional too)
+  for (const sec of eventSections) {
+    const type = sec.querySelector('.event-type').value;
+    if (type === 'automation_finished') {
+      const automationSel = sec.querySelector('.event-automation');
+      if (!automationSel.value) {
+        automationSel.classList.add('invalid');
+        return 'Each automation_finished event must have an automation selected';
+      }
+    } else if (type === 'webhook') {
+      const webhookInput = sec.querySelector('.event-webhook');
+      if (!/^[A-Za-z0-9_-]+$/.test(webhookInput.value.trim())) {
+        webhookInput.classList.add('invalid');
+        return "Webhook name is required and may only contain letters, digits, '-' and '_'";
+      }
+    } else {
+      const deviceSel = sec.querySelector('.event-device');
+      if (!deviceSel.value) {
+        deviceSel.classList.add('invalid');
+        return 'Each device event must have a device selected';
+      }
+    }
+    const condError = validateConditionRows(sec);
+    if (condError) return condError;
   }
 
   // Validate triggers (optional, but if present must be complete)
   const triggerSections = document.querySelectorAll('#triggers-container .dynamic-section');
   for (const sec of triggerSections) {
+    if (sec.classList.contains('time-window')) {
+      const timeError = validateTimeWindow(sec);
+      if (timeError) return timeError;
+      continue;
+    }
     const deviceSel = sec.querySelector('.trigger-device');
     if (!deviceSel.value) {
       deviceSel.classList.add('invalid');
       return 'Each trigger must have a device selected';
     }
     const actionSel = sec.querySelector('.trigger-action');
-    if (!actionSel.value) {
+    if (sec.querySelector('.trigger-source').value !== 'reported' && !actionSel.value) {
       actionSel.classList.add('invalid');
       return 'Each trigger must have an action selected';
     }
-    const condRows = sec.querySelectorAll('.condition-row');
-    if (condRows.length === 0) {
+    if (sec.querySelectorAll('.condition-row').length === 0) {
       return 'Each trigger must have at least one condition';
     }
-    for (const row of condRows) {
-      const fieldInput = row.querySelector('.cond-field');
-      if (!fieldInput.value.trim()) {
-        fieldInput.classList.add('invalid');
-        return 'Condition field cannot be empty';
-      }
-      const threshInput = row.querySelector('.cond-threshold');
-      if (threshInput.value === '' || isNaN(parseFloat(threshInput.value))) {
-        threshInput.classList.add('invalid');
-        return 'Condition threshold is required';
-      }
-    }
+    const condError = validateConditionRows(sec);
+    if (condError) return condError;
   }
 
   // Validate actions (required)
@@ -467,6 +786,8 @@ document.getElementById('automations-form').addEventListener('submit', async (e)
     definition: yaml,
   };
   try {
+    const existing = automations.find(a => a.id === Number(id));
+    if (!(await renameReferenced('/automations', id, existing?.name, body.name))) return;
     if (id) {
       await API.post('/automations/' + id, body);
     } else {
@@ -481,9 +802,110 @@ document.getElementById('automations-form').addEventListener('submit', async (e)
 });
 
 // ============ AUTOMATION BUILDER ============
+let eventCount = 0;
 let triggerCount = 0;
 let autoActionCount = 0;
 
+const EVENT_TYPES = ['device_reported', 'device_offline', 'device_online', 'automation_finished', 'webhook'];
+
+function addEvent(data) {
+  const idx = eventCount++;
+  const div = document.createElement('div');
+  div.className = 'dynamic-section';
+  div.dataset.eventIdx = idx;
+  div.innerHTML = `
+    <div class="section-header">
+      <span>Event #${idx + 1}</span>
+      <button type="button" class="btn btn-danger btn-sm" onclick="removeEvent(this)">Remove</button>
+    </div>
+    <div class="form-row">
+      <div class="form-group">
+        <label>Type</label>
+        <select class="event-type" onchange="onEventTypeChange(this)">
+          ${EVENT_TYPES.map(t => `<option value="${t}">${t}</option>`).join('')}
+        </select>
+      </div>
+      <div class="form-group event-device-group">
+        <label>Device</label>
+        <select class="event-device"><option value="">Select...</option></select>
+      </div>
+      <div class="form-group event-automation-group" style="display:none">
+        <label>Automation</label>
+        <select class="event-automation"><option value="">Select...</option></select>
+      </div>
+      <div class="form-group event-webhook-group" style="display:none">
+        <label>Webhook</label>
+        <input type="text" class="event-webhook" placeholder="doorbell">
+      </div>
+    </div>
+    <div class="conditions-list"></div>
+    <button type="button" class="btn btn-secondary btn-sm" onclick="addCondition(this)" style="margin-top:0.3rem">+ Condition</button>
+  `;
+  document.getElementById('events-container').appendChild(div);
+  populateDeviceSelect(div.querySelector('.event-device'), data?.device || '');
+
+  const ownName = document.getElementById('auto-name').value;
+  const automationSel = div.querySelector('.event-automation');
+  automations.filter(a => a.name !== ownName).forEach(a => {
+    const opt = document.createElement('option');
+    opt.value = a.name;
+    opt.textContent = a.name;
+    if (a.name === data?.automation) opt.selected = true;
+    automationSel.appendChild(opt);
+  });
+
+  div.querySelector('.event-type').value = EVENT_TYPES.includes(data?.type) ? data.type : EVENT_TYPES[0];
+  div.querySelector('.event-webhook').value = data?.webhook || '';
+  onEventTypeChange(div.querySelector('.event-type'));
+  (data?.conditions || []).forEach(c => addCondition(div.querySelector('.btn-secondary'), c));
+  updateYAMLPreview();
+}
+
+function removeEvent(btn) {
+  btn.closest('.dynamic-section').remove();
+  updateYAMLPreview();
+}
+
+function onEventTypeChange(sel) {
+  const section = sel.closest('.dynamic-section');
+  section.querySelector('.event-device-group').style.display = sel.value.startsWith('device_') ? '' : 'none';
+  section.querySelector('.event-automation-group').style.display = sel.value === 'automation_finished' ? '' : 'none';
+  section.querySelector('.event-webhook-group').style.display = sel.value === 'webhook' ? '' : 'none';
+  updateYAMLPreview();
+}
+
+function readConditionRows(section) {
+  return Array.from(section.querySelectorAll('.condition-row')).map(row => ({
+    field: row.querySelector('.cond-field').value,
+    operator: row.querySelector('.cond-op').value,
+    threshold: parseThreshold(row.querySelector('.cond-threshold').value),
+  }));
+}
+
+// parseThreshold reads a threshold as typed in the builder: a number, true, false,
+// null, or a string. Quotes force a string, e.g. "1".
+function parseThreshold(s) {
+  const v = s.trim();
+  if (v === '' || v === 'null') return null;
+  if (v === 'true' || v === 'false') return v === 'true';
+  if (/^(["']).*\1$/.test(v)) return v.slice(1, -1);
+  if (!isNaN(Number(v))) return Number(v);
+  return v;
+}
+
+// thresholdToInput writes a threshold for the builder, quoting strings that would
+// otherwise read as another type.
+function thresholdToInput(v) {
+  if (v === null || v === undefined) return 'null';
+  if (typeof v === 'string' && typeof parseThreshold(v) !== 'string') return `'${v}'`;
+  return String(v);
+}
+
+function thresholdToYAML(v) {
+  if (v === null || v === undefined) return 'null';
+  return typeof v === 'string' ? JSON.stringify(v) : String(v);
+}
+
 function addTrigger(data) {
   const idx = triggerCount++;
   const div = document.createElement('div');
@@ -502,18 +924,44 @@ function addTrigger(data) {
         </select>
       </div>
       <div class="form-group">
+        <label>Source</label>
+        <select class="trigger-source" onchange="onTriggerSourceChange(this)">
+          <option value="">Action</option>
+          <option value="reported">Reported</option>
+        </select>
+      </div>
+      <div class="form-group trigger-action-group">
         <label>Action</label>
-        <select class="trigger-action"><option value="">Select...</option></select>
+        <select class="trigger-action" onchange="onTriggerActionChange(this)"><option value="">Select...</option></select>
+      </div>
+      <div class="form-group trigger-max-age-group" style="display:none">
+        <label>Max Age</label>
+        <input type="text" class="trigger-max-age" placeholder="e.g. 15m">
+      </div>
+      <div class="form-group trigger-match-group" style="display:none">
+        <label>Match</label>
+        <select class="trigger-match">
+          <option value="">all devices</option>
+          <option value="any">any device</option>
+        </select>
       </div>
     </div>
+    <datalist id="trigger-fields-${idx}"></datalist>
     <div class="conditions-list"></div>
     <button type="button" class="btn btn-secondary btn-sm" onclick="addCondition(this)" style="margin-top:0.3rem">+ Condition</button>
   `;
   document.getElementById('triggers-container').appendChild(div);
-  populateDeviceSelect(div.querySelector('.trigger-device'), data?.device || '');
-  if (data?.device) {
-    populateActionSelect(div.querySelector('.trigger-action'), data.device, data?.action || '');
+  const target = data?.group ? GROUP_PREFIX + data.group : data?.device || '';
+  populateDeviceSelect(div.querySelector('.trigger-device'), target, true);
+  if (target) {
+    populateActionSelect(div.querySelector('.trigger-action'), target, data?.action || '');
+    onTriggerActionChange(div.querySelector('.trigger-action'));
   }
+  div.querySelector('.trigger-source').value = data?.source === 'reported' ? 'reported' : '';
+  div.querySelector('.trigger-max-age').value = data?.max_age || '';
+  div.querySelector('.trigger-match').value = data?.match === 'any' ? 'any' : '';
+  div.querySelector('.trigger-match-group').style.display = data?.group ? '' : 'none';
+  onTriggerSourceChange(div.querySelector('.trigger-source'));
   if (data?.conditions) {
     data.conditions.forEach(c => addCondition(div.querySelector('.btn-secondary'), c));
   } else {
@@ -522,6 +970,103 @@ function addTrigger(data) {
   updateYAMLPreview();
 }
 
+const WEEKDAYS = ['mon', 'tue', 'wed', 'thu', 'fri', 'sat', 'sun'];
+const SUN_TIME = /^(sunrise|sunset)(\s*[+-]\s*\S+)?$/;
+
+// addTimeWindow adds a time trigger, which checks the time of day, weekday and date
+// instead of reading a device.
+function addTimeWindow(data) {
+  const idx = triggerCount++;
+  const div = document.createElement('div');
+  div.className = 'dynamic-section time-window';
+  div.innerHTML = `
+    <div class="section-header">
+      <span>Time Window #${idx + 1}</span>
+      <button type="button" class="btn btn-danger btn-sm" onclick="removeTrigger(this)">Remove</button>
+    </div>
+    <div class="form-row">
+      <div class="form-group">
+        <label>After</label>
+        <input type="text" class="time-after" placeholder="08:00 or sunset" value="${esc(data?.after || '')}">
+      </div>
+      <div class="form-group">
+        <label>Before</label>
+        <input type="text" class="time-before" placeholder="20:00 or sunrise+30m" value="${esc(data?.before || '')}">
+      </div>
+      <div class="form-group">
+        <label>Sun</label>
+        <select class="time-sun">
+          <option value="">any</option>
+          <option value="up"${data?.sun === 'up' ? ' selected' : ''}>up</option>
+          <option value="down"${data?.sun === 'down' ? ' selected' : ''}>down</option>
+        </select>
+      </div>
+      <div class="form-group">
+        <label>Weekdays</label>
+        <input type="text" class="time-weekdays" placeholder="mon, tue, wed, thu, fri" value="${esc((data?.weekdays || []).join(', '))}">
+      </div>
+    </div>
+    <div class="form-row">
+      <div class="form-group">
+        <label>From</label>
+        <input type="text" class="time-from" placeholder="2026-06-01 or 06-01" value="${esc(data?.from || '')}">
+      </div>
+      <div class="form-group">
+        <label>To</label>
+        <input type="text" class="time-to" placeholder="2026-08-31 or 08-31" value="${esc(data?.to || '')}">
+      </div>
+      <div class="form-group">
+        <label>Except</label>
+        <input type="text" class="time-except" placeholder="12-25, 2026-04-05" value="${esc((data?.except || []).join(', '))}">
+      </div>
+    </div>
+  `;
+  document.getElementById('triggers-container').appendChild(div);
+  updateYAMLPreview();
+}
+
+function splitList(s) {
+  return s.split(',').map(v => v.trim()).filter(v => v);
+}
+
+function readTimeWindow(sec) {
+  return {
+    after: sec.querySelector('.time-after').value.trim(),
+    before: sec.querySelector('.time-before').value.trim(),
+    sun: sec.querySelector('.time-sun').value,
+    weekdays: splitList(sec.querySelector('.time-weekdays').value.toLowerCase()),
+    from: sec.querySelector('.time-from').value.trim(),
+    to: sec.querySelector('.time-to').value.trim(),
+    except: splitList(sec.querySelector('.time-except').value),
+  };
+}
+
+function validateTimeWindow(sec) {
+  const w = readTimeWindow(sec);
+  if (!w.after && !w.before && !w.sun && w.weekdays.length === 0 && !w.from && !w.to && w.except.length === 0) {
+    return 'Each time window must set a time, weekday or date';
+  }
+  for (const [cls, value] of [['.time-after', w.after], ['.time-before', w.before]]) {
+    if (value && !SUN_TIME.test(value) && !/^([01]\d|2[0-3]):[0-5]\d(:[0-5]\d)?$/.test(value)) {
+      sec.querySelector(cls).classList.add('invalid');
+      return `Time '${value}' must be HH:MM or a sun time like 'sunset-30m'`;
+    }
+  }
+  const unknownDay = w.weekdays.find(d => !WEEKDAYS.includes(d));
+  if (unknownDay) {
+    sec.querySelector('.time-weekdays').classList.add('invalid');
+    return `Weekday '${unknownDay}' must be one of ${WEEKDAYS.join(', ')}`;
+  }
+  for (const [cls, values] of [['.time-from', [w.from]], ['.time-to', [w.to]], ['.time-except', w.except]]) {
+    const bad = values.find(v => v && !/^(\d{4}-)?\d{2}-\d{2}$/.test(v));
+    if (bad) {
+      sec.querySelector(cls).classList.add('invalid');
+      return `Date '${bad}' must be YYYY-MM-DD or MM-DD`;
+    }
+  }
+  return null;
+}
+
 function removeTrigger(btn) {
   btn.closest('.dynamic-section').remove();
   updateYAMLPreview();
@@ -529,11 +1074,26 @@ function removeTrigger(btn) {
 
 function onTriggerDeviceChange(sel) {
   const section = sel.closest('.dynamic-section');
+  section.querySelector('.trigger-match-group').style.display = sel.value.startsWith(GROUP_PREFIX) ? '' : 'none';
   const actionSel = section.querySelector('.trigger-action');
   populateActionSelect(actionSel, sel.value, '');
+  onTriggerActionChange(actionSel);
   updateYAMLPreview();
 }
 
+function onTriggerSourceChange(sel) {
+  const section = sel.closest('.dynamic-section');
+  const reported = sel.value === 'reported';
+  section.querySelector('.trigger-action-group').style.display = reported ? 'none' : '';
+  section.querySelector('.trigger-max-age-group').style.display = reported ? '' : 'none';
+  updateYAMLPreview();
+}
+
+function onTriggerActionChange(sel) {
+  const datalist = sel.closest('.dynamic-section').querySelector('datalist');
+  datalist.innerHTML = resultFieldsForAction(sel.value).map(f => `<option value="${esc(f)}">`).join('');
+}
+
 function addCondition(btn, data) {
   const section = btn.closest('.dynamic-section');
   const list = section.querySelector('.conditions-list');
@@ -542,7 +1102,7 @@ function addCondition(btn, data) {
   div.innerHTML = `
     <div class="form-group">
       <label>Field</label>
-      <input type="text" class="cond-field" value="${esc(data?.field || '')}" placeholder="temperature">
+      <input type="text" class="cond-field" list="trigger-fields-${section.dataset.triggerIdx}" value="${esc(data?.field || '')}" placeholder="temperature">
     </div>
     <div class="form-group" style="min-width:60px;flex:0 0 80px">
       <label>Op</label>
@@ -557,7 +1117,7 @@ function addCondition(btn, data) {
     </div>
     <div class="form-group" style="min-width:60px;flex:0 0 100px">
       <label>Threshold</label>
-      <input type="number" step="any" class="cond-threshold" value="${data?.threshold ?? ''}">
+      <input type="text" class="cond-threshold" value="${data ? esc(thresholdToInput(data.threshold)) : ''}" placeholder="25, open, true">
     </div>
     <div class="form-group" style="flex:0 0 auto;min-width:auto;justify-content:end">
       <label>&nbsp;</label>
@@ -597,9 +1157,10 @@ function addAutoAction(data) {
     </div>
   `;
   document.getElementById('auto-actions-container').appendChild(div);
-  populateDeviceSelect(div.querySelector('.auto-action-device'), data?.device || '');
-  if (data?.device) {
-    populateActionSelect(div.querySelector('.auto-action-action'), data.device, data?.action || '');
+  const target = data?.group ? GROUP_PREFIX + data.group : data?.device || '';
+  populateDeviceSelect(div.querySelector('.auto-action-device'), target, true);
+  if (target) {
+    populateActionSelect(div.querySelector('.auto-action-action'), target, data?.action || '');
   }
   updateYAMLPreview();
 }
@@ -613,6 +1174,7 @@ function onAutoActionDeviceChange(sel) {
   const section = sel.closest('.dynamic-section');
   const actionSel = section.querySelector('.auto-action-action');
   populateActionSelect(actionSel, sel.value, '');
+  onTriggerActionChange(actionSel);
   updateYAMLPreview();
 }
 
@@ -620,30 +1182,46 @@ function onAutoActionDeviceChange(sel) {
 function buildDefinitionFromForm() {
   const def = {
     interval: document.getElementById('auto-interval').value || '',
+    schedule: splitSchedule(document.getElementById('auto-schedule').value),
+    timezone: document.getElementById('auto-timezone').value.trim(),
     condition_logic: document.getElementById('auto-logic').value || '',
+    events: [],
     triggers: [],
     actions: [],
   };
 
+  document.querySelectorAll('#events-container .dynamic-section').forEach(sec => {
+    const type = sec.querySelector('.event-type').value;
+    def.events.push({
+      type,
+      device: type.startsWith('device_') ? sec.querySelector('.event-device').value : '',
+      automation: type === 'automation_finished' ? sec.querySelector('.event-automation').value : '',
+      webhook: type === 'webhook' ? sec.querySelector('.event-webhook').value.trim() : '',
+      conditions: readConditionRows(sec),
+    });
+  });
+
   document.querySelectorAll('#triggers-container .dynamic-section').forEach(sec => {
+    if (sec.classList.contains('time-window')) {
+      def.triggers.push({ time: readTimeWindow(sec) });
+      return;
+    }
+    const reported = sec.querySelector('.trigger-source').value === 'reported';
+    const target = splitTarget(sec.querySelector('.trigger-device').value);
     const trigger = {
-      device: sec.querySelector('.trigger-device').value,
-      action: sec.querySelector('.trigger-action').value,
-      conditions: [],
+      ...target,
+      match: target.group ? sec.querySelector('.trigger-match').value : '',
+      source: reported ? 'reported' : '',
+      action: reported ? '' : sec.querySelector('.trigger-action').value,
+      max_age: reported ? sec.querySelector('.trigger-max-age').value.trim() : '',
+      conditions: readConditionRows(sec),
     };
-    sec.querySelectorAll('.condition-row').forEach(row => {
-      trigger.conditions.push({
-        field: row.querySelector('.cond-field').value,
-        operator: row.querySelector('.cond-op').value,
-        threshold: parseFloat(row.querySelector('.cond-threshold').value) || 0,
-      });
-    });
     def.triggers.push(trigger);
   });
 
   document.querySelectorAll('#auto-actions-container .dynamic-section').forEach(sec => {
     def.actions.push({
-      device: sec.querySelector('.auto-action-device').value,
+      ...splitTarget(sec.querySelector('.auto-action-device').value),
       action: sec.querySelector('.auto-action-action').value,
     });
   });
@@ -651,31 +1229,78 @@ function buildDefinitionFromForm() {
   return def;
 }
 
+function conditionsToYAML(lines, conditions) {
+  if (conditions.length === 0) return;
+  lines.push('    conditions:');
+  for (const c of conditions) {
+    lines.push(`      - field: "${c.field}"`);
+    lines.push(`        operator: "${c.operator}"`);
+    lines.push(`        threshold: ${thresholdToYAML(c.threshold)}`);
+  }
+}
+
+function timeWindowToYAML(lines, w) {
+  lines.push('  - time:');
+  if (w.after) lines.push(`      after: "${w.after}"`);
+  if (w.before) lines.push(`      before: "${w.before}"`);
+  if (w.sun) lines.push(`      sun: "${w.sun}"`);
+  if (w.weekdays.length > 0) lines.push(`      weekdays: [${w.weekdays.join(', ')}]`);
+  if (w.from) lines.push(`      from: "${w.from}"`);
+  if (w.to) lines.push(`      to: "${w.to}"`);
+  if (w.except.length > 0) lines.push(`      except: [${w.except.map(d => `"${d}"`).join(', ')}]`);
+}
+
 function toYAML(def) {
   const lines = [];
-  lines.push(`interval: "${def.interval}"`);
+  if (def.interval || (def.schedule.length === 0 && def.events.length === 0)) {
+    lines.push(`interval: "${def.interval}"`);
+  }
+  if (def.schedule.length > 0) {
+    lines.push('schedule:');
+    for (const expr of def.schedule) lines.push(`  - "${expr}"`);
+  }
+  if (def.timezone) {
+    lines.push(`timezone: "${def.timezone}"`);
+  }
   if (def.condition_logic) {
     lines.push(`condition_logic: "${def.condition_logic}"`);
   }
+  if (def.events.length > 0) {
+    lines.push('events:');
+    for (const e of def.events) {
+      lines.push(`  - type: "${e.type}"`);
+      if (e.device) lines.push(`    device: "${e.device}"`);
+      if (e.automation) lines.push(`    automation: "${e.automation}"`);
+      if (e.webhook) lines.push(`    webhook: "${e.webhook}"`);
+      conditionsToYAML(lines, e.conditions);
+    }
+  }
   if (def.triggers.length > 0) {
     lines.push('triggers:');
     for (const t of def.triggers) {
-      lines.push(`  - device: "${t.device}"`);
-      lines.push(`    action: "${t.action}"`);
-      if (t.conditions.length > 0) {
-        lines.push('    conditions:');
-        for (const c of t.conditions) {
-          lines.push(`      - field: "${c.field}"`);
-          lines.push(`        operator: "${c.operator}"`);
-          lines.push(`        threshold: ${c.threshold}`);
-        }
+      if (t.time) {
+        timeWindowToYAML(lines, t.time);
+        continue;
+      }
+      if (t.group) {
+        lines.push(`  - group: "${t.group}"`);
+        if (t.match) lines.push(`    match: "${t.match}"`);
+      } else {
+        lines.push(`  - device: "${t.device}"`);
+      }
+      if (t.source) {
+        lines.push(`    source: "${t.source}"`);
+        if (t.max_age) lines.push(`    max_age: "${t.max_age}"`);
+      } else {
+        lines.push(`    action: "${t.action}"`);
       }
+      conditionsToYAML(lines, t.conditions);
     }
   }
   if (def.actions.length > 0) {
     lines.push('actions:');
     for (const a of def.actions) {
-      lines.push(`  - device: "${a.device}"`);
+      lines.push(a.group ? `  - group: "${a.group}"` : `  - device: "${a.device}"`);
       lines.push(`    action: "${a.action}"`);
     }
   }
@@ -693,22 +1318,49 @@ document.getElementById('automations-form').addEventListener('change', updateYAM
 
 // ============ YAML PARSER (for edit mode) ============
 function populateBuilderFromYAML(yamlStr) {
+  document.getElementById('events-container').innerHTML = '';
   document.getElementById('triggers-container').innerHTML = '';
   document.getElementById('auto-actions-container').innerHTML = '';
+  eventCount = 0;
   triggerCount = 0;
   autoActionCount = 0;
 
   const def = parseSimpleYAML(yamlStr);
   document.getElementById('auto-interval').value = def.interval || '';
+  document.getElementById('auto-schedule').value = def.schedule.join('; ');
+  document.getElementById('auto-timezone').value = def.timezone || '';
   document.getElementById('auto-logic').value = def.condition_logic || '';
 
-  (def.triggers || []).forEach(t => addTrigger(t));
+  (def.events || []).forEach(e => addEvent(e));
+  (def.triggers || []).forEach(t => t.time ? addTimeWindow(t.time) : addTrigger(t));
   (def.actions || []).forEach(a => addAutoAction(a));
   updateYAMLPreview();
 }
 
+// parseConditions reads a conditions list starting at line i into conditions and
+// returns the index of the first line after it.
+function parseConditions(lines, i, conditions) {
+  while (i < lines.length && lines[i].match(/^      /)) {
+    if (lines[i].trim().startsWith('- field:')) {
+      const cond = { field: '', operator: '', threshold: null };
+      cond.field = extractValue(lines[i].trim().replace('- ', ''));
+      i++;
+      while (i < lines.length && lines[i].match(/^        /) && !lines[i].trim().startsWith('- ')) {
+        const cl = lines[i].trim();
+        if (cl.startsWith('operator:')) cond.operator = extractValue(cl);
+        else if (cl.startsWith('threshold:')) cond.threshold = parseThreshold(cl.slice('threshold:'.length));
+        i++;
+      }
+      conditions.push(cond);
+    } else {
+      i++;
+    }
+  }
+  return i;
+}
+
 function parseSimpleYAML(str) {
-  const def = { interval: '', condition_logic: '', triggers: [], actions: [] };
+  const def = { interval: '', schedule: [], timezone: '', condition_logic: '', events: [], triggers: [], actions: [] };
   const lines = str.split('\n');
   let i = 0;
 
@@ -719,39 +1371,89 @@ function parseSimpleYAML(str) {
     if (trimmed.startsWith('interval:')) {
       def.interval = extractValue(trimmed);
       i++;
+    } else if (trimmed === 'schedule:') {
+      i++;
+      while (i < lines.length && lines[i].match(/^  - /)) {
+        def.schedule.push(lines[i].trim().slice(2).trim().replace(/^["']|["']$/g, ''));
+        i++;
+      }
+    } else if (trimmed.startsWith('schedule:')) {
+      def.schedule.push(extractValue(trimmed));
+      i++;
+    } else if (trimmed.startsWith('timezone:')) {
+      def.timezone = extractValue(trimmed);
+      i++;
     } else if (trimmed.startsWith('condition_logic:')) {
       def.condition_logic = extractValue(trimmed);
       i++;
+    } else if (trimmed === 'events:') {
+      i++;
+      while (i < lines.length && lines[i].match(/^  /)) {
+        if (lines[i].trim().startsWith('- type:')) {
+          const event = { type: '', device: '', automation: '', webhook: '', conditions: [] };
+          event.type = extractValue(lines[i].trim().replace('- ', ''));
+          i++;
+          while (i < lines.length && lines[i].match(/^    /) && !lines[i].trim().startsWith('- type:')) {
+            const el = lines[i].trim();
+            if (el.startsWith('device:')) {
+              event.device = extractValue(el);
+              i++;
+            } else if (el.startsWith('automation:')) {
+              event.automation = extractValue(el);
+              i++;
+            } else if (el.startsWith('webhook:')) {
+              event.webhook = extractValue(el);
+              i++;
+            } else if (el === 'conditions:') {
+              i = parseConditions(lines, i + 1, event.conditions);
+            } else {
+              i++;
+            }
+          }
+          def.events.push(event);
+        } else {
+          i++;
+        }
+      }
     } else if (trimmed === 'triggers:') {
       i++;
       while (i < lines.length && lines[i].match(/^  /)) {
-        if (lines[i].trim().startsWith('- device:')) {
-          const trigger = { device: '', action: '', conditions: [] };
-          trigger.device = extractValue(lines[i].trim().replace('- ', ''));
+        if (lines[i].trim() === '- time:') {
+          const time = { after: '', before: '', sun: '', weekdays: [], from: '', to: '', except: [] };
           i++;
-          while (i < lines.length && lines[i].match(/^    /) && !lines[i].trim().startsWith('- device:')) {
+          while (i < lines.length && lines[i].match(/^      /)) {
             const tl = lines[i].trim();
-            if (tl.startsWith('action:')) {
+            const key = tl.split(':')[0];
+            if (key === 'weekdays' || key === 'except') {
+              time[key] = splitList(extractValue(tl).replace(/^\[|\]$/g, '')).map(v => v.replace(/^["']|["']$/g, ''));
+            } else if (key in time) {
+              time[key] = extractValue(tl);
+            }
+            i++;
+          }
+          def.triggers.push({ time });
+        } else if (lines[i].trim().startsWith('- device:') || lines[i].trim().startsWith('- group:')) {
+          const trigger = { device: '', group: '', match: '', source: '', action: '', max_age: '', conditions: [] };
+          const first = lines[i].trim().replace('- ', '');
+          if (first.startsWith('group:')) trigger.group = extractValue(first);
+          else trigger.device = extractValue(first);
+          i++;
+          while (i < lines.length && lines[i].match(/^    /) && !lines[i].trim().startsWith('- ')) {
+            const tl = lines[i].trim();
+            if (tl.startsWith('match:')) {
+              trigger.match = extractValue(tl);
+              i++;
+            } else if (tl.startsWith('action:')) {
               trigger.action = extractValue(tl);
               i++;
-            } else if (tl === 'conditions:') {
+            } else if (tl.startsWith('source:')) {
+              trigger.source = extractValue(tl);
               i++;
-              while (i < lines.length && lines[i].match(/^      /)) {
-                if (lines[i].trim().startsWith('- field:')) {
-                  const cond = { field: '', operator: '', threshold: 0 };
-                  cond.field = extractValue(lines[i].trim().replace('- ', ''));
-                  i++;
-                  while (i < lines.length && lines[i].match(/^        /) && !lines[i].trim().startsWith('- ')) {
-                    const cl = lines[i].trim();
-                    if (cl.startsWith('operator:')) cond.operator = extractValue(cl);
-                    else if (cl.startsWith('threshold:')) cond.threshold = parseFloat(extractValue(cl)) || 0;
-                    i++;
-                  }
-                  trigger.conditions.push(cond);
-                } else {
-                  i++;
-                }
-              }
+            } else if (tl.startsWith('max_age:')) {
+              trigger.max_age = extractValue(tl);
+              i++;
+            } else if (tl === 'conditions:') {
+              i = parseConditions(lines, i + 1, trigger.conditions);
             } else {
               i++;
             }
@@ -764,9 +1466,11 @@ function parseSimpleYAML(str) {
     } else if (trimmed === 'actions:') {
       i++;
       while (i < lines.length && lines[i].match(/^  /)) {
-        if (lines[i].trim().startsWith('- device:')) {
-          const action = { device: '', action: '' };
-          action.device = extractValue(lines[i].trim().replace('- ', ''));
+        if (lines[i].trim().startsWith('- device:') || lines[i].trim().startsWith('- group:')) {
+          const action = { device: '', group: '', action: '' };
+          const first = lines[i].trim().replace('- ', '');
+          if (first.startsWith('group:')) action.group = extractValue(first);
+          else action.device = extractValue(first);
           i++;
           while (i < lines.length && lines[i].match(/^    /) && !lines[i].trim().startsWith('- ')) {
             const al = lines[i].trim();
@@ -785,6 +1489,12 @@ function parseSimpleYAML(str) {
   return def;
 }
 
+// splitSchedule splits the schedule input into cron expressions. Expressions are
+// separated by ';' since cron fields use commas.
+function splitSchedule(s) {
+  return s.split(';').map(e => e.trim()).filter(e => e);
+}
+
 function extractValue(s) {
   const parts = s.split(':');
   parts.shift();